@@ -0,0 +1,213 @@
+// This example shows how to use the mirror package without the command line tool. It's a small HTTP server that
+// schedules jobs and reports their progress:
+//
+//	curl -d '{"src": "/data", "dst": "/backup", "start": "2030-01-02T03:04:05Z"}' localhost:8080/jobs
+//	curl localhost:8080/jobs/1
+//	curl -X DELETE localhost:8080/jobs/1
+//
+// When the server listens on a network, use -token (clients then send "Authorization: Bearer <token>")
+// together with -tls-cert and -tls-key
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"mirror/mirror"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusScheduled = "scheduled"
+	StatusRunning   = "running"
+	StatusFinished  = "finished"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+	JobsPath        = "/jobs"
+	BearerPrefix    = "Bearer "
+	EnvToken        = "MIRROR_TOKEN"
+)
+
+// request is the body of POST /jobs. Start is optional, jobs without it start right away
+type request struct {
+	Src   string    `json:"src"`
+	Dst   string    `json:"dst"`
+	Clean bool      `json:"clean"`
+	Start time.Time `json:"start"`
+}
+
+// status is the body of GET /jobs/{id}
+type status struct {
+	ID       int             `json:"id"`
+	Status   string          `json:"status"`
+	Progress mirror.Progress `json:"progress"`
+	Error    string          `json:"error,omitempty"`
+	cancel   context.CancelFunc
+}
+
+type server struct {
+	mu     sync.Mutex
+	jobs   map[int]*status
+	lastID int
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	token := flag.String("token", os.Getenv(EnvToken), "token that clients have to send (defaults to the "+EnvToken+" environment variable)")
+	cert := flag.String("tls-cert", "", "TLS certificate file, the server uses plain HTTP without it")
+	key := flag.String("tls-key", "", "TLS key file")
+	flag.Parse()
+
+	if (*cert == "") != (*key == "") {
+		log.Fatalln("-tls-cert and -tls-key have to be used together")
+	}
+
+	s := &server{jobs: make(map[int]*status)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(JobsPath, s.handleJobs)
+	mux.HandleFunc(JobsPath+"/", s.handleJob)
+	handler := requireToken(*token, mux)
+
+	if *cert != "" {
+		log.Fatalln(http.ListenAndServeTLS(*addr, *cert, *key, handler))
+	}
+	log.Fatalln(http.ListenAndServe(*addr, handler))
+}
+
+// requireToken rejects requests that don't send the token in a Bearer Authorization header. An empty token lets every
+// request through
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, BearerPrefix) || subtle.ConstantTimeCompare([]byte(header[len(BearerPrefix):]), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "wrong or missing token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleJobs schedules a new job
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Src == "" || req.Dst == "" {
+		http.Error(w, "src and dst are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.lastID++
+	st := &status{ID: s.lastID, Status: StatusScheduled, cancel: cancel}
+	s.jobs[st.ID] = st
+	s.mu.Unlock()
+
+	go s.run(ctx, st, req)
+
+	s.writeStatus(w, http.StatusCreated, st)
+}
+
+// handleJob reports the status of a job or cancels it
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, JobsPath+"/"))
+	s.mu.Lock()
+	st, ok := s.jobs[id]
+	s.mu.Unlock()
+	if err != nil || !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		st.cancel()
+	default:
+		http.Error(w, "use GET or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeStatus(w, http.StatusOK, st)
+}
+
+func (s *server) run(ctx context.Context, st *status, req request) {
+	select {
+	case <-time.After(time.Until(req.Start)):
+	case <-ctx.Done():
+		s.setStatus(st, StatusCanceled, nil)
+		return
+	}
+	s.setStatus(st, StatusRunning, nil)
+
+	progress := make(chan mirror.Progress, 64)
+	job := mirror.Job{Src: req.Src, Dst: req.Dst, CleaningMode: req.Clean, Opts: mirror.Options{Progress: progress}}
+
+	done := make(chan error)
+	go func() {
+		done <- job.Run(ctx)
+	}()
+
+	for {
+		select {
+		case p := <-progress:
+			s.mu.Lock()
+			st.Progress = p
+			s.mu.Unlock()
+		case err := <-done:
+			s.mu.Lock()
+			for len(progress) > 0 {
+				st.Progress = <-progress
+			}
+			s.mu.Unlock()
+
+			switch {
+			case errors.Is(err, mirror.ErrStopped):
+				s.setStatus(st, StatusCanceled, nil)
+			case err != nil:
+				s.setStatus(st, StatusFailed, err)
+			default:
+				s.setStatus(st, StatusFinished, nil)
+			}
+			return
+		}
+	}
+}
+
+func (s *server) setStatus(st *status, value string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st.Status = value
+	if err != nil {
+		st.Error = err.Error()
+	}
+}
+
+// writeStatus responds with code and st as JSON. Headers can't be set once WriteHeader was called, so it's called here
+func (s *server) writeStatus(w http.ResponseWriter, code int, st *status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		log.Println(err)
+	}
+}
@@ -1,3 +1,3 @@
 module mirror
 
-go 1.17
+go 1.18
@@ -2,121 +2,1206 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"mirror/mirror"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const (
 	MsgCanceling     = "canceling"
 	MsgGatheringInfo = "gathering info about files"
 	MgsAreYouSure    = "Do you want to continue?"
-	MsgLogging       = "Also a log file named 'log' will be generated."
+	MsgLogging       = "Also a log file %q will be generated."
 	MsgNothingToDo   = "there is nothing to do"
 	MsgErrOccurred   = "an error occurred:"
 	MsgFinished      = "the program finished successfully"
 	MsgDone          = "done"
+	MsgPingFailed    = "couldn't ping the monitoring URL:"
+	MsgAnsweredYes   = "y (the -yes or -dry-run flag was used)"
+	MsgDryRun        = "dry run, nothing was changed"
+	MsgSignal        = "finishing the current item and stopping because of a signal:"
+	MsgSignalAgain   = "stopping right away because of another signal, partial copies may be left behind:"
+	MsgBenchmarking  = "measuring throughput of %q\n"
+	MsgUnreadable    = "paths that couldn't be read and will be left alone:"
+	MsgInfected      = "infected files, see the log file for their paths:"
+	MsgSplitDrive    = "%d files (%s MB) will be copied to %q, it has %s MB free\n"
+	MsgHashed        = "%d files hashed into %s files\n"
+	MsgMismatched    = "doesn't match:"
+	MsgMissing       = "missing:"
+	MsgUnlisted      = "not listed:"
+	MsgResuming      = "resuming the interrupted run, %d files (%s MB) and %d folders are left\n"
+	MsgListed        = "%d files in %q listed\n"
+	MsgStalePlan     = "The folders were scanned %s ago and may have changed since. Do you want to scan them again?"
+	MsgTempDirLeft   = "couldn't remove the temporary folder:"
+	MsgCrashed       = "the program crashed, please attach %q to the bug report\n"
+	MsgNoCrashReport = "couldn't write the crash report:"
+	MsgTraceFailed   = "couldn't send the trace:"
+	MsgPluginFailed  = "a plugin failed when it was stopped:"
+	MsgShrinkage     = "WARNING: %q would shrink from %s MB to %s MB, that's more than %d%%."
+	MsgAutoRerun     = "the run didn't finish everything (%s), running what is left again in %s (%d of %d)\n"
+	MsgRerunFailed   = "%d errors were ignored"
+	MsgRerunDone     = "nothing is left after the rerun"
+	MsgSwapConfirmed = "the previous tree of %q was removed\n"
+	MsgSwapRolled    = "the previous tree of %q is back in place\n"
+	MsgUpToDate      = "the program is up to date, version %s\n"
+	MsgNewRelease    = "version %s is released, this is %s\n"
+	MsgUpdated       = "updated to version %s\n"
+	MsgInitialized   = "%q is set up as a destination of %s runs, its configuration is in %q\n"
+	MsgRunManifest   = "recording the manifest of the run for 'changes', files that weren't written keep their hashes"
+	MsgNoRunManifest = "couldn't record the manifest of the run, 'changes' won't find it:"
+)
+
+var (
+	// pingURL gets the summary when the program ends
+	pingURL string
+	summary []string
+	// tempDir is the temporary folder of the run, it's removed on every exit
+	tempDir string
+	// snapshot is the -snapshot that src is read from, it's removed on every exit
+	snapshot *mirror.Snapshot
+	// swapDst is the dst that the new tree of a -swap run replaces, see startSwap
+	swapDst string
+	// runManifest holds the hashes of the last successful run into dst, see startRun and recordManifest
+	runManifest map[string]string
+	// session notes the questions and answers of the run, they are written into the log file once it's emptied
+	session = mirror.Session{Args: os.Args}
+	// runOpts are the options of the run, crash reports show their state
+	runOpts *mirror.Options
+	// tracer gets the spans of the run if the -otel flag was used, they are sent when the program ends
+	tracer *mirror.Tracer
+	// plugins are the ones of the -plugin flags, they get the finished event and are stopped when the program ends
+	plugins *mirror.Plugins
+	// subcommands are run instead of copying or cleaning if their name is the first argument
+	subcommands = map[string]func(args []string){
+		mirror.CmdBench:      doBench,
+		mirror.CmdSplit:      doSplit,
+		mirror.CmdSums:       doSums,
+		mirror.CmdVerify:     doVerify,
+		mirror.CmdRestore:    doRestore,
+		mirror.CmdInventory:  doInventory,
+		mirror.CmdDiff:       doDiff,
+		mirror.CmdChanges:    doChanges,
+		mirror.CmdReplay:     doReplay,
+		mirror.CmdSwap:       doSwap,
+		mirror.CmdSelfUpdate: doSelfUpdate,
+		mirror.CmdInit:       doInit,
+	}
 )
 
 func main() {
-	dst, src, cleaningMode, err := mirror.VetFlags()
+	defer crashReport()
+
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	flags, err := mirror.VetFlags(os.Args[1:])
+	pingURL, runOpts = flags.Ping, &flags.Opts
 	checkErr(err)
 
-	if cleaningMode {
-		doCleaning(dst, src)
+	sink, err := mirror.SetLogSink(flags.LogSink)
+	checkErr(err)
+	defer sink.Close()
+
+	err = mirror.SetLogFormat(flags.LogFormat)
+	checkErr(err)
+
+	if flags.Opts.LogPath == "" {
+		flags.Opts.LogPath = mirror.LogFile
+		useServiceLogFile(&flags.Opts, flags.LogSink)
+	}
+
+	if flags.OTel != "" {
+		tracer = mirror.NewTracer(flags.OTel, flags.OTelSample, map[string]string{"mirror.src": flags.Src, "mirror.dst": flags.Dst, "mirror.mode": flags.Mode()})
+		flags.Opts.Tracer = tracer
+	}
+
+	if flags.MemStats > 0 {
+		mirror.LogMemStats(flags.MemStats, nil)
+	}
+
+	if !flags.Yes && !flags.DryRun && !mirror.IsTerminal(os.Stdin) {
+		checkErr(mirror.ErrNotTerminal)
+	}
+
+	if flags.Snapshot != "" {
+		makeSnapshot(&flags)
+	}
+
+	// plugins tell the trees apart by their root, so they start once src is the snapshot that is read
+	if len(flags.Plugins) > 0 {
+		plugins, err = mirror.StartPlugins(flags.Plugins, flags.Src, flags.Dst)
+		checkErr(err)
+		flags.Opts.Plugins = plugins
+	}
+
+	if flags.CAS {
+		doCAS(&flags)
+	} else if flags.Sync {
+		doSyncing(&flags)
+	} else if flags.CleaningMode {
+		doCleaning(&flags)
 	} else {
-		doCopying(dst, src)
+		doCopying(&flags)
+	}
+	finishSwap(&flags)
+
+	if len(flags.Opts.Report.Vanished) > 0 {
+		log.Println(mirror.MsgVanished, len(flags.Opts.Report.Vanished))
+		addSummary("%d files vanished before they could be copied", len(flags.Opts.Report.Vanished))
+	}
+
+	if len(flags.Opts.Report.Infected) > 0 {
+		log.Println(MsgInfected, len(flags.Opts.Report.Infected))
+		addSummary("%d infected files were handled with the %q policy", len(flags.Opts.Report.Infected), flags.Opts.ScanPolicy)
+	}
+
+	if len(flags.Opts.Report.OwnerNotKept) > 0 {
+		log.Println(mirror.MsgOwnerNotKept, len(flags.Opts.Report.OwnerNotKept))
+		addSummary("%d files and folders were copied without their owner", len(flags.Opts.Report.OwnerNotKept))
+	}
+
+	if len(flags.Opts.Report.XattrsNotKept) > 0 {
+		log.Println(mirror.MsgXattrsNotKept, len(flags.Opts.Report.XattrsNotKept))
+		addSummary("%d files were copied without their extended attributes", len(flags.Opts.Report.XattrsNotKept))
+	}
+
+	if len(flags.Opts.Report.FlagsNotKept) > 0 {
+		log.Println(mirror.MsgFileFlagsNotKept, len(flags.Opts.Report.FlagsNotKept))
+		addSummary("%d files were copied without their capabilities or flags", len(flags.Opts.Report.FlagsNotKept))
+	}
+
+	if len(flags.Opts.Report.TooLong) > 0 {
+		log.Println(mirror.MsgTooLong, len(flags.Opts.Report.TooLong))
+		addSummary("%d files, folders and links weren't copied because their names are too long for %q", len(flags.Opts.Report.TooLong), flags.Dst)
+	}
+
+	if len(flags.Opts.Report.Moved) > 0 {
+		log.Println(mirror.MsgMoved, len(flags.Opts.Report.Moved))
+		addSummary("%d copied files were removed from %q", len(flags.Opts.Report.Moved), flags.Src)
+	}
+
+	if len(flags.Opts.Report.NotMoved) > 0 {
+		log.Println(mirror.MsgNotMoved, len(flags.Opts.Report.NotMoved))
+		addSummary("%d copied files were kept in %q because they changed since they were copied", len(flags.Opts.Report.NotMoved), flags.Src)
+	}
+
+	if r := flags.Opts.Report; len(r.Patched) > 0 {
+		log.Printf(mirror.MsgPatched, len(r.Patched), mirror.BytesToMB(r.PatchWritten), mirror.BytesToMB(r.PatchedSize))
+		addSummary("%d changed files were patched in place, %s MB of %s MB written", len(r.Patched), mirror.BytesToMB(r.PatchWritten), mirror.BytesToMB(r.PatchedSize))
+	}
+
+	if len(flags.Opts.Report.SizeChanged) > 0 {
+		log.Println(mirror.MsgSizeChanged, len(flags.Opts.Report.SizeChanged))
+		addSummary("%d files changed their size while they were copied, handled with the %q policy", len(flags.Opts.Report.SizeChanged), flags.Opts.SizeChange)
+	}
+
+	if len(flags.Opts.Report.BrokenLinks) > 0 {
+		log.Println(mirror.MsgBrokenLinks, len(flags.Opts.Report.BrokenLinks))
+		addSummary("%d symlinks were made whose target doesn't exist", len(flags.Opts.Report.BrokenLinks))
 	}
 
+	if len(flags.Opts.Report.IgnoredErrors) > 0 {
+		err = mirror.LogIgnoredErrors(flags.Opts.Report.IgnoredErrors, &flags.Opts)
+		checkErr(err)
+		addSummary("%d errors ignored", len(flags.Opts.Report.IgnoredErrors))
+	}
+
+	removeTempDir()
+	removeSnapshot()
 	log.Println(MsgFinished)
+	sendTrace(nil)
+	stopPlugins(false, MsgFinished)
+	ping(false, MsgFinished)
 }
 
-func doCopying(dst, src string) {
-	if !mirror.AskQuestion(fmt.Sprintf("files from %q will be copied to %q. %s", src, dst, MgsAreYouSure)) {
-		exitWithZero(MsgCanceling)
+// useServiceLogFile moves the log file into the log folder of the system if the program runs as a service, and says where
+func useServiceLogFile(opts *mirror.Options, sink string) {
+	path, err := mirror.ServiceLogPath(sink)
+	if err != nil {
+		log.Println(mirror.MsgNoServiceLog, err)
+		return
+	}
+	if path != "" {
+		opts.LogPath = path
+		log.Println(mirror.MsgServiceLogFile, path)
 	}
+}
+
+// logging says which log file will be generated, for the questions of the program
+func logging(opts *mirror.Options) string {
+	return fmt.Sprintf(MsgLogging, opts.LogFilePath())
+}
+
+func doCopying(flags *mirror.Flags) {
+	dst, src, opts := flags.Dst, flags.Src, &flags.Opts
+
+	resume, resumed := resumedPlan(flags)
+	missingFolders, missingFiles, totalSize, hardLinks, missingLinks := resume.Folders, resume.Files, resume.TotalSize, resume.HardLinks, resume.MissingLinks
+	staleParts := resume.StaleParts
+	if !resumed {
+		if !ask(flags, fmt.Sprintf("%s\nfiles from %q will be copied to %q. %s", flags.EffectiveOptions(), src, dst, MgsAreYouSure)) {
+			exitWithZero(MsgCanceling)
+		}
+
+		for {
+			plan, _ := srcDstDiff(flags)
+			missingFolders, missingFiles, totalSize, missingLinks, hardLinks = plan.MissingFolders, plan.MissingFiles, plan.CopySize, plan.MissingLinks, plan.HardLinks
+			staleParts = plan.StaleParts
+			planned := time.Now()
+
+			warning, err := mirror.InodeWarning(dst, len(missingFiles)+len(missingFolders))
+			checkErr(err)
+
+			question := fmt.Sprintf("%d files will be coppied (%s MB) and %d folders will be created.", len(missingFiles), mirror.BytesToMB(totalSize), len(missingFolders))
+			if len(hardLinks) > 0 {
+				question += fmt.Sprintf(" %d hard links will be made.", len(hardLinks))
+			}
+			if opts.Move {
+				question += fmt.Sprintf(" The copied files will be removed from %q.", src)
+			}
+			if len(missingLinks) > 0 {
+				question += fmt.Sprintf(" %d symlinks will be made.", len(missingLinks))
+			}
+			if warning != "" {
+				question += " " + warning
+			}
+
+			if !ask(flags, fmt.Sprintf("%s %s %s", question, logging(&flags.Opts), MgsAreYouSure)) {
+				exitWithZero(MsgCanceling)
+			}
+
+			if !rescan(flags, planned) {
+				break
+			}
+		}
+	}
+
+	if flags.DryRun {
+		dryRun(flags, missingFolders, missingFiles, missingLinks, hardLinks)
+	}
+
+	stopOnSignal(opts)
+	finish := startRun(flags, resumed, mirror.ResumePlan{Folders: missingFolders, Files: missingFiles, TotalSize: totalSize, HardLinks: hardLinks, MissingLinks: missingLinks, StaleParts: staleParts})
+
+	plan := mirror.SyncPlan{MissingFolders: missingFolders, MissingFiles: missingFiles, CopySize: totalSize, MissingLinks: missingLinks, HardLinks: hardLinks, StaleParts: staleParts}
+	checkErr(autoRerun(flags, plan, runPlan(flags, plan)))
+	recordManifest(flags, plan)
+	finish()
+}
+
+func doCleaning(flags *mirror.Flags) {
+	dst, opts := flags.Dst, &flags.Opts
 
-	missingFolders, missingFiles, totalSize := srcDstDiff(dst, src, false)
+	resume, resumed := resumedPlan(flags)
+	foldersToClean, filesToClean, totalSize, linksToClean := resume.Folders, resume.Files, resume.TotalSize, resume.LinksToClean
+	staleParts := resume.StaleParts
+	if !resumed {
+		if !ask(flags, fmt.Sprintf("%s\nfiles may be deleted in the %q folder. %s", flags.EffectiveOptions(), dst, MgsAreYouSure)) {
+			exitWithZero(MsgCanceling)
+		}
 
-	if !mirror.AskQuestion(fmt.Sprintf("%d files will be coppied (%s MB) and %d folders will be created. %s %s", len(missingFiles), mirror.BytesToMB(totalSize), len(missingFolders), MsgLogging, MgsAreYouSure)) {
+		for {
+			plan, dstSize := srcDstDiff(flags)
+			foldersToClean, filesToClean, totalSize, linksToClean = plan.FoldersToClean, plan.FilesToClean, plan.CleanSize, plan.LinksToClean
+			staleParts = plan.StaleParts
+			planned := time.Now()
+
+			question := fmt.Sprintf("%d files (%s MB) and %d folders will be deleted.", len(filesToClean), mirror.BytesToMB(totalSize), len(foldersToClean))
+			if len(linksToClean) > 0 {
+				question += fmt.Sprintf(" %d symlinks will be removed.", len(linksToClean))
+			}
+			if !ask(flags, fmt.Sprintf("%s %s %s", question, logging(&flags.Opts), MgsAreYouSure)) {
+				exitWithZero(MsgCanceling)
+			}
+
+			checkShrinkage(flags, dstSize, totalSize)
+
+			if !rescan(flags, planned) {
+				break
+			}
+		}
+	}
+
+	if flags.DryRun {
+		dryRun(flags, foldersToClean, filesToClean, linksToClean, nil)
+	}
+
+	stopOnSignal(opts)
+	finish := startRun(flags, resumed, mirror.ResumePlan{Folders: foldersToClean, Files: filesToClean, TotalSize: totalSize, LinksToClean: linksToClean, StaleParts: staleParts})
+
+	plan := mirror.SyncPlan{FoldersToClean: foldersToClean, FilesToClean: filesToClean, CleanSize: totalSize, LinksToClean: linksToClean, StaleParts: staleParts}
+	checkErr(autoRerun(flags, plan, runPlan(flags, plan)))
+	recordManifest(flags, plan)
+	finish()
+}
+
+// doSyncing copies what is missing in dst and removes what isn't in src, after one scan and one confirmation
+func doSyncing(flags *mirror.Flags) {
+	dst, src, opts := flags.Dst, flags.Src, &flags.Opts
+
+	if !ask(flags, fmt.Sprintf("%s\nfiles from %q will be copied to %q and files that aren't in %q will be deleted from it. %s", flags.EffectiveOptions(), src, dst, src, MgsAreYouSure)) {
 		exitWithZero(MsgCanceling)
 	}
 
-	err := mirror.TruncateLogFile()
-	checkErr(err)
+	var plan mirror.SyncPlan
+	for {
+		var dstSize int64
+		plan, dstSize = srcDstDiff(flags)
+		planned := time.Now()
 
-	if len(missingFolders) > 0 {
-		err = mirror.MakeFolders(missingFolders, dst)
+		warning, err := mirror.InodeWarning(dst, len(plan.MissingFiles)+len(plan.MissingFolders))
 		checkErr(err)
+
+		question := fmt.Sprintf("%d files will be coppied (%s MB) and %d folders will be created, %d files (%s MB) and %d folders will be deleted.",
+			len(plan.MissingFiles), mirror.BytesToMB(plan.CopySize), len(plan.MissingFolders), len(plan.FilesToClean), mirror.BytesToMB(plan.CleanSize), len(plan.FoldersToClean))
+		if len(plan.Renames) > 0 {
+			question += fmt.Sprintf(" %d files will be moved instead.", len(plan.Renames))
+		}
+		if len(plan.HardLinks) > 0 {
+			question += fmt.Sprintf(" %d hard links will be made.", len(plan.HardLinks))
+		}
+		if len(plan.MissingLinks) > 0 || len(plan.LinksToClean) > 0 {
+			question += fmt.Sprintf(" %d symlinks will be made and %d removed.", len(plan.MissingLinks), len(plan.LinksToClean))
+		}
+		if warning != "" {
+			question += " " + warning
+		}
+
+		if !ask(flags, fmt.Sprintf("%s %s %s", question, logging(&flags.Opts), MgsAreYouSure)) {
+			exitWithZero(MsgCanceling)
+		}
+
+		checkShrinkage(flags, dstSize, plan.CleanSize)
+
+		if !rescan(flags, planned) {
+			break
+		}
+	}
+
+	if flags.DryRun {
+		checkErr(mirror.WriteLinks(os.Stdout, plan.LinksToClean, true))
+		checkErr(mirror.WriteRenames(os.Stdout, plan.Renames))
+		checkErr(mirror.WritePlan(os.Stdout, plan.FoldersToClean, plan.FilesToClean, true))
+		checkErr(mirror.WritePlan(os.Stdout, plan.MissingFolders, plan.MissingFiles, false))
+		checkErr(mirror.WriteHardLinks(os.Stdout, plan.HardLinks))
+		checkErr(mirror.WriteLinks(os.Stdout, plan.MissingLinks, false))
+		exitWithZero(MsgDryRun)
+	}
+
+	stopOnSignal(opts)
+	finish := startRun(flags, false, mirror.ResumePlan{})
+
+	checkErr(autoRerun(flags, plan, runPlan(flags, plan)))
+	recordManifest(flags, plan)
+	finish()
+}
+
+// runPlan removes and then copies what plan has. Removing first frees space and lets a folder replace a file of
+// the same name, see mirror.Sync
+func runPlan(flags *mirror.Flags, plan mirror.SyncPlan) error {
+	if len(plan.StaleParts) > 0 {
+		if err := mirror.RemoveStaleParts(plan.StaleParts, flags.Dst, &flags.Opts); err != nil {
+			return err
+		}
+	}
+	if err := cleanExtraneous(flags, plan.FoldersToClean, plan.FilesToClean, plan.LinksToClean, plan.Renames, plan.CleanSize); err != nil {
+		return err
+	}
+	return copyMissing(flags, plan.MissingFolders, plan.MissingFiles, plan.MissingLinks, plan.HardLinks, plan.CopySize)
+}
+
+// autoRerun runs what is left of plan again after a run that failed with err or ignored errors, up to -auto-rerun
+// times with a growing pause before each rerun. Reruns only handle items of plan, so nothing that wasn't confirmed
+// is copied or removed. It returns the error of the last run
+func autoRerun(flags *mirror.Flags, plan mirror.SyncPlan, err error) error {
+	opts := &flags.Opts
+
+	for i := 1; i <= flags.AutoRerun && !errors.Is(err, mirror.ErrStopped); i++ {
+		reason := fmt.Sprintf(MsgRerunFailed, len(opts.Report.IgnoredErrors))
+		if err != nil {
+			reason = err.Error()
+		} else if len(opts.Report.IgnoredErrors) == 0 {
+			return nil
+		}
+
+		delay := mirror.RerunDelay(i)
+		log.Printf(MsgAutoRerun, reason, delay, i, flags.AutoRerun)
+		select {
+		case <-time.After(delay):
+		case <-opts.Stop:
+			return mirror.ErrStopped
+		}
+
+		// the ignored errors of the rerun replace the ones of the run before, which it retried, and the scan finds the
+		// names that are too long again
+		opts.Report.IgnoredErrors, opts.Report.Unreadable, opts.Report.TooLong = nil, nil, nil
+		var now mirror.SyncPlan
+		if now, _, err = scanPlan(flags, ""); err != nil {
+			continue
+		}
+		left := mirror.RemainingPlan(plan, now)
+		if left.Empty() {
+			log.Println(MsgRerunDone)
+			return nil
+		}
+		err = runPlan(flags, left)
+	}
+	return err
+}
+
+// copyMissing makes folders, copies files from src to dst and then makes hard links and symlinks
+func copyMissing(flags *mirror.Flags, folders mirror.Folder, files mirror.File, links mirror.Links, hardLinks mirror.HardLinks, totalSize int64) error {
+	dst, src, opts := flags.Dst, flags.Src, &flags.Opts
+
+	if len(folders) > 0 {
+		if err := mirror.MakeFoldersFS(folders, mirror.OSFS(src), dst, opts); err != nil {
+			return err
+		}
 		log.Println(MsgDone)
+		addSummary("%d folders made in %q", len(folders), dst)
 	}
 
-	if len(missingFiles) > 0 {
-		err = mirror.CopyFiles(missingFiles, totalSize, src, dst)
-		checkErr(err)
+	if len(files) > 0 {
+		if err := mirror.CopyFiles(files, totalSize, src, dst, opts); err != nil {
+			return err
+		}
+		log.Println(MsgDone)
+		addSummary("%d files (%s MB) copied from %q to %q", len(files), mirror.BytesToMB(totalSize), src, dst)
+	}
+
+	if len(hardLinks) > 0 {
+		if err := mirror.MakeHardLinks(hardLinks, dst, opts); err != nil {
+			return err
+		}
 		log.Println(MsgDone)
+		addSummary("%d hard links made in %q", len(hardLinks), dst)
 	}
+
+	if len(links) > 0 {
+		if err := mirror.MakeLinks(links, dst, opts); err != nil {
+			return err
+		}
+		log.Println(MsgDone)
+		addSummary("%d symlinks made in %q", len(links), dst)
+	}
+	return nil
 }
 
-func doCleaning(dst, src string) {
-	if !mirror.AskQuestion(fmt.Sprintf("files may be deleted in the %q folder. %s", dst, MgsAreYouSure)) {
-		exitWithZero(MsgCanceling)
+// cleanExtraneous removes files and links from dst, moves renamed files and then removes folders, which can hold
+// their old paths
+func cleanExtraneous(flags *mirror.Flags, folders mirror.Folder, files mirror.File, links mirror.Links, renames mirror.Renames, totalSize int64) error {
+	dst, opts := flags.Dst, &flags.Opts
+
+	if len(files) > 0 {
+		if err := mirror.CleanFiles(files, totalSize, dst, opts); err != nil {
+			return err
+		}
+		log.Println(MsgDone)
+		addSummary("%d files (%s MB) removed from %q", len(files), mirror.BytesToMB(totalSize), dst)
 	}
 
-	foldersToClean, filesToClean, totalSize := srcDstDiff(dst, src, true)
+	if len(links) > 0 {
+		if err := mirror.CleanLinks(links, dst, opts); err != nil {
+			return err
+		}
+		log.Println(MsgDone)
+		addSummary("%d symlinks removed from %q", len(links), dst)
+	}
+
+	if len(renames) > 0 {
+		if err := mirror.MoveFiles(renames, mirror.OSFS(flags.Src), dst, opts); err != nil {
+			return err
+		}
+		log.Println(MsgDone)
+		addSummary("%d files moved in %q", len(renames), dst)
+	}
 
-	if !mirror.AskQuestion(fmt.Sprintf("%d files (%s MB) and %d folders will be deleted. %s %s", len(filesToClean), mirror.BytesToMB(totalSize), len(foldersToClean), MsgLogging, MgsAreYouSure)) {
+	if len(folders) > 0 {
+		if err := mirror.CleanFolders(folders, dst, opts); err != nil {
+			return err
+		}
+		log.Println(MsgDone)
+		addSummary("%d folders removed from %q", len(folders), dst)
+	}
+	return nil
+}
+
+// checkShrinkage asks for the typed confirmation if removing removedSize from dstSize is more than -shrink-limit allows
+func checkShrinkage(flags *mirror.Flags, dstSize, removedSize int64) {
+	if !mirror.ShrinksTooMuch(dstSize, removedSize, flags.ShrinkLimit) || flags.DryRun {
+		return
+	}
+	if flags.Yes {
+		checkErr(mirror.ErrTooMuchShrinkage)
+	}
+	if !askTypedConfirmation(fmt.Sprintf(MsgShrinkage, flags.Dst, mirror.BytesToMB(dstSize), mirror.BytesToMB(dstSize-removedSize), flags.ShrinkLimit), mirror.ConfirmationWord) {
 		exitWithZero(MsgCanceling)
 	}
+}
+
+// dryRun prints the plan to stdout and exits
+func dryRun(flags *mirror.Flags, folders mirror.Folder, files mirror.File, links mirror.Links, hardLinks mirror.HardLinks) {
+	if flags.CleaningMode {
+		checkErr(mirror.WriteLinks(os.Stdout, links, true))
+	}
+	checkErr(mirror.WritePlan(os.Stdout, folders, files, flags.CleaningMode))
+	if flags.CleaningMode {
+		checkErr(mirror.WriteReclaim(os.Stdout, files))
+	} else {
+		checkErr(mirror.WriteHardLinks(os.Stdout, hardLinks))
+		checkErr(mirror.WriteLinks(os.Stdout, links, false))
+	}
+	exitWithZero(MsgDryRun)
+}
 
-	err := mirror.TruncateLogFile()
+// rescan asks whether the folders should be scanned again if the questions were answered more than -stale-after after planned
+func rescan(flags *mirror.Flags, planned time.Time) bool {
+	age := time.Since(planned)
+	if flags.StaleAfter == 0 || age <= flags.StaleAfter {
+		return false
+	}
+	return ask(flags, fmt.Sprintf(MsgStalePlan, age.Round(time.Second)))
+}
+
+// makeTempDir makes the temporary folder of the run in the -temp-dir folder. Without it, files are copied next to
+// where they belong, see mirror.PartSuffix
+func makeTempDir(flags *mirror.Flags) {
+	if flags.TempDir == "" {
+		return
+	}
+
+	var err error
+	tempDir, err = mirror.NewTempDir(flags.TempDir)
 	checkErr(err)
+	flags.Opts.TempDir = tempDir
+}
 
-	if len(filesToClean) > 0 {
-		err = mirror.CleanFiles(filesToClean, totalSize, dst)
+// startSwap makes the new tree of a -swap run and runs in it. The plan stays right, the new tree is a copy of dst
+func startSwap(flags *mirror.Flags) {
+	newDst, err := mirror.SeedSwap(flags.Dst, &flags.Opts)
+	checkErr(err)
+	swapDst, flags.Dst = flags.Dst, newDst
+}
+
+// finishSwap puts the new tree of a -swap run in place of dst after the run succeeded
+func finishSwap(flags *mirror.Flags) {
+	if swapDst == "" {
+		return
+	}
+	// the temporary folder is inside the new tree
+	removeTempDir()
+	checkErr(mirror.Swap(swapDst))
+
+	_, oldPath := mirror.SwapPaths(swapDst)
+	flags.Dst, swapDst = swapDst, ""
+	addSummary("the new tree replaced %q, the previous one is in %q until 'swap -confirm'", flags.Dst, oldPath)
+}
+
+// makeSnapshot makes the -snapshot of src and reads src from it for the rest of the run
+func makeSnapshot(flags *mirror.Flags) {
+	var err error
+	snapshot, err = mirror.NewSnapshot(flags.Snapshot, flags.Src)
+	checkErr(err)
+	log.Printf(mirror.MsgSnapshot, snapshot.Path)
+
+	flags.Src = snapshot.Path
+	flags.Opts.IgnoreFS = mirror.OSFS(flags.Src)
+}
+
+func removeSnapshot() {
+	if snapshot == nil {
+		return
+	}
+	if err := snapshot.Remove(); err != nil {
+		log.Println(mirror.MsgSnapshotLeft, err)
+	}
+	snapshot = nil
+}
+
+func removeTempDir() {
+	if err := mirror.RemoveTempDir(tempDir); err != nil {
+		log.Println(MsgTempDirLeft, err)
+	}
+	tempDir = ""
+}
+
+// resumedPlan returns what is left of an interrupted run if the -resume flag was used and the run had the same folders and mode
+func resumedPlan(flags *mirror.Flags) (plan mirror.ResumePlan, ok bool) {
+	if !flags.Resume {
+		return
+	}
+
+	plan, ok, err := mirror.LoadResumePlan(flags.Src, flags.Dst, flags.CleaningMode)
+	checkErr(err)
+	if ok {
+		log.Printf(MsgResuming, len(plan.Files), mirror.BytesToMB(plan.TotalSize), len(plan.Folders))
+	}
+	return plan, ok
+}
+
+// startRun empties the log file unless a run is resumed and writes the answers of session into it. With the -resume flag, it saves plan of a new run and starts
+// noting finished items. The returned function removes the saved state, it should be called after the run finished
+func startRun(flags *mirror.Flags, resumed bool, plan mirror.ResumePlan) (finish func()) {
+	if flags.Swap {
+		startSwap(flags)
+	}
+	if !resumed {
+		err := mirror.TruncateLogFile(&flags.Opts)
 		checkErr(err)
-		log.Println(MsgDone)
 	}
+	checkErr(session.Write(&flags.Opts))
+	makeTempDir(flags)
+
+	// a manifest that isn't recorded again would describe an older tree, so it's removed even without -record-manifest
+	var err error
+	runManifest, err = mirror.TakeRunManifest(flags.Dst)
+	checkErr(err)
 
-	if len(foldersToClean) > 0 {
-		err = mirror.CleanFolders(foldersToClean, dst)
+	if !flags.Resume {
+		return func() {}
+	}
+
+	if !resumed {
+		plan.Src, plan.Dst, plan.CleaningMode = flags.Src, flags.Dst, flags.CleaningMode
+		err := mirror.SaveResumePlan(plan)
 		checkErr(err)
-		log.Println(MsgDone)
 	}
+
+	journal, err := mirror.OpenResumeJournal()
+	checkErr(err)
+	flags.Opts.Journal = journal
+
+	return func() {
+		checkErr(journal.Close())
+		checkErr(mirror.RemoveResumeState())
+	}
+}
+
+// recordManifest writes the manifest of the finished run into dst for 'changes' if the -record-manifest flag was used,
+// see mirror.WriteRunManifest. A run that can't record it still succeeded
+func recordManifest(flags *mirror.Flags, plan mirror.SyncPlan) {
+	if !flags.RecordManifest {
+		return
+	}
+	log.Println(MsgRunManifest)
+	if err := mirror.WriteRunManifest(flags.Dst, runManifest, plan, &flags.Opts); err != nil {
+		log.Println(MsgNoRunManifest, err)
+		return
+	}
+	log.Println(MsgDone)
 }
 
-func srcDstDiff(dst, src string, cleaningMod bool) (folders mirror.Folder, files mirror.File, totalSize int64) {
+// doCAS stores all files from src in the CAS layout in dst, there is no diff because objects that already exist are skipped
+func doCAS(flags *mirror.Flags) {
+	dst, src, opts := flags.Dst, flags.Src, &flags.Opts
+
+	if !ask(flags, fmt.Sprintf("%s\nfiles from %q will be stored as objects in %q. %s", flags.EffectiveOptions(), src, dst, MgsAreYouSure)) {
+		exitWithZero(MsgCanceling)
+	}
+
 	log.Println(MsgGatheringInfo)
+	folders, files, skipped, err := mirror.ReadFolder(src, opts)
+	checkErr(err)
+	mirror.DropUnreadable(opts.Report.Unreadable, folders, files)
+	if msg := skipped.Summary(src); msg != "" {
+		log.Println(msg)
+	}
+
+	totalSize := mirror.TotalSize(files)
+	if flags.DryRun {
+		dryRun(flags, folders, files, nil, nil)
+	}
+	if !ask(flags, fmt.Sprintf("%d files (%s MB) will be hashed and the new ones stored. %s %s", len(files), mirror.BytesToMB(totalSize), logging(opts), MgsAreYouSure)) {
+		exitWithZero(MsgCanceling)
+	}
+
+	stopOnSignal(opts)
 
-	srcFolders, srcFiles, err := mirror.ReadFolder(src)
+	err = mirror.TruncateLogFile(opts)
 	checkErr(err)
+	checkErr(session.Write(opts))
+	makeTempDir(flags)
 
-	dstFolders, dstFiles, err := mirror.ReadFolder(dst)
+	manifest, err := mirror.CASStore(folders, files, totalSize, src, dst, opts)
 	checkErr(err)
+	log.Println(MsgDone)
+	addSummary("%d files from %q stored in %q, manifest %q", len(files), src, dst, manifest)
+}
 
-	if cleaningMod {
-		folders = mirror.FoldersToClean(dstFolders, srcFolders)
-		files, totalSize = mirror.FilesToClean(dstFiles, srcFiles)
-	} else {
-		folders = mirror.MissingFolders(dstFolders, srcFolders)
-		files, totalSize = mirror.MissingFiles(dstFiles, srcFiles)
+func doRestore(args []string) {
+	src, dst, manifest, err := mirror.VetRestoreFlags(args)
+	checkErr(err)
+
+	opts := &mirror.Options{LogPath: mirror.LogFile}
+	err = mirror.TruncateLogFile(opts)
+	checkErr(err)
+
+	err = mirror.CASRestore(src, manifest, dst, opts)
+	checkErr(err)
+	log.Println(MsgFinished)
+}
+
+func doSplit(args []string) {
+	src, dsts, err := mirror.VetSplitFlags(args)
+	checkErr(err)
+
+	drives, err := mirror.NewDrives(dsts)
+	checkErr(err)
+
+	log.Println(MsgGatheringInfo)
+	opts := &mirror.Options{LogPath: mirror.LogFile}
+	_, files, _, err := mirror.ReadFolder(src, opts)
+	checkErr(err)
+
+	err = mirror.SplitPlan(files, drives)
+	checkErr(err)
+
+	for _, d := range drives {
+		log.Printf(MsgSplitDrive, len(d.Files), mirror.BytesToMB(mirror.TotalSize(d.Files)), d.Path, mirror.BytesToMB(d.Free))
+	}
+	if !askQuestion(fmt.Sprintf("Each drive will get a list of files on all drives named %q. %s %s", mirror.SplitRecordFile, logging(opts), MgsAreYouSure)) {
+		exitWithZero(MsgCanceling)
+	}
+
+	stopOnSignal(opts)
+
+	err = mirror.TruncateLogFile(opts)
+	checkErr(err)
+	checkErr(session.Write(opts))
+
+	err = mirror.Split(src, drives, opts)
+	checkErr(err)
+	log.Println(MsgFinished)
+}
+
+func doSums(args []string) {
+	dst, err := mirror.VetSumsFlags(mirror.CmdSums, args)
+	checkErr(err)
+
+	opts := &mirror.Options{}
+	stopOnSignal(opts)
+
+	hashed, err := mirror.WriteSums(dst, opts)
+	checkErr(err)
+	log.Printf(MsgHashed, hashed, mirror.SumsFile)
+}
+
+func doVerify(args []string) {
+	dst, err := mirror.VetSumsFlags(mirror.CmdVerify, args)
+	checkErr(err)
+
+	opts := &mirror.Options{}
+	stopOnSignal(opts)
+
+	res, err := mirror.VerifySums(dst, opts)
+	checkErr(err)
+
+	for _, file := range res.Mismatched {
+		log.Println(MsgMismatched, file)
+	}
+	for _, file := range res.Missing {
+		log.Println(MsgMissing, file)
+	}
+	for _, file := range res.Unlisted {
+		log.Println(MsgUnlisted, file)
+	}
+	log.Println(res)
+
+	if !res.OK() {
+		checkErr(mirror.ErrSumsMismatch)
+	}
+}
+
+func doInventory(args []string) {
+	dst, output, hash, ignoreErrors, err := mirror.VetInventoryFlags(args)
+	checkErr(err)
+
+	w := os.Stdout
+	if output != "" {
+		w, err = os.Create(output)
+		checkErr(err)
+	}
+
+	opts := &mirror.Options{IgnoreErrors: ignoreErrors}
+	stopOnSignal(opts)
+
+	listed, err := mirror.Inventory(w, dst, hash, opts)
+	checkErr(err)
+	checkErr(w.Close())
+	if len(opts.Report.IgnoredErrors) > 0 {
+		checkErr(mirror.LogIgnoredErrors(opts.Report.IgnoredErrors, opts))
+	}
+	log.Printf(MsgListed, listed, dst)
+}
+
+func doDiff(args []string) {
+	a, b, format, err := mirror.VetDiffFlags(args)
+	checkErr(err)
+
+	d, err := mirror.DiffTrees(a, b, &mirror.Options{})
+	checkErr(err)
+	checkErr(d.Write(os.Stdout, format))
+}
+
+func doChanges(args []string) {
+	src, cas, manifest, format, err := mirror.VetChangesFlags(args)
+	checkErr(err)
+
+	opts := &mirror.Options{}
+	stopOnSignal(opts)
+
+	c, err := mirror.ChangedSince(src, cas, manifest, opts)
+	checkErr(err)
+	checkErr(c.Write(os.Stdout, format))
+}
+
+func doReplay(args []string) {
+	path, speed, err := mirror.VetReplayFlags(args)
+	checkErr(err)
+
+	f, err := os.Open(path)
+	checkErr(err)
+	defer f.Close()
+
+	res, err := mirror.Replay(os.Stdout, f, speed)
+	checkErr(err)
+	log.Println(res)
+}
+
+func doSelfUpdate(args []string) {
+	url, key, check, err := mirror.VetSelfUpdateFlags(args)
+	checkErr(err)
+	if key == "" {
+		log.Println(mirror.MsgReleaseUnsigned)
+	}
+
+	release, err := mirror.CheckRelease(url, key)
+	checkErr(err)
+	if release.Version == mirror.Version {
+		log.Printf(MsgUpToDate, mirror.Version)
+		return
+	}
+	newer, err := release.Newer(mirror.Version)
+	checkErr(err)
+	if !newer {
+		log.Printf(mirror.MsgOlderRelease, release.Version, mirror.Version)
+		return
+	}
+	log.Printf(MsgNewRelease, release.Version, mirror.Version)
+	if check {
+		return
 	}
 
-	if len(files) == 0 && len(folders) == 0 {
+	exe, err := mirror.Executable()
+	checkErr(err)
+	checkErr(mirror.SelfUpdate(release, exe))
+	log.Printf(MsgUpdated, release.Version)
+}
+
+func doInit(args []string) {
+	dst, config, err := mirror.VetInitFlags(args)
+	checkErr(err)
+
+	checkErr(mirror.InitDst(dst, config))
+	log.Printf(MsgInitialized, dst, config.Mode, mirror.DstConfigPath(dst))
+}
+
+func doSwap(args []string) {
+	dst, rollback, err := mirror.VetSwapFlags(args)
+	checkErr(err)
+
+	if rollback {
+		checkErr(mirror.RollbackSwap(dst))
+		log.Printf(MsgSwapRolled, dst)
+		return
+	}
+	checkErr(mirror.ConfirmSwap(dst))
+	log.Printf(MsgSwapConfirmed, dst)
+}
+
+func doBench(args []string) {
+	dst, files, size, err := mirror.VetBenchFlags(args)
+	checkErr(err)
+
+	log.Printf(MsgBenchmarking, dst)
+	res, err := mirror.Bench(dst, files, size)
+	checkErr(err)
+	log.Println(res)
+}
+
+// srcDstDiff returns what should be copied and cleaned and the size of all files in dst. Only the half that the mode needs
+// is filled, copying mode leaves out what would be cleaned and cleaning mode what would be copied, -sync fills both
+func srcDstDiff(flags *mirror.Flags) (plan mirror.SyncPlan, dstSize int64) {
+	plan, dstSize, err := scanPlan(flags, flags.Audit)
+	checkErr(err)
+
+	if plan.Empty() {
 		exitWithZero(MsgNothingToDo)
 	}
+	return
+}
+
+// scanPlan reads both trees and returns the plan of srcDstDiff. The audit is written into audit if it isn't empty
+func scanPlan(flags *mirror.Flags, audit string) (plan mirror.SyncPlan, dstSize int64, err error) {
+	log.Println(MsgGatheringInfo)
+	opts := &flags.Opts
+	copying, cleaning := !flags.CleaningMode, flags.CleaningMode || flags.Sync
 
+	srcFolders, srcFiles, srcLinks, srcSkipped, err := readFolder(flags.Src, true, opts)
+	if err != nil {
+		return
+	}
+
+	dstFolders, dstFiles, dstLinks, dstSkipped, err := readFolder(flags.Dst, false, opts)
+	if err != nil {
+		return
+	}
+
+	mirror.DropUnreadable(opts.Report.Unreadable, srcFolders, srcFiles)
+	mirror.DropUnreadable(opts.Report.Unreadable, dstFolders, dstFiles)
+	mirror.DropUnreadableLinks(opts.Report.Unreadable, srcLinks)
+	mirror.DropUnreadableLinks(opts.Report.Unreadable, dstLinks)
+
+	for _, skipped := range []string{srcSkipped.Summary(flags.Src), dstSkipped.Summary(flags.Dst)} {
+		if skipped != "" {
+			log.Println(skipped)
+		}
+	}
+	if len(opts.Report.Unreadable) > 0 {
+		log.Println(MsgUnreadable, len(opts.Report.Unreadable))
+	}
+	if n := countReason(srcSkipped, mirror.ReasonSymlink); n > 0 {
+		log.Printf(mirror.MsgLinksSkipped, n)
+	}
+
+	changed := mirror.File{}
+	if copying {
+		if changed, _, err = opts.Compare.ChangedFiles(dstFiles, srcFiles, flags.Dst, flags.Src); err != nil {
+			return
+		}
+	}
+
+	dstSize = mirror.TotalSize(dstFiles)
+
+	plan = mirror.NewSyncPlan(dstFolders, srcFolders, dstFiles, srcFiles, changed)
+	plan.KeepSkipped(srcSkipped)
+	plan.StaleParts = mirror.StaleParts(dstSkipped)
+	if opts.Links {
+		plan.MissingLinks, plan.LinksToClean = mirror.MissingLinks(dstLinks, srcLinks), mirror.LinksToClean(dstLinks, srcLinks)
+	}
+	var tooLong mirror.Skipped
+	if copying {
+		if tooLong, err = mirror.SkipTooLong(flags.Dst, plan.MissingFolders, plan.MissingFiles, plan.MissingLinks, opts); err != nil {
+			return
+		}
+		if summary := tooLong.Summary(flags.Src); summary != "" {
+			log.Println(summary)
+		}
+		plan.CopySize = mirror.TotalSize(plan.MissingFiles)
+	}
+	if opts.HardLinks && copying {
+		var groups [][]string
+		if groups, err = mirror.HardLinkGroups(mirror.OSFS(flags.Src), srcFiles, opts); err != nil {
+			return
+		}
+		plan.HardLinks = mirror.PlanHardLinks(groups, plan.MissingFiles)
+		plan.CopySize = mirror.TotalSize(plan.MissingFiles)
+	}
+	if opts.DetectRenames && copying && cleaning {
+		if plan.Renames, err = mirror.PlanRenames(plan.MissingFiles, plan.FilesToClean, plan.FoldersToClean, mirror.OSFS(flags.Src), flags.Dst, opts); err != nil {
+			return
+		}
+		plan.CopySize, plan.CleanSize = mirror.TotalSize(plan.MissingFiles), mirror.TotalSize(plan.FilesToClean)
+	}
+	if !copying {
+		plan.MissingFolders, plan.MissingFiles, plan.CopySize, plan.MissingLinks = nil, nil, 0, nil
+	}
+	if !cleaning {
+		plan.FoldersToClean, plan.FilesToClean, plan.CleanSize, plan.LinksToClean = nil, nil, 0, nil
+	}
+
+	// once every planner is done, so the audit has what the run does
+	if audit != "" {
+		writeAudit(audit, copying, cleaning, plan, tooLong, dstFolders, srcFolders, dstFiles, srcFiles, changed, dstLinks, srcLinks, dstSkipped, srcSkipped, opts.Report.Unreadable)
+	}
 	return
 }
 
+// readFolder reads path with mirror.ReadFolderLinks if symlinks are made in dst, links is nil otherwise. Links are
+// followed only in src, following them in dst could remove what they point to
+func readFolder(path string, src bool, opts *mirror.Options) (folders mirror.Folder, files mirror.File, links mirror.Links, skipped mirror.Skipped, err error) {
+	switch {
+	case opts.Links:
+		return mirror.ReadFolderLinks(path, opts)
+	case opts.FollowLinks && src:
+		folders, files, skipped, err = mirror.ReadFSFollowLinks(mirror.OSFS(path), opts)
+	default:
+		folders, files, skipped, err = mirror.ReadFolder(path, opts)
+	}
+	return
+}
+
+// countReason returns how many items were skipped because of reason
+func countReason(skipped mirror.Skipped, reason string) (n int) {
+	for _, r := range skipped {
+		if r == reason {
+			n++
+		}
+	}
+	return
+}
+
+func writeAudit(path string, copying, cleaning bool, plan mirror.SyncPlan, tooLong mirror.Skipped, dstFolders, srcFolders mirror.Folder, dstFiles, srcFiles, changed mirror.File, dstLinks, srcLinks mirror.Links, dstSkipped, srcSkipped mirror.Skipped, unreadable []string) {
+	audit, err := mirror.NewAudit(path)
+	checkErr(err)
+
+	audit.Planned(plan, tooLong)
+	checkErr(audit.Folders(dstFolders, srcFolders, copying, cleaning))
+	checkErr(audit.Files(dstFiles, srcFiles, changed, copying, cleaning))
+	checkErr(audit.Links(dstLinks, srcLinks, copying, cleaning))
+	checkErr(audit.Skipped(srcSkipped, mirror.TreeSrc))
+	checkErr(audit.Skipped(dstSkipped, mirror.TreeDst))
+	checkErr(audit.Unreadable(unreadable))
+	checkErr(audit.Close())
+}
+
+// ask asks question, or only logs it if the -yes or -dry-run flag was used
+func ask(flags *mirror.Flags, question string) bool {
+	if flags.Yes || flags.DryRun {
+		log.Printf("%s (y/n) %s\n", question, MsgAnsweredYes)
+		session.Answer(question, time.Now(), MsgAnsweredYes)
+		return true
+	}
+	return askQuestion(question)
+}
+
+// askQuestion prints question and returns true if it gets y/Y on input. The answer is noted in session
+func askQuestion(question string) bool {
+	reader := bufio.NewReader(os.Stdin)
+	log.Printf("%s (y/n)\n", question)
+	asked := time.Now()
+	answer, _ := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	session.Answer(question, asked, answer)
+	if !strings.EqualFold("y", answer) {
+		return false
+	}
+	return true
+}
+
+// askTypedConfirmation prints question and returns true only if the exact word is typed on input. The answer is
+// noted in session
+func askTypedConfirmation(question, word string) bool {
+	reader := bufio.NewReader(os.Stdin)
+	log.Printf("%s (type %s to proceed)\n", question, word)
+	asked := time.Now()
+	answer, _ := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	session.Answer(question, asked, answer)
+	return answer == word
+}
+
+// stopOnSignal closes opts.Stop on SIGTERM or an interrupt, so the item that is being worked on is finished before the program exits.
+// A second signal exits at once, e.g. when a large file takes too long to finish
+func stopOnSignal(opts *mirror.Options) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	stop := make(chan struct{})
+	go func() {
+		log.Println(MsgSignal, <-signals)
+		close(stop)
+		log.Fatalln(MsgSignalAgain, <-signals)
+	}()
+	opts.Stop = stop
+}
+
+// crashReport writes a crash report if the program panics and then lets it crash as usual
+func crashReport() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	if p, ok := r.(*mirror.WorkerPanic); ok {
+		stack = p.Stack
+	}
+	if err := mirror.WriteCrashReport(mirror.CrashReportFile, r, stack, runOpts); err != nil {
+		log.Println(MsgNoCrashReport, err)
+	} else {
+		log.Printf(MsgCrashed, mirror.CrashReportFile)
+	}
+
+	removeTempDir()
+	removeSnapshot()
+	sendTrace(fmt.Errorf("%v", r))
+	stopPlugins(true, fmt.Sprint(r))
+	ping(true, fmt.Sprintln(MsgErrOccurred, r))
+	panic(r)
+}
+
 func checkErr(err error) {
 	if err != nil {
+		removeTempDir()
+		removeSnapshot()
+		sendTrace(err)
+		stopPlugins(true, err.Error())
+		ping(true, fmt.Sprintln(MsgErrOccurred, err))
 		log.Fatalln(MsgErrOccurred, err)
 	}
 }
 
 func exitWithZero(msg string) {
+	removeTempDir()
+	removeSnapshot()
 	log.Println(msg)
+	sendTrace(nil)
+	stopPlugins(false, msg)
+	ping(false, msg)
 	os.Exit(0)
 }
+
+// sendTrace sends the spans of the run to the collector if the -otel flag was used, err is why the run failed
+func sendTrace(err error) {
+	if err := tracer.Flush(err); err != nil {
+		log.Println(MsgTraceFailed, err)
+	}
+	tracer = nil
+}
+
+// stopPlugins sends the finished event with msg to the plugins of the -plugin flags and waits until they exit
+func stopPlugins(failed bool, msg string) {
+	if err := plugins.Close(failed, msg); err != nil {
+		log.Println(MsgPluginFailed, err)
+	}
+	plugins = nil
+}
+
+func addSummary(format string, a ...interface{}) {
+	summary = append(summary, fmt.Sprintf(format, a...))
+}
+
+// ping sends the summary and msg to pingURL if it was set
+func ping(failed bool, msg string) {
+	if pingURL == "" {
+		return
+	}
+
+	body := strings.Join(append(summary, msg), "\n")
+	if err := mirror.Ping(pingURL, failed, body); err != nil {
+		log.Println(MsgPingFailed, err)
+	}
+}
@@ -0,0 +1,94 @@
+package mirror
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FlagNameNewerThan  = "newer-than"
+	FlagNameOlderThan  = "older-than"
+	FlagUsageNewerThan = "files modified before this are skipped in src and dst, a duration back from now like 7d, 12h or 2w, or a date like 2024-05-01 or 2024-05-01 18:30"
+	FlagUsageOlderThan = "files modified after this are skipped in src and dst, takes the same values as -" + FlagNameNewerThan
+	ErrBadAge          = CustomErr("invalid age, use a duration like 7d or 12h, or a date like 2024-05-01, got")
+	ErrAgeRange        = CustomErr("-" + FlagNameOlderThan + " isn't later than -" + FlagNameNewerThan + ", so every file would be skipped")
+	ReasonTooOld       = "modified before -" + FlagNameNewerThan
+	ReasonTooNew       = "modified after -" + FlagNameOlderThan
+)
+
+// ageLayouts are the date formats that Age accepts, dates without a zone are in local time
+var ageLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// ageUnits are the units that Age accepts on top of the ones of time.ParseDuration
+var ageUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// Age is a point in time that can be read from a command line flag as a duration back from now or as a date.
+// The zero Age turns the filter that uses it off
+type Age time.Time
+
+func (a *Age) String() string {
+	if time.Time(*a).IsZero() {
+		return ""
+	}
+	return time.Time(*a).Format(time.RFC3339)
+}
+
+func (a *Age) Set(value string) error {
+	v := strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		*a = Age(t)
+		return nil
+	}
+	for _, layout := range ageLayouts {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			*a = Age(t)
+			return nil
+		}
+	}
+
+	d, err := parseAge(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%w %q", ErrBadAge, value)
+	}
+	*a = Age(time.Now().Add(-d))
+	return nil
+}
+
+// parseAge is time.ParseDuration with days and weeks, which can't be mixed with other units
+func parseAge(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, ErrBadAge
+	}
+	if unit, ok := ageUnits[v[len(v)-1:]]; ok {
+		n, err := strconv.ParseFloat(v[:len(v)-1], 64)
+		if err != nil || !(n >= 0) || n*float64(unit) > math.MaxInt64 {
+			return 0, ErrBadAge
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	return time.ParseDuration(v)
+}
+
+// ageFiltered returns the reason why a file modified at modTime is skipped by -newer-than or -older-than,
+// or an empty string
+func (o *Options) ageFiltered(modTime time.Time) string {
+	if newer := time.Time(o.NewerThan); !newer.IsZero() && modTime.Before(newer) {
+		return ReasonTooOld
+	}
+	if older := time.Time(o.OlderThan); !older.IsZero() && modTime.After(older) {
+		return ReasonTooNew
+	}
+	return ""
+}
+
+// filtersAge returns true if -newer-than or -older-than is used. Copies then keep the modification time of the
+// source, a copy that got the time of the run would be outside of the window in dst
+func (o *Options) filtersAge() bool {
+	return !time.Time(o.NewerThan).IsZero() || !time.Time(o.OlderThan).IsZero()
+}
@@ -0,0 +1,118 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestAgeSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ago   time.Duration
+		err   error
+	}{
+		{value: "2024-05-01", want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{value: "2024-05-01 18:30", want: time.Date(2024, 5, 1, 18, 30, 0, 0, time.Local)},
+		{value: "2024-05-01T18:30:15", want: time.Date(2024, 5, 1, 18, 30, 15, 0, time.Local)},
+		{value: "2024-05-01T18:30:00Z", want: time.Date(2024, 5, 1, 18, 30, 0, 0, time.UTC)},
+		{value: "12h", ago: 12 * time.Hour},
+		{value: "1h30m", ago: 90 * time.Minute},
+		{value: "7d", ago: 7 * 24 * time.Hour},
+		{value: "1.5d", ago: 36 * time.Hour},
+		{value: "2w", ago: 14 * 24 * time.Hour},
+		{value: "", err: ErrBadAge},
+		{value: "d", err: ErrBadAge},
+		{value: "-7d", err: ErrBadAge},
+		{value: "-1h", err: ErrBadAge},
+		{value: "7x", err: ErrBadAge},
+		{value: "2024-13-01", err: ErrBadAge},
+		{value: "1000000000w", err: ErrBadAge},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			var a Age
+			before := time.Now()
+			err := a.Set(test.value)
+			after := time.Now()
+
+			assert(t, test.err != nil, errors.Is(err, ErrBadAge))
+			switch got := time.Time(a); {
+			case test.err != nil:
+				assert(t, true, got.IsZero())
+			case test.ago > 0:
+				if got.Before(before.Add(-test.ago)) || got.After(after.Add(-test.ago)) {
+					t.Errorf("want %s ago, got %s", test.ago, got)
+				}
+			default:
+				assert(t, true, test.want.Equal(got))
+			}
+		})
+	}
+}
+
+func TestReadFolderAgeFilters(t *testing.T) {
+	now := time.Now()
+	fsys := fstest.MapFS{
+		"new":     {Data: []byte("n"), ModTime: now.Add(-time.Hour)},
+		"week":    {Data: []byte("w"), ModTime: now.Add(-5 * 24 * time.Hour)},
+		"a/month": {Data: []byte("m"), ModTime: now.Add(-30 * 24 * time.Hour)},
+	}
+
+	tests := []struct {
+		name                 string
+		newerThan, olderThan time.Duration
+		files                File
+		skipped              Skipped
+	}{
+		{name: "no window", files: File{"new": 1, "week": 1, filepath.Join("a", "month"): 1}, skipped: Skipped{}},
+		{name: "newer than", newerThan: 7 * 24 * time.Hour, files: File{"new": 1, "week": 1}, skipped: Skipped{filepath.Join("a", "month"): ReasonTooOld}},
+		{name: "older than", olderThan: 24 * time.Hour, files: File{"week": 1, filepath.Join("a", "month"): 1}, skipped: Skipped{"new": ReasonTooNew}},
+		{
+			name: "window", newerThan: 7 * 24 * time.Hour, olderThan: 24 * time.Hour,
+			files:   File{"week": 1},
+			skipped: Skipped{"new": ReasonTooNew, filepath.Join("a", "month"): ReasonTooOld},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &Options{}
+			if test.newerThan > 0 {
+				opts.NewerThan = Age(now.Add(-test.newerThan))
+			}
+			if test.olderThan > 0 {
+				opts.OlderThan = Age(now.Add(-test.olderThan))
+			}
+
+			_, files, skipped, err := ReadFS(fsys, opts)
+			assertError(t, nil, err)
+			assert(t, test.files, files)
+			assert(t, test.skipped, skipped)
+		})
+	}
+}
+
+func TestAgeWindowCheck(t *testing.T) {
+	now := time.Now()
+	assertError(t, ErrAgeRange, (&Options{NewerThan: Age(now), OlderThan: Age(now.Add(-time.Hour))}).check())
+	assertError(t, nil, (&Options{NewerThan: Age(now.Add(-time.Hour)), OlderThan: Age(now)}).check())
+	assertError(t, nil, (&Options{OlderThan: Age(now)}).check())
+}
+
+func TestCopyFilesAgeFilterKeepsModTime(t *testing.T) {
+	discardLog(t)
+	modTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	fsys := fstest.MapFS{"a": {Data: []byte("a"), ModTime: modTime}}
+	dst := t.TempDir()
+
+	opts := &Options{LogPath: os.DevNull, NewerThan: Age(modTime.Add(-time.Hour))}
+	assertError(t, nil, CopyFilesFS(File{"a": 1}, 1, fsys, dst, opts))
+
+	f, err := os.Stat(filepath.Join(dst, "a"))
+	assertError(t, nil, err)
+	assert(t, true, modTime.Equal(f.ModTime()))
+}
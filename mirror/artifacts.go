@@ -0,0 +1,44 @@
+package mirror
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FlagNameArtifact  = "artifact"
+	FlagUsageArtifact = "file or folder that is never copied or removed, like the log file, the crash report and the resume files, which are excluded anyway (can be repeated)"
+	ReasonArtifact    = "file of the program"
+)
+
+// artifacts returns absolute paths of the files the program writes, so they aren't mirrored or removed when they are
+// inside src or dst: the log file, the crash report, the resume files and o.Artifacts
+func (o *Options) artifacts() Paths {
+	res := make(Paths, 0, len(o.Artifacts)+4)
+	for _, path := range append([]string{o.LogFilePath(), CrashReportFile, ResumePlanFile, ResumeJournalFile}, o.Artifacts...) {
+		// a path that can't be made absolute can't be inside src or dst either
+		if abs, err := filepath.Abs(path); err == nil {
+			res = append(res, fixLongPath(abs))
+		}
+	}
+	return res
+}
+
+// artifactsIn returns paths of the artifacts inside fsys relative to it. Only an OSFS can have them
+func (o *Options) artifactsIn(fsys fs.FS) map[string]struct{} {
+	root, ok := fsys.(OSFS)
+	if !ok {
+		return nil
+	}
+
+	res := make(map[string]struct{})
+	for _, path := range o.artifacts() {
+		rel, err := filepath.Rel(string(root), path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		res[rel] = struct{}{}
+	}
+	return res
+}
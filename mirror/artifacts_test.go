@@ -0,0 +1,51 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadFolderSkipsArtifacts(t *testing.T) {
+	// the working folder has no symlinks in it, e.g. on macOS
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	assertError(t, nil, err)
+	for _, file := range []string{"mirror.log", CrashReportFile, filepath.Join("a", "audit.json"), filepath.Join("a", "kept"), filepath.Join("cache", "c")} {
+		assertError(t, nil, os.MkdirAll(filepath.Join(root, filepath.Dir(file)), FolderPerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(root, file), []byte("x"), FilePerm))
+	}
+
+	wd, err := os.Getwd()
+	assertError(t, nil, err)
+	assertError(t, nil, os.Chdir(root))
+	t.Cleanup(func() {
+		assertError(t, nil, os.Chdir(wd))
+	})
+
+	opts := &Options{LogPath: filepath.Join(root, "mirror.log"), Artifacts: Paths{filepath.Join("a", "audit.json"), filepath.Join(root, "cache")}}
+	folders, files, skipped, err := ReadFolder(root, opts)
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}}, folders)
+	assert(t, File{filepath.Join("a", "kept"): 1}, files)
+	assert(t, Skipped{
+		"mirror.log":                     ReasonArtifact,
+		CrashReportFile:                  ReasonArtifact,
+		filepath.Join("a", "audit.json"): ReasonArtifact,
+		"cache":                          ReasonArtifact,
+	}, skipped)
+
+	t.Run("artifacts outside the folder don't matter", func(t *testing.T) {
+		_, files, _, err := ReadFolder(filepath.Join(root, "a"), opts)
+		assertError(t, nil, err)
+		assert(t, File{"kept": 1}, files)
+	})
+}
+
+func TestArtifactsIn(t *testing.T) {
+	root := t.TempDir()
+	opts := &Options{LogPath: filepath.Join(root, "log"), Artifacts: Paths{root, filepath.Dir(root), filepath.Join(root, "..", "other")}}
+
+	assert(t, map[string]struct{}{"log": {}}, opts.artifactsIn(OSFS(root)))
+	assert(t, map[string]struct{}(nil), opts.artifactsIn(fstest.MapFS{}))
+}
@@ -0,0 +1,16 @@
+package mirror
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the access time of info if it's from the disk
+func accessTime(info fs.FileInfo) (time.Time, bool) {
+	s, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(s.Atimespec.Unix()), true
+}
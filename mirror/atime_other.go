@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package mirror
+
+import (
+	"io/fs"
+	"time"
+)
+
+// accessTime doesn't know where the BSDs and others keep the access time in fs.FileInfo.Sys, copies get the time of
+// the copy
+func accessTime(info fs.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
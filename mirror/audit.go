@@ -0,0 +1,240 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	DecisionCopy          = "copy"
+	DecisionSkip          = "skip"
+	DecisionDelete        = "delete"
+	DecisionIgnore        = "ignore"
+	DecisionHardLink      = "hard link"
+	DecisionMove          = "move"
+	TypeFolder            = "folder"
+	TypeFile              = "file"
+	TypeLink              = "link"
+	TreeSrc               = "src"
+	TreeDst               = "dst"
+	ReasonMissingInDst    = "missing in dst"
+	ReasonNotInSrc        = "not in src"
+	ReasonSameSize        = "same size in src and dst"
+	ReasonInBoth          = "present in src and dst"
+	ReasonOnlyInDst       = "only in dst and cleaning mode is off"
+	ReasonOnlyInSrc       = "only in src and cleaning mode doesn't copy"
+	ReasonCleaningKeeps   = "present in src, cleaning mode doesn't compare sizes"
+	ReasonUnreadable      = "couldn't be read, the error was ignored"
+	ReasonSkippedInSrc    = "skipped in src, so dst keeps it"
+	ReasonSameTarget      = "same target in src and dst"
+	formatReasonSizeDiffs = "size differs: %d B in src, %d B in dst"
+	formatReasonTargets   = "target differs: %s in src, %s in dst"
+	formatReasonHardLink  = "made as a hard link of %s, like in src"
+	formatReasonMovedFrom = "moved from %s in dst, which has the same content"
+	formatReasonMovedTo   = "moved to %s, where src has the same content"
+)
+
+// AuditRecord is one line of the audit file
+type AuditRecord struct {
+	// Schema is SchemaAudit, it's set when the record is written
+	Schema   int    `json:"schema"`
+	Path     string `json:"path"`
+	Type     string `json:"type,omitempty"`
+	Tree     string `json:"tree,omitempty"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+}
+
+// Audit writes a JSON line with a decision and its reason for every examined path
+type Audit struct {
+	f   *os.File
+	enc *json.Encoder
+	// plan and tooLong change the decisions of Folders and Files, see Planned
+	plan    SyncPlan
+	tooLong Skipped
+}
+
+// NewAudit creates (or truncates) the audit file at path
+func NewAudit(path string) (*Audit, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Audit{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Planned makes Folders, Files and Links record what the planners made of the plan after the trees were compared:
+// items skipped by SkipTooLong, files made as hard links by PlanHardLinks, files moved by PlanRenames and items that
+// SyncPlan.KeepSkipped keeps. It's called before them
+func (a *Audit) Planned(plan SyncPlan, tooLong Skipped) {
+	a.plan, a.tooLong = plan, tooLong
+}
+
+// Folders records decisions about folders from both trees. copying and cleaning tell which of the two the run does, -sync does both
+func (a *Audit) Folders(dst, src Folder, copying, cleaning bool) error {
+	records := make([]AuditRecord, 0, len(src)+len(dst))
+
+	for folder := range src {
+		r := AuditRecord{Path: folder, Type: TypeFolder, Decision: DecisionSkip, Reason: ReasonInBoth}
+		if _, ok := dst[folder]; !ok {
+			r.Decision, r.Reason = DecisionCopy, ReasonMissingInDst
+			if !copying {
+				r.Decision, r.Reason = DecisionSkip, ReasonOnlyInSrc
+			} else if reason, ok := a.tooLong[folder]; ok {
+				r.Decision, r.Reason = DecisionSkip, reason
+			}
+		}
+		records = append(records, r)
+	}
+
+	for folder := range dst {
+		if _, ok := src[folder]; ok {
+			continue
+		}
+		r := AuditRecord{Path: folder, Type: TypeFolder, Decision: DecisionSkip, Reason: ReasonOnlyInDst}
+		if _, ok := a.plan.FoldersToClean[folder]; cleaning && a.plan.FoldersToClean != nil && !ok {
+			r.Reason = ReasonSkippedInSrc
+		} else if cleaning {
+			r.Decision, r.Reason = DecisionDelete, ReasonNotInSrc
+		}
+		records = append(records, r)
+	}
+
+	return a.write(records)
+}
+
+// Files records decisions about files from both trees. changed holds files of the same size that are copied anyway, see Comparer
+func (a *Audit) Files(dst, src, changed File, copying, cleaning bool) error {
+	records := make([]AuditRecord, 0, len(src)+len(dst))
+
+	for file, size := range src {
+		r := AuditRecord{Path: file, Type: TypeFile}
+		dstSize, ok := dst[file]
+		_, isChanged := changed[file]
+		switch {
+		case !copying && ok:
+			r.Decision, r.Reason = DecisionSkip, ReasonCleaningKeeps
+		case !copying:
+			r.Decision, r.Reason = DecisionSkip, ReasonOnlyInSrc
+		case !ok:
+			r.Decision, r.Reason = DecisionCopy, ReasonMissingInDst
+		case dstSize != size:
+			r.Decision, r.Reason = DecisionCopy, fmt.Sprintf(formatReasonSizeDiffs, size, dstSize)
+		case isChanged:
+			r.Decision, r.Reason = DecisionCopy, ReasonModTimeDiffers
+		default:
+			r.Decision, r.Reason = DecisionSkip, ReasonSameSize
+		}
+		if r.Decision == DecisionCopy {
+			if reason, ok := a.tooLong[file]; ok {
+				r.Decision, r.Reason = DecisionSkip, reason
+			} else if target, ok := a.plan.HardLinks[file]; ok {
+				r.Decision, r.Reason = DecisionHardLink, fmt.Sprintf(formatReasonHardLink, target)
+			} else if from, ok := a.plan.Renames[file]; ok {
+				r.Decision, r.Reason = DecisionMove, fmt.Sprintf(formatReasonMovedFrom, from)
+			}
+		}
+		records = append(records, r)
+	}
+
+	movedTo := make(map[string]string, len(a.plan.Renames))
+	for to, from := range a.plan.Renames {
+		movedTo[from] = to
+	}
+	for file := range dst {
+		if _, ok := src[file]; ok {
+			continue
+		}
+		r := AuditRecord{Path: file, Type: TypeFile, Decision: DecisionSkip, Reason: ReasonOnlyInDst}
+		if to, ok := movedTo[file]; ok {
+			r.Decision, r.Reason = DecisionMove, fmt.Sprintf(formatReasonMovedTo, to)
+		} else if _, ok := a.plan.FilesToClean[file]; cleaning && a.plan.FilesToClean != nil && !ok {
+			r.Reason = ReasonSkippedInSrc
+		} else if cleaning {
+			r.Decision, r.Reason = DecisionDelete, ReasonNotInSrc
+		}
+		records = append(records, r)
+	}
+
+	return a.write(records)
+}
+
+// Links records decisions about symlinks from both trees, read with the -links flag. A link of src that points
+// somewhere else in dst is made again
+func (a *Audit) Links(dst, src Links, copying, cleaning bool) error {
+	records := make([]AuditRecord, 0, len(src)+len(dst))
+
+	for link, target := range src {
+		r := AuditRecord{Path: link, Type: TypeLink}
+		dstTarget, ok := dst[link]
+		switch {
+		case !copying && ok:
+			r.Decision, r.Reason = DecisionSkip, ReasonInBoth
+		case !copying:
+			r.Decision, r.Reason = DecisionSkip, ReasonOnlyInSrc
+		case !ok:
+			r.Decision, r.Reason = DecisionCopy, ReasonMissingInDst
+		case dstTarget != target:
+			r.Decision, r.Reason = DecisionCopy, fmt.Sprintf(formatReasonTargets, target, dstTarget)
+		default:
+			r.Decision, r.Reason = DecisionSkip, ReasonSameTarget
+		}
+		if reason, ok := a.tooLong[link]; ok && r.Decision == DecisionCopy {
+			r.Decision, r.Reason = DecisionSkip, reason
+		}
+		records = append(records, r)
+	}
+
+	for link := range dst {
+		if _, ok := src[link]; ok {
+			continue
+		}
+		r := AuditRecord{Path: link, Type: TypeLink, Decision: DecisionSkip, Reason: ReasonOnlyInDst}
+		if _, ok := a.plan.LinksToClean[link]; cleaning && a.plan.LinksToClean != nil && !ok {
+			r.Reason = ReasonSkippedInSrc
+		} else if cleaning {
+			r.Decision, r.Reason = DecisionDelete, ReasonNotInSrc
+		}
+		records = append(records, r)
+	}
+
+	return a.write(records)
+}
+
+// Skipped records items that weren't read in tree (TreeSrc or TreeDst)
+func (a *Audit) Skipped(skipped Skipped, tree string) error {
+	records := make([]AuditRecord, 0, len(skipped))
+	for path, reason := range skipped {
+		records = append(records, AuditRecord{Path: path, Tree: tree, Decision: DecisionIgnore, Reason: reason})
+	}
+	return a.write(records)
+}
+
+// Unreadable records paths that couldn't be read because of an ignored error
+func (a *Audit) Unreadable(paths []string) error {
+	records := make([]AuditRecord, 0, len(paths))
+	for _, path := range paths {
+		records = append(records, AuditRecord{Path: path, Decision: DecisionIgnore, Reason: ReasonUnreadable})
+	}
+	return a.write(records)
+}
+
+func (a *Audit) Close() error {
+	return a.f.Close()
+}
+
+func (a *Audit) write(records []AuditRecord) error {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Path < records[j].Path
+	})
+
+	for _, r := range records {
+		r.Schema = SchemaAudit
+		if err := a.enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	makeTestFolders(t)
+
+	tests := []struct {
+		name              string
+		copying, cleaning bool
+		expected          map[string]string
+	}{
+		{
+			name:    "copying mode",
+			copying: true,
+			expected: map[string]string{
+				filepath.Join("same_1/same_2/not_in_dst"):  DecisionCopy,
+				filepath.Join("same_1/same_2/not_in_src"):  DecisionSkip,
+				filepath.Join("same_1/same_2/_not_in_dst"): DecisionCopy,
+				filepath.Join("same_1/same_2/_not_in_src"): DecisionSkip,
+				filepath.Join("same_1/_different"):         DecisionCopy,
+				"_same_1":                                  DecisionSkip,
+				"link":                                     DecisionIgnore,
+			},
+		},
+		{
+			name:     "cleaning mode",
+			cleaning: true,
+			expected: map[string]string{
+				filepath.Join("same_1/same_2/not_in_dst"):  DecisionSkip,
+				filepath.Join("same_1/same_2/not_in_src"):  DecisionDelete,
+				filepath.Join("same_1/same_2/_not_in_dst"): DecisionSkip,
+				filepath.Join("same_1/same_2/_not_in_src"): DecisionDelete,
+				filepath.Join("same_1/_different"):         DecisionSkip,
+				"_same_1":                                  DecisionSkip,
+				"link":                                     DecisionIgnore,
+			},
+		},
+		{
+			name:     "sync",
+			copying:  true,
+			cleaning: true,
+			expected: map[string]string{
+				filepath.Join("same_1/same_2/not_in_dst"):  DecisionCopy,
+				filepath.Join("same_1/same_2/not_in_src"):  DecisionDelete,
+				filepath.Join("same_1/same_2/_not_in_dst"): DecisionCopy,
+				filepath.Join("same_1/same_2/_not_in_src"): DecisionDelete,
+				filepath.Join("same_1/_different"):         DecisionCopy,
+				"_same_1":                                  DecisionSkip,
+				"link":                                     DecisionIgnore,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := "audit.jsonl"
+
+			a, err := NewAudit(fileName)
+			assertError(t, nil, err)
+			assertError(t, nil, a.Folders(dstFolders, srcFolders, test.copying, test.cleaning))
+			assertError(t, nil, a.Files(dstFiles, srcFiles, nil, test.copying, test.cleaning))
+			assertError(t, nil, a.Skipped(Skipped{"link": ReasonSymlink}, TreeSrc))
+			assertError(t, nil, a.Close())
+
+			f, err := os.Open(fileName)
+			assertError(t, nil, err)
+
+			got := make(map[string]string)
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var r AuditRecord
+				assertError(t, nil, json.Unmarshal(scanner.Bytes(), &r))
+				if r.Reason == "" {
+					t.Errorf("%q has no reason", r.Path)
+				}
+				got[r.Path] = r.Decision
+			}
+
+			assertError(t, nil, f.Close())
+			assertError(t, nil, os.Remove(fileName))
+
+			for path, decision := range test.expected {
+				assert(t, decision, got[path])
+			}
+		})
+	}
+
+	cleanTestFolders(t)
+}
+
+func TestAuditPlanned(t *testing.T) {
+	src := File{"long": 1, "link": 1, "orig": 1, "new": 1}
+	dst := File{"old": 1}
+	fileName := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	a, err := NewAudit(fileName)
+	assertError(t, nil, err)
+	a.Planned(SyncPlan{HardLinks: HardLinks{"link": "orig"}, Renames: Renames{"new": "old"}}, Skipped{"long": ReasonNameTooLong})
+	assertError(t, nil, a.Files(dst, src, nil, true, true))
+	assertError(t, nil, a.Close())
+
+	data, err := os.ReadFile(fileName)
+	assertError(t, nil, err)
+	got := make(map[string]AuditRecord)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var r AuditRecord
+		assertError(t, nil, json.Unmarshal(scanner.Bytes(), &r))
+		got[r.Path] = r
+	}
+
+	assert(t, AuditRecord{Schema: SchemaAudit, Path: "long", Type: TypeFile, Decision: DecisionSkip, Reason: ReasonNameTooLong}, got["long"])
+	assert(t, DecisionHardLink, got["link"].Decision)
+	assert(t, DecisionCopy, got["orig"].Decision)
+	assert(t, DecisionMove, got["new"].Decision)
+	assert(t, DecisionMove, got["old"].Decision)
+}
+
+func TestAuditLinks(t *testing.T) {
+	src := Links{"new": "a", "moved": "b", "same": "c", "long": "d"}
+	dst := Links{"moved": "x", "same": "c", "old": "e", "kept": "f"}
+	fileName := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	a, err := NewAudit(fileName)
+	assertError(t, nil, err)
+	a.Planned(SyncPlan{LinksToClean: Links{"old": "e"}}, Skipped{"long": ReasonNameTooLong})
+	assertError(t, nil, a.Links(dst, src, true, true))
+	assertError(t, nil, a.Close())
+
+	data, err := os.ReadFile(fileName)
+	assertError(t, nil, err)
+	got := make(map[string]AuditRecord)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var r AuditRecord
+		assertError(t, nil, json.Unmarshal(scanner.Bytes(), &r))
+		got[r.Path] = r
+	}
+
+	assert(t, AuditRecord{Schema: SchemaAudit, Path: "new", Type: TypeLink, Decision: DecisionCopy, Reason: ReasonMissingInDst}, got["new"])
+	assert(t, DecisionCopy, got["moved"].Decision)
+	assert(t, DecisionSkip, got["same"].Decision)
+	assert(t, ReasonNameTooLong, got["long"].Reason)
+	assert(t, DecisionDelete, got["old"].Decision)
+	assert(t, ReasonSkippedInSrc, got["kept"].Reason)
+}
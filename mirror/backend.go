@@ -0,0 +1,63 @@
+package mirror
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	ErrUnknownBackend = CustomErr("no backend is registered for the scheme of")
+	backendSeparator  = "://"
+)
+
+// BackendFactory opens the storage that u points to as the fs.FS that a Mirror reads the source from, see
+// RegisterBackend. Like with NewFS, the source is only read
+type BackendFactory func(u *url.URL) (fs.FS, error)
+
+// backends maps lower case schemes to their factories
+var backends = struct {
+	sync.RWMutex
+	m map[string]BackendFactory
+}{m: make(map[string]BackendFactory)}
+
+// RegisterBackend makes New and Job read a source given as a URL of scheme, like "tape://library/pool", from the
+// fs.FS that factory opens for it, so other Go modules can add storage the program doesn't know. Schemes aren't case
+// sensitive. It's meant to be called from init functions and panics if scheme is empty, factory is nil or the scheme
+// is registered already, like sql.Register
+func RegisterBackend(scheme string, factory BackendFactory) {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" || factory == nil {
+		panic("mirror: RegisterBackend needs a scheme and a factory")
+	}
+
+	backends.Lock()
+	defer backends.Unlock()
+	if _, ok := backends.m[scheme]; ok {
+		panic("mirror: RegisterBackend called twice for " + scheme)
+	}
+	backends.m[scheme] = factory
+}
+
+// OpenBackend opens src with the backend of its scheme. ok is false if src isn't a URL, like "scheme://...", then
+// it's a folder on disk. A URL of a scheme that has no backend returns ErrUnknownBackend
+func OpenBackend(src string) (fsys fs.FS, ok bool, err error) {
+	if !strings.Contains(src, backendSeparator) {
+		return nil, false, nil
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, true, err
+	}
+
+	backends.RLock()
+	factory, found := backends.m[strings.ToLower(u.Scheme)]
+	backends.RUnlock()
+	if !found {
+		return nil, true, fmt.Errorf("%w %q", ErrUnknownBackend, src)
+	}
+	fsys, err = factory(u)
+	return fsys, true, err
+}
@@ -0,0 +1,43 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRegisterBackend(t *testing.T) {
+	discardLog(t)
+	var opened *url.URL
+	RegisterBackend("TestFS", func(u *url.URL) (fs.FS, error) {
+		opened = u
+		return fstest.MapFS{"a/b": {Data: []byte("bbb")}}, nil
+	})
+
+	dst := t.TempDir()
+	m, err := New("testfs://host/pool", dst, WithLogFile(os.DevNull))
+	assertError(t, nil, err)
+	assert(t, "host", opened.Host)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assertError(t, nil, m.Copy(context.Background(), p))
+	got, err := os.ReadFile(filepath.Join(dst, "a", "b"))
+	assertError(t, nil, err)
+	assert(t, "bbb", string(got))
+
+	j := &Job{Src: "testfs://host/pool", Dst: dst, Opts: Options{LogPath: os.DevNull, Links: true}}
+	assertError(t, ErrLinksNeedsOSFS, j.Run(context.Background()))
+
+	_, err = New("other://host", dst)
+	assert(t, true, errors.Is(err, ErrUnknownBackend))
+
+	defer func() {
+		assert(t, true, recover() != nil)
+	}()
+	RegisterBackend("testfs", func(u *url.URL) (fs.FS, error) { return nil, nil })
+}
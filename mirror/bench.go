@@ -0,0 +1,176 @@
+package mirror
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	CmdBench             = "bench"
+	BenchFolderPattern   = "mirror-bench-*"
+	BenchSmallFileSize   = 4096
+	BenchChunkSize       = 1 << 20
+	FlagNameBenchFiles   = "files"
+	FlagNameBenchSize    = "size"
+	FlagUsageBenchDst    = "folder whose file system is tested, a temporary folder is made in it and removed afterwards"
+	FlagUsageBenchFiles  = "number of small files"
+	FlagUsageBenchSize   = "size of the large file in MB"
+	ErrBenchWrongArgs    = CustomErr("wrong arguments, use 'bench -h' for help")
+	formatBenchSmall     = "%d small files (%d B): writing %.0f files/s (%s per file), reading %.0f files/s (%s per file)"
+	formatBenchLarge     = "large file (%s MB): writing %.1f MB/s, reading %.1f MB/s"
+	defaultBenchFiles    = 1000
+	defaultBenchSizeInMB = 100
+)
+
+// BenchResult holds durations measured by Bench
+type BenchResult struct {
+	SmallFiles            int
+	SmallWrite, SmallRead time.Duration
+	LargeSize             int64
+	LargeWrite, LargeRead time.Duration
+}
+
+func (r BenchResult) String() string {
+	return fmt.Sprintf(formatBenchSmall, r.SmallFiles, BenchSmallFileSize,
+		perSecond(float64(r.SmallFiles), r.SmallWrite), perItem(r.SmallWrite, r.SmallFiles),
+		perSecond(float64(r.SmallFiles), r.SmallRead), perItem(r.SmallRead, r.SmallFiles)) + "\n" +
+		fmt.Sprintf(formatBenchLarge, BytesToMB(r.LargeSize),
+			perSecond(float64(r.LargeSize)/BytesInMB, r.LargeWrite), perSecond(float64(r.LargeSize)/BytesInMB, r.LargeRead))
+}
+
+// VetBenchFlags parses flags of the bench subcommand and rewrites dst into an absolute path
+func VetBenchFlags(args []string) (dst string, files int, size int64, err error) {
+	fs := flag.NewFlagSet(CmdBench, flag.ExitOnError)
+	dstPath := fs.String(FlagNameDst, "", FlagUsageBenchDst)
+	fs.IntVar(&files, FlagNameBenchFiles, defaultBenchFiles, FlagUsageBenchFiles)
+	sizeInMB := fs.Int64(FlagNameBenchSize, defaultBenchSizeInMB, FlagUsageBenchSize)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *dstPath == "" || files < 1 || *sizeInMB < 1 || fs.NArg() > 0 {
+		err = ErrBenchWrongArgs
+		return
+	}
+
+	if dst, err = filepath.Abs(*dstPath); err != nil {
+		return
+	}
+
+	if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrDstNotFound
+		return
+	}
+
+	size = *sizeInMB * BytesInMB
+	return
+}
+
+// Bench writes and reads many small files and one large file of size bytes in a temporary folder inside dst
+// and measures how long it takes. Reading may be served from the OS cache
+func Bench(dst string, files int, size int64) (res BenchResult, err error) {
+	tmp, err := os.MkdirTemp(dst, BenchFolderPattern)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if errRemove := os.RemoveAll(tmp); err == nil {
+			err = errRemove
+		}
+	}()
+
+	res.SmallFiles, res.LargeSize = files, size
+	data := make([]byte, BenchChunkSize)
+	rand.Read(data)
+
+	start := time.Now()
+	for i := 0; i < files; i++ {
+		if err = os.WriteFile(filepath.Join(tmp, strconv.Itoa(i)), data[:BenchSmallFileSize], FilePerm); err != nil {
+			return
+		}
+	}
+	res.SmallWrite = time.Since(start)
+
+	start = time.Now()
+	for i := 0; i < files; i++ {
+		if _, err = os.ReadFile(filepath.Join(tmp, strconv.Itoa(i))); err != nil {
+			return
+		}
+	}
+	res.SmallRead = time.Since(start)
+
+	large := filepath.Join(tmp, "large")
+	start = time.Now()
+	if err = writeLargeFile(large, data, size); err != nil {
+		return
+	}
+	res.LargeWrite = time.Since(start)
+
+	start = time.Now()
+	if err = readLargeFile(large, data); err != nil {
+		return
+	}
+	res.LargeRead = time.Since(start)
+
+	return
+}
+
+func writeLargeFile(path string, chunk []byte, size int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	for written := int64(0); written < size; {
+		n := int64(len(chunk))
+		if size-written < n {
+			n = size - written
+		}
+		if _, err = f.Write(chunk[:n]); err != nil {
+			f.Close()
+			return err
+		}
+		written += n
+	}
+
+	// without syncing, only the OS cache would be measured
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readLargeFile(path string, buf []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.CopyBuffer(io.Discard, f, buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func perSecond(n float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return n / d.Seconds()
+}
+
+func perItem(d time.Duration, n int) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	return d / time.Duration(n)
+}
@@ -0,0 +1,51 @@
+package mirror
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVetBenchFlags(t *testing.T) {
+	makeTestFolders(t)
+
+	t.Run("with correct flags", func(t *testing.T) {
+		_, files, size, err := VetBenchFlags([]string{"-" + FlagNameDst, dstPathTest, "-" + FlagNameBenchFiles, "5", "-" + FlagNameBenchSize, "2"})
+		assertError(t, nil, err)
+		assert(t, 5, files)
+		assert(t, int64(2*BytesInMB), size)
+	})
+
+	t.Run("without dst", func(t *testing.T) {
+		_, _, _, err := VetBenchFlags(nil)
+		assertError(t, ErrBenchWrongArgs, err)
+	})
+
+	t.Run("with incorrect dst", func(t *testing.T) {
+		_, _, _, err := VetBenchFlags([]string{"-" + FlagNameDst, "aaa"})
+		assertError(t, ErrDstNotFound, err)
+	})
+
+	cleanTestFolders(t)
+}
+
+func TestBench(t *testing.T) {
+	makeTestFolders(t)
+
+	res, err := Bench(dstPathTest, 10, BenchChunkSize+1)
+	assertError(t, nil, err)
+	assert(t, 10, res.SmallFiles)
+	if !strings.Contains(res.String(), "10 small files") {
+		t.Errorf("unexpected result %q", res)
+	}
+
+	items, err := os.ReadDir(dstPathTest)
+	assertError(t, nil, err)
+	for _, item := range items {
+		if strings.HasPrefix(item.Name(), strings.TrimSuffix(BenchFolderPattern, "*")) {
+			t.Errorf("temporary folder %q wasn't removed", item.Name())
+		}
+	}
+
+	cleanTestFolders(t)
+}
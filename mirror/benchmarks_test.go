@@ -0,0 +1,144 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// benchTrees are the synthetic trees the benchmarks run on, files are spread into folders of filesPerFolder files
+var benchTrees = []struct {
+	files, filesPerFolder int
+	size                  int64
+}{
+	{files: 1000, filesPerFolder: 50, size: 1 << 10},
+	{files: 10000, filesPerFolder: 100, size: 1 << 10},
+	{files: 20, filesPerFolder: 10, size: 1 << 20},
+}
+
+func benchName(files int, size int64) string {
+	return fmt.Sprintf("%d files of %s B", files, ThousandSeparator(fmt.Sprint(size)))
+}
+
+// makeBenchTree writes a tree of files of size bytes into root and returns what ReadFolder would find in it
+func makeBenchTree(b *testing.B, root string, files, filesPerFolder int, size int64) (Folder, File) {
+	b.Helper()
+
+	content := make([]byte, size)
+	folders, res := make(Folder), make(File)
+	for i := 0; i < files; i++ {
+		folder := filepath.Join(fmt.Sprintf("folder_%d", i/filesPerFolder/10), fmt.Sprintf("folder_%d", i/filesPerFolder))
+		file := filepath.Join(folder, fmt.Sprintf("file_%d", i))
+
+		if _, ok := folders[folder]; !ok {
+			if err := os.MkdirAll(filepath.Join(root, folder), FolderPerm); err != nil {
+				b.Fatal(err)
+			}
+			folders[folder], folders[filepath.Dir(folder)] = struct{}{}, struct{}{}
+		}
+		if err := os.WriteFile(filepath.Join(root, file), content, FilePerm); err != nil {
+			b.Fatal(err)
+		}
+		res[file] = size
+	}
+	return folders, res
+}
+
+// reportPerFile adds the time spent on one file, so trees of different sizes can be compared
+func reportPerFile(b *testing.B, start time.Time, files int) {
+	b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*files), "ns/file")
+}
+
+// discardLog silences the progress log of the tested functions until the test or benchmark ends
+func discardLog(tb testing.TB) {
+	prev := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() {
+		log.SetOutput(prev)
+	})
+}
+
+func BenchmarkReadFolder(b *testing.B) {
+	for _, tree := range benchTrees {
+		b.Run(benchName(tree.files, tree.size), func(b *testing.B) {
+			root := b.TempDir()
+			makeBenchTree(b, root, tree.files, tree.filesPerFolder, tree.size)
+
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				if _, _, _, err := ReadFolder(root, &Options{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportPerFile(b, start, tree.files)
+		})
+	}
+}
+
+func BenchmarkNewSyncPlan(b *testing.B) {
+	for _, files := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("%d files", files), func(b *testing.B) {
+			// every third file is missing in dst, every fifth one has another size and every seventh one isn't in src
+			srcFolders, dstFolders := make(Folder), make(Folder)
+			srcFiles, dstFiles := make(File), make(File)
+			for i := 0; i < files; i++ {
+				folder := fmt.Sprintf("folder_%d", i/100)
+				file := filepath.Join(folder, fmt.Sprintf("file_%d", i))
+				srcFolders[folder], dstFolders[folder] = struct{}{}, struct{}{}
+
+				switch {
+				case i%7 == 0:
+					dstFiles[file] = 1
+				case i%3 == 0:
+					srcFiles[file] = 1
+				case i%5 == 0:
+					srcFiles[file], dstFiles[file] = 1, 2
+				default:
+					srcFiles[file], dstFiles[file] = 1, 1
+				}
+			}
+
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				NewSyncPlan(dstFolders, srcFolders, dstFiles, srcFiles, nil)
+			}
+			reportPerFile(b, start, files)
+		})
+	}
+}
+
+func BenchmarkCopyFiles(b *testing.B) {
+	for _, tree := range benchTrees {
+		for _, workers := range []int{1, 8} {
+			b.Run(fmt.Sprintf("%s with %d workers", benchName(tree.files, tree.size), workers), func(b *testing.B) {
+				discardLog(b)
+				src, dst := b.TempDir(), b.TempDir()
+				folders, files := makeBenchTree(b, src, tree.files, tree.filesPerFolder, tree.size)
+				if err := MakeFolders(folders, dst, &Options{}); err != nil {
+					b.Fatal(err)
+				}
+				totalSize := TotalSize(files)
+
+				b.SetBytes(totalSize)
+				b.ResetTimer()
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					if err := CopyFiles(files, totalSize, src, dst, &Options{Workers: workers}); err != nil {
+						b.Fatal(err)
+					}
+				}
+				reportPerFile(b, start, tree.files)
+			})
+		}
+	}
+
+	if err := os.Remove(LogFile); err != nil && !os.IsNotExist(err) {
+		b.Fatal(err)
+	}
+}
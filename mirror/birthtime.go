@@ -0,0 +1,7 @@
+package mirror
+
+const (
+	FlagNameBirthTime       = "birth-time"
+	FlagUsageBirthTime      = "copied files keep the creation time of the source (Windows and macOS only)"
+	ErrBirthTimeUnsupported = CustomErr("creation times can't be set on this system")
+)
@@ -0,0 +1,46 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	birthTimeSupported = true
+	// attrBitMapCount and attrCmnCrTime are ATTR_BIT_MAP_COUNT and ATTR_CMN_CRTIME from sys/attr.h
+	attrBitMapCount = 5
+	attrCmnCrTime   = 0x00000200
+)
+
+// attrList is struct attrlist from sys/attr.h
+type attrList struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32
+}
+
+// copyBirthTime sets the creation time of dst to the one of src
+func copyBirthTime(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	created := info.Sys().(*syscall.Stat_t).Birthtimespec
+
+	path, err := syscall.BytePtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	attrs := attrList{bitmapCount: attrBitMapCount, commonAttr: attrCmnCrTime}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETATTRLIST, uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&attrs)),
+		uintptr(unsafe.Pointer(&created)), unsafe.Sizeof(created), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
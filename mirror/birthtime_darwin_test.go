@@ -0,0 +1,11 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func birthTimeOf(info os.FileInfo) time.Time {
+	return time.Unix(info.Sys().(*syscall.Stat_t).Birthtimespec.Unix())
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package mirror
+
+// Linux can read creation times with statx, but there is no way to set them
+const birthTimeSupported = false
+
+func copyBirthTime(src, dst string) error {
+	return ErrBirthTimeUnsupported
+}
@@ -0,0 +1,40 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyBirthTime(t *testing.T) {
+	makeTestFolders(t)
+
+	err := CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest, &Options{BirthTime: true})
+	if !birthTimeSupported {
+		if !errors.Is(err, ErrBirthTimeUnsupported) {
+			t.Errorf("wanted ErrBirthTimeUnsupported, but got %q", err)
+		}
+		cleanTestFolders(t)
+		return
+	}
+	assertError(t, nil, err)
+
+	for file := range missingFiles {
+		want := testBirthTime(t, filepath.Join(srcPathTest, file))
+		if got := testBirthTime(t, filepath.Join(dstPathTest, file)); !got.Equal(want) {
+			t.Errorf("%s: want creation time %v, got %v", file, want, got)
+		}
+	}
+
+	cleanTestFolders(t)
+}
+
+func testBirthTime(t testing.TB, path string) time.Time {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	assertError(t, nil, err)
+	return birthTimeOf(info)
+}
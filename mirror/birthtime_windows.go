@@ -0,0 +1,30 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+)
+
+const birthTimeSupported = true
+
+// copyBirthTime sets the creation time of dst to the one of src
+func copyBirthTime(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	created := info.Sys().(*syscall.Win32FileAttributeData).CreationTime
+
+	path, err := syscall.UTF16PtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(path, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	return syscall.SetFileTime(h, &created, nil, nil)
+}
@@ -0,0 +1,11 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func birthTimeOf(info os.FileInfo) time.Time {
+	return time.Unix(0, info.Sys().(*syscall.Win32FileAttributeData).CreationTime.Nanoseconds())
+}
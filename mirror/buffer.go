@@ -0,0 +1,54 @@
+package mirror
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	FlagNameBufferSize  = "buffer-size"
+	FlagUsageBufferSize = "buffer that files are copied through, e.g. 4MiB, which helps on network file systems. By default files on disk are copied by the system (copy_file_range on Linux) and others through a 1 MiB buffer"
+	ErrBadBufferSize    = CustomErr("the buffer size must be between 4 KiB and 1 GiB")
+	defaultBufferSize   = 1 << 20
+	minBufferSize       = 4 << 10
+	maxBufferSize       = 1 << 30
+)
+
+// bufferPools holds a *sync.Pool of buffers for every buffer size, so workers reuse them instead of making one for
+// every file
+var bufferPools sync.Map
+
+// VetBufferSize checks if size can be a copy buffer, 0 is the default
+func VetBufferSize(size Size) error {
+	if size != 0 && (size < minBufferSize || size > maxBufferSize) {
+		return ErrBadBufferSize
+	}
+	return nil
+}
+
+// copyBuffered copies r into w through a pooled buffer of size bytes, defaultBufferSize if it's 0
+func copyBuffered(w io.Writer, r io.Reader, size Size) (int64, error) {
+	if size == 0 {
+		size = defaultBufferSize
+	}
+	p, _ := bufferPools.LoadOrStore(size, &sync.Pool{New: func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}})
+	pool := p.(*sync.Pool)
+	buf := pool.Get().(*[]byte)
+	defer pool.Put(buf)
+
+	// without ReadFrom, io.CopyBuffer can't skip the buffer
+	return io.CopyBuffer(struct{ io.Writer }{w}, r, *buf)
+}
+
+// writeTo copies r into d. A file on disk is copied by the system if size is 0, see FlagUsageBufferSize, everything
+// else through a buffer
+func writeTo(d *os.File, r io.Reader, size Size) (int64, error) {
+	if _, ok := r.(*os.File); ok && size == 0 {
+		return io.Copy(d, r)
+	}
+	return copyBuffered(d, r, size)
+}
@@ -0,0 +1,47 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestVetBufferSize(t *testing.T) {
+	assertError(t, nil, VetBufferSize(0))
+	assertError(t, nil, VetBufferSize(4<<20))
+	assertError(t, ErrBadBufferSize, VetBufferSize(10))
+	assertError(t, ErrBadBufferSize, VetBufferSize(2<<30))
+}
+
+func TestWriteFileBuffered(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	src := filepath.Join(t.TempDir(), "src")
+	assertError(t, nil, os.WriteFile(src, data, FilePerm))
+
+	for _, size := range []Size{0, minBufferSize} {
+		for name, open := range map[string]func(t *testing.T) io.Reader{
+			"file": func(t *testing.T) io.Reader {
+				f, err := os.Open(src)
+				assertError(t, nil, err)
+				t.Cleanup(func() { f.Close() })
+				return f
+			},
+			"reader": func(t *testing.T) io.Reader {
+				return iotest.HalfReader(bytes.NewReader(data))
+			},
+		} {
+			dst := filepath.Join(t.TempDir(), "dst")
+			written, err := writeFile(open(t), dst, size)
+			assertError(t, nil, err)
+			assert(t, int64(len(data)), written)
+			got, err := os.ReadFile(dst)
+			assertError(t, nil, err)
+			if !bytes.Equal(data, got) {
+				t.Errorf("%s with a buffer of %d: the copy differs", name, size)
+			}
+		}
+	}
+}
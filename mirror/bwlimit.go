@@ -0,0 +1,82 @@
+package mirror
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	FlagNameBWLimit  = "bwlimit"
+	FlagUsageBWLimit = "bytes per second that all workers together may read from src, e.g. 50M, 0 turns it off"
+	// bwBurst is how long the limit may be used up at once after a pause, so short reads don't wait every time
+	bwBurst = 100 * time.Millisecond
+	// minBWBurst keeps the bucket of a low limit big enough for a read
+	minBWBurst = 32 << 10
+)
+
+// limiterInit guards the lazy creation of Options.limiter
+var limiterInit sync.Mutex
+
+// rateLimiter is a token bucket that all copies of a run share. A read that takes more than there is goes into
+// debt, the next reads wait until it's paid off
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond Size) *rateLimiter {
+	rate := float64(bytesPerSecond)
+	burst := rate * bwBurst.Seconds()
+	if burst < minBWBurst {
+		burst = minBWBurst
+	}
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes n bytes from the bucket and sleeps until they're covered
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+type limitedReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (r limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.l.wait(n)
+	return n, err
+}
+
+// limit returns r, which reads from the source, limited to o.BWLimit. r itself is returned if there is no limit
+func (o *Options) limit(r io.Reader) io.Reader {
+	if o.BWLimit <= 0 {
+		return r
+	}
+
+	limiterInit.Lock()
+	if o.limiter == nil {
+		o.limiter = newRateLimiter(o.BWLimit)
+	}
+	limiterInit.Unlock()
+	return limitedReader{r: r, l: o.limiter}
+}
@@ -0,0 +1,30 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimit(t *testing.T) {
+	r := bytes.NewReader(nil)
+	opts := &Options{}
+	if opts.limit(r) != io.Reader(r) {
+		t.Error("a reader without a limit was wrapped")
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 40000)
+	opts.BWLimit = 1 << 20
+	start := time.Now()
+	got, err := io.ReadAll(opts.limit(bytes.NewReader(data)))
+	assertError(t, nil, err)
+	if !bytes.Equal(data, got) {
+		t.Error("the limited reader changed the data")
+	}
+	// the bucket is full at the start, the rest takes its time
+	min := time.Duration((float64(len(data)) - opts.limiter.burst) / float64(opts.BWLimit) * float64(time.Second))
+	if took := time.Since(start); took < min*9/10 {
+		t.Errorf("%d B were read in %v with a limit of %d B/s", len(data), took, opts.BWLimit)
+	}
+}
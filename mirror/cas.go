@@ -0,0 +1,392 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CmdRestore            = "restore"
+	CASObjects            = "objects"
+	CASManifests          = "manifests"
+	CASManifestExt        = ".json"
+	FlagNameManifest      = "manifest"
+	FlagUsageRestoreSrc   = "folder made with the -cas flag"
+	FlagUsageRestoreDst   = "folder the tree is restored to"
+	FlagUsageManifest     = "name of the manifest that is restored, the latest one by default"
+	ErrRestoreWrongArgs   = CustomErr("wrong arguments, use 'restore -h' for help")
+	ErrRestoreNotEmpty    = CustomErr("the folder a tree is restored to has to be empty")
+	ErrNoManifest         = CustomErr("there is no manifest in the CAS folder")
+	ErrCASCleaning        = CustomErr("the -cas flag can't be used together with the -c flag")
+	ErrCASCorrupted       = CustomErr("an object doesn't match its hash:")
+	LogStoredObjects      = "files stored as new objects:"
+	LogRestoredFiles      = "files restored:"
+	MsgProgressStoring    = "storing files:"
+	MsgProgressRestoring  = "restoring files:"
+	casManifestTimeFormat = "20060102T150405.000000000Z"
+	casTempPattern        = ".tmp-*"
+)
+
+// Manifest describes the tree of one run in the CAS layout. Paths use forward slashes
+type Manifest struct {
+	// Schema is SchemaManifest, it's set when the manifest is written
+	Schema  int       `json:"schema"`
+	Time    time.Time `json:"time"`
+	Folders []string  `json:"folders"`
+	// Files maps paths to SHA-256 hashes of their content
+	Files map[string]string `json:"files"`
+}
+
+// VetRestoreFlags parses flags of the restore subcommand, rewrites src and dst into absolute paths and checks that dst is empty
+func VetRestoreFlags(args []string) (src, dst, manifest string, err error) {
+	fs := flag.NewFlagSet(CmdRestore, flag.ExitOnError)
+	srcPath := fs.String(FlagNameSrc, "", FlagUsageRestoreSrc)
+	dstPath := fs.String(FlagNameDst, "", FlagUsageRestoreDst)
+	fs.StringVar(&manifest, FlagNameManifest, "", FlagUsageManifest)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *srcPath == "" || *dstPath == "" || fs.NArg() > 0 {
+		err = ErrRestoreWrongArgs
+		return
+	}
+
+	if src, err = filepath.Abs(*srcPath); err != nil {
+		return
+	}
+	if dst, err = filepath.Abs(*dstPath); err != nil {
+		return
+	}
+
+	if f, errF := os.Stat(filepath.Join(src, CASManifests)); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrSrcNotFound
+		return
+	}
+
+	if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrDstNotFound
+		return
+	}
+
+	// restoring never overwrites anything
+	entries, err := os.ReadDir(dst)
+	if err == nil && len(entries) > 0 {
+		err = ErrRestoreNotEmpty
+	}
+	return
+}
+
+// CASStore stores files from src in dst/objects under their SHA-256 hash and writes a manifest of folders and files
+// into dst/manifests. Files whose object already exists aren't copied again. It returns the path of the manifest
+func CASStore(folders Folder, files File, totalSize int64, src, dst string, opts *Options) (manifest string, err error) {
+	var bytesRead, recentlyLoggedProgress int64
+
+	l, err := initLogFile(opts)
+	if err != nil {
+		return
+	}
+
+	LogToFile(l, LogStoredObjects+"\n")
+	log.Println(MsgProgressStoring, ZeroPercent)
+
+	m := Manifest{Time: time.Now().UTC(), Folders: []string{}, Files: make(map[string]string, len(files))}
+	for _, folder := range sortFoldersOrFiles(folders) {
+		m.Folders = append(m.Folders, filepath.ToSlash(folder))
+	}
+
+	for _, file := range sortFoldersOrFiles(files) {
+		if opts.stopped() {
+			return "", closeStoppedLog(l)
+		}
+
+		sum, stored, err := storeObject(filepath.Join(src, file), dst, opts.TempDir)
+		if err != nil && vanished(OSFS(src), fsName(file), err) {
+			opts.Report.Vanished = append(opts.Report.Vanished, file)
+			totalSize -= files[file]
+			LogToFile(l, LogVanished+file)
+			continue
+		}
+		if err != nil {
+			if !opts.ignoreErr(file, err) {
+				l.Close()
+				return "", err
+			}
+			continue
+		}
+		m.Files[filepath.ToSlash(file)] = sum
+		bytesRead += files[file]
+
+		logProgressFiles(&recentlyLoggedProgress, totalSize, bytesRead, MsgProgressStoring)
+		opts.sendProgress(PhaseCopyingFiles, bytesRead, totalSize)
+
+		if stored {
+			LogToFile(l, file)
+		}
+	}
+
+	if err = l.Close(); err != nil {
+		return
+	}
+
+	return writeManifest(dst, m)
+}
+
+// CASRestore copies the tree described by manifest from the CAS folder src into dst and checks hashes of the objects.
+// If manifest is empty, the latest one is restored
+func CASRestore(src, manifest, dst string, opts *Options) error {
+	var recentlyLoggedProgress int64
+
+	if manifest == "" {
+		var err error
+		if manifest, err = LatestManifest(src); err != nil {
+			return err
+		}
+	}
+
+	m, err := readManifest(filepath.Join(src, CASManifests, manifest))
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range m.Folders {
+		if err = os.MkdirAll(filepath.Join(dst, filepath.FromSlash(folder)), FolderPerm); err != nil {
+			return err
+		}
+	}
+
+	files := make([]string, 0, len(m.Files))
+	for file := range m.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	l, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(l, LogRestoredFiles+"\n")
+	log.Println(MsgProgressRestoring, ZeroPercent)
+
+	for i, file := range files {
+		if opts.stopped() {
+			return closeStoppedLog(l)
+		}
+
+		path := filepath.FromSlash(file)
+		if err = os.MkdirAll(filepath.Join(dst, filepath.Dir(path)), FolderPerm); err != nil {
+			l.Close()
+			return err
+		}
+
+		if err = restoreObject(objectPath(src, m.Files[file]), m.Files[file], filepath.Join(dst, path)); err != nil {
+			if !opts.ignoreErr(path, err) {
+				l.Close()
+				return err
+			}
+			continue
+		}
+
+		logProgressFiles(&recentlyLoggedProgress, int64(len(files)), int64(i+1), MsgProgressRestoring)
+		opts.sendProgress(PhaseCopyingFiles, int64(i+1), int64(len(files)))
+
+		LogToFile(l, path)
+	}
+
+	return l.Close()
+}
+
+// LatestManifest returns the name of the newest manifest in the CAS folder path
+func LatestManifest(path string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(path, CASManifests))
+	if err != nil {
+		return "", err
+	}
+
+	// names start with the time of the run, so the last one in the sorted list is the newest
+	var latest string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), CASManifestExt) {
+			latest = e.Name()
+		}
+	}
+
+	if latest == "" {
+		return "", ErrNoManifest
+	}
+	return latest, nil
+}
+
+func objectPath(cas, sum string) string {
+	return filepath.Join(cas, CASObjects, sum[:2], sum)
+}
+
+// storeObject hashes src and copies it into the CAS folder if its object doesn't exist yet. The file is copied
+// into a temporary file in tempDir (or in the objects folder if it's empty) first, so an interrupted run doesn't
+// leave a broken object behind
+func storeObject(src, cas, tempDir string) (sum string, stored bool, err error) {
+	if sum, err = hashFile(src); err != nil {
+		return
+	}
+	if _, err = os.Stat(objectPath(cas, sum)); err == nil {
+		return
+	}
+
+	objects := filepath.Join(cas, CASObjects)
+	if err = os.MkdirAll(objects, FolderPerm); err != nil {
+		return
+	}
+
+	if tempDir == "" {
+		tempDir = objects
+	}
+	tmp, err := os.CreateTemp(tempDir, casTempPattern)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	s, err := os.Open(src)
+	if err != nil {
+		tmp.Close()
+		return
+	}
+	defer s.Close()
+
+	// the file may have changed since it was hashed, so the hash of what was actually copied is used
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, h), s); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	sum = hex.EncodeToString(h.Sum(nil))
+	if err = os.MkdirAll(filepath.Dir(objectPath(cas, sum)), FolderPerm); err != nil {
+		return
+	}
+	if err = renameOrCopy(tmp.Name(), objectPath(cas, sum)); err != nil {
+		return
+	}
+	return sum, true, nil
+}
+
+func restoreObject(object, sum, dst string) (err error) {
+	s, err := os.Open(object)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+
+	d, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(d, h), s); err != nil {
+		d.Close()
+		return
+	}
+	if err = d.Close(); err != nil {
+		return
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("%w %s", ErrCASCorrupted, object)
+	}
+	return
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// hashReader returns the hex encoded SHA-256 of everything read from r
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeManifest(cas string, m Manifest) (string, error) {
+	folder := filepath.Join(cas, CASManifests)
+	if err := os.MkdirAll(folder, FolderPerm); err != nil {
+		return "", err
+	}
+
+	m.Schema = SchemaManifest
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(folder, m.Time.Format(casManifestTimeFormat)+CASManifestExt)
+	return path, os.WriteFile(path, data, FilePerm)
+}
+
+// readManifest reads the manifest at path and returns ErrCASCorrupted if one of its paths leaves the tree or one of
+// its hashes isn't a SHA-256
+func readManifest(path string) (m Manifest, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = decodeVersioned(data, manifestSchema, &m); err != nil {
+		return
+	}
+
+	for _, folder := range m.Folders {
+		if !insideTree(folder) {
+			return m, fmt.Errorf("%w %s: path %q is outside of the tree", ErrCASCorrupted, path, folder)
+		}
+	}
+	for file, sum := range m.Files {
+		if !insideTree(file) {
+			return m, fmt.Errorf("%w %s: path %q is outside of the tree", ErrCASCorrupted, path, file)
+		}
+		if !isSHA256(sum) {
+			return m, fmt.Errorf("%w %s: %q of %q isn't a SHA-256", ErrCASCorrupted, path, sum, file)
+		}
+	}
+	return
+}
+
+// insideTree returns true if the manifest path p, with forward slashes, names something inside the tree
+func insideTree(p string) bool {
+	path := filepath.Clean(filepath.FromSlash(p))
+	if p == "" || path == "." || filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(p, "/") {
+		return false
+	}
+	return path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
+
+// isSHA256 returns true if sum is a hex encoded SHA-256
+func isSHA256(sum string) bool {
+	if len(sum) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCAS(t *testing.T) {
+	makeTestFolders(t)
+
+	cas, restored := t.TempDir(), t.TempDir()
+
+	first, err := CASStore(srcFolders, srcFiles, 4, srcPathTest, cas, &Options{})
+	assertError(t, nil, err)
+
+	objects := countObjects(t, cas)
+	assert(t, len(srcFiles), objects)
+
+	t.Run("unchanged files aren't stored again", func(t *testing.T) {
+		second, err := CASStore(srcFolders, srcFiles, 4, srcPathTest, cas, &Options{})
+		assertError(t, nil, err)
+		assert(t, objects, countObjects(t, cas))
+
+		latest, err := LatestManifest(cas)
+		assertError(t, nil, err)
+		assert(t, filepath.Base(second), latest)
+		if first == second {
+			t.Errorf("both runs wrote the manifest %q", first)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		err := CASRestore(cas, filepath.Base(first), restored, &Options{})
+		assertError(t, nil, err)
+
+		folders, files, _, err := ReadFolder(restored, &Options{})
+		assertError(t, nil, err)
+		assert(t, srcFolders, folders)
+		assert(t, srcFiles, files)
+	})
+
+	t.Run("restore of a corrupted object", func(t *testing.T) {
+		sum, err := hashFile(filepath.Join(srcPathTest, "_same_1"))
+		assertError(t, nil, err)
+		err = os.WriteFile(objectPath(cas, sum), []byte("x"), FilePerm)
+		assertError(t, nil, err)
+
+		err = CASRestore(cas, "", t.TempDir(), &Options{})
+		if !errors.Is(err, ErrCASCorrupted) {
+			t.Errorf("wanted ErrCASCorrupted, but got %q", err)
+		}
+	})
+
+	cleanTestFolders(t)
+}
+
+func TestRestoreBadManifest(t *testing.T) {
+	discardLog(t)
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "path outside of the tree", data: `{"schema":1,"time":"2024-05-01T10:00:00Z","folders":[],"files":{"../escape":"` + sum + `"}}`},
+		{name: "absolute path", data: `{"schema":1,"time":"2024-05-01T10:00:00Z","folders":[],"files":{"/escape":"` + sum + `"}}`},
+		{name: "folder outside of the tree", data: `{"schema":1,"time":"2024-05-01T10:00:00Z","folders":["a/../.."],"files":{}}`},
+		{name: "short hash", data: `{"schema":1,"time":"2024-05-01T10:00:00Z","folders":[],"files":{"x":"a"}}`},
+		{name: "hash that isn't hex", data: `{"schema":1,"time":"2024-05-01T10:00:00Z","folders":[],"files":{"x":"` + strings.Repeat("zz", 32) + `"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cas, dst := t.TempDir(), t.TempDir()
+			assertError(t, nil, os.Mkdir(filepath.Join(cas, CASManifests), FolderPerm))
+			assertError(t, nil, os.WriteFile(filepath.Join(cas, CASManifests, "m.json"), []byte(test.data), FilePerm))
+
+			err := CASRestore(cas, "", dst, &Options{LogPath: os.DevNull})
+			assert(t, true, errors.Is(err, ErrCASCorrupted))
+			_, err = ChangedSince(t.TempDir(), cas, "", &Options{})
+			assert(t, true, errors.Is(err, ErrCASCorrupted))
+		})
+	}
+}
+
+func TestVetRestoreFlags(t *testing.T) {
+	cas := t.TempDir()
+	err := os.Mkdir(filepath.Join(cas, CASManifests), FolderPerm)
+	assertError(t, nil, err)
+
+	t.Run("with correct flags", func(t *testing.T) {
+		_, _, manifest, err := VetRestoreFlags([]string{"-" + FlagNameSrc, cas, "-" + FlagNameDst, t.TempDir(), "-" + FlagNameManifest, "m.json"})
+		assertError(t, nil, err)
+		assert(t, "m.json", manifest)
+	})
+
+	t.Run("without src", func(t *testing.T) {
+		_, _, _, err := VetRestoreFlags([]string{"-" + FlagNameDst, t.TempDir()})
+		assertError(t, ErrRestoreWrongArgs, err)
+	})
+
+	t.Run("with a src that isn't a CAS", func(t *testing.T) {
+		_, _, _, err := VetRestoreFlags([]string{"-" + FlagNameSrc, t.TempDir(), "-" + FlagNameDst, t.TempDir()})
+		assertError(t, ErrSrcNotFound, err)
+	})
+
+	t.Run("with a dst that isn't empty", func(t *testing.T) {
+		_, _, _, err := VetRestoreFlags([]string{"-" + FlagNameSrc, cas, "-" + FlagNameDst, cas})
+		assertError(t, ErrRestoreNotEmpty, err)
+	})
+}
+
+func TestLatestManifest(t *testing.T) {
+	_, err := LatestManifest(t.TempDir())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wanted os.ErrNotExist, but got %q", err)
+	}
+
+	cas := t.TempDir()
+	err = os.Mkdir(filepath.Join(cas, CASManifests), FolderPerm)
+	assertError(t, nil, err)
+	_, err = LatestManifest(cas)
+	assertError(t, ErrNoManifest, err)
+}
+
+func countObjects(t testing.TB, cas string) (n int) {
+	t.Helper()
+
+	err := filepath.WalkDir(filepath.Join(cas, CASObjects), func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	assertError(t, nil, err)
+	return
+}
@@ -0,0 +1,302 @@
+package mirror
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	CmdChanges              = "changes"
+	FlagNameRecordManifest  = "record-manifest"
+	FlagUsageRecordManifest = "record the hashes of the files in dst after the run, so 'changes' can compare src with them. Files the run didn't write are hashed only by the first run with this flag"
+	FlagUsageChangesSrc     = "folder that is compared with the manifest"
+	FlagUsageChangesDst     = "destination of runs with -" + FlagNameRecordManifest + ", or a folder made with the -cas flag"
+	FlagUsageChangesMan     = "name of the manifest of a -cas folder that src is compared with, the latest one by default"
+	ErrChangesWrongArgs     = CustomErr("wrong arguments, use 'changes -h' for help")
+	ChangesHeaderNew        = "new"
+	ChangesHeaderModified   = "modified"
+	ChangesHeaderDeleted    = "deleted"
+)
+
+// Changes lists what changed in a tree since a run stored it with CASStore or recorded it with WriteRunManifest.
+// Paths use forward slashes and folders end with a slash
+type Changes struct {
+	New      []string `json:"new"`
+	Modified []string `json:"modified"`
+	Deleted  []string `json:"deleted"`
+}
+
+// VetChangesFlags parses flags of the changes subcommand and rewrites src and dst into absolute paths
+func VetChangesFlags(args []string) (src, dst, manifest, format string, err error) {
+	fs := flag.NewFlagSet(CmdChanges, flag.ExitOnError)
+	srcPath := fs.String(FlagNameSrc, "", FlagUsageChangesSrc)
+	dstPath := fs.String(FlagNameDst, "", FlagUsageChangesDst)
+	fs.StringVar(&manifest, FlagNameManifest, "", FlagUsageChangesMan)
+	fs.StringVar(&format, FlagNameDiffFormat, DiffFormatText, FlagUsageDiffFmt)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *srcPath == "" || *dstPath == "" || fs.NArg() > 0 {
+		err = ErrChangesWrongArgs
+		return
+	}
+	if format != DiffFormatText && format != DiffFormatJSON && format != DiffFormatCSV {
+		err = ErrUnknownDiffFmt
+		return
+	}
+
+	if src, err = filepath.Abs(*srcPath); err != nil {
+		return
+	}
+	if dst, err = filepath.Abs(*dstPath); err != nil {
+		return
+	}
+
+	if f, errF := os.Stat(src); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrSrcNotFound
+		return
+	}
+	if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrDstNotFound
+	}
+	return
+}
+
+// ChangedSince compares src with the manifest of the last successful run into dst, see WriteRunManifest. If dst has
+// none or manifest isn't empty, dst is a CAS folder and src is compared with manifest in it, the latest one if
+// manifest is empty. Nothing is written. A file is modified if its size differs from the size of its copy in dst or
+// of its object or, when the sizes are the same, if its hash differs, so files of the same size are read
+func ChangedSince(src, dst, manifest string, opts *Options) (c Changes, err error) {
+	m, fromRun, err := changesManifest(dst, manifest)
+	if err != nil {
+		return
+	}
+
+	folders, files, _, err := ReadFolder(src, opts)
+	if err != nil {
+		return
+	}
+	DropUnreadable(opts.Report.Unreadable, folders, files)
+	if fromRun {
+		// a run manifest only has files, so only the folders that hold files can be compared
+		folders = parentFolders(sortFoldersOrFiles(files))
+	}
+
+	c = Changes{New: []string{}, Modified: []string{}, Deleted: []string{}}
+	stored := make(map[string]struct{}, len(m.Folders))
+	for _, folder := range m.Folders {
+		stored[folder] = struct{}{}
+		if _, ok := folders[filepath.FromSlash(folder)]; !ok {
+			c.Deleted = append(c.Deleted, folder+diffFolderSuffix)
+		}
+	}
+	for _, folder := range sortFoldersOrFiles(folders) {
+		if _, ok := stored[filepath.ToSlash(folder)]; !ok {
+			c.New = append(c.New, filepath.ToSlash(folder)+diffFolderSuffix)
+		}
+	}
+
+	for file := range m.Files {
+		if _, ok := files[filepath.FromSlash(file)]; !ok {
+			c.Deleted = append(c.Deleted, file)
+		}
+	}
+	for _, file := range sortFoldersOrFiles(files) {
+		if opts.stopped() {
+			return c, ErrStopped
+		}
+
+		name := filepath.ToSlash(file)
+		sum, ok := m.Files[name]
+		if !ok {
+			c.New = append(c.New, name)
+			continue
+		}
+
+		copyPath := filepath.Join(dst, file)
+		if !fromRun {
+			copyPath = objectPath(dst, sum)
+		}
+		modified, err := fileChanged(filepath.Join(src, file), files[file], copyPath, sum)
+		if err != nil {
+			if !opts.ignoreErr(file, err) {
+				return c, err
+			}
+			continue
+		}
+		if modified {
+			c.Modified = append(c.Modified, name)
+		}
+	}
+
+	sort.Strings(c.New)
+	sort.Strings(c.Modified)
+	sort.Strings(c.Deleted)
+	return
+}
+
+// changesManifest returns the manifest that ChangedSince compares with, and true if it's the one of a run into dst
+func changesManifest(dst, manifest string) (m Manifest, fromRun bool, err error) {
+	if manifest == "" {
+		sums, err := readSums(RunManifestPath(dst))
+		if err == nil {
+			var files []string
+			for file := range sums {
+				files = append(files, filepath.FromSlash(file))
+			}
+			m = Manifest{Files: sums}
+			for _, folder := range sortFoldersOrFiles(parentFolders(files)) {
+				m.Folders = append(m.Folders, filepath.ToSlash(folder))
+			}
+			return m, true, nil
+		}
+		if !os.IsNotExist(err) {
+			return m, false, err
+		}
+		if manifest, err = LatestManifest(dst); err != nil {
+			return m, false, err
+		}
+	}
+
+	m, err = readManifest(filepath.Join(dst, CASManifests, manifest))
+	return m, false, err
+}
+
+// parentFolders returns every folder that holds one of files
+func parentFolders(files []string) Folder {
+	res := make(Folder)
+	for _, file := range files {
+		for dir := filepath.Dir(file); dir != "."; dir = filepath.Dir(dir) {
+			res[dir] = struct{}{}
+		}
+	}
+	return res
+}
+
+// fileChanged returns true if the file path of size doesn't match sum, stored is the copy of the file that sum was
+// taken from
+func fileChanged(path string, size int64, stored, sum string) (bool, error) {
+	// a copy that is missing doesn't say anything about the size, the hash still does
+	if f, err := os.Stat(stored); err == nil && f.Size() != size {
+		return true, nil
+	}
+
+	got, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	return got != sum, nil
+}
+
+// RunManifestPath returns where the manifest of the last successful run into dst is, see WriteRunManifest
+func RunManifestPath(dst string) string {
+	return filepath.Join(dst, MetaFolder, SumsFile)
+}
+
+// TakeRunManifest reads the manifest of the last successful run into dst and removes it, so a run that doesn't
+// finish leaves none behind. It returns nil if there is none. The hashes go to WriteRunManifest once the run finished
+func TakeRunManifest(dst string) (map[string]string, error) {
+	path := RunManifestPath(dst)
+	sums, err := readSums(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sums, os.Remove(path)
+}
+
+// WriteRunManifest writes the SHA-256 hashes of the files in dst into RunManifestPath after a successful run of p, in
+// the format of SumsFile with paths relative to dst. A file that p didn't write keeps its hash from prev, see
+// TakeRunManifest, the others are hashed, so only the first run reads every file of dst
+func WriteRunManifest(dst string, prev map[string]string, p SyncPlan, opts *Options) error {
+	_, files, _, err := ReadFolder(dst, opts)
+	if err != nil {
+		return err
+	}
+	DropUnreadable(opts.Report.Unreadable, nil, files)
+
+	written := make(map[string]struct{}, len(p.MissingFiles)+len(p.HardLinks)+len(p.Renames))
+	for file := range p.MissingFiles {
+		written[file] = struct{}{}
+	}
+	for file := range p.HardLinks {
+		written[file] = struct{}{}
+	}
+	for file := range p.Renames {
+		written[file] = struct{}{}
+	}
+
+	var b strings.Builder
+	for _, file := range sortFoldersOrFiles(files) {
+		if opts.stopped() {
+			return ErrStopped
+		}
+
+		name := filepath.ToSlash(file)
+		sum, ok := prev[name]
+		if _, w := written[file]; !ok || w {
+			if sum, err = hashFile(filepath.Join(dst, file)); err != nil {
+				if vanished(OSFS(dst), fsName(file), err) || opts.ignoreErr(file, err) {
+					continue
+				}
+				return err
+			}
+		}
+		fmt.Fprintf(&b, formatSumsLine, sum, name)
+	}
+
+	if err = os.MkdirAll(filepath.Join(dst, MetaFolder), FolderPerm); err != nil {
+		return err
+	}
+	return os.WriteFile(RunManifestPath(dst), []byte(b.String()), FilePerm)
+}
+
+// Empty returns true if nothing changed
+func (c Changes) Empty() bool {
+	return len(c.New) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// Write writes c into w in format (DiffFormatText, DiffFormatJSON or DiffFormatCSV). Text and CSV have a column
+// for each list
+func (c Changes) Write(w io.Writer, format string) error {
+	switch format {
+	case DiffFormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		return e.Encode(c)
+	case DiffFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(c.rows()); err != nil {
+			return err
+		}
+		return cw.Error()
+	case DiffFormatText:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, row := range c.rows() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", row[0], row[1], row[2])
+		}
+		return tw.Flush()
+	default:
+		return ErrUnknownDiffFmt
+	}
+}
+
+func (c Changes) rows() [][]string {
+	rows := [][]string{{ChangesHeaderNew, ChangesHeaderModified, ChangesHeaderDeleted}}
+	for i := 0; i < len(c.New) || i < len(c.Modified) || i < len(c.Deleted); i++ {
+		rows = append(rows, []string{item(c.New, i), item(c.Modified, i), item(c.Deleted, i)})
+	}
+	return rows
+}
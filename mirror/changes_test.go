@@ -0,0 +1,153 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangedSince(t *testing.T) {
+	discardLog(t)
+	src, cas := t.TempDir(), t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(src, filepath.FromSlash(name))
+		assertError(t, nil, os.MkdirAll(filepath.Dir(path), FolderPerm))
+		assertError(t, nil, os.WriteFile(path, []byte(data), FilePerm))
+	}
+
+	write("same", "a")
+	write("edited", "abc")
+	write("grown", "a")
+	write("gone/file", "a")
+	write("kept/file", "a")
+
+	folders, files, _, err := ReadFolder(src, &Options{})
+	assertError(t, nil, err)
+	_, err = CASStore(folders, files, TotalSize(files), src, cas, &Options{LogPath: os.DevNull})
+	assertError(t, nil, err)
+
+	c, err := ChangedSince(src, cas, "", &Options{})
+	assertError(t, nil, err)
+	assert(t, true, c.Empty())
+
+	write("edited", "xyz")
+	write("grown", "abc")
+	write("kept/new", "a")
+	write("added/file", "a")
+	assertError(t, nil, os.RemoveAll(filepath.Join(src, "gone")))
+
+	c, err = ChangedSince(src, cas, "", &Options{})
+	assertError(t, nil, err)
+	assert(t, Changes{
+		New:      []string{"added/", "added/file", "kept/new"},
+		Modified: []string{"edited", "grown"},
+		Deleted:  []string{"gone/", "gone/file"},
+	}, c)
+
+	t.Run("unknown manifest", func(t *testing.T) {
+		_, err := ChangedSince(src, cas, "missing.json", &Options{})
+		assert(t, true, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("without a manifest", func(t *testing.T) {
+		_, err := ChangedSince(src, t.TempDir(), "", &Options{})
+		assert(t, true, errors.Is(err, os.ErrNotExist))
+	})
+}
+
+func TestChangedSinceRun(t *testing.T) {
+	discardLog(t)
+	src, dst := t.TempDir(), t.TempDir()
+	write := func(root, name, data string) {
+		t.Helper()
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assertError(t, nil, os.MkdirAll(filepath.Dir(path), FolderPerm))
+		assertError(t, nil, os.WriteFile(path, []byte(data), FilePerm))
+	}
+
+	write(src, "same", "a")
+	write(src, "edited", "abc")
+	write(src, "gone/file", "a")
+	assertError(t, nil, os.Mkdir(filepath.Join(src, "empty"), FolderPerm))
+
+	j := Job{Src: src, Dst: dst, Sync: true}
+	assertError(t, nil, j.Run(context.Background()))
+	prev, err := TakeRunManifest(dst)
+	assertError(t, nil, err)
+	assert(t, map[string]string(nil), prev)
+	assertError(t, nil, WriteRunManifest(dst, nil, SyncPlan{}, &Options{}))
+
+	c, err := ChangedSince(src, dst, "", &Options{})
+	assertError(t, nil, err)
+	assert(t, true, c.Empty())
+
+	write(src, "edited", "xyz")
+	write(src, "added/file", "a")
+	assertError(t, nil, os.RemoveAll(filepath.Join(src, "gone")))
+
+	c, err = ChangedSince(src, dst, "", &Options{})
+	assertError(t, nil, err)
+	assert(t, Changes{
+		New:      []string{"added/", "added/file"},
+		Modified: []string{"edited"},
+		Deleted:  []string{"gone/", "gone/file"},
+	}, c)
+
+	t.Run("files that weren't written keep their hashes", func(t *testing.T) {
+		prev, err := TakeRunManifest(dst)
+		assertError(t, nil, err)
+		_, err = os.Stat(RunManifestPath(dst))
+		assert(t, true, os.IsNotExist(err))
+
+		// same is changed behind the back of the runs, the manifest still has what the last run wrote
+		write(dst, "same", "b")
+		write(dst, "edited", "xyz")
+		assertError(t, nil, WriteRunManifest(dst, prev, SyncPlan{MissingFiles: File{"edited": 3}}, &Options{}))
+
+		sums, err := readSums(RunManifestPath(dst))
+		assertError(t, nil, err)
+		assert(t, prev["same"], sums["same"])
+		want, err := hashFile(filepath.Join(dst, "edited"))
+		assertError(t, nil, err)
+		assert(t, want, sums["edited"])
+	})
+}
+
+func TestVetChangesFlags(t *testing.T) {
+	cas := t.TempDir()
+	assertError(t, nil, os.Mkdir(filepath.Join(cas, CASManifests), FolderPerm))
+
+	tests := []struct {
+		name     string
+		args     []string
+		manifest string
+		err      error
+	}{
+		{name: "with correct flags", args: []string{"-" + FlagNameSrc, t.TempDir(), "-" + FlagNameDst, cas, "-" + FlagNameManifest, "m.json"}, manifest: "m.json"},
+		{name: "without dst", args: []string{"-" + FlagNameSrc, t.TempDir()}, err: ErrChangesWrongArgs},
+		{name: "with an unknown format", args: []string{"-" + FlagNameSrc, t.TempDir(), "-" + FlagNameDst, cas, "-" + FlagNameDiffFormat, "xml"}, err: ErrUnknownDiffFmt},
+		{name: "with a missing dst", args: []string{"-" + FlagNameSrc, t.TempDir(), "-" + FlagNameDst, filepath.Join(cas, "missing")}, err: ErrDstNotFound},
+		{name: "with a missing src", args: []string{"-" + FlagNameSrc, filepath.Join(cas, "missing"), "-" + FlagNameDst, cas}, err: ErrSrcNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, manifest, _, err := VetChangesFlags(test.args)
+			assertError(t, test.err, err)
+			assert(t, test.manifest, manifest)
+		})
+	}
+}
+
+func TestChangesWrite(t *testing.T) {
+	c := Changes{New: []string{"a", "b/"}, Modified: []string{"c"}, Deleted: []string{}}
+
+	var b bytes.Buffer
+	assertError(t, nil, c.Write(&b, DiffFormatCSV))
+	assert(t, "new,modified,deleted\na,c,\nb/,,\n", b.String())
+
+	assertError(t, ErrUnknownDiffFmt, c.Write(&b, "xml"))
+}
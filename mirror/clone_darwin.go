@@ -0,0 +1,43 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// sysFClonefileat is the number of fclonefileat, syscall doesn't have it
+	sysFClonefileat = 463
+	// atFDCWD makes fclonefileat resolve a relative dst from the working folder
+	atFDCWD = -2
+	// cloneNoOwnerCopy gives the clone the owner of the process, like a copy
+	cloneNoOwnerCopy = 0x0002
+)
+
+// cloneFile makes dst a clone of s on APFS, which shares its blocks until one of them changes, so nothing is copied.
+// The clone also gets the extended attributes of s. cloned is false if the file system can't clone s into dst, then
+// writeFile copies it
+func cloneFile(s *os.File, dst string) (written int64, cloned bool, err error) {
+	// unlike a copy, a clone can't replace a file
+	if err = os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	p, err := syscall.BytePtrFromString(dst)
+	if err != nil {
+		return
+	}
+	fd := atFDCWD
+	if _, _, errno := syscall.Syscall6(sysFClonefileat, s.Fd(), uintptr(fd), uintptr(unsafe.Pointer(p)), cloneNoOwnerCopy, 0, 0); errno != 0 {
+		if cloneUnsupported(errno) {
+			return 0, false, nil
+		}
+		return 0, false, &os.PathError{Op: "fclonefileat", Path: dst, Err: errno}
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		return
+	}
+	return info.Size(), true, nil
+}
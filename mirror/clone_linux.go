@@ -0,0 +1,33 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+)
+
+// fiClone is FICLONE, the ioctl that makes a file share the blocks of another one on Btrfs and XFS
+const fiClone = 0x40049409
+
+// cloneFile makes dst a clone of s, which shares its blocks until one of them changes, so nothing is copied. cloned
+// is false if the file system can't clone s into dst, then writeFile copies it, and io.Copy between two files uses
+// copy_file_range, which lets the file system or the server of a share copy the data itself
+func cloneFile(s *os.File, dst string) (written int64, cloned bool, err error) {
+	d, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), fiClone, s.Fd()); errno != 0 {
+		d.Close()
+		if cloneUnsupported(errno) {
+			return 0, false, nil
+		}
+		return 0, false, &os.PathError{Op: "ioctl FICLONE", Path: dst, Err: errno}
+	}
+
+	info, err := d.Stat()
+	if err != nil {
+		d.Close()
+		return
+	}
+	return info.Size(), true, d.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package mirror
+
+import "os"
+
+// cloneFile can't clone files on this system, writeFile copies them
+func cloneFile(s *os.File, dst string) (written int64, cloned bool, err error) {
+	return 0, false, nil
+}
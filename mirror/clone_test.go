@@ -0,0 +1,35 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloneFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assertError(t, nil, os.WriteFile(src, []byte("abc"), FilePerm))
+	assertError(t, nil, os.WriteFile(dst, []byte("old content"), FilePerm))
+
+	s, err := os.Open(src)
+	assertError(t, nil, err)
+	defer s.Close()
+
+	// not every file system that tests run on can clone, a copy must be the same then
+	written, cloned, err := cloneFile(s, dst)
+	assertError(t, nil, err)
+	if cloned {
+		assert(t, int64(3), written)
+		got, err := os.ReadFile(dst)
+		assertError(t, nil, err)
+		assert(t, "abc", string(got))
+	}
+
+	written, err = copyFile(src, dst)
+	assertError(t, nil, err)
+	assert(t, int64(3), written)
+	got, err := os.ReadFile(dst)
+	assertError(t, nil, err)
+	assert(t, "abc", string(got))
+}
@@ -0,0 +1,13 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package mirror
+
+import "syscall"
+
+// cloneUnsupported is true for errors of a clone that a copy doesn't have: the file system can't clone, or src
+// and dst are on different ones. ENOTSUP and EOPNOTSUPP are the same on Linux, but not on macOS
+func cloneUnsupported(errno syscall.Errno) bool {
+	return errno == syscall.EOPNOTSUPP || errno == syscall.ENOTSUP || errno == syscall.ENOTTY || errno == syscall.EXDEV ||
+		errno == syscall.EINVAL || errno == syscall.ENOSYS
+}
@@ -0,0 +1,79 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CompareSize               = "size"
+	CompareSizeModTime        = "size+mtime"
+	FlagNameCompare           = "compare"
+	FlagNameComparePattern    = "compare-pattern"
+	FlagNameModTimeTolerance  = "mtime-tolerance"
+	FlagUsageCompare          = "how files in src and dst are compared: size, or size+mtime which also copies files of the same size whose modification times differ"
+	FlagUsageComparePattern   = "pattern of files that are compared by " + CompareSizeModTime + ", other files are compared by size only (can be repeated, all files by default)"
+	FlagUsageModTimeTolerance = "modification times that differ by less than this are the same, e.g. because FAT stores them in 2 second steps"
+	ErrUnknownCompare         = CustomErr("unknown comparison, use " + CompareSize + " or " + CompareSizeModTime)
+	ReasonModTimeDiffers      = "same size, but modification times differ"
+	defaultModTimeTolerance   = 2 * time.Second
+)
+
+// Comparer decides which files that have the same size in src and dst are different anyway
+type Comparer struct {
+	// Mode is CompareSize or CompareSizeModTime, an empty Mode is CompareSize
+	Mode string
+	// Patterns limit CompareSizeModTime to matching files, it applies to all files if there are none
+	Patterns Patterns
+	// Tolerance is the biggest difference of modification times that files can have and still be the same
+	Tolerance time.Duration
+}
+
+// ChangedFiles returns files that have the same size in dst and src but whose modification times differ by more
+// than c.Tolerance. It returns nothing if c.Mode isn't CompareSizeModTime
+func (c Comparer) ChangedFiles(dst, src File, dstPath, srcPath string) (res File, totalSize int64, err error) {
+	return c.ChangedFilesFS(dst, src, dstPath, OSFS(srcPath))
+}
+
+// ChangedFilesFS is ChangedFiles with the source in srcFS
+func (c Comparer) ChangedFilesFS(dst, src File, dstPath string, srcFS fs.FS) (res File, totalSize int64, err error) {
+	res = make(File)
+	if c.Mode != CompareSizeModTime {
+		return
+	}
+
+	for file, size := range src {
+		if dstSize, ok := dst[file]; !ok || dstSize != size || (len(c.Patterns) > 0 && !c.Patterns.Match(file)) {
+			continue
+		}
+
+		var differs bool
+		if differs, err = c.modTimesDiffer(srcFS, fsName(file), filepath.Join(dstPath, file)); err != nil {
+			return nil, 0, err
+		}
+		if differs {
+			res[file] = size
+			totalSize += size
+		}
+	}
+	return
+}
+
+func (c Comparer) modTimesDiffer(srcFS fs.FS, src, dst string) (bool, error) {
+	s, err := fs.Stat(srcFS, src)
+	if err != nil {
+		return false, err
+	}
+	d, err := os.Lstat(dst)
+	if err != nil {
+		return false, err
+	}
+
+	diff := s.ModTime().Sub(d.ModTime())
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > c.Tolerance, nil
+}
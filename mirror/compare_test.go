@@ -0,0 +1,65 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangedFiles(t *testing.T) {
+	makeTestFolders(t)
+
+	now := time.Now()
+	setModTime(t, filepath.Join(srcPathTest, "_same_1"), now)
+	setModTime(t, filepath.Join(dstPathTest, "_same_1"), now.Add(-time.Second))
+
+	tests := []struct {
+		name    string
+		c       Comparer
+		changed File
+	}{
+		{"size only", Comparer{Mode: CompareSize}, File{}},
+		{"within the tolerance", Comparer{Mode: CompareSizeModTime, Tolerance: 2 * time.Second}, File{}},
+		{"over the tolerance", Comparer{Mode: CompareSizeModTime}, File{"_same_1": 1}},
+		{"with a matching pattern", Comparer{Mode: CompareSizeModTime, Patterns: Patterns{"_same_*"}}, File{"_same_1": 1}},
+		{"without a matching pattern", Comparer{Mode: CompareSizeModTime, Patterns: Patterns{"*.jpg"}}, File{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, size, err := tt.c.ChangedFiles(dstFiles, srcFiles, dstPathTest, srcPathTest)
+			assertError(t, nil, err)
+			assert(t, tt.changed, changed)
+			assert(t, TotalSize(tt.changed), size)
+		})
+	}
+
+	cleanTestFolders(t)
+}
+
+func TestCopyFilesModTime(t *testing.T) {
+	makeTestFolders(t)
+
+	c := Comparer{Mode: CompareSizeModTime}
+	opts := &Options{Compare: c}
+	setModTime(t, filepath.Join(srcPathTest, "_same_1"), time.Now().Add(-time.Hour))
+
+	changed, size, err := c.ChangedFiles(dstFiles, srcFiles, dstPathTest, srcPathTest)
+	assertError(t, nil, err)
+	err = CopyFiles(changed, size, srcPathTest, dstPathTest, opts)
+	assertError(t, nil, err)
+
+	changed, _, err = c.ChangedFiles(dstFiles, srcFiles, dstPathTest, srcPathTest)
+	assertError(t, nil, err)
+	assert(t, File{}, changed)
+
+	cleanTestFolders(t)
+}
+
+func setModTime(t testing.TB, path string, mtime time.Time) {
+	t.Helper()
+
+	err := os.Chtimes(path, mtime, mtime)
+	assertError(t, nil, err)
+}
@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	CrashReportFile      = "mirror-crash.txt"
+	formatCrashHeader    = "mirror crashed at %s (%s, %s/%s)\npanic: %v\n"
+	formatCrashPhase     = "phase: %s, %s of %s done\n"
+	formatCrashInFlight  = "in flight: %s (for %s)\n"
+	formatCrashCounters  = "errors ignored: %d, unreadable: %d, vanished: %d, infected: %d\n"
+	formatCrashStack     = "\n%s"
+	crashNoPhase         = "none"
+	crashInFlightNothing = "in flight: nothing\n"
+)
+
+// WorkerPanic carries a panic of a copying goroutine to the goroutine that called CopyFiles, which panics with it,
+// so one recover at the top of the program sees it. Stack is the stack of the worker
+type WorkerPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *WorkerPanic) Error() string {
+	return fmt.Sprint(p.Value)
+}
+
+// runState is what a crash report shows about a run. Workers update it too, so it has a lock
+type runState struct {
+	mu          sync.Mutex
+	phase       string
+	done, total int64
+	inFlight    map[string]time.Time
+}
+
+// stateInit guards the lazy creation of Options.state
+var stateInit sync.Mutex
+
+func (o *Options) runState() *runState {
+	stateInit.Lock()
+	defer stateInit.Unlock()
+
+	if o.state == nil {
+		o.state = &runState{inFlight: make(map[string]time.Time)}
+	}
+	return o.state
+}
+
+func (s *runState) progress(phase string, done, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase, s.done, s.total = phase, done, total
+}
+
+func (s *runState) begin(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[path] = time.Now()
+}
+
+func (s *runState) end(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, path)
+}
+
+// WriteCrashReport writes recovered, the phase and the files that were being worked on, counters from opts.Report
+// and stack into path. opts can be nil if the program crashed before a run started
+func WriteCrashReport(path string, recovered interface{}, stack []byte, opts *Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = writeCrashReport(f, recovered, stack, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeCrashReport(w io.Writer, recovered interface{}, stack []byte, opts *Options) error {
+	if _, err := fmt.Fprintf(w, formatCrashHeader, time.Now().Format(time.RFC3339), runtime.Version(), runtime.GOOS, runtime.GOARCH, recovered); err != nil {
+		return err
+	}
+
+	if opts != nil {
+		s := opts.runState()
+		s.mu.Lock()
+		phase, done, total := s.phase, s.done, s.total
+		inFlight := make([]string, 0, len(s.inFlight))
+		since := make(map[string]time.Duration, len(s.inFlight))
+		for path, started := range s.inFlight {
+			inFlight = append(inFlight, path)
+			since[path] = time.Since(started).Round(time.Millisecond)
+		}
+		s.mu.Unlock()
+		sort.Strings(inFlight)
+
+		if phase == "" {
+			phase = crashNoPhase
+		}
+		if _, err := fmt.Fprintf(w, formatCrashPhase, phase, ThousandSeparator(strconv.FormatInt(done, 10)), ThousandSeparator(strconv.FormatInt(total, 10))); err != nil {
+			return err
+		}
+
+		if len(inFlight) == 0 {
+			if _, err := io.WriteString(w, crashInFlightNothing); err != nil {
+				return err
+			}
+		}
+		for _, path := range inFlight {
+			if _, err := fmt.Fprintf(w, formatCrashInFlight, path, since[path]); err != nil {
+				return err
+			}
+		}
+
+		r := opts.Report
+		if _, err := fmt.Fprintf(w, formatCrashCounters, len(r.IgnoredErrors), len(r.Unreadable), len(r.Vanished), len(r.Infected)); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, formatCrashStack, stack)
+	return err
+}
@@ -0,0 +1,65 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCrashReport(t *testing.T) {
+	t.Run("with a run", func(t *testing.T) {
+		opts := &Options{Report: Report{Vanished: []string{"a"}, IgnoredErrors: []error{errors.New("x"), errors.New("y")}}}
+		opts.sendProgress(PhaseCopyingFiles, 1234, 5678)
+		opts.runState().begin(filepath.Join("a", "b"))
+		opts.runState().begin("c")
+		opts.runState().begin("d")
+		opts.runState().end("d")
+
+		path := filepath.Join(t.TempDir(), CrashReportFile)
+		assertError(t, nil, WriteCrashReport(path, "boom", []byte("goroutine 1 [running]"), opts))
+
+		got, err := os.ReadFile(path)
+		assertError(t, nil, err)
+		for _, want := range []string{
+			"panic: boom\n",
+			"phase: copying files, 1 234 of 5 678 done\n",
+			"in flight: " + filepath.Join("a", "b") + " (for ",
+			"in flight: c (for ",
+			"errors ignored: 2, unreadable: 0, vanished: 1, infected: 0\n",
+			"\ngoroutine 1 [running]",
+		} {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("want %q in %q", want, got)
+			}
+		}
+		if strings.Contains(string(got), "in flight: d") {
+			t.Errorf("finished file in %q", got)
+		}
+	})
+
+	t.Run("before a run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), CrashReportFile)
+		assertError(t, nil, WriteCrashReport(path, "boom", nil, nil))
+
+		got, err := os.ReadFile(path)
+		assertError(t, nil, err)
+		if strings.Contains(string(got), "phase:") {
+			t.Errorf("unexpected state in %q", got)
+		}
+	})
+
+	t.Run("nothing in flight", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), CrashReportFile)
+		assertError(t, nil, WriteCrashReport(path, "boom", nil, &Options{}))
+
+		got, err := os.ReadFile(path)
+		assertError(t, nil, err)
+		for _, want := range []string{"phase: " + crashNoPhase + ", 0 of 0 done\n", crashInFlightNothing} {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("want %q in %q", want, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package mirror
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"os"
+)
+
+const (
+	FlagNameDelta  = "delta"
+	FlagUsageDelta = "patch changed files of dst in place, so only the blocks that differ from src are written, like rsync does, which helps with large files like VM images and databases"
+	ErrDeltaMode   = CustomErr("the -delta flag can't be used together with the -swap or -cas flags, or with a scan command, files aren't copied into a new file")
+	LogPatched     = "patched in place, %s of %s B written: "
+	MsgPatched     = "%d changed files were patched in place, %s MB of %s MB written\n"
+	// deltaBlockSize is the size of the blocks that are compared, a smaller one finds more of them but makes a
+	// bigger index
+	deltaBlockSize = 64 << 10
+	// deltaMinSize is the size that both copies of a file need to be patched, smaller files are copied whole
+	deltaMinSize = 16 * deltaBlockSize
+)
+
+// rollingSum is the weak checksum of a block that rsync uses. It can be moved by a byte without reading the block
+// again, see roll
+type rollingSum struct {
+	a, b uint32
+}
+
+func newRollingSum(block []byte) rollingSum {
+	var s rollingSum
+	n := uint32(len(block))
+	for i, c := range block {
+		s.a += uint32(c)
+		s.b += (n - uint32(i)) * uint32(c)
+	}
+	return s
+}
+
+// roll moves the block of n bytes by one byte, out leaves it at the start and in joins it at the end
+func (s *rollingSum) roll(out, in byte, n uint32) {
+	s.a += uint32(in) - uint32(out)
+	s.b += s.a - n*uint32(out)
+}
+
+func (s rollingSum) sum() uint32 {
+	return s.a&0xffff | s.b<<16
+}
+
+// blockIndex finds blocks of the old copy of a file by their weak and then their strong checksum
+type blockIndex struct {
+	weak   map[uint32][]int64
+	strong [][sha256.Size]byte
+}
+
+// newBlockIndex reads f in blocks of deltaBlockSize, a shorter block at the end isn't indexed
+func newBlockIndex(f io.Reader) (*blockIndex, error) {
+	idx := &blockIndex{weak: make(map[uint32][]int64)}
+	block := make([]byte, deltaBlockSize)
+	for i := int64(0); ; i++ {
+		if _, err := io.ReadFull(f, block); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return idx, nil
+		} else if err != nil {
+			return nil, err
+		}
+		weak := newRollingSum(block).sum()
+		idx.weak[weak] = append(idx.weak[weak], i)
+		idx.strong = append(idx.strong, sha256.Sum256(block))
+	}
+}
+
+// find returns the index of a block that has the same content as block and starts at off or after it, so it wasn't
+// overwritten yet, see patcher. One at off is preferred, it doesn't have to be written at all
+func (idx *blockIndex) find(weak uint32, block []byte, off int64) (int64, bool) {
+	candidates := idx.weak[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	strong := sha256.Sum256(block)
+	found, ok := int64(0), false
+	for _, i := range candidates {
+		if i*deltaBlockSize < off || idx.strong[i] != strong {
+			continue
+		}
+		if i*deltaBlockSize == off {
+			return i, true
+		}
+		if !ok {
+			found, ok = i, true
+		}
+	}
+	return found, ok
+}
+
+// patcher writes the new content of a file over the old one. Blocks are only taken from where nothing was written
+// yet, so the old content they need is still there
+type patcher struct {
+	f *os.File
+	// off is where the next bytes go
+	off int64
+	// written counts the bytes that were written, blocks that stay where they are aren't
+	written int64
+	block   []byte
+}
+
+func (p *patcher) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	n, err := p.f.WriteAt(data, p.off)
+	p.off += int64(n)
+	p.written += int64(n)
+	return err
+}
+
+func (p *patcher) copyBlock(i int64) error {
+	from := i * deltaBlockSize
+	if from == p.off {
+		p.off += deltaBlockSize
+		return nil
+	}
+	if _, err := p.f.ReadAt(p.block, from); err != nil {
+		return err
+	}
+	return p.literal(p.block)
+}
+
+// patchFile writes name of fsys over path, the older copy of it, so that only the blocks that differ are written.
+// name is read within opts.BWLimit.
+// Both copies need deltaMinSize, otherwise or if path can't be written, nothing happens and patched is false. A path
+// with more hard links isn't patched either, patching its data would change the other paths too, e.g. the ones that
+// -hard-links made, it's copied into a part which only replaces path.
+// It returns the bytes written and the size of the new content. A failed patch leaves a file that is partly
+// patched, it's only in place once its times are copied, so the next run finds it changed
+func patchFile(fsys fs.FS, name, path string, size int64, opts *Options) (patched bool, written, total int64, err error) {
+	if size < deltaMinSize {
+		return
+	}
+	if info, errS := os.Lstat(path); errS != nil || !info.Mode().IsRegular() || info.Size() < deltaMinSize {
+		return
+	} else if _, linked := hardLinkID(info); linked {
+		return
+	}
+	d, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsPermission(err) {
+		return false, 0, 0, nil
+	} else if err != nil {
+		return
+	}
+	defer d.Close()
+
+	idx, err := newBlockIndex(bufio.NewReader(d))
+	if err != nil {
+		return
+	}
+
+	s, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+
+	p := &patcher{f: d, block: make([]byte, deltaBlockSize)}
+	if err = diff(bufio.NewReaderSize(opts.limit(s), 4*deltaBlockSize), idx, p); err != nil {
+		return
+	}
+	if err = d.Truncate(p.off); err != nil {
+		return
+	}
+	return true, p.written, p.off, d.Close()
+}
+
+// diff reads the new content from r and hands it to p as blocks that idx has and literal bytes in between
+func diff(r *bufio.Reader, idx *blockIndex, p *patcher) error {
+	// buf holds literal bytes that weren't written yet and then the window, which starts at w
+	buf := make([]byte, 0, 2*deltaBlockSize)
+	w := 0
+	eof := false
+
+	fill := func() error {
+		for !eof && len(buf)-w < deltaBlockSize {
+			c, err := r.ReadByte()
+			if err == io.EOF {
+				eof = true
+				break
+			} else if err != nil {
+				return err
+			}
+			buf = append(buf, c)
+		}
+		return nil
+	}
+
+	if err := fill(); err != nil {
+		return err
+	}
+	var sum rollingSum
+	if len(buf) == deltaBlockSize {
+		sum = newRollingSum(buf)
+	}
+
+	for len(buf)-w == deltaBlockSize {
+		if i, ok := idx.find(sum.sum(), buf[w:], p.off+int64(w)); ok {
+			if err := p.literal(buf[:w]); err != nil {
+				return err
+			}
+			if err := p.copyBlock(i); err != nil {
+				return err
+			}
+			buf, w = buf[:0], 0
+			if err := fill(); err != nil {
+				return err
+			}
+			if len(buf) == deltaBlockSize {
+				sum = newRollingSum(buf)
+			}
+			continue
+		}
+
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			eof = true
+			break
+		} else if err != nil {
+			return err
+		}
+		out := buf[w]
+		buf = append(buf, c)
+		w++
+		sum.roll(out, c, deltaBlockSize)
+
+		// the literal bytes are written once there is a block of them, so buf doesn't grow
+		if w == deltaBlockSize {
+			if err = p.literal(buf[:w]); err != nil {
+				return err
+			}
+			buf = append(buf[:0], buf[w:]...)
+			w = 0
+		}
+	}
+	return p.literal(buf)
+}
@@ -0,0 +1,94 @@
+package mirror
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatchFile(t *testing.T) {
+	old := make([]byte, 2*deltaMinSize+123)
+	rand.New(rand.NewSource(1)).Read(old)
+	changed := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), old...))
+	}
+
+	tests := []struct {
+		name       string
+		new        []byte
+		maxWritten int
+	}{
+		{"unchanged", old, 123},
+		{"changed block", changed(func(b []byte) []byte { b[deltaMinSize] ^= 1; return b }), deltaBlockSize + 123},
+		// blocks that moved back are written again, ones that moved forward are already overwritten
+		{"bytes inserted", changed(func(b []byte) []byte { return append([]byte("new"), b...) }), len(old) + 3},
+		{"bytes removed", changed(func(b []byte) []byte { return b[3:] }), len(old) - 3},
+		{"shorter", changed(func(b []byte) []byte { return b[:deltaMinSize+5] }), 5},
+		{"longer", changed(func(b []byte) []byte { return append(b, old[:deltaBlockSize]...) }), deltaBlockSize + 123},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			assertError(t, nil, os.WriteFile(filepath.Join(src, "f"), tt.new, FilePerm))
+			assertError(t, nil, os.WriteFile(filepath.Join(dst, "f"), old, FilePerm))
+
+			patched, written, total, err := patchFile(OSFS(src), "f", filepath.Join(dst, "f"), int64(len(tt.new)), &Options{})
+			assertError(t, nil, err)
+			assert(t, true, patched)
+			assert(t, int64(len(tt.new)), total)
+			assert(t, true, written <= int64(tt.maxWritten))
+
+			got, err := os.ReadFile(filepath.Join(dst, "f"))
+			assertError(t, nil, err)
+			assert(t, true, bytes.Equal(tt.new, got))
+		})
+	}
+
+	t.Run("small", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "f"), []byte("1"), FilePerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(dst, "f"), old, FilePerm))
+		patched, _, _, err := patchFile(OSFS(src), "f", filepath.Join(dst, "f"), 1, &Options{})
+		assertError(t, nil, err)
+		assert(t, false, patched)
+	})
+
+	t.Run("hard linked", func(t *testing.T) {
+		if !hardLinksSupported {
+			t.Skip("no hard links")
+		}
+		src, dst := t.TempDir(), t.TempDir()
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "f"), tests[1].new, FilePerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(dst, "f"), old, FilePerm))
+		assertError(t, nil, os.Link(filepath.Join(dst, "f"), filepath.Join(dst, "link")))
+
+		patched, _, _, err := patchFile(OSFS(src), "f", filepath.Join(dst, "f"), int64(len(tests[1].new)), &Options{})
+		assertError(t, nil, err)
+		assert(t, false, patched)
+		got, err := os.ReadFile(filepath.Join(dst, "link"))
+		assertError(t, nil, err)
+		assert(t, true, bytes.Equal(old, got))
+	})
+}
+
+func TestCopyFilesDelta(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	data := make([]byte, deltaMinSize)
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "f"), data, FilePerm))
+	data = append(data, "new"...)
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "f"), data, FilePerm))
+
+	opts := &Options{LogPath: os.DevNull, Delta: true}
+	files := File{"f": int64(len(data))}
+	assertError(t, nil, CopyFiles(files, TotalSize(files), src, dst, opts))
+	assert(t, []string{"f"}, opts.Report.Patched)
+	assert(t, int64(3), opts.Report.PatchWritten)
+
+	got, err := os.ReadFile(filepath.Join(dst, "f"))
+	assertError(t, nil, err)
+	assert(t, true, bytes.Equal(data, got))
+	_, err = os.Stat(filepath.Join(dst, "f"+PartSuffix))
+	assert(t, true, os.IsNotExist(err))
+}
@@ -0,0 +1,209 @@
+package mirror
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	CmdDiff            = "diff"
+	DiffFormatText     = "text"
+	DiffFormatJSON     = "json"
+	DiffFormatCSV      = "csv"
+	FlagNameDiffFormat = "format"
+	FlagUsageDiffFmt   = "format of the report: text, json or csv"
+	ErrDiffWrongArgs   = CustomErr("wrong arguments, use 'diff [-format text|json|csv] A B'")
+	ErrUnknownDiffFmt  = CustomErr("unknown diff format")
+	DiffHeaderOnlyInA  = "only in A"
+	DiffHeaderOnlyInB  = "only in B"
+	DiffHeaderDiffers  = "different"
+	DiffHeaderNearInA  = "near duplicate in A"
+	DiffHeaderNearInB  = "near duplicate in B"
+	// diffFolderSuffix marks folders in the report
+	diffFolderSuffix = "/"
+)
+
+// Diff lists differences of two trees. Paths use forward slashes and folders end with a slash
+type Diff struct {
+	OnlyInA   []string `json:"onlyInA"`
+	OnlyInB   []string `json:"onlyInB"`
+	Different []string `json:"different"`
+	// NearDuplicates are paths that differ only in case or diacritics, they cause trouble on file systems
+	// that ignore case or normalize Unicode
+	NearDuplicates []NearDuplicate `json:"nearDuplicates"`
+}
+
+// NearDuplicate is a pair of paths from the two trees that differ only in case or diacritics
+type NearDuplicate struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// VetDiffFlags parses flags and arguments of the diff subcommand and rewrites a and b into absolute paths
+func VetDiffFlags(args []string) (a, b, format string, err error) {
+	fs := flag.NewFlagSet(CmdDiff, flag.ExitOnError)
+	fs.StringVar(&format, FlagNameDiffFormat, DiffFormatText, FlagUsageDiffFmt)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if fs.NArg() != 2 {
+		err = ErrDiffWrongArgs
+		return
+	}
+	if format != DiffFormatText && format != DiffFormatJSON && format != DiffFormatCSV {
+		err = ErrUnknownDiffFmt
+		return
+	}
+
+	if a, err = filepath.Abs(fs.Arg(0)); err != nil {
+		return
+	}
+	if b, err = filepath.Abs(fs.Arg(1)); err != nil {
+		return
+	}
+
+	for _, path := range []string{a, b} {
+		if f, errF := os.Stat(path); os.IsNotExist(errF) || !f.IsDir() {
+			err = fmt.Errorf("%w %s", ErrSrcNotFound, path)
+			return
+		}
+	}
+	return
+}
+
+// DiffTrees compares trees a and b with the same planners that copying and cleaning use, nothing is changed.
+// Files are different if they are in both trees but their sizes aren't the same
+func DiffTrees(a, b string, opts *Options) (d Diff, err error) {
+	aFolders, aFiles, _, err := ReadFolder(a, opts)
+	if err != nil {
+		return
+	}
+	bFolders, bFiles, _, err := ReadFolder(b, opts)
+	if err != nil {
+		return
+	}
+
+	DropUnreadable(opts.Report.Unreadable, aFolders, aFiles)
+	DropUnreadable(opts.Report.Unreadable, bFolders, bFiles)
+
+	missingInB, _ := MissingFiles(bFiles, aFiles)
+	missingInA, _ := MissingFiles(aFiles, bFiles)
+
+	d.OnlyInA = diffFolders(MissingFolders(bFolders, aFolders))
+	d.OnlyInB = diffFolders(MissingFolders(aFolders, bFolders))
+	d.Different = []string{}
+	for _, file := range sortFoldersOrFiles(missingInB) {
+		if _, ok := bFiles[file]; ok {
+			d.Different = append(d.Different, filepath.ToSlash(file))
+		} else {
+			d.OnlyInA = append(d.OnlyInA, filepath.ToSlash(file))
+		}
+	}
+	for _, file := range sortFoldersOrFiles(missingInA) {
+		if _, ok := aFiles[file]; !ok {
+			d.OnlyInB = append(d.OnlyInB, filepath.ToSlash(file))
+		}
+	}
+
+	sort.Strings(d.OnlyInA)
+	sort.Strings(d.OnlyInB)
+	d.NearDuplicates = nearDuplicates(diffPaths(aFolders, aFiles), diffPaths(bFolders, bFiles))
+	return
+}
+
+// nearDuplicates returns pairs of paths from a and b that are different but fold into the same name, see foldName
+func nearDuplicates(a, b []string) []NearDuplicate {
+	folded := make(map[string][]string)
+	for _, path := range b {
+		folded[foldName(path)] = append(folded[foldName(path)], path)
+	}
+
+	res := []NearDuplicate{}
+	for _, pathA := range a {
+		for _, pathB := range folded[foldName(pathA)] {
+			if pathA != pathB {
+				res = append(res, NearDuplicate{A: pathA, B: pathB})
+			}
+		}
+	}
+	return res
+}
+
+// diffPaths returns sorted paths of folders and files as they are written in the report
+func diffPaths(folders Folder, files File) []string {
+	res := diffFolders(folders)
+	for _, file := range sortFoldersOrFiles(files) {
+		res = append(res, filepath.ToSlash(file))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Empty returns true if the trees are the same
+func (d Diff) Empty() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.Different) == 0
+}
+
+// Write writes d into w in format (DiffFormatText, DiffFormatJSON or DiffFormatCSV). Text and CSV have
+// a column for each list, near duplicates follow in a table with their own header
+func (d Diff) Write(w io.Writer, format string) error {
+	switch format {
+	case DiffFormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		return e.Encode(d)
+	case DiffFormatCSV:
+		c := csv.NewWriter(w)
+		if err := c.WriteAll(d.rows()); err != nil {
+			return err
+		}
+		return c.Error()
+	case DiffFormatText:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, row := range d.rows() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", row[0], row[1], row[2])
+		}
+		return tw.Flush()
+	default:
+		return ErrUnknownDiffFmt
+	}
+}
+
+func (d Diff) rows() [][]string {
+	rows := [][]string{{DiffHeaderOnlyInA, DiffHeaderOnlyInB, DiffHeaderDiffers}}
+	for i := 0; i < len(d.OnlyInA) || i < len(d.OnlyInB) || i < len(d.Different); i++ {
+		rows = append(rows, []string{item(d.OnlyInA, i), item(d.OnlyInB, i), item(d.Different, i)})
+	}
+
+	if len(d.NearDuplicates) > 0 {
+		rows = append(rows, []string{DiffHeaderNearInA, DiffHeaderNearInB, ""})
+		for _, n := range d.NearDuplicates {
+			rows = append(rows, []string{n.A, n.B, ""})
+		}
+	}
+	return rows
+}
+
+func item(list []string, i int) string {
+	if i < len(list) {
+		return list[i]
+	}
+	return ""
+}
+
+func diffFolders(folders Folder) []string {
+	res := make([]string, 0, len(folders))
+	for _, folder := range sortFoldersOrFiles(folders) {
+		res = append(res, filepath.ToSlash(folder)+diffFolderSuffix)
+	}
+	return res
+}
@@ -0,0 +1,88 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffTrees(t *testing.T) {
+	makeTestFolders(t)
+
+	d, err := DiffTrees(srcPathTest, dstPathTest, &Options{})
+	assertError(t, nil, err)
+	assert(t, Diff{
+		OnlyInA:        []string{"same_1/same_2/_not_in_dst", "same_1/same_2/not_in_dst/"},
+		OnlyInB:        []string{"same_1/same_2/_not_in_src", "same_1/same_2/not_in_src/"},
+		Different:      []string{"same_1/_different"},
+		NearDuplicates: []NearDuplicate{},
+	}, d)
+	assert(t, false, d.Empty())
+
+	d, err = DiffTrees(srcPathTest, srcPathTest, &Options{})
+	assertError(t, nil, err)
+	assert(t, true, d.Empty())
+
+	cleanTestFolders(t)
+}
+
+func TestDiffWrite(t *testing.T) {
+	d := Diff{OnlyInA: []string{"a", "b"}, OnlyInB: []string{}, Different: []string{"c"}}
+
+	tests := []struct {
+		format, want string
+	}{
+		{DiffFormatCSV, "only in A,only in B,different\na,,c\nb,,\n"},
+		{DiffFormatText, "only in A  only in B  different\na" + strings.Repeat(" ", 21) + "c\nb" + strings.Repeat(" ", 21) + "\n"},
+		{DiffFormatJSON, "{\n\t\"onlyInA\": [\n\t\t\"a\",\n\t\t\"b\"\n\t],\n\t\"onlyInB\": [],\n\t\"different\": [\n\t\t\"c\"\n\t],\n\t\"nearDuplicates\": null\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			err := d.Write(&b, tt.format)
+			assertError(t, nil, err)
+			assert(t, tt.want, b.String())
+		})
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	makeTestFolders(t)
+
+	err := os.WriteFile(filepath.Join(srcPathTest, "Čaj.txt"), []byte("a"), FilePerm)
+	assertError(t, nil, err)
+	// "c" followed by a combining caron is how macOS stores "č"
+	err = os.WriteFile(filepath.Join(dstPathTest, "c\u030caj.TXT"), []byte("a"), FilePerm)
+	assertError(t, nil, err)
+
+	d, err := DiffTrees(srcPathTest, dstPathTest, &Options{})
+	assertError(t, nil, err)
+	assert(t, []NearDuplicate{{A: "Čaj.txt", B: "c\u030caj.TXT"}}, d.NearDuplicates)
+
+	var b strings.Builder
+	err = d.Write(&b, DiffFormatCSV)
+	assertError(t, nil, err)
+	if !strings.HasSuffix(b.String(), "near duplicate in A,near duplicate in B,\nČaj.txt,c\u030caj.TXT,\n") {
+		t.Errorf("near duplicates are missing in %q", b.String())
+	}
+
+	cleanTestFolders(t)
+}
+
+func TestVetDiffFlags(t *testing.T) {
+	makeTestFolders(t)
+
+	_, _, format, err := VetDiffFlags([]string{"-" + FlagNameDiffFormat, DiffFormatJSON, srcPathTest, dstPathTest})
+	assertError(t, nil, err)
+	assert(t, DiffFormatJSON, format)
+
+	_, _, _, err = VetDiffFlags([]string{srcPathTest})
+	assertError(t, ErrDiffWrongArgs, err)
+
+	_, _, _, err = VetDiffFlags([]string{"-" + FlagNameDiffFormat, "xml", srcPathTest, dstPathTest})
+	assertError(t, ErrUnknownDiffFmt, err)
+
+	cleanTestFolders(t)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package mirror
+
+import "errors"
+
+var errNoFifo = errors.New("named pipes can't be made on this system")
+
+func makeFifo(path string) error {
+	return errNoFifo
+}
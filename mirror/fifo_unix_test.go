@@ -0,0 +1,12 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package mirror
+
+import "syscall"
+
+var errNoFifo error
+
+func makeFifo(path string) error {
+	return syscall.Mkfifo(path, FilePerm)
+}
@@ -0,0 +1,10 @@
+package mirror
+
+const (
+	FlagNameFileFlags       = "file-flags"
+	FlagUsageFileFlags      = "copied files keep the file capabilities (setcap) and the immutable and append-only flags (chattr) of the source, setting them usually needs root (Linux only)"
+	ErrFileFlagsUnsupported = CustomErr("file capabilities and flags can't be copied on this system")
+	ErrFileFlagsNeedsOSFS   = CustomErr("file capabilities and flags can only be copied from a folder on disk")
+	LogFileFlagsNotKept     = "copied without capabilities or flags, dst can't hold them: "
+	MsgFileFlagsNotKept     = "copied files whose capabilities or flags dst can't hold:"
+)
@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fileFlagsSupported = true
+	xattrCapability    = "security.capability"
+	fileFlagImmutable  = 0x10
+	fileFlagAppendOnly = 0x20
+	// FS_IOC_GETFLAGS and FS_IOC_SETFLAGS have the size of a long in their number, but the kernel reads an int
+	fsIocGetFlags = 0x80006601 | unsafe.Sizeof(uintptr(0))<<16
+	fsIocSetFlags = 0x40006602 | unsafe.Sizeof(uintptr(0))<<16
+)
+
+// copyFileFlags gives dst the capabilities and the immutable and append-only flags of src. kept is false if src has
+// some of them but the file system of dst can't hold them. The flags come last, an immutable dst can't be changed
+func copyFileFlags(src, dst string) (kept bool, err error) {
+	kept = true
+
+	caps, err := getXattr(src, xattrCapability)
+	if err != nil {
+		return false, err
+	}
+	if len(caps) > 0 {
+		if err = syscall.Setxattr(dst, xattrCapability, caps, 0); notSupported(err) {
+			kept = false
+		} else if err != nil {
+			return false, &os.PathError{Op: "setxattr", Path: dst, Err: err}
+		}
+	}
+
+	flags, err := getFileFlags(src)
+	if notSupported(err) {
+		return kept, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if flags &= fileFlagImmutable | fileFlagAppendOnly; flags == 0 {
+		return kept, nil
+	}
+
+	dstFlags, err := getFileFlags(dst)
+	if err == nil {
+		err = setFileFlags(dst, dstFlags|flags)
+	}
+	if notSupported(err) {
+		return false, nil
+	}
+	return kept, err
+}
+
+func getFileFlags(path string) (flags uint32, err error) {
+	err = fileFlagsIoctl(path, fsIocGetFlags, &flags)
+	return
+}
+
+func setFileFlags(path string, flags uint32) error {
+	return fileFlagsIoctl(path, fsIocSetFlags, &flags)
+}
+
+func fileFlagsIoctl(path string, req uintptr, flags *uint32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(flags))); errno != 0 {
+		return &os.PathError{Op: "ioctl", Path: path, Err: errno}
+	}
+	return nil
+}
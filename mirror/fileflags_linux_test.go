@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// testCapability is a version 2 security.capability value with CAP_NET_BIND_SERVICE permitted and effective
+func testCapability() []byte {
+	b := make([]byte, 20)
+	binary.LittleEndian.PutUint32(b, 0x02000001)
+	binary.LittleEndian.PutUint32(b[4:], 1<<10)
+	return b
+}
+
+// withFileFlags gives path flags and the test capability, or skips the test if they can't be set here
+func withFileFlags(t *testing.T, path string, flags uint32) {
+	t.Helper()
+	if err := syscall.Setxattr(path, xattrCapability, testCapability(), 0); err != nil {
+		t.Skipf("capabilities can't be set here: %v", err)
+	}
+	if err := setFileFlags(path, flags); err != nil {
+		t.Skipf("file flags can't be set here: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := setFileFlags(path, 0); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestCopyFileFlags(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "plain"), []byte("p"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "plain"), []byte("p"), FilePerm))
+
+	t.Run("a file without capabilities and flags", func(t *testing.T) {
+		kept, err := copyFileFlags(filepath.Join(src, "plain"), filepath.Join(dst, "plain"))
+		assertError(t, nil, err)
+		assert(t, true, kept)
+
+		caps, err := getXattr(filepath.Join(dst, "plain"), xattrCapability)
+		assertError(t, nil, err)
+		assert(t, 0, len(caps))
+	})
+
+	t.Run("immutable with a capability", func(t *testing.T) {
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "ping"), []byte("x"), FilePerm))
+		withFileFlags(t, filepath.Join(src, "ping"), fileFlagImmutable)
+
+		discardLog(t)
+		opts := &Options{LogPath: os.DevNull, FileFlags: true}
+		assertError(t, nil, CopyFiles(File{"ping": 1}, 1, src, dst, opts))
+		copied := filepath.Join(dst, "ping")
+		t.Cleanup(func() {
+			if err := setFileFlags(copied, 0); err != nil {
+				t.Error(err)
+			}
+		})
+		assert(t, 0, len(opts.Report.FlagsNotKept))
+
+		caps, err := getXattr(copied, xattrCapability)
+		assertError(t, nil, err)
+		assert(t, testCapability(), caps)
+
+		flags, err := getFileFlags(copied)
+		assertError(t, nil, err)
+		assert(t, uint32(fileFlagImmutable), flags&(fileFlagImmutable|fileFlagAppendOnly))
+
+		err = os.WriteFile(copied, []byte("y"), FilePerm)
+		assert(t, true, errors.Is(err, os.ErrPermission))
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package mirror
+
+// capabilities and chattr flags are Linux only, BSD flags and macOS attributes are different things
+const fileFlagsSupported = false
+
+func copyFileFlags(src, dst string) (bool, error) {
+	return false, ErrFileFlagsUnsupported
+}
@@ -0,0 +1,23 @@
+package mirror
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileFlagsCheck(t *testing.T) {
+	err := (&Options{FileFlags: true}).check()
+	if fileFlagsSupported {
+		assertError(t, nil, err)
+	} else {
+		assertError(t, ErrFileFlagsUnsupported, err)
+	}
+
+	fsys := fstest.MapFS{"a": {Data: []byte("a")}}
+	err = CopyFilesFS(File{"a": 1}, 1, fsys, t.TempDir(), &Options{LogPath: os.DevNull, FileFlags: true})
+	assertError(t, ErrFileFlagsNeedsOSFS, err)
+
+	_, err = NewFS(fsys, t.TempDir(), WithFileFlags())
+	assertError(t, ErrFileFlagsNeedsOSFS, err)
+}
@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	FlagNameInclude       = "include"
+	FlagNameExclude       = "exclude"
+	FlagNameIncludeRegex  = "include-regex"
+	FlagNameExcludeRegex  = "exclude-regex"
+	FlagUsageInclude      = "comma separated glob patterns of files that are mirrored, other files are skipped in src and dst, '**' matches any number of folders, e.g. '*.mp4' or 'photos/**/*.jpg' (can be repeated)"
+	FlagUsageExclude      = "comma separated glob patterns of files and folders that are skipped in src and dst, e.g. 'node_modules/**' or '*.tmp' (can be repeated)"
+	FlagUsageIncludeRegex = "regular expression of paths of files that are mirrored like with -" + FlagNameInclude + ", paths use forward slashes, e.g. '^photos/.*\\.(jpe?g|png)$' (can be repeated)"
+	FlagUsageExcludeRegex = "regular expression of paths of files and folders that are skipped like with -" + FlagNameExclude + ", paths of folders end with a slash, e.g. '_old/$' (can be repeated)"
+	ErrBadRegex           = CustomErr("invalid regular expression")
+	ReasonExcluded        = "excluded by -" + FlagNameExclude
+	ReasonExcludedRegex   = "excluded by -" + FlagNameExcludeRegex
+	ReasonNotIncluded     = "not included by -" + FlagNameInclude + " or -" + FlagNameIncludeRegex
+	globSeparator         = ","
+	globAnyFolders        = "**"
+)
+
+// Globs holds glob patterns that use forward slashes. A pattern without a slash matches the name of an item in any
+// folder, other patterns match the whole path from the read folder, and '**' in them matches any number of folders
+type Globs []string
+
+func (g *Globs) String() string {
+	return strings.Join(*g, globSeparator)
+}
+
+// Set adds every comma separated pattern of value
+func (g *Globs) Set(value string) error {
+	for _, pattern := range strings.Split(value, globSeparator) {
+		pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		for _, part := range strings.Split(pattern, "/") {
+			if _, err := path.Match(part, ""); err != nil {
+				return ErrBadPattern
+			}
+		}
+		*g = append(*g, pattern)
+	}
+	return nil
+}
+
+// Match returns true if name, a path that uses forward slashes, matches one of the patterns
+func (g Globs) Match(name string) bool {
+	for _, pattern := range g {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+			continue
+		}
+		if matchParts(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == globAnyFolders {
+			// '**' takes as many folders as the rest of the pattern needs
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Regexps holds regular expressions of paths that use forward slashes, where paths of folders end with a slash
+type Regexps []*regexp.Regexp
+
+func (r *Regexps) String() string {
+	res := make([]string, len(*r))
+	for i, re := range *r {
+		res[i] = re.String()
+	}
+	return strings.Join(res, " ")
+}
+
+func (r *Regexps) Set(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrBadRegex, expr)
+	}
+	*r = append(*r, re)
+	return nil
+}
+
+// Match returns true if one of the expressions matches name, a path with forward slashes. A folder is matched
+// with a slash at the end
+func (r Regexps) Match(name string, isDir bool) bool {
+	if isDir {
+		name += "/"
+	}
+	for _, re := range r {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filtered returns the reason why the item name (with forward slashes) is skipped by the filters of o,
+// or an empty string if it isn't. Includes only apply to files, so folders are read to find them, and a file that
+// matches a glob or an expression is included
+func (o *Options) filtered(name string, isDir bool) string {
+	if o.Exclude.Match(name) {
+		return ReasonExcluded
+	}
+	if o.ExcludeRegex.Match(name, isDir) {
+		return ReasonExcludedRegex
+	}
+	if !isDir && (len(o.Include) > 0 || len(o.IncludeRegex) > 0) && !o.Include.Match(name) && !o.IncludeRegex.Match(name, false) {
+		return ReasonNotIncluded
+	}
+	return ""
+}
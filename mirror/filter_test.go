@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGlobsSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  Globs
+		err   error
+	}{
+		{name: "one pattern", value: "*.mp4", want: Globs{"*.mp4"}},
+		{name: "comma separated patterns", value: "*.mp4, node_modules/**,,", want: Globs{"*.mp4", "node_modules/**"}},
+		{name: "leading slash", value: "/build", want: Globs{"build"}},
+		{name: "bad pattern", value: "*.mp4,a/[b", err: ErrBadPattern},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var g Globs
+			assertError(t, test.err, g.Set(test.value))
+			if test.err == nil {
+				assert(t, test.want, g)
+			}
+		})
+	}
+}
+
+func TestGlobsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{pattern: "*.mp4", name: "a.mp4", want: true},
+		{pattern: "*.mp4", name: "a/b/c.mp4", want: true},
+		{pattern: "*.mp4", name: "a.mp4/b"},
+		{pattern: "node_modules/**", name: "node_modules", want: true},
+		{pattern: "node_modules/**", name: "node_modules/a/b", want: true},
+		{pattern: "node_modules/**", name: "a/node_modules/b"},
+		{pattern: "**/node_modules", name: "a/b/node_modules", want: true},
+		{pattern: "**/node_modules", name: "node_modules", want: true},
+		{pattern: "photos/**/*.jpg", name: "photos/a.jpg", want: true},
+		{pattern: "photos/**/*.jpg", name: "photos/2020/01/a.jpg", want: true},
+		{pattern: "photos/**/*.jpg", name: "photos/2020/a.png"},
+		{pattern: "a/*/c", name: "a/b/c", want: true},
+		{pattern: "a/*/c", name: "a/b/b/c"},
+		{pattern: "a/b", name: "a/b/c"},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.name, func(t *testing.T) {
+			assert(t, test.want, Globs{test.pattern}.Match(test.name))
+		})
+	}
+}
+
+func TestReadFolderFilters(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.mp4":                  {Data: []byte("a")},
+		"b.txt":                  {Data: []byte("b")},
+		"movies/c.mp4":           {Data: []byte("c")},
+		"movies/tmp/d.mp4":       {Data: []byte("d")},
+		"node_modules/e/f.mp4":   {Data: []byte("f")},
+		"src/node_modules/g.mp4": {Data: []byte("g")},
+	}
+
+	tests := []struct {
+		name                       string
+		include, exclude           Globs
+		includeRegex, excludeRegex []string
+		folders                    Folder
+		files                      File
+		skipped                    Skipped
+	}{
+		{
+			name:    "include",
+			include: Globs{"*.mp4"},
+			folders: Folder{"movies": {}, filepath.Join("movies", "tmp"): {}, "node_modules": {}, filepath.Join("node_modules", "e"): {}, "src": {}, filepath.Join("src", "node_modules"): {}},
+			files: File{"a.mp4": 1, filepath.Join("movies", "c.mp4"): 1, filepath.Join("movies", "tmp", "d.mp4"): 1,
+				filepath.Join("node_modules", "e", "f.mp4"): 1, filepath.Join("src", "node_modules", "g.mp4"): 1},
+			skipped: Skipped{"b.txt": ReasonNotIncluded},
+		},
+		{
+			name:    "exclude",
+			exclude: Globs{"**/node_modules", "movies/tmp"},
+			folders: Folder{"movies": {}, "src": {}},
+			files:   File{"a.mp4": 1, "b.txt": 1, filepath.Join("movies", "c.mp4"): 1},
+			skipped: Skipped{"node_modules": ReasonExcluded, filepath.Join("src", "node_modules"): ReasonExcluded, filepath.Join("movies", "tmp"): ReasonExcluded},
+		},
+		{
+			name:    "exclude wins over include",
+			include: Globs{"*.mp4"},
+			exclude: Globs{"c.mp4", "node_modules", "src", "movies/tmp/**"},
+			folders: Folder{"movies": {}},
+			files:   File{"a.mp4": 1},
+			skipped: Skipped{"b.txt": ReasonNotIncluded, filepath.Join("movies", "c.mp4"): ReasonExcluded, filepath.Join("movies", "tmp"): ReasonExcluded,
+				"node_modules": ReasonExcluded, "src": ReasonExcluded},
+		},
+		{
+			name:         "exclude regex",
+			excludeRegex: []string{`(^|/)node_modules/$`, `^movies/.*/$`, `\.txt$`},
+			folders:      Folder{"movies": {}, "src": {}},
+			files:        File{"a.mp4": 1, filepath.Join("movies", "c.mp4"): 1},
+			skipped: Skipped{"b.txt": ReasonExcludedRegex, "node_modules": ReasonExcludedRegex, filepath.Join("src", "node_modules"): ReasonExcludedRegex,
+				filepath.Join("movies", "tmp"): ReasonExcludedRegex},
+		},
+		{
+			name:         "include regex or glob",
+			include:      Globs{"b.txt"},
+			includeRegex: []string{`^movies/[^/]*\.mp4$`},
+			exclude:      Globs{"node_modules", "src"},
+			folders:      Folder{"movies": {}, filepath.Join("movies", "tmp"): {}},
+			files:        File{"b.txt": 1, filepath.Join("movies", "c.mp4"): 1},
+			skipped: Skipped{"a.mp4": ReasonNotIncluded, filepath.Join("movies", "tmp", "d.mp4"): ReasonNotIncluded,
+				"node_modules": ReasonExcluded, "src": ReasonExcluded},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &Options{Include: test.include, Exclude: test.exclude}
+			for _, expr := range test.includeRegex {
+				assertError(t, nil, opts.IncludeRegex.Set(expr))
+			}
+			for _, expr := range test.excludeRegex {
+				assertError(t, nil, opts.ExcludeRegex.Set(expr))
+			}
+
+			folders, files, skipped, err := ReadFS(fsys, opts)
+			assertError(t, nil, err)
+			assert(t, test.folders, folders)
+			assert(t, test.files, files)
+			assert(t, test.skipped, skipped)
+		})
+	}
+}
+
+func TestRegexps(t *testing.T) {
+	var r Regexps
+	assert(t, true, errors.Is(r.Set("a(b"), ErrBadRegex))
+	assertError(t, nil, r.Set(`_old/$`))
+	assertError(t, nil, r.Set(`^a/[0-9]+\.log$`))
+	assert(t, `_old/$ ^a/[0-9]+\.log$`, r.String())
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{name: "x/photos_old", isDir: true, want: true},
+		{name: "x/photos_old"},
+		{name: "x/photos_old/a", isDir: true},
+		{name: "a/12.log", want: true},
+		{name: "b/a/12.log"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert(t, test.want, r.Match(test.name, test.isDir))
+		})
+	}
+}
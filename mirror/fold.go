@@ -0,0 +1,56 @@
+package mirror
+
+import (
+	"strings"
+	"unicode"
+)
+
+// foldTable maps lower case Latin letters with diacritics to the letters without them. It covers Latin-1 and
+// Latin Extended-A, which is what names of files on European systems usually contain
+var foldTable = func() map[rune]rune {
+	letters := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏő",
+		'r': "ŕŗř",
+		's': "śŝşš",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűų",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+
+	table := make(map[rune]rune)
+	for base, variants := range letters {
+		for _, r := range variants {
+			table[r] = base
+		}
+	}
+	return table
+}()
+
+// foldName returns name in lower case without diacritics, combining marks of decomposed letters (NFD) included,
+// so names that differ only in case or Unicode normalization fold into the same string
+func foldName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if base, ok := foldTable[r]; ok {
+			r = base
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
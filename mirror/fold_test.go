@@ -0,0 +1,20 @@
+package mirror
+
+import "testing"
+
+func TestFoldName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Foo.TXT", "foo.txt"},
+		{"Žltý kôň", "zlty kon"},
+		{"e\u0301te\u0301", "ete"},
+		{"日本", "日本"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert(t, tt.want, foldName(tt.name))
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+)
+
+const (
+	FlagNameFollowLinks  = "follow-links"
+	FlagUsageFollowLinks = "copy what symlinks in src point to instead of skipping them, links to folders that hold them are skipped"
+	ErrFollowLinksMode   = CustomErr("the -" + FlagNameLinks + " and -" + FlagNameFollowLinks + " flags can't be used together")
+	ReasonBrokenLink     = "symlink whose target doesn't exist"
+	ReasonLinkCycle      = "symlink to a folder that holds it"
+)
+
+// ReadFSFollowLinks is ReadFS that lists symlinks as the files and folders they point to. A link to a folder that
+// holds it, which would make the tree endless, is skipped with ReasonLinkCycle
+func ReadFSFollowLinks(fsys fs.FS, opts *Options) (folders Folder, files File, skipped Skipped, err error) {
+	r := &folderReader{fsys: fsys, folders: make(Folder), files: make(File), skipped: make(Skipped), artifacts: opts.artifactsIn(fsys), follow: true, opts: opts}
+	root, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return
+	}
+	r.parents = []fs.FileInfo{root}
+	err = r.readFolder(".", nil)
+	return r.folders, r.files, r.skipped, err
+}
+
+// inParents returns true if the folder info is one of the folders that hold the one being read
+func (r *folderReader) inParents(info fs.FileInfo) bool {
+	for _, parent := range r.parents {
+		if os.SameFile(parent, info) {
+			return true
+		}
+	}
+	return false
+}
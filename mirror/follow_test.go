@@ -0,0 +1,67 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFSFollowLinks(t *testing.T) {
+	src := t.TempDir()
+	assertError(t, nil, os.MkdirAll(filepath.Join(src, "a", "b"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a", "file"), []byte("1"), FilePerm))
+	if err := os.Symlink("file", filepath.Join(src, "a", "rel")); err != nil {
+		t.Skip("can't make symlinks:", err)
+	}
+	assertError(t, nil, os.Symlink("a", filepath.Join(src, "folder")))
+	assertError(t, nil, os.Symlink(filepath.Join(src, "missing"), filepath.Join(src, "broken")))
+	assertError(t, nil, os.Symlink(filepath.Join("..", ".."), filepath.Join(src, "a", "b", "up")))
+
+	folders, files, skipped, err := ReadFSFollowLinks(OSFS(src), &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}, filepath.Join("a", "b"): {}, "folder": {}, filepath.Join("folder", "b"): {}}, folders)
+	assert(t, File{
+		filepath.Join("a", "file"): 1, filepath.Join("a", "rel"): 1,
+		filepath.Join("folder", "file"): 1, filepath.Join("folder", "rel"): 1,
+	}, files)
+	assert(t, Skipped{
+		"broken":                           ReasonBrokenLink,
+		filepath.Join("a", "b", "up"):      ReasonLinkCycle,
+		filepath.Join("folder", "b", "up"): ReasonLinkCycle,
+	}, skipped)
+}
+
+func TestMirrorFollowLinks(t *testing.T) {
+	discardLog(t)
+	src, dst, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(outside, "file"), []byte("data"), 0o600))
+	if err := os.Symlink(filepath.Join(outside, "file"), filepath.Join(src, "link")); err != nil {
+		t.Skip("can't make symlinks:", err)
+	}
+	// links in dst aren't followed, so this one and what it points to are left alone
+	assertError(t, nil, os.Symlink(outside, filepath.Join(dst, "extra")))
+
+	m, err := New(src, dst, WithFollowLinks(), WithLogFile(os.DevNull))
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assertError(t, nil, m.Sync(context.Background(), p))
+
+	b, err := os.ReadFile(filepath.Join(dst, "link"))
+	assertError(t, nil, err)
+	assert(t, "data", string(b))
+	info, err := os.Lstat(filepath.Join(dst, "link"))
+	assertError(t, nil, err)
+	assert(t, true, info.Mode().IsRegular())
+	if permsSupported {
+		assert(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+	_, err = os.Stat(filepath.Join(outside, "file"))
+	assertError(t, nil, err)
+	_, err = os.Lstat(filepath.Join(dst, "extra"))
+	assertError(t, nil, err)
+
+	_, err = New(src, dst, WithFollowLinks(), WithLinks())
+	assertError(t, ErrFollowLinksMode, err)
+}
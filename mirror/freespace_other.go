@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package mirror
+
+func freeSpace(path string) (free int64, ok bool, err error) {
+	return
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package mirror
+
+import "syscall"
+
+func freeSpace(path string) (free int64, ok bool, err error) {
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(path, &stat); err != nil {
+		return
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), true, nil
+}
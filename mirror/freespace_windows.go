@@ -0,0 +1,23 @@
+package mirror
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+func freeSpace(path string) (free int64, ok bool, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return
+	}
+
+	// the second argument is the space available to the user, quotas included
+	var available uint64
+	if r, _, errCall := procGetDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&available)), 0, 0); r == 0 {
+		err = errCall
+		return
+	}
+	return int64(available), true, nil
+}
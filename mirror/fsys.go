@@ -0,0 +1,81 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const ErrBirthTimeNeedsOSFS = CustomErr("creation times can only be copied from a folder on disk")
+
+// OSFS is the folder on disk at its path as an fs.FS, it's the source that ReadFolder and CopyFiles use.
+// Unlike os.DirFS it joins names with filepath.Join, so long paths on Windows keep working. Its Stat follows symlinks,
+// so the files and folders that ReadFSFollowLinks lists have the attributes of what the links point to. ReadFolder
+// decides about everything else with the info of the folder entries, which doesn't follow them
+type OSFS string
+
+func (f OSFS) Open(name string) (fs.File, error) {
+	path, err := f.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (f OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := f.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+func (f OSFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := f.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+// join turns the slash separated name into a path on disk
+func (f OSFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return string(f), nil
+	}
+	return filepath.Join(string(f), filepath.FromSlash(name)), nil
+}
+
+// fsName turns a path of a File or Folder into a name of an fs.FS
+func fsName(path string) string {
+	return filepath.ToSlash(path)
+}
+
+// needsOSFS returns an error if opts copy something that only a source on disk has but fsys isn't an OSFS
+func needsOSFS(fsys fs.FS, opts *Options) error {
+	if _, ok := fsys.(OSFS); ok {
+		return nil
+	}
+	if opts.BirthTime {
+		return ErrBirthTimeNeedsOSFS
+	}
+	if opts.Xattrs {
+		return ErrXattrsNeedsOSFS
+	}
+	if opts.FileFlags {
+		return ErrFileFlagsNeedsOSFS
+	}
+	if opts.PreserveOwner {
+		return ErrOwnerNeedsOSFS
+	}
+	if opts.Links {
+		return ErrLinksNeedsOSFS
+	}
+	if opts.Move {
+		return ErrMoveNeedsOSFS
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package mirror
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestOSFS(t *testing.T) {
+	root := t.TempDir()
+	assertError(t, nil, os.MkdirAll(filepath.Join(root, "a", "b"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(root, "a", "b", "c"), []byte("ccc"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(root, "d"), []byte("d"), FilePerm))
+
+	assertError(t, nil, fstest.TestFS(OSFS(root), "a/b/c", "d"))
+
+	for _, name := range []string{"../d", "/d", "a/../d", ""} {
+		_, err := OSFS(root).Open(name)
+		assertError(t, fs.ErrInvalid, err.(*fs.PathError).Err)
+	}
+}
+
+func TestReadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b/c":                      {Data: []byte("ccc")},
+		"a/d":                        {Data: []byte("d")},
+		"e":                          {Mode: fs.ModeDir},
+		"link":                       {Mode: fs.ModeSymlink},
+		"pipe":                       {Mode: fs.ModeNamedPipe},
+		FolderToIgnore + "/secret":   {Data: []byte("s")},
+		TempDirPrefix + "1/part":     {Data: []byte("p")},
+		"a/" + FolderToIgnore + "/x": {Data: []byte("x")},
+	}
+
+	folders, files, skipped, err := ReadFS(fsys, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}, filepath.Join("a", "b"): {}, "e": {}}, folders)
+	assert(t, File{filepath.Join("a", "b", "c"): 3, filepath.Join("a", "d"): 1}, files)
+	assert(t, Skipped{
+		"link":                             ReasonSymlink,
+		"pipe":                             ReasonSpecialFile,
+		FolderToIgnore:                     ReasonIgnoredFolder,
+		TempDirPrefix + "1":                ReasonTempFolder,
+		filepath.Join("a", FolderToIgnore): ReasonIgnoredFolder,
+	}, skipped)
+}
+
+func TestCopyFilesFS(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a/b": {Data: []byte("bbb"), ModTime: modTime},
+		"c":   {Data: []byte("c"), ModTime: modTime},
+	}
+	files := File{filepath.Join("a", "b"): 3, "c": 1, "vanished": 5}
+
+	t.Run("files are copied with their modification times", func(t *testing.T) {
+		dst := t.TempDir()
+		assertError(t, nil, os.Mkdir(filepath.Join(dst, "a"), FolderPerm))
+		opts := &Options{LogPath: os.DevNull, Compare: Comparer{Mode: CompareSizeModTime}}
+
+		assertError(t, nil, CopyFilesFS(files, TotalSize(files), fsys, dst, opts))
+		assert(t, []string{"vanished"}, opts.Report.Vanished)
+
+		_, got, _, err := ReadFolder(dst, &Options{})
+		assertError(t, nil, err)
+		assert(t, File{filepath.Join("a", "b"): 3, "c": 1}, got)
+
+		data, err := os.ReadFile(filepath.Join(dst, "a", "b"))
+		assertError(t, nil, err)
+		assert(t, "bbb", string(data))
+
+		info, err := os.Stat(filepath.Join(dst, "c"))
+		assertError(t, nil, err)
+		assert(t, true, info.ModTime().Equal(modTime))
+	})
+
+	t.Run("creation times need a folder on disk", func(t *testing.T) {
+		err := CopyFilesFS(files, TotalSize(files), fsys, t.TempDir(), &Options{LogPath: os.DevNull, BirthTime: true})
+		assertError(t, ErrBirthTimeNeedsOSFS, err)
+	})
+}
+
+func TestNewFS(t *testing.T) {
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	for name, content := range map[string]string{"a/b": "bbb", "a/c/d": "dd", "e": "e"} {
+		f, err := w.Create(name)
+		assertError(t, nil, err)
+		_, err = f.Write([]byte(content))
+		assertError(t, nil, err)
+	}
+	assertError(t, nil, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	assertError(t, nil, err)
+
+	dst := t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "old"), []byte("o"), FilePerm))
+
+	_, err = NewFS(r, dst, WithBirthTime())
+	assertError(t, ErrBirthTimeNeedsOSFS, err)
+
+	m, err := NewFS(r, dst, WithLogFile(""))
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, File{"old": 1}, p.FilesToClean)
+	assertError(t, nil, m.Sync(context.Background(), p))
+
+	folders, files, _, err := ReadFolder(dst, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}, filepath.Join("a", "c"): {}}, folders)
+	assert(t, File{filepath.Join("a", "b"): 3, filepath.Join("a", "c", "d"): 2, "e": 1}, files)
+}
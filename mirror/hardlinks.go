@@ -0,0 +1,143 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	FlagNameHardLinks          = "hard-links"
+	FlagUsageHardLinks         = "make hard links in dst between files that are hard links of each other in src, instead of copying the same data again"
+	ErrHardLinksUnsupported    = CustomErr("hard links can't be found on Windows")
+	LogMadeHardLinks           = "hard links made:"
+	MsgProgressMakingHardLinks = "making hard links:"
+	PlanMakeHardLink           = "make hard link"
+)
+
+// HardLinks maps relative paths of files that aren't copied to the paths of files in the same tree that they are
+// made as hard links of, see PlanHardLinks
+type HardLinks map[string]string
+
+// fileID is the device and the inode of a file, which every hard link of the file shares
+type fileID struct {
+	dev, ino uint64
+}
+
+// HardLinkGroups returns the paths of files that are hard links of each other in fsys, sorted, one group for each
+// file with more than one path in files. It stats every file once more, a file that is gone in the meantime is left out
+func HardLinkGroups(fsys fs.FS, files File, opts *Options) ([][]string, error) {
+	ids := make(map[fileID][]string)
+	for _, file := range sortFoldersOrFiles(files) {
+		info, err := fs.Stat(fsys, fsName(file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			if opts.ignoreErr(file, err) {
+				continue
+			}
+			return nil, err
+		}
+		if id, ok := hardLinkID(info); ok {
+			ids[id] = append(ids[id], file)
+		}
+	}
+
+	var groups [][]string
+	for _, paths := range ids {
+		if len(paths) > 1 {
+			groups = append(groups, paths)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups, nil
+}
+
+// PlanHardLinks moves files of missing that have a hard link among the other files of their group to the returned
+// links. Every group keeps one file to link to: the first one that is already in dst, or the first one otherwise,
+// which stays in missing, so it's copied before the links are made
+func PlanHardLinks(groups [][]string, missing File) HardLinks {
+	links := make(HardLinks)
+	for _, group := range groups {
+		target := group[0]
+		for _, file := range group {
+			if _, ok := missing[file]; !ok {
+				target = file
+				break
+			}
+		}
+		for _, file := range group {
+			if _, ok := missing[file]; ok && file != target {
+				links[file] = target
+				delete(missing, file)
+			}
+		}
+	}
+	return links
+}
+
+// MakeHardLinks makes every file of links in path as a hard link of the file it maps to and logs progress. A file
+// that is already there is replaced
+func MakeHardLinks(links HardLinks, path string, opts *Options) error {
+	var recentlyLoggedProgress, counter int
+
+	f, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(f, LogMadeHardLinks+"\n")
+	log.Println(MsgProgressMakingHardLinks, ZeroPercent)
+
+	sortedLinks := sortLinks(Links(links))
+	for _, link := range sortedLinks {
+		if opts.stopped() {
+			return closeStoppedLog(f)
+		}
+
+		if err = makeHardLink(filepath.Join(path, links[link]), filepath.Join(path, link)); err != nil {
+			if !opts.ignoreErr(link, err) {
+				f.Close()
+				return err
+			}
+			continue
+		}
+
+		logProgressFolders(&recentlyLoggedProgress, &counter, len(sortedLinks), MsgProgressMakingHardLinks)
+		opts.sendProgress(PhaseMakingHardLinks, int64(counter), int64(len(sortedLinks)))
+
+		LogToFile(f, link)
+		opts.journal(link)
+	}
+
+	err = f.Close()
+	return err
+}
+
+// WriteHardLinks is WriteLinks for hard links
+func WriteHardLinks(w io.Writer, links HardLinks) error {
+	for _, link := range sortLinks(Links(links)) {
+		if _, err := fmt.Fprintf(w, formatPlanLink, PlanMakeHardLink, link, links[link]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeHardLink makes path a hard link of target, a file that is already at path is removed first
+func makeHardLink(target, path string) error {
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return os.Link(target, path)
+}
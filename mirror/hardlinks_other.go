@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+const hardLinksSupported = true
+
+// hardLinkID returns the fileID of the file in info if it has more than one path
+func hardLinkID(info fs.FileInfo) (fileID, bool) {
+	s, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || s.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(s.Dev), ino: uint64(s.Ino)}, true
+}
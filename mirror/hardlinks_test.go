@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHardLinkGroups(t *testing.T) {
+	if !hardLinksSupported {
+		t.Skip(ErrHardLinksUnsupported)
+	}
+	src := t.TempDir()
+	assertError(t, nil, os.MkdirAll(filepath.Join(src, "a"), FolderPerm))
+	for _, file := range []string{"1", "2", "single"} {
+		assertError(t, nil, os.WriteFile(filepath.Join(src, file), []byte(file), FilePerm))
+	}
+	if err := os.Link(filepath.Join(src, "1"), filepath.Join(src, "a", "1")); err != nil {
+		t.Skip("can't make hard links:", err)
+	}
+	assertError(t, nil, os.Link(filepath.Join(src, "1"), filepath.Join(src, "b")))
+	assertError(t, nil, os.Link(filepath.Join(src, "2"), filepath.Join(src, "c")))
+	// a link to outside of the listed files doesn't make a group
+	assertError(t, nil, os.Link(filepath.Join(src, "single"), filepath.Join(t.TempDir(), "outside")))
+
+	_, files, _, err := ReadFolder(src, &Options{})
+	assertError(t, nil, err)
+	files["gone"] = 1
+
+	groups, err := HardLinkGroups(OSFS(src), files, &Options{})
+	assertError(t, nil, err)
+	assert(t, [][]string{{"1", filepath.Join("a", "1"), "b"}, {"2", "c"}}, groups)
+}
+
+func TestPlanHardLinks(t *testing.T) {
+	groups := [][]string{{"a", "b", "c"}, {"d", "e"}, {"f", "g"}}
+	tests := []struct {
+		name    string
+		missing File
+		links   HardLinks
+		left    File
+	}{
+		{
+			name:    "all missing",
+			missing: File{"a": 1, "b": 1, "c": 1, "d": 2, "e": 2},
+			links:   HardLinks{"b": "a", "c": "a", "e": "d"},
+			left:    File{"a": 1, "d": 2},
+		},
+		{
+			name:    "one is in dst",
+			missing: File{"a": 1, "c": 1},
+			links:   HardLinks{"a": "b", "c": "b"},
+			left:    File{},
+		},
+		{name: "none missing", missing: File{"x": 1}, links: HardLinks{}, left: File{"x": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert(t, test.links, PlanHardLinks(groups, test.missing))
+			assert(t, test.left, test.missing)
+		})
+	}
+}
+
+func TestMakeHardLinks(t *testing.T) {
+	discardLog(t)
+	dst := t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "target"), []byte("1"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "old"), []byte("old"), FilePerm))
+
+	opts := &Options{LogPath: os.DevNull}
+	if err := MakeHardLinks(HardLinks{"new": "target", "old": "target"}, dst, opts); err != nil {
+		t.Skip("can't make hard links:", err)
+	}
+	target, err := os.Stat(filepath.Join(dst, "target"))
+	assertError(t, nil, err)
+	for _, link := range []string{"new", "old"} {
+		info, err := os.Stat(filepath.Join(dst, link))
+		assertError(t, nil, err)
+		assert(t, true, os.SameFile(target, info))
+	}
+
+	assert(t, true, MakeHardLinks(HardLinks{"x": "missing"}, dst, opts) != nil)
+}
+
+func TestMirrorWithHardLinks(t *testing.T) {
+	if !hardLinksSupported {
+		t.Skip(ErrHardLinksUnsupported)
+	}
+	discardLog(t)
+	src, dst := t.TempDir(), t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a"), []byte("data"), FilePerm))
+	if err := os.Link(filepath.Join(src, "a"), filepath.Join(src, "b")); err != nil {
+		t.Skip("can't make hard links:", err)
+	}
+	assertError(t, nil, os.Link(filepath.Join(src, "a"), filepath.Join(src, "c")))
+	// a is already in dst, so the others are linked to it
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "a"), []byte("data"), FilePerm))
+
+	m, err := New(src, dst, WithHardLinks(), WithLogFile(os.DevNull))
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, File{}, p.MissingFiles)
+	assert(t, int64(0), p.CopySize)
+	assert(t, HardLinks{"b": "a", "c": "a"}, p.HardLinks)
+
+	assertError(t, nil, m.Copy(context.Background(), p))
+	a, err := os.Stat(filepath.Join(dst, "a"))
+	assertError(t, nil, err)
+	for _, file := range []string{"b", "c"} {
+		info, err := os.Stat(filepath.Join(dst, file))
+		assertError(t, nil, err)
+		assert(t, true, os.SameFile(a, info))
+	}
+
+	p, err = m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, true, p.Empty())
+}
+
+func TestWriteHardLinks(t *testing.T) {
+	var b bytes.Buffer
+	assertError(t, nil, WriteHardLinks(&b, HardLinks{"b": "a", "c": "a"}))
+	assert(t, "make hard link  b -> a\nmake hard link  c -> a\n", b.String())
+}
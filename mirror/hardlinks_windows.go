@@ -0,0 +1,10 @@
+package mirror
+
+import "io/fs"
+
+// fs.FileInfo on Windows doesn't have the file index that tells hard links apart
+const hardLinksSupported = false
+
+func hardLinkID(info fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,144 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MirrorIgnoreFile holds gitignore-style patterns of items in its folder that aren't mirrored, see parseIgnoreFile
+	MirrorIgnoreFile   = ".mirrorignore"
+	ErrBadMirrorIgnore = CustomErr("invalid pattern at")
+	ReasonMirrorIgnore = "matched by " + MirrorIgnoreFile
+)
+
+// ignoreRule is one pattern of a MirrorIgnoreFile
+type ignoreRule struct {
+	// parts is the pattern split at slashes. A rule that isn't anchored has one part that matches names in any folder
+	parts    []string
+	anchored bool
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreFile holds the rules of the MirrorIgnoreFile in folder, which uses forward slashes
+type ignoreFile struct {
+	folder string
+	rules  []ignoreRule
+}
+
+// parseIgnoreFile reads rules like gitignore does: blank lines and lines starting with '#' are skipped, '!' re-includes
+// what an earlier rule ignored, a trailing slash only matches folders, a pattern with another slash is relative to
+// folder, other patterns match names in any folder below it, and '**' matches any number of folders
+func parseIgnoreFile(folder string, data []byte) (*ignoreFile, error) {
+	res := &ignoreFile{folder: folder}
+
+	for n, line := range strings.Split(strings.TrimPrefix(string(data), "\ufeff"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored, line = true, strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		r.parts = strings.Split(line, "/")
+		for _, part := range r.parts {
+			if _, err := path.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("%w %s:%d", ErrBadMirrorIgnore, filepath.FromSlash(path.Join(folder, MirrorIgnoreFile)), n+1)
+			}
+		}
+		res.rules = append(res.rules, r)
+	}
+	return res, nil
+}
+
+// match returns true if rel, the path of an item relative to the folder of the rule, matches r
+func (r ignoreRule) match(rel string) bool {
+	if !r.anchored {
+		ok, _ := path.Match(r.parts[0], path.Base(rel))
+		return ok
+	}
+
+	parts := strings.Split(rel, "/")
+	// a trailing '**' matches what is inside a folder, but not the folder, so a later rule can re-include some of it
+	if r.parts[len(r.parts)-1] == globAnyFolders && len(parts) < len(r.parts) {
+		return false
+	}
+	return matchParts(r.parts, parts)
+}
+
+// ignored returns true if the item name (with forward slashes, from the read folder) is ignored by files, which
+// are ordered from the read folder down. The last matching rule decides, so rules of deeper folders win
+func ignored(files []*ignoreFile, name string, isDir bool) bool {
+	res := false
+	for _, f := range files {
+		rel := name
+		if f.folder != "." {
+			if !strings.HasPrefix(name, f.folder+"/") {
+				continue
+			}
+			rel = name[len(f.folder)+1:]
+		}
+		for _, r := range f.rules {
+			if (!r.dirOnly || isDir) && r.match(rel) {
+				res = !r.negate
+			}
+		}
+	}
+	return res
+}
+
+// loadIgnoreFile adds the MirrorIgnoreFile of the folder name to ignores. It's read from opts.IgnoreFS if it's set,
+// so dst is read with the rules of src, and from fsys otherwise, where items tell whether there is one
+func (o *Options) loadIgnoreFile(fsys fs.FS, name string, items []fs.DirEntry, ignores []*ignoreFile) ([]*ignoreFile, error) {
+	source := o.IgnoreFS
+	if source == nil {
+		source = fsys
+		found := false
+		for _, item := range items {
+			if item.Name() == MirrorIgnoreFile {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ignores, nil
+		}
+	}
+
+	data, err := fs.ReadFile(source, path.Join(name, MirrorIgnoreFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ignores, nil
+	}
+	if err != nil {
+		return ignores, err
+	}
+
+	f, err := parseIgnoreFile(name, data)
+	if err != nil {
+		return ignores, err
+	}
+	// sibling folders must not share the backing array
+	return append(ignores[:len(ignores):len(ignores)], f), nil
+}
@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseIgnoreFile(t *testing.T) {
+	data := "# comment\n\n*.log  \n!keep.log\r\nbuild/\n/cache\ndocs/**/*.pdf\n\\#hash\n\\!bang\ntrailing\\ \n/\n"
+
+	f, err := parseIgnoreFile("a", []byte(data))
+	assertError(t, nil, err)
+	assert(t, &ignoreFile{folder: "a", rules: []ignoreRule{
+		{parts: []string{"*.log"}},
+		{parts: []string{"keep.log"}, negate: true},
+		{parts: []string{"build"}, dirOnly: true},
+		{parts: []string{"cache"}, anchored: true},
+		{parts: []string{"docs", "**", "*.pdf"}, anchored: true},
+		{parts: []string{"#hash"}},
+		{parts: []string{"!bang"}},
+		{parts: []string{`trailing\ `}},
+	}}, f)
+
+	_, err = parseIgnoreFile("a", []byte("*.log\n[b\n"))
+	assert(t, true, errors.Is(err, ErrBadMirrorIgnore))
+	assert(t, ErrBadMirrorIgnore.Error()+" "+filepath.Join("a", MirrorIgnoreFile)+":2", err.Error())
+}
+
+func TestIgnored(t *testing.T) {
+	root, err := parseIgnoreFile(".", []byte("*.log\nbuild/\n/top\nsrc/**\n!src/main.go\n"))
+	assertError(t, nil, err)
+	nested, err := parseIgnoreFile("sub", []byte("!debug.log\n/local\n"))
+	assertError(t, nil, err)
+	files := []*ignoreFile{root, nested}
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{name: "a.log", want: true},
+		{name: "x/y/a.log", want: true},
+		{name: "sub/debug.log"},
+		{name: "sub/other.log", want: true},
+		{name: "build", isDir: true, want: true},
+		{name: "x/build", isDir: true, want: true},
+		{name: "build"},
+		{name: "top", want: true},
+		{name: "x/top"},
+		{name: "sub/local", want: true},
+		{name: "local"},
+		{name: "src", isDir: true},
+		{name: "src/util.go", want: true},
+		{name: "src/main.go"},
+		{name: "readme"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert(t, test.want, ignored(files, test.name, test.isDir))
+		})
+	}
+}
+
+func TestReadFolderMirrorIgnore(t *testing.T) {
+	src := fstest.MapFS{
+		MirrorIgnoreFile:          {Data: []byte("*.tmp\nnode_modules/\n")},
+		"a.txt":                   {Data: []byte("a")},
+		"a.tmp":                   {Data: []byte("a")},
+		"app/node_modules/x":      {Data: []byte("x")},
+		"app/" + MirrorIgnoreFile: {Data: []byte("!keep.tmp\n/dist\n")},
+		"app/keep.tmp":            {Data: []byte("k")},
+		"app/dist/app.js":         {Data: []byte("js")},
+		"lib/dist/lib.js":         {Data: []byte("js")},
+	}
+
+	folders, files, skipped, err := ReadFS(src, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"app": {}, "lib": {}, filepath.Join("lib", "dist"): {}}, folders)
+	assert(t, File{MirrorIgnoreFile: 20, "a.txt": 1, filepath.Join("app", MirrorIgnoreFile): 16, filepath.Join("app", "keep.tmp"): 1,
+		filepath.Join("lib", "dist", "lib.js"): 2}, files)
+	assert(t, Skipped{"a.tmp": ReasonMirrorIgnore, filepath.Join("app", "node_modules"): ReasonMirrorIgnore,
+		filepath.Join("app", "dist"): ReasonMirrorIgnore}, skipped)
+
+	t.Run("dst is read with the rules of src", func(t *testing.T) {
+		dst := fstest.MapFS{
+			MirrorIgnoreFile: {Data: []byte("# old rules\n")},
+			"a.txt":          {Data: []byte("a")},
+			"old.tmp":        {Data: []byte("o")},
+			"app/dist/x.js":  {Data: []byte("x")},
+		}
+
+		_, files, skipped, err := ReadFS(dst, &Options{IgnoreFS: src})
+		assertError(t, nil, err)
+		assert(t, File{MirrorIgnoreFile: 12, "a.txt": 1}, files)
+		assert(t, Skipped{"old.tmp": ReasonMirrorIgnore, filepath.Join("app", "dist"): ReasonMirrorIgnore}, skipped)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		src := fstest.MapFS{"lib/" + MirrorIgnoreFile: {Data: []byte("[bad\n")}}
+		_, _, _, err := ReadFS(src, &Options{})
+		assert(t, true, errors.Is(err, ErrBadMirrorIgnore))
+	})
+}
@@ -0,0 +1,41 @@
+package mirror
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	FlagNameIgnoreDir  = "ignore-dir"
+	FlagUsageIgnoreDir = "name of folders that are skipped in src and dst wherever they are, e.g. .git or cache, besides " + FolderToIgnore + " (can be repeated)"
+	ErrBadFolderName   = CustomErr("a folder name can't contain a path separator, name")
+	reasonFolderNamed  = "folder named "
+)
+
+// Names holds names of folders that can be used as a repeatable command line flag
+type Names []string
+
+func (n *Names) String() string {
+	return strings.Join(*n, ",")
+}
+
+func (n *Names) Set(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w %q", ErrBadFolderName, name)
+	}
+	*n = append(*n, name)
+	return nil
+}
+
+// ignoredDir returns the reason why folders named name are skipped, or an empty string if they aren't
+func (o *Options) ignoredDir(name string) string {
+	if name == FolderToIgnore {
+		return ReasonIgnoredFolder
+	}
+	for _, ignored := range o.IgnoreDirs {
+		if name == ignored {
+			return reasonFolderNamed + name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package mirror
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNamesSet(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: ".git"},
+		{name: "node modules"},
+		{name: "", err: ErrBadFolderName},
+		{name: "..", err: ErrBadFolderName},
+		{name: "a/b", err: ErrBadFolderName},
+		{name: `a\b`, err: ErrBadFolderName},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var n Names
+			err := n.Set(test.name)
+			assert(t, test.err != nil, errors.Is(err, ErrBadFolderName))
+			if test.err == nil {
+				assert(t, Names{test.name}, n)
+			}
+		})
+	}
+}
+
+func TestReadFolderIgnoreDirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		".git/HEAD":                    {Data: []byte("h")},
+		"app/cache/c":                  {Data: []byte("c")},
+		"app/cache.txt":                {Data: []byte("t")},
+		"app/" + FolderToIgnore + "/s": {Data: []byte("s")},
+		"tmp/cache/c":                  {Data: []byte("c")},
+	}
+
+	folders, files, skipped, err := ReadFS(fsys, &Options{IgnoreDirs: Names{".git", "cache"}})
+	assertError(t, nil, err)
+	assert(t, Folder{"app": {}, "tmp": {}}, folders)
+	assert(t, File{filepath.Join("app", "cache.txt"): 1}, files)
+	assert(t, Skipped{
+		".git":                               reasonFolderNamed + ".git",
+		filepath.Join("app", "cache"):        reasonFolderNamed + "cache",
+		filepath.Join("tmp", "cache"):        reasonFolderNamed + "cache",
+		filepath.Join("app", FolderToIgnore): ReasonIgnoredFolder,
+	}, skipped)
+	assert(t, `skipped in "src": folder named .git 1, folder named cache 2, `+ReasonIgnoredFolder+" 1", skipped.Summary("src"))
+}
@@ -0,0 +1,197 @@
+package mirror
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	CmdInit                 = "init"
+	MetaFolder              = ".mirror"
+	DstConfigFile           = "config.json"
+	SchemaDstConfig         = 1
+	FlagUsageInitDst        = "folder that is set up as a destination, it's made if it doesn't exist"
+	FlagUsageInitC          = "runs into dst clean it"
+	FlagUsageInitSync       = "runs into dst sync it"
+	FlagUsageInitCAS        = "runs into dst store files in the content addressed layout"
+	ModeCopy                = "copy"
+	ModeClean               = "clean"
+	ModeSync                = FlagNameSync
+	ModeCAS                 = FlagNameCAS
+	ErrInitWrongArgs        = CustomErr("wrong arguments, use 'init -h' for help")
+	ErrInitialized          = CustomErr("the destination is already set up, its configuration is in")
+	ErrDstConfigMismatch    = CustomErr("the run doesn't match the configuration that the destination was set up with in")
+	ReasonMetaFolder        = "metadata folder"
+	formatDstConfigMismatch = "%s is %v, the destination has %v"
+)
+
+// DstConfig is the configuration that 'init' records in the metadata folder of a destination. Runs into the
+// destination have to use the same one, see CheckDstConfig
+type DstConfig struct {
+	// Schema is SchemaDstConfig
+	Schema  int       `json:"schema"`
+	Created time.Time `json:"created"`
+	// Version is the one of the program that set up the destination
+	Version string `json:"version"`
+	// Mode is ModeCopy, ModeClean, ModeSync or ModeCAS
+	Mode          string `json:"mode"`
+	Compare       string `json:"compare"`
+	PreserveTimes bool   `json:"preserveTimes"`
+	PreservePerms bool   `json:"preservePerms"`
+	PreserveOwner bool   `json:"preserveOwner"`
+	Xattrs        bool   `json:"xattrs"`
+	Links         bool   `json:"links"`
+	FollowLinks   bool   `json:"followLinks"`
+	HardLinks     bool   `json:"hardLinks"`
+}
+
+var dstConfigSchema = schema{name: "destination configuration", version: SchemaDstConfig, migrations: []func(map[string]json.RawMessage) error{migrateUnversioned},
+	required: []string{"mode", "compare"}}
+
+// DstConfigPath returns where the configuration of dst is
+func DstConfigPath(dst string) string {
+	return filepath.Join(dst, MetaFolder, DstConfigFile)
+}
+
+// Mode names what the run does: ModeCopy, ModeClean, ModeSync or ModeCAS
+func (f *Flags) Mode() string {
+	switch {
+	case f.CAS:
+		return ModeCAS
+	case f.Sync:
+		return ModeSync
+	case f.CleaningMode:
+		return ModeClean
+	default:
+		return ModeCopy
+	}
+}
+
+// DstConfig returns the configuration of the run that f describes
+func (f *Flags) DstConfig() DstConfig {
+	o := &f.Opts
+	compare := o.Compare.Mode
+	if compare == "" {
+		compare = CompareSize
+	}
+	return DstConfig{Mode: f.Mode(), Compare: compare, PreserveTimes: o.PreserveTimes, PreservePerms: o.PreservePerms,
+		PreserveOwner: o.PreserveOwner, Xattrs: o.Xattrs, Links: o.Links, FollowLinks: o.FollowLinks, HardLinks: o.HardLinks}
+}
+
+// VetInitFlags parses flags of the init subcommand, they are the flags of a run that the destination records, with the
+// same defaults, and rewrites dst into an absolute path
+func VetInitFlags(args []string) (dst string, config DstConfig, err error) {
+	fs := flag.NewFlagSet(CmdInit, flag.ExitOnError)
+	var flags Flags
+	dstPath := fs.String(FlagNameDst, "", FlagUsageInitDst)
+	fs.BoolVar(&flags.CleaningMode, FlagNameC, false, FlagUsageInitC)
+	fs.BoolVar(&flags.Sync, FlagNameSync, false, FlagUsageInitSync)
+	fs.BoolVar(&flags.CAS, FlagNameCAS, false, FlagUsageInitCAS)
+	fs.StringVar(&flags.Opts.Compare.Mode, FlagNameCompare, CompareSize, FlagUsageCompare)
+	fs.BoolVar(&flags.Opts.PreserveTimes, FlagNamePreserveTimes, true, FlagUsagePreserveTimes)
+	fs.BoolVar(&flags.Opts.PreservePerms, FlagNamePreservePerms, true, FlagUsagePreservePerms)
+	fs.BoolVar(&flags.Opts.PreserveOwner, FlagNamePreserveOwner, false, FlagUsagePreserveOwner)
+	fs.BoolVar(&flags.Opts.Xattrs, FlagNameXattrs, false, FlagUsageXattrs)
+	fs.BoolVar(&flags.Opts.Links, FlagNameLinks, false, FlagUsageLinks)
+	fs.BoolVar(&flags.Opts.FollowLinks, FlagNameFollowLinks, false, FlagUsageFollowLinks)
+	fs.BoolVar(&flags.Opts.HardLinks, FlagNameHardLinks, false, FlagUsageHardLinks)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	modes := 0
+	for _, set := range []bool{flags.CleaningMode, flags.Sync, flags.CAS} {
+		if set {
+			modes++
+		}
+	}
+	if *dstPath == "" || fs.NArg() > 0 || modes > 1 {
+		err = ErrInitWrongArgs
+		return
+	}
+	if m := flags.Opts.Compare.Mode; m != CompareSize && m != CompareSizeModTime {
+		err = ErrUnknownCompare
+		return
+	}
+	if flags.Opts.Links && flags.Opts.FollowLinks {
+		err = ErrFollowLinksMode
+		return
+	}
+
+	config = flags.DstConfig()
+	dst, err = filepath.Abs(*dstPath)
+	return
+}
+
+// InitDst makes dst if it doesn't exist and its metadata folder with config in it. A CAS destination also gets the
+// folders of its layout. A destination that is already set up stays as it is
+func InitDst(dst string, config DstConfig) error {
+	path := DstConfigPath(dst)
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w %q", ErrInitialized, path)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), FolderPerm); err != nil {
+		return err
+	}
+	if config.Mode == ModeCAS {
+		for _, folder := range []string{CASObjects, CASManifests} {
+			if err := os.MkdirAll(filepath.Join(dst, folder), FolderPerm); err != nil {
+				return err
+			}
+		}
+	}
+
+	config.Schema, config.Created, config.Version = SchemaDstConfig, time.Now().UTC(), Version
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, FilePerm)
+}
+
+// CheckDstConfig returns ErrDstConfigMismatch with every difference if flags don't match the configuration that dst
+// was set up with. A destination that wasn't set up with 'init' takes any run
+func CheckDstConfig(flags *Flags) error {
+	path := DstConfigPath(flags.Dst)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var want DstConfig
+	if err = decodeVersioned(data, dstConfigSchema, &want); err != nil {
+		return err
+	}
+	got := flags.DstConfig()
+
+	var diffs []string
+	add := func(flag string, got, want interface{}) {
+		if got != want {
+			diffs = append(diffs, fmt.Sprintf(formatDstConfigMismatch, flag, got, want))
+		}
+	}
+	add("the mode", got.Mode, want.Mode)
+	add("-"+FlagNameCompare, got.Compare, want.Compare)
+	add("-"+FlagNamePreserveTimes, got.PreserveTimes, want.PreserveTimes)
+	add("-"+FlagNamePreservePerms, got.PreservePerms, want.PreservePerms)
+	add("-"+FlagNamePreserveOwner, got.PreserveOwner, want.PreserveOwner)
+	add("-"+FlagNameXattrs, got.Xattrs, want.Xattrs)
+	add("-"+FlagNameLinks, got.Links, want.Links)
+	add("-"+FlagNameFollowLinks, got.FollowLinks, want.FollowLinks)
+	add("-"+FlagNameHardLinks, got.HardLinks, want.HardLinks)
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w %q: %s", ErrDstConfigMismatch, path, strings.Join(diffs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVetInitFlags(t *testing.T) {
+	dst := t.TempDir()
+	got, config, err := VetInitFlags([]string{"-dst", dst, "-cas", "-preserve-perms=false"})
+	assertError(t, nil, err)
+	assert(t, dst, got)
+	assert(t, DstConfig{Mode: ModeCAS, Compare: CompareSize, PreserveTimes: true}, config)
+
+	for _, args := range [][]string{{}, {"-dst", dst, "-c", "-sync"}, {"-dst", dst, "extra"}} {
+		_, _, err = VetInitFlags(args)
+		assertError(t, ErrInitWrongArgs, err)
+	}
+	_, _, err = VetInitFlags([]string{"-dst", dst, "-compare", "hash"})
+	assertError(t, ErrUnknownCompare, err)
+}
+
+func TestInitDst(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "dst")
+	config := DstConfig{Mode: ModeCAS, Compare: CompareSizeModTime, PreserveTimes: true}
+	assertError(t, nil, InitDst(dst, config))
+	for _, folder := range []string{CASObjects, CASManifests, MetaFolder} {
+		if f, err := os.Stat(filepath.Join(dst, folder)); err != nil || !f.IsDir() {
+			t.Errorf("%s wasn't made: %v", folder, err)
+		}
+	}
+	if err := InitDst(dst, config); !errors.Is(err, ErrInitialized) {
+		t.Errorf("want %v, got %v", ErrInitialized, err)
+	}
+
+	flags := &Flags{Dst: dst, CAS: true, Opts: Options{Compare: Comparer{Mode: CompareSizeModTime}, PreserveTimes: true}}
+	assertError(t, nil, CheckDstConfig(flags))
+
+	flags.CAS, flags.Opts.PreserveTimes = false, false
+	err := CheckDstConfig(flags)
+	if !errors.Is(err, ErrDstConfigMismatch) || !strings.Contains(err.Error(), "the mode is copy, the destination has cas") ||
+		!strings.Contains(err.Error(), "-"+FlagNamePreserveTimes+" is false") {
+		t.Errorf("want both differences, got %v", err)
+	}
+
+	// a destination that wasn't set up takes any run
+	assertError(t, nil, CheckDstConfig(&Flags{Dst: t.TempDir()}))
+}
+
+func TestReadFSSkipsMetaFolder(t *testing.T) {
+	fsys := fstest.MapFS{
+		MetaFolder + "/" + DstConfigFile: {Data: []byte("{}")},
+		"a/" + MetaFolder + "/f":         {Data: []byte("f")},
+	}
+	folders, files, skipped, err := ReadFS(fsys, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}, filepath.Join("a", MetaFolder): {}}, folders)
+	assert(t, File{filepath.Join("a", MetaFolder, "f"): 1}, files)
+	assert(t, Skipped{MetaFolder: ReasonMetaFolder}, skipped)
+}
@@ -0,0 +1,15 @@
+package mirror
+
+import "fmt"
+
+const formatInodeWarning = "WARNING: %d files and folders will be made, but the file system of %q has only %d free inodes."
+
+// InodeWarning returns a warning if there are fewer free inodes on the file system of path than needed.
+// It returns an empty string if there are enough of them or if the file system doesn't report them
+func InodeWarning(path string, needed int) (string, error) {
+	free, ok, err := freeInodes(path)
+	if err != nil || !ok || uint64(needed) <= free {
+		return "", err
+	}
+	return fmt.Sprintf(formatInodeWarning, needed, path, free), nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package mirror
+
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	return
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package mirror
+
+import "syscall"
+
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(path, &stat); err != nil {
+		return
+	}
+
+	// file systems like btrfs don't have a fixed number of inodes and report zero
+	if stat.Files == 0 {
+		return
+	}
+	return stat.Ffree, true, nil
+}
@@ -0,0 +1,39 @@
+package mirror
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestInodeWarning(t *testing.T) {
+	t.Run("enough inodes", func(t *testing.T) {
+		got, err := InodeWarning(".", 0)
+		assertError(t, nil, err)
+		assert(t, "", got)
+	})
+
+	t.Run("not enough inodes", func(t *testing.T) {
+		_, ok, err := freeInodes(".")
+		assertError(t, nil, err)
+		if !ok {
+			t.Skip("the file system doesn't report inodes")
+		}
+
+		got, err := InodeWarning(".", math.MaxInt32)
+		assertError(t, nil, err)
+		if !strings.Contains(got, "free inodes") {
+			t.Errorf("want a warning, got %q", got)
+		}
+	})
+
+	t.Run("with incorrect path", func(t *testing.T) {
+		if _, ok, _ := freeInodes("."); !ok {
+			t.Skip("the file system doesn't report inodes")
+		}
+		_, err := InodeWarning("aaa", 1)
+		if err == nil {
+			t.Error("wanted an error")
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Scenario trees are lists of entries: "folder/", "file=content", "link->target" and "pipe|" for a named pipe
+const (
+	entryFolder = "/"
+	entryFile   = "="
+	entryLink   = "->"
+	entryPipe   = "|"
+)
+
+func TestIntegration(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst []string
+		// clean runs a cleaning job after the copying one, like running the program twice
+		clean bool
+		// caseSensitive scenarios are skipped on file systems that ignore case
+		caseSensitive bool
+		opts          Options
+		// want is the state of dst after the run, see treeState
+		want string
+	}{
+		{
+			name: "empty destination",
+			src:  []string{"a/b/c=abc", "d=d", "e/"},
+			want: "a/\na/b/\na/b/c 3\nd 1\ne/\n",
+		},
+		{
+			name:  "renamed file and folder",
+			src:   []string{"new/name=xyz", "same=s"},
+			dst:   []string{"old/name=xyz", "same=s"},
+			clean: true,
+			want:  "new/\nnew/name 3\nsame 1\n",
+		},
+		{
+			name: "different size overwrites, cleaning keeps it",
+			src:  []string{"f=longer"},
+			dst:  []string{"f=short", "extra=e"},
+			want: "extra 1\nf 6\n",
+		},
+		{
+			name:          "names that differ only in case",
+			src:           []string{"Foo.txt=a"},
+			dst:           []string{"foo.txt=b"},
+			caseSensitive: true,
+			want:          "Foo.txt 1\nfoo.txt 1\n",
+		},
+		{
+			name: "symlinks and special files are skipped",
+			src:  []string{"target=t", "link->target", "pipe|", "folder/link->../target"},
+			want: "folder/\ntarget 1\n",
+		},
+		{
+			name:  "ignored and temporary folders are left alone",
+			src:   []string{FolderToIgnore + "/secret=s", TempDirPrefix + "1/part=p", "kept=k"},
+			dst:   []string{FolderToIgnore + "/old=o", TempDirPrefix + "2/part=p"},
+			clean: true,
+			want:  TempDirPrefix + "2/\n" + TempDirPrefix + "2/part 1\n" + FolderToIgnore + "/\n" + FolderToIgnore + "/old 1\nkept 1\n",
+		},
+		{
+			name: "temporary folder of the run",
+			src:  []string{"a/b=b", "c=cc"},
+			opts: Options{TempDir: "."},
+			want: "a/\na/b 1\nc 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			if tt.caseSensitive && !isCaseSensitive(t, dst) {
+				t.Skip("the file system ignores case")
+			}
+			buildTree(t, src, tt.src)
+			buildTree(t, dst, tt.dst)
+
+			opts := tt.opts
+			if opts.TempDir != "" {
+				tempDir, err := NewTempDir(dst)
+				assertError(t, nil, err)
+				opts.TempDir = tempDir
+				defer func() { assertError(t, nil, RemoveTempDir(tempDir)) }()
+			}
+
+			runJob(t, Job{Src: src, Dst: dst, Opts: opts})
+			if tt.clean {
+				runJob(t, Job{Src: src, Dst: dst, CleaningMode: true, Opts: opts})
+			}
+
+			got := treeState(t, dst)
+			if opts.TempDir != "" {
+				got = strings.Replace(got, filepath.Base(opts.TempDir)+"/\n", "", 1)
+			}
+			assert(t, tt.want, got)
+		})
+	}
+}
+
+func TestIntegrationLog(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	buildTree(t, src, []string{"a/copied=c"})
+	buildTree(t, dst, []string{"removed=r"})
+
+	logPath := filepath.Join(t.TempDir(), LogFile)
+	runJob(t, Job{Src: src, Dst: dst, Opts: Options{LogPath: logPath}})
+	runJob(t, Job{Src: src, Dst: dst, CleaningMode: true, Opts: Options{LogPath: logPath}})
+
+	data, err := os.ReadFile(logPath)
+	assertError(t, nil, err)
+	for _, want := range []string{LogMadeFolders, "a\n", LogCopiedFiles, filepath.Join("a", "copied"), LogCleanedFiles, "removed"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("want %q in the log file %q", want, data)
+		}
+	}
+}
+
+func TestIntegrationManyFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("makes thousands of files")
+	}
+
+	src, dst := t.TempDir(), t.TempDir()
+	var entries []string
+	for i := 0; i < 2000; i++ {
+		entries = append(entries, filepath.ToSlash(filepath.Join(strconv.Itoa(i%50), strconv.Itoa(i/50), "f"))+"="+strconv.Itoa(i))
+	}
+	buildTree(t, src, entries)
+
+	// a sparse file takes no space in src, the copy is written in full
+	sparse, err := os.Create(filepath.Join(src, "sparse"))
+	assertError(t, nil, err)
+	assertError(t, nil, sparse.Truncate(8*BytesInMB))
+	assertError(t, nil, sparse.Close())
+
+	runJob(t, Job{Src: src, Dst: dst})
+	assert(t, treeState(t, src), treeState(t, dst))
+
+	t.Run("a second run has nothing to do", func(t *testing.T) {
+		progress := make(chan Progress, 10)
+		runJob(t, Job{Src: src, Dst: dst, Opts: Options{Progress: progress}})
+		close(progress)
+		for p := range progress {
+			if p.Phase != PhaseScanning {
+				t.Errorf("unexpected progress %+v", p)
+			}
+		}
+	})
+}
+
+func TestIntegrationCAS(t *testing.T) {
+	src, cas, restored := t.TempDir(), t.TempDir(), t.TempDir()
+	buildTree(t, src, []string{"a/1=same", "b/2=same", "c=other", "empty/"})
+
+	folders, files, _, err := ReadFolder(src, &Options{})
+	assertError(t, nil, err)
+	_, err = CASStore(folders, files, TotalSize(files), src, cas, &Options{})
+	assertError(t, nil, err)
+	assert(t, 2, countObjects(t, cas))
+
+	err = CASRestore(cas, "", restored, &Options{})
+	assertError(t, nil, err)
+	assert(t, treeState(t, src), treeState(t, restored))
+}
+
+func isCaseSensitive(t testing.TB, folder string) bool {
+	t.Helper()
+
+	err := os.WriteFile(filepath.Join(folder, "case"), nil, FilePerm)
+	assertError(t, nil, err)
+	defer os.Remove(filepath.Join(folder, "case"))
+
+	_, err = os.Stat(filepath.Join(folder, "CASE"))
+	return os.IsNotExist(err)
+}
+
+func runJob(t testing.TB, j Job) {
+	t.Helper()
+
+	err := j.Run(context.Background())
+	assertError(t, nil, err)
+}
+
+// buildTree makes entries inside root, see entryFolder, entryFile, entryLink and entryPipe
+func buildTree(t testing.TB, root string, entries []string) {
+	t.Helper()
+
+	for _, entry := range entries {
+		var err error
+		switch {
+		case strings.HasSuffix(entry, entryFolder):
+			err = os.MkdirAll(filepath.Join(root, entry), FolderPerm)
+		case strings.HasSuffix(entry, entryPipe):
+			path := filepath.Join(root, strings.TrimSuffix(entry, entryPipe))
+			if err = makeFifo(path); errors.Is(err, errNoFifo) {
+				continue
+			}
+		case strings.Contains(entry, entryLink):
+			parts := strings.SplitN(entry, entryLink, 2)
+			path := filepath.Join(root, parts[0])
+			if err = os.MkdirAll(filepath.Dir(path), FolderPerm); err == nil {
+				if err = os.Symlink(filepath.FromSlash(parts[1]), path); err != nil {
+					// making symlinks needs special rights on Windows
+					t.Skip("symlinks can't be made:", err)
+				}
+			}
+		default:
+			parts := strings.SplitN(entry, entryFile, 2)
+			path := filepath.Join(root, parts[0])
+			if err = os.MkdirAll(filepath.Dir(path), FolderPerm); err == nil {
+				err = os.WriteFile(path, []byte(parts[1]), FilePerm)
+			}
+		}
+		assertError(t, nil, err)
+	}
+}
+
+// treeState lists everything in root, one sorted line per item: "folder/", "file size" or "link ->"
+func treeState(t testing.TB, root string) string {
+	t.Helper()
+
+	var lines []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			lines = append(lines, rel+"/")
+		case info.Mode()&fs.ModeSymlink != 0:
+			lines = append(lines, rel+" "+entryLink)
+		case !info.Mode().IsRegular():
+			lines = append(lines, rel+" "+entryPipe)
+		default:
+			lines = append(lines, rel+" "+strconv.FormatInt(info.Size(), 10))
+		}
+		return nil
+	})
+	assertError(t, nil, err)
+
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
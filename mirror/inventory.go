@@ -0,0 +1,106 @@
+package mirror
+
+import (
+	"encoding/csv"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	CmdInventory            = "inventory"
+	FlagNameOutput          = "o"
+	FlagNameHash            = "hash"
+	FlagUsageInventoryDst   = "folder whose files are listed"
+	FlagUsageOutput         = "CSV file the list is written to, stdout by default"
+	FlagUsageHash           = "add SHA-256 hashes of files, this reads every file"
+	ErrInventoryWrongArgs   = CustomErr("wrong arguments, use 'inventory -h' for help")
+	inventoryHeaderPath     = "path"
+	inventoryHeaderSize     = "size"
+	inventoryHeaderModTime  = "mtime"
+	inventoryHeaderChecksum = "sha256"
+)
+
+// VetInventoryFlags parses flags of the inventory subcommand and rewrites dst into an absolute path
+func VetInventoryFlags(args []string) (dst, output string, hash bool, ignoreErrors Patterns, err error) {
+	fs := flag.NewFlagSet(CmdInventory, flag.ExitOnError)
+	dstPath := fs.String(FlagNameDst, "", FlagUsageInventoryDst)
+	fs.StringVar(&output, FlagNameOutput, "", FlagUsageOutput)
+	fs.BoolVar(&hash, FlagNameHash, false, FlagUsageHash)
+	fs.Var(&ignoreErrors, FlagNameIgnoreErrors, FlagUsageIgnoreErrors)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *dstPath == "" || fs.NArg() > 0 {
+		err = ErrInventoryWrongArgs
+		return
+	}
+
+	if dst, err = filepath.Abs(*dstPath); err != nil {
+		return
+	}
+
+	if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrDstNotFound
+	}
+	return
+}
+
+// Inventory writes path, size, modification time and optionally the SHA-256 hash of every file in path into w as CSV.
+// Files are found the same way ReadFolder finds them, files that vanish or whose errors are ignored are left out. It
+// returns the number of listed files
+func Inventory(w io.Writer, path string, hash bool, opts *Options) (int, error) {
+	_, files, _, err := ReadFolder(path, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	c := csv.NewWriter(w)
+	header := []string{inventoryHeaderPath, inventoryHeaderSize, inventoryHeaderModTime}
+	if hash {
+		header = append(header, inventoryHeaderChecksum)
+	}
+	if err = c.Write(header); err != nil {
+		return 0, err
+	}
+
+	listed := 0
+	for _, file := range sortFoldersOrFiles(files) {
+		if opts.stopped() {
+			return listed, ErrStopped
+		}
+
+		info, err := os.Lstat(filepath.Join(path, file))
+		if err != nil {
+			if vanished(OSFS(path), fsName(file), err) || opts.ignoreErr(file, err) {
+				continue
+			}
+			return listed, err
+		}
+
+		record := []string{filepath.ToSlash(file), strconv.FormatInt(info.Size(), 10), info.ModTime().UTC().Format(time.RFC3339Nano)}
+		if hash {
+			sum, err := hashFile(filepath.Join(path, file))
+			if err != nil {
+				if vanished(OSFS(path), fsName(file), err) || opts.ignoreErr(file, err) {
+					continue
+				}
+				return listed, err
+			}
+			record = append(record, sum)
+		}
+
+		if err = c.Write(record); err != nil {
+			return listed, err
+		}
+		listed++
+	}
+
+	c.Flush()
+	return listed, c.Error()
+}
@@ -0,0 +1,70 @@
+package mirror
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	makeTestFolders(t)
+
+	var b strings.Builder
+	listed, err := Inventory(&b, srcPathTest, true, &Options{})
+	assertError(t, nil, err)
+	assert(t, len(srcFiles), listed)
+
+	records, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	assertError(t, nil, err)
+	assert(t, []string{"path", "size", "mtime", "sha256"}, records[0])
+	assert(t, len(srcFiles)+1, len(records))
+
+	sum, err := hashFile(filepath.Join(srcPathTest, "_same_1"))
+	assertError(t, nil, err)
+	assert(t, "_same_1", records[1][0])
+	assert(t, "1", records[1][1])
+	assert(t, sum, records[1][3])
+
+	cleanTestFolders(t)
+}
+
+func TestInventoryIgnoreErrors(t *testing.T) {
+	root := t.TempDir()
+	for _, file := range []string{"a", "secret"} {
+		assertError(t, nil, os.WriteFile(filepath.Join(root, file), []byte(file), FilePerm))
+	}
+	assertError(t, nil, os.Chmod(filepath.Join(root, "secret"), 0))
+	if f, err := os.Open(filepath.Join(root, "secret")); err == nil {
+		// the tests are probably running as root, so the file can be read anyway
+		f.Close()
+		t.Skip("file without permissions is still readable")
+	}
+
+	var b strings.Builder
+	_, err := Inventory(&b, root, true, &Options{})
+	assert(t, true, err != nil)
+
+	b.Reset()
+	opts := &Options{IgnoreErrors: Patterns{"secret"}}
+	listed, err := Inventory(&b, root, true, opts)
+	assertError(t, nil, err)
+	assert(t, 1, listed)
+	assert(t, 1, len(opts.Report.IgnoredErrors))
+}
+
+func TestVetInventoryFlags(t *testing.T) {
+	makeTestFolders(t)
+
+	_, output, hash, ignoreErrors, err := VetInventoryFlags([]string{"-" + FlagNameDst, dstPathTest, "-" + FlagNameOutput, "inv.csv", "-" + FlagNameHash, "-" + FlagNameIgnoreErrors, "*"})
+	assertError(t, nil, err)
+	assert(t, "inv.csv", output)
+	assert(t, true, hash)
+	assert(t, Patterns{"*"}, ignoreErrors)
+
+	_, _, _, _, err = VetInventoryFlags(nil)
+	assertError(t, ErrInventoryWrongArgs, err)
+
+	cleanTestFolders(t)
+}
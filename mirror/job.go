@@ -0,0 +1,54 @@
+package mirror
+
+import "context"
+
+const (
+	PhaseScanning        = "scanning"
+	PhaseMakingFolders   = "making folders"
+	PhaseCopyingFiles    = "copying files"
+	PhaseCleaningFiles   = "removing files"
+	PhaseCleaningFolders = "removing folders"
+	PhaseMakingLinks     = "making symlinks"
+	PhaseCleaningLinks   = "removing symlinks"
+	PhaseMakingHardLinks = "making hard links"
+	PhaseMovingFiles     = "moving files"
+)
+
+// Progress describes how far a phase got. Done and Total are bytes when files are copied or removed, otherwise they count folders, links or moved files
+type Progress struct {
+	Phase string `json:"phase"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+}
+
+// Job mirrors Src into Dst, or cleans Dst if CleaningMode is set, or does both if Sync is set, without asking any questions.
+// It lets other Go programs use the same steps as the command line tool, Mirror gives them each step on its own
+type Job struct {
+	Src, Dst     string
+	CleaningMode bool
+	Sync         bool
+	Opts         Options
+}
+
+// Run scans both folders and then copies or cleans what's needed. Updates are sent to j.Opts.Progress.
+// Canceling ctx makes Run return ErrStopped before it starts with the next item. Src can be a URL of a backend,
+// see RegisterBackend. The folders and j.Opts are checked like with New, which returns the same errors
+func (j *Job) Run(ctx context.Context) error {
+	m, err := newWith(j.Src, j.Dst, &j.Opts, nil)
+	if err != nil {
+		return err
+	}
+	p, err := m.Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case j.Sync:
+		return m.Sync(ctx, p)
+	case j.CleaningMode:
+		return m.Clean(ctx, p)
+	default:
+		return m.Copy(ctx, p)
+	}
+}
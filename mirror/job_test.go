@@ -0,0 +1,98 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJobRun(t *testing.T) {
+	t.Run("copying", func(t *testing.T) {
+		makeTestFolders(t)
+
+		progress := make(chan Progress, 100)
+		j := Job{Src: srcPathTest, Dst: dstPathTest, Opts: Options{Progress: progress}}
+		err := j.Run(context.Background())
+		assertError(t, nil, err)
+		close(progress)
+
+		phases := make(map[string]Progress)
+		for p := range progress {
+			phases[p.Phase] = p
+		}
+		assert(t, Progress{Phase: PhaseCopyingFiles, Done: sizeOfMissingFiles, Total: sizeOfMissingFiles}, phases[PhaseCopyingFiles])
+		assert(t, Progress{Phase: PhaseMakingFolders, Done: 1, Total: 1}, phases[PhaseMakingFolders])
+
+		_, dst, _, err := ReadFolder(dstPathTest, &Options{})
+		assertError(t, nil, err)
+		missing, _ := MissingFiles(dst, srcFiles)
+		assert(t, 0, len(missing))
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("cleaning", func(t *testing.T) {
+		makeTestFolders(t)
+
+		j := Job{Src: srcPathTest, Dst: dstPathTest, CleaningMode: true}
+		err := j.Run(context.Background())
+		assertError(t, nil, err)
+
+		folders, files, _, err := ReadFolder(dstPathTest, &Options{})
+		assertError(t, nil, err)
+		assert(t, 0, len(FoldersToClean(folders, srcFolders)))
+		toClean, _ := FilesToClean(files, srcFiles)
+		assert(t, 0, len(toClean))
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		makeTestFolders(t)
+
+		j := Job{Src: srcPathTest, Dst: dstPathTest, Sync: true}
+		err := j.Run(context.Background())
+		assertError(t, nil, err)
+
+		folders, files, _, err := ReadFolder(dstPathTest, &Options{})
+		assertError(t, nil, err)
+		assert(t, srcFolders, folders)
+		assert(t, srcFiles, files)
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		makeTestFolders(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		j := Job{Src: srcPathTest, Dst: dstPathTest}
+		assertError(t, ErrStopped, j.Run(ctx))
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("checked like New", func(t *testing.T) {
+		dir := t.TempDir()
+		tests := []struct {
+			name string
+			job  Job
+			err  error
+		}{
+			{"same folder", Job{Src: dir, Dst: dir}, ErrSameFolder},
+			{"nested folder", Job{Src: dir, Dst: filepath.Join(dir, "a")}, ErrNestedFolder},
+			{"missing src", Job{Src: filepath.Join(dir, "missing"), Dst: dir}, ErrSrcNotFound},
+			{"missing dst", Job{Src: dir, Dst: filepath.Join(dir, "missing")}, ErrDstNotFound},
+			{"wrong options", Job{Src: dir, Dst: t.TempDir(), Opts: Options{MinSize: 2, MaxSize: 1}}, ErrSizeRange},
+		}
+		assertError(t, nil, os.Mkdir(filepath.Join(dir, "a"), FolderPerm))
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assertError(t, tt.err, tt.job.Run(context.Background()))
+			})
+		}
+	})
+}
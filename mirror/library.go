@@ -0,0 +1,530 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Mirror copies what is missing from one folder into another one and cleans what isn't in the first one anymore.
+// It's the library counterpart of the command line tool: it doesn't parse flags or ask questions. Make it with New or NewFS
+type Mirror struct {
+	// src is empty if the source isn't a folder on disk
+	src, dst string
+	srcFS    fs.FS
+	opts     *Options
+}
+
+// Option changes how New sets up a Mirror
+type Option func(o *Options) error
+
+// WithIgnoreErrors makes errors of paths that match one of patterns (or whose parent folder does) show up in the
+// report instead of stopping the Mirror, see Options.IgnoreErrors
+func WithIgnoreErrors(patterns ...string) Option {
+	return func(o *Options) error {
+		for _, pattern := range patterns {
+			if err := o.IgnoreErrors.Set(pattern); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithProgress sends progress updates to progress, updates are dropped if it isn't ready to receive them
+func WithProgress(progress chan<- Progress) Option {
+	return func(o *Options) error {
+		o.Progress = progress
+		return nil
+	}
+}
+
+// WithCompare decides which files of the same size are copied anyway, see Comparer
+func WithCompare(c Comparer) Option {
+	return func(o *Options) error {
+		o.Compare = c
+		return nil
+	}
+}
+
+// WithWorkers copies n files at once, one is the default
+func WithWorkers(n int) Option {
+	return func(o *Options) error {
+		o.Workers = n
+		return nil
+	}
+}
+
+// WithScan runs command on every copied file and deals with infected files according to policy, see scanFile
+func WithScan(command, policy, quarantine string) Option {
+	return func(o *Options) error {
+		o.ScanCmd, o.ScanPolicy, o.Quarantine = command, policy, quarantine
+		return nil
+	}
+}
+
+// WithPreserveTimes turns off keeping the modification and access times of the source on copies if preserve is false,
+// they are kept by default like on the command line
+func WithPreserveTimes(preserve bool) Option {
+	return func(o *Options) error {
+		o.PreserveTimes = preserve
+		return nil
+	}
+}
+
+// WithPreservePerms turns off keeping the permission bits of the source on copies and made folders if preserve is
+// false, they are kept by default like on the command line
+func WithPreservePerms(preserve bool) Option {
+	return func(o *Options) error {
+		o.PreservePerms = preserve
+		return nil
+	}
+}
+
+// WithPreserveOwner makes copied files and made folders keep the owner and group of the source, see
+// Options.PreserveOwner
+func WithPreserveOwner() Option {
+	return func(o *Options) error {
+		o.PreserveOwner = true
+		return nil
+	}
+}
+
+// WithXattrs makes copied files keep the extended attributes of the source, see FlagUsageXattrs
+func WithXattrs() Option {
+	return func(o *Options) error {
+		o.Xattrs = true
+		return nil
+	}
+}
+
+// WithFileFlags makes copied files keep the capabilities and the immutable and append-only flags of the source
+func WithFileFlags() Option {
+	return func(o *Options) error {
+		o.FileFlags = true
+		return nil
+	}
+}
+
+// WithLinks makes symlinks of the source in dst with the same target instead of skipping them, see MakeLinks
+func WithLinks() Option {
+	return func(o *Options) error {
+		o.Links = true
+		return nil
+	}
+}
+
+// WithHardLinks makes files that are hard links of each other in the source hard links in dst too, see PlanHardLinks
+func WithHardLinks() Option {
+	return func(o *Options) error {
+		o.HardLinks = true
+		return nil
+	}
+}
+
+// WithDelta makes Copy and Sync patch files that are already in dst in place, so only the blocks that changed are
+// written, see patchFile
+func WithDelta() Option {
+	return func(o *Options) error {
+		o.Delta = true
+		return nil
+	}
+}
+
+// WithMove makes Copy and Sync remove copied files from the source once their copies are verified with verify,
+// MoveVerifySize or MoveVerifySHA256, and then the folders of the source this empties
+func WithMove(verify string) Option {
+	return func(o *Options) error {
+		if err := VetMoveVerify(verify); err != nil {
+			return err
+		}
+		o.Move, o.MoveVerify = true, verify
+		return nil
+	}
+}
+
+// WithDetectRenames makes Plan pair files that were moved in the source with their old paths in dst, Sync then moves
+// them instead of removing and copying them. Copy and Clean return ErrDetectRenamesMode for plans with moved files
+func WithDetectRenames() Option {
+	return func(o *Options) error {
+		o.DetectRenames = true
+		return nil
+	}
+}
+
+// WithFollowLinks makes symlinks of the source count as the files and folders they point to, see ReadFSFollowLinks
+func WithFollowLinks() Option {
+	return func(o *Options) error {
+		o.FollowLinks = true
+		return nil
+	}
+}
+
+// WithBirthTime makes copied files keep the creation time of the source
+func WithBirthTime() Option {
+	return func(o *Options) error {
+		o.BirthTime = true
+		return nil
+	}
+}
+
+// WithTempDir copies files into path first and renames them into place, see NewTempDir
+func WithTempDir(path string) Option {
+	return func(o *Options) error {
+		o.TempDir = path
+		return nil
+	}
+}
+
+// WithLogFile makes the Mirror list handled items in path, there is no log file by default.
+// An empty path turns the log file off
+func WithLogFile(path string) Option {
+	return func(o *Options) error {
+		o.LogPath = path
+		return nil
+	}
+}
+
+// WithModTimeWindow makes the Mirror skip files modified before newer or after older in both folders, a zero time
+// turns that side off
+func WithModTimeWindow(newer, older time.Time) Option {
+	return func(o *Options) error {
+		o.NewerThan, o.OlderThan = Age(newer), Age(older)
+		return nil
+	}
+}
+
+// WithSizeLimits makes the Mirror skip files smaller than min or larger than max bytes in both folders,
+// a max of 0 turns the upper limit off
+func WithSizeLimits(min, max int64) Option {
+	return func(o *Options) error {
+		o.MinSize, o.MaxSize = Size(min), Size(max)
+		return nil
+	}
+}
+
+// WithBufferSize makes the Mirror copy files through a buffer of size bytes, see VetBufferSize
+func WithBufferSize(size int64) Option {
+	return func(o *Options) error {
+		o.BufferSize = Size(size)
+		return nil
+	}
+}
+
+// WithBWLimit makes the Mirror read at most bytesPerSecond from the source while it copies, with all workers
+func WithBWLimit(bytesPerSecond int64) Option {
+	return func(o *Options) error {
+		o.BWLimit = Size(bytesPerSecond)
+		return nil
+	}
+}
+
+// WithIgnoreDirs makes the Mirror skip folders with one of names in both folders, like it skips FolderToIgnore
+func WithIgnoreDirs(names ...string) Option {
+	return func(o *Options) error {
+		for _, name := range names {
+			if err := o.IgnoreDirs.Set(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithInclude makes the Mirror only see files that match one of patterns in both folders, see Globs
+func WithInclude(patterns ...string) Option {
+	return func(o *Options) error {
+		for _, pattern := range patterns {
+			if err := o.Include.Set(pattern); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithExclude makes the Mirror skip files and folders that match one of patterns in both folders, see Globs
+func WithExclude(patterns ...string) Option {
+	return func(o *Options) error {
+		for _, pattern := range patterns {
+			if err := o.Exclude.Set(pattern); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithPriority makes the Mirror copy files that match one of patterns before the others, see PrioritizeFiles
+func WithPriority(patterns ...string) Option {
+	return func(o *Options) error {
+		for _, pattern := range patterns {
+			if err := o.Priority.Set(pattern); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithIncludeRegex makes the Mirror only see files whose path matches one of exprs (or one of the WithInclude
+// patterns) in both folders, see Regexps
+func WithIncludeRegex(exprs ...string) Option {
+	return func(o *Options) error {
+		for _, expr := range exprs {
+			if err := o.IncludeRegex.Set(expr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithExcludeRegex makes the Mirror skip files and folders whose path matches one of exprs in both folders, see Regexps
+func WithExcludeRegex(exprs ...string) Option {
+	return func(o *Options) error {
+		for _, expr := range exprs {
+			if err := o.ExcludeRegex.Set(expr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithArtifacts makes the Mirror skip paths in both folders, like it skips its log file
+func WithArtifacts(paths ...string) Option {
+	return func(o *Options) error {
+		o.Artifacts = append(o.Artifacts, paths...)
+		return nil
+	}
+}
+
+// WithMaxMem makes Plan return ErrMaxMem instead of using more than bytes of heap while it reads the folders
+func WithMaxMem(bytes int64) Option {
+	return func(o *Options) error {
+		o.MaxMem = bytes
+		return nil
+	}
+}
+
+// WithTracer sends spans of the phases and of sampled copied files to t, call t.Flush when the Mirror is done
+func WithTracer(t *Tracer) Option {
+	return func(o *Options) error {
+		o.Tracer = t
+		return nil
+	}
+}
+
+// WithPlugins lets the plugins p skip items and sends them events about copied and removed files, call p.Close when
+// the Mirror is done
+func WithPlugins(p *Plugins) Option {
+	return func(o *Options) error {
+		o.Plugins = p
+		return nil
+	}
+}
+
+// WithRetries makes the Mirror try an item up to n more times when reading, copying or removing it fails with an
+// error of the system, the first retry waits wait and every next one twice as long
+func WithRetries(n int, wait time.Duration) Option {
+	return func(o *Options) error {
+		o.Retries, o.RetryWait = n, wait
+		return nil
+	}
+}
+
+// WithJournal writes the path of every finished item into w on its own line
+func WithJournal(w io.Writer) Option {
+	return func(o *Options) error {
+		o.Journal = w
+		return nil
+	}
+}
+
+// New checks that src and dst are folders that aren't inside each other and applies opts. A src URL of a scheme
+// that RegisterBackend registered is read from its backend, like with NewFS
+func New(src, dst string, opts ...Option) (*Mirror, error) {
+	return newWith(src, dst, defaultOptions(), opts)
+}
+
+// newWith is New that applies opts to o, which the Mirror keeps using, see Job.Run
+func newWith(src, dst string, o *Options, opts []Option) (*Mirror, error) {
+	if fsys, ok, err := OpenBackend(src); err != nil {
+		return nil, err
+	} else if ok {
+		return newMirror(fsys, dst, o, opts)
+	}
+
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return nil, err
+	}
+	abs = fixLongPath(abs)
+	if f, err := os.Stat(abs); err != nil || !f.IsDir() {
+		return nil, ErrSrcNotFound
+	}
+
+	m, err := newMirror(OSFS(abs), dst, o, opts)
+	if err != nil {
+		return nil, err
+	}
+	m.src = abs
+
+	if err = CheckNotNested(m.src, m.dst); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewFS is New with the source in src, e.g. an embed.FS or a zip archive, which is only read.
+// WithBirthTime, WithXattrs, WithFileFlags and WithPreserveOwner need a folder on disk, use New for them
+func NewFS(src fs.FS, dst string, opts ...Option) (*Mirror, error) {
+	return newMirror(src, dst, defaultOptions(), opts)
+}
+
+// defaultOptions are the options of New and NewFS before their Options are applied
+func defaultOptions() *Options {
+	return &Options{PreserveTimes: true, PreservePerms: true}
+}
+
+func newMirror(src fs.FS, dst string, o *Options, opts []Option) (*Mirror, error) {
+	m := &Mirror{srcFS: src, opts: o}
+
+	for _, opt := range opts {
+		if err := opt(m.opts); err != nil {
+			return nil, err
+		}
+	}
+	if m.opts.IgnoreFS == nil {
+		m.opts.IgnoreFS = src
+	}
+	if err := needsOSFS(src, m.opts); err != nil {
+		return nil, err
+	}
+	if err := m.opts.check(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if m.dst, err = filepath.Abs(dst); err != nil {
+		return nil, err
+	}
+	m.dst = fixLongPath(m.dst)
+
+	if f, err := os.Stat(m.dst); err != nil || !f.IsDir() {
+		return nil, ErrDstNotFound
+	}
+	return m, nil
+}
+
+// Plan scans both folders and returns what Copy, Clean or Sync would do. It returns ErrStopped if ctx is canceled while scanning
+func (m *Mirror) Plan(ctx context.Context) (p SyncPlan, err error) {
+	m.opts.Stop = ctx.Done()
+	m.opts.sendProgress(PhaseScanning, 0, 0)
+
+	if m.src != "" {
+		if err = CheckNotNested(m.src, m.dst); err != nil {
+			return
+		}
+	}
+
+	var srcFolders, dstFolders Folder
+	var srcFiles, dstFiles File
+	var srcLinks, dstLinks Links
+	var srcSkipped Skipped
+	if m.opts.Links {
+		// newMirror made sure that srcFS is an OSFS
+		srcFolders, srcFiles, srcLinks, srcSkipped, err = ReadFolderLinks(string(m.srcFS.(OSFS)), m.opts)
+	} else if m.opts.FollowLinks {
+		srcFolders, srcFiles, srcSkipped, err = ReadFSFollowLinks(m.srcFS, m.opts)
+	} else {
+		srcFolders, srcFiles, srcSkipped, err = ReadFS(m.srcFS, m.opts)
+	}
+	if err != nil {
+		return
+	}
+
+	var dstSkipped Skipped
+	if m.opts.Links {
+		dstFolders, dstFiles, dstLinks, dstSkipped, err = ReadFolderLinks(m.dst, m.opts)
+	} else {
+		dstFolders, dstFiles, dstSkipped, err = ReadFolder(m.dst, m.opts)
+	}
+	if err != nil {
+		return
+	}
+
+	DropUnreadable(m.opts.Report.Unreadable, srcFolders, srcFiles)
+	DropUnreadable(m.opts.Report.Unreadable, dstFolders, dstFiles)
+	DropUnreadableLinks(m.opts.Report.Unreadable, srcLinks)
+	DropUnreadableLinks(m.opts.Report.Unreadable, dstLinks)
+
+	if ctx.Err() != nil {
+		return p, ErrStopped
+	}
+
+	changed, _, err := m.opts.Compare.ChangedFilesFS(dstFiles, srcFiles, m.dst, m.srcFS)
+	if err != nil {
+		return
+	}
+	p = NewSyncPlan(dstFolders, srcFolders, dstFiles, srcFiles, changed)
+	p.KeepSkipped(srcSkipped)
+	p.StaleParts = StaleParts(dstSkipped)
+	if m.opts.Links {
+		p.MissingLinks, p.LinksToClean = MissingLinks(dstLinks, srcLinks), LinksToClean(dstLinks, srcLinks)
+	}
+	if _, err = SkipTooLong(m.dst, p.MissingFolders, p.MissingFiles, p.MissingLinks, m.opts); err != nil {
+		return
+	}
+	p.CopySize = TotalSize(p.MissingFiles)
+	if m.opts.HardLinks {
+		groups, err := HardLinkGroups(m.srcFS, srcFiles, m.opts)
+		if err != nil {
+			return p, err
+		}
+		p.HardLinks = PlanHardLinks(groups, p.MissingFiles)
+		p.CopySize = TotalSize(p.MissingFiles)
+	}
+	if m.opts.DetectRenames {
+		if p.Renames, err = PlanRenames(p.MissingFiles, p.FilesToClean, p.FoldersToClean, m.srcFS, m.dst, m.opts); err != nil {
+			return
+		}
+		p.CopySize, p.CleanSize = TotalSize(p.MissingFiles), TotalSize(p.FilesToClean)
+	}
+	return p, nil
+}
+
+// Copy makes the missing folders of p, copies its missing files and makes its hard links and missing links.
+// Canceling ctx makes it return ErrStopped before it starts with the next item
+func (m *Mirror) Copy(ctx context.Context, p SyncPlan) error {
+	m.opts.Stop = ctx.Done()
+	if len(p.Renames) > 0 {
+		return ErrDetectRenamesMode
+	}
+	return SyncFS(SyncPlan{MissingFolders: p.MissingFolders, MissingFiles: p.MissingFiles, CopySize: p.CopySize, MissingLinks: p.MissingLinks, HardLinks: p.HardLinks, StaleParts: p.StaleParts}, m.srcFS, m.dst, m.opts)
+}
+
+// Clean removes the files, the links and then the folders of p that aren't in src.
+// Canceling ctx makes it return ErrStopped before it starts with the next item
+func (m *Mirror) Clean(ctx context.Context, p SyncPlan) error {
+	m.opts.Stop = ctx.Done()
+	if len(p.Renames) > 0 {
+		return ErrDetectRenamesMode
+	}
+	return SyncFS(SyncPlan{FoldersToClean: p.FoldersToClean, FilesToClean: p.FilesToClean, CleanSize: p.CleanSize, LinksToClean: p.LinksToClean, StaleParts: p.StaleParts}, m.srcFS, m.dst, m.opts)
+}
+
+// Sync cleans and then copies everything in p, see the SyncFS function
+func (m *Mirror) Sync(ctx context.Context, p SyncPlan) error {
+	m.opts.Stop = ctx.Done()
+	return SyncFS(p, m.srcFS, m.dst, m.opts)
+}
+
+// Report returns things that happened so far but didn't stop the Mirror, like ignored errors or vanished files
+func (m *Mirror) Report() Report {
+	return m.opts.Report
+}
@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+
+	tests := []struct {
+		name     string
+		src, dst string
+		opts     []Option
+		want     error
+	}{
+		{name: "correct folders", src: src, dst: dst},
+		{name: "missing src", src: filepath.Join(src, "aaa"), dst: dst, want: ErrSrcNotFound},
+		{name: "missing dst", src: src, dst: filepath.Join(dst, "aaa"), want: ErrDstNotFound},
+		{name: "the same folder", src: src, dst: src, want: ErrSameFolder},
+		{name: "bad pattern", src: src, dst: dst, opts: []Option{WithIgnoreErrors("[a")}, want: ErrBadPattern},
+		{name: "unknown comparison", src: src, dst: dst, opts: []Option{WithCompare(Comparer{Mode: "hash"})}, want: ErrUnknownCompare},
+		{name: "quarantine without a folder", src: src, dst: dst, opts: []Option{WithScan("true", ScanPolicyQuarantine, "")}, want: ErrNoQuarantine},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.src, test.dst, test.opts...)
+			assertError(t, test.want, err)
+		})
+	}
+}
+
+func TestMirror(t *testing.T) {
+	makeTestFolders(t)
+	logPath := filepath.Join(t.TempDir(), "mirror.log")
+
+	m, err := New(srcPathTest, dstPathTest, WithLogFile(logPath), WithWorkers(2))
+	assertError(t, nil, err)
+
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, missingFiles, p.MissingFiles)
+	assert(t, filesToClean, p.FilesToClean)
+
+	assertError(t, nil, m.Copy(context.Background(), p))
+	folders, files, _, err := ReadFolder(dstPathTest, &Options{})
+	assertError(t, nil, err)
+	missing, _ := MissingFiles(files, srcFiles)
+	assert(t, 0, len(missing))
+	assert(t, 0, len(MissingFolders(folders, srcFolders)))
+	toClean, _ := FilesToClean(files, srcFiles)
+	assert(t, filesToClean, toClean)
+
+	assertError(t, nil, m.Clean(context.Background(), p))
+	folders, files, _, err = ReadFolder(dstPathTest, &Options{})
+	assertError(t, nil, err)
+	assert(t, srcFolders, folders)
+	assert(t, srcFiles, files)
+	assert(t, 0, len(m.Report().IgnoredErrors))
+
+	_, err = os.Stat(logPath)
+	assertError(t, nil, err)
+
+	cleanTestFolders(t)
+}
+
+func TestMirrorWithoutLogFile(t *testing.T) {
+	makeTestFolders(t)
+	if err := os.Remove(LogFile); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	m, err := New(srcPathTest, dstPathTest)
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assertError(t, nil, m.Sync(context.Background(), p))
+
+	_, err = os.Stat(LogFile)
+	assert(t, true, os.IsNotExist(err))
+
+	cleanTestFolders(t)
+}
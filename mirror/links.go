@@ -0,0 +1,194 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	FlagNameLinks            = "links"
+	FlagUsageLinks           = "make symlinks of src in dst with the same target instead of skipping them, relative targets stay relative"
+	ErrLinksNeedsOSFS        = CustomErr("symlinks can only be copied from a folder on disk")
+	LogMadeLinks             = "symlinks made:"
+	LogCleanedLinks          = "symlinks removed:"
+	LogBrokenLink            = "made, but its target doesn't exist: "
+	MsgBrokenLinks           = "made symlinks whose target doesn't exist:"
+	MsgLinksSkipped          = "%d symlinks were skipped, -" + FlagNameLinks + " makes them in dst too\n"
+	MsgProgressMakingLinks   = "making symlinks:"
+	MsgProgressCleaningLinks = "removing symlinks:"
+	PlanMakeLink             = "make link"
+	PlanRemoveLink           = "remove link"
+	formatPlanLink           = "%-13s  %s -> %s\n"
+)
+
+// Links maps relative paths of symlinks to their targets, as os.Readlink returns them
+type Links map[string]string
+
+// ReadFolderLinks is ReadFolder that lists symlinks in links instead of skipping them
+func ReadFolderLinks(path string, opts *Options) (folders Folder, files File, links Links, skipped Skipped, err error) {
+	r := &folderReader{fsys: OSFS(path), folders: make(Folder), files: make(File), links: make(Links), skipped: make(Skipped), opts: opts}
+	r.artifacts = opts.artifactsIn(r.fsys)
+	err = r.readFolder(".", nil)
+	return r.folders, r.files, r.links, r.skipped, err
+}
+
+// readLink returns the target of the symlink name, the reader's fsys is an OSFS when it lists links
+func (r *folderReader) readLink(name string) (string, error) {
+	path, err := r.fsys.(OSFS).join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+// MissingLinks returns symlinks of src that aren't in dst or point somewhere else there
+func MissingLinks(dst, src Links) Links {
+	res := make(Links)
+
+	for link, target := range src {
+		if t, ok := dst[link]; !ok || t != target {
+			res[link] = target
+		}
+	}
+	return res
+}
+
+// LinksToClean returns symlinks of dst that aren't symlinks in src
+func LinksToClean(dst, src Links) Links {
+	res := make(Links)
+
+	for link, target := range dst {
+		if _, ok := src[link]; !ok {
+			res[link] = target
+		}
+	}
+	return res
+}
+
+// DropUnreadableLinks is DropUnreadable for links
+func DropUnreadableLinks(unreadable []string, links Links) {
+	for link := range links {
+		if isInside(link, unreadable) {
+			delete(links, link)
+		}
+	}
+}
+
+// MakeLinks makes symlinks with their targets in path and logs progress. Whatever is in the place of a link, except
+// a folder, is replaced. Links whose target doesn't exist are still made and added to opts.Report.BrokenLinks
+func MakeLinks(links Links, path string, opts *Options) error {
+	var recentlyLoggedProgress, counter int
+
+	f, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(f, LogMadeLinks+"\n")
+	log.Println(MsgProgressMakingLinks, ZeroPercent)
+
+	sortedLinks := sortLinks(links)
+	for _, link := range sortedLinks {
+		if opts.stopped() {
+			return closeStoppedLog(f)
+		}
+
+		if err = makeLink(links[link], filepath.Join(path, link)); err != nil {
+			if !opts.ignoreErr(link, err) {
+				f.Close()
+				return err
+			}
+			continue
+		}
+
+		logProgressFolders(&recentlyLoggedProgress, &counter, len(sortedLinks), MsgProgressMakingLinks)
+		opts.sendProgress(PhaseMakingLinks, int64(counter), int64(len(sortedLinks)))
+
+		// os.Stat follows the link, a relative target is resolved from the folder of the link
+		if _, err = os.Stat(filepath.Join(path, link)); os.IsNotExist(err) {
+			opts.Report.BrokenLinks = append(opts.Report.BrokenLinks, link)
+			LogToFile(f, LogBrokenLink+link)
+		}
+		LogToFile(f, link)
+		opts.journal(link)
+	}
+
+	err = f.Close()
+	return err
+}
+
+// CleanLinks removes symlinks from path and logs progress, their targets stay
+func CleanLinks(links Links, path string, opts *Options) error {
+	var recentlyLoggedProgress, counter int
+
+	f, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(f, LogCleanedLinks+"\n")
+	log.Println(MsgProgressCleaningLinks, ZeroPercent)
+
+	sortedLinks := sortLinks(links)
+	for _, link := range sortedLinks {
+		if opts.stopped() {
+			return closeStoppedLog(f)
+		}
+
+		if err = os.Remove(filepath.Join(path, link)); err != nil {
+			if !opts.ignoreErr(link, err) {
+				f.Close()
+				return err
+			}
+			continue
+		}
+
+		logProgressFolders(&recentlyLoggedProgress, &counter, len(sortedLinks), MsgProgressCleaningLinks)
+		opts.sendProgress(PhaseCleaningLinks, int64(counter), int64(len(sortedLinks)))
+
+		LogToFile(f, link)
+		opts.journal(link)
+	}
+
+	err = f.Close()
+	return err
+}
+
+// WriteLinks is WritePlan for links, one line for every link that would be made or removed
+func WriteLinks(w io.Writer, links Links, cleaningMode bool) error {
+	action := PlanMakeLink
+	if cleaningMode {
+		action = PlanRemoveLink
+	}
+
+	for _, link := range sortLinks(links) {
+		if _, err := fmt.Fprintf(w, formatPlanLink, action, link, links[link]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeLink makes a symlink to target at path. A file or a link that is already there is removed first, a folder
+// makes it fail
+func makeLink(target, path string) error {
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, path)
+}
+
+func sortLinks(links Links) []string {
+	res := make([]string, 0, len(links))
+	for link := range links {
+		res = append(res, link)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,109 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadFolderLinks(t *testing.T) {
+	src := t.TempDir()
+	assertError(t, nil, os.MkdirAll(filepath.Join(src, "a"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a", "file"), []byte("1"), FilePerm))
+	if err := os.Symlink("file", filepath.Join(src, "a", "rel")); err != nil {
+		t.Skip("can't make symlinks:", err)
+	}
+	assertError(t, nil, os.Symlink(filepath.Join(src, "missing"), filepath.Join(src, "abs")))
+	assertError(t, nil, os.Symlink("a", filepath.Join(src, "folder")))
+
+	folders, files, links, skipped, err := ReadFolderLinks(src, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}}, folders)
+	assert(t, File{filepath.Join("a", "file"): 1}, files)
+	assert(t, Links{filepath.Join("a", "rel"): "file", "abs": filepath.Join(src, "missing"), "folder": "a"}, links)
+	assert(t, Skipped{}, skipped)
+
+	_, _, skipped, err = ReadFolder(src, &Options{})
+	assertError(t, nil, err)
+	assert(t, Skipped{filepath.Join("a", "rel"): ReasonSymlink, "abs": ReasonSymlink, "folder": ReasonSymlink}, skipped)
+}
+
+func TestMissingLinksAndLinksToClean(t *testing.T) {
+	dst := Links{"same": "a", "moved": "a", "extra": "a"}
+	src := Links{"same": "a", "moved": "b", "new": "a"}
+
+	assert(t, Links{"moved": "b", "new": "a"}, MissingLinks(dst, src))
+	assert(t, Links{"extra": "a"}, LinksToClean(dst, src))
+}
+
+func TestMakeAndCleanLinks(t *testing.T) {
+	discardLog(t)
+	dst := t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "target"), []byte("1"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "file"), []byte("1"), FilePerm))
+	if err := os.Symlink("old", filepath.Join(dst, "link")); err != nil {
+		t.Skip("can't make symlinks:", err)
+	}
+	assertError(t, nil, os.Mkdir(filepath.Join(dst, "folder"), FolderPerm))
+
+	opts := &Options{LogPath: os.DevNull}
+	links := Links{"link": "target", "file": "target", "broken": "missing"}
+	assertError(t, nil, MakeLinks(links, dst, opts))
+	for link, target := range links {
+		got, err := os.Readlink(filepath.Join(dst, link))
+		assertError(t, nil, err)
+		assert(t, target, got)
+	}
+	assert(t, []string{"broken"}, opts.Report.BrokenLinks)
+
+	assert(t, true, MakeLinks(Links{"folder": "target"}, dst, opts) != nil)
+
+	assertError(t, nil, CleanLinks(Links{"link": "target", "broken": "missing"}, dst, opts))
+	_, err := os.Lstat(filepath.Join(dst, "link"))
+	assert(t, true, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dst, "target"))
+	assertError(t, nil, err)
+}
+
+func TestMirrorWithLinks(t *testing.T) {
+	discardLog(t)
+	src, dst := t.TempDir(), t.TempDir()
+	assertError(t, nil, os.MkdirAll(filepath.Join(src, "a"), FolderPerm))
+	if err := os.Symlink(filepath.Join("..", "b"), filepath.Join(src, "a", "up")); err != nil {
+		t.Skip("can't make symlinks:", err)
+	}
+	assertError(t, nil, os.Symlink("a", filepath.Join(dst, "extra")))
+
+	m, err := New(src, dst, WithLinks(), WithLogFile(os.DevNull))
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, Links{filepath.Join("a", "up"): filepath.Join("..", "b")}, p.MissingLinks)
+	assert(t, Links{"extra": "a"}, p.LinksToClean)
+
+	assertError(t, nil, m.Sync(context.Background(), p))
+	_, _, links, _, err := ReadFolderLinks(dst, &Options{})
+	assertError(t, nil, err)
+	assert(t, Links{filepath.Join("a", "up"): filepath.Join("..", "b")}, links)
+	assert(t, []string{filepath.Join("a", "up")}, m.Report().BrokenLinks)
+
+	p, err = m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, true, p.Empty())
+
+	_, err = NewFS(fstest.MapFS{}, dst, WithLinks())
+	assertError(t, ErrLinksNeedsOSFS, err)
+}
+
+func TestWriteLinks(t *testing.T) {
+	var b bytes.Buffer
+	assertError(t, nil, WriteLinks(&b, Links{"b": "x", "a": "y"}, false))
+	assert(t, "make link      a -> y\nmake link      b -> x\n", b.String())
+
+	b.Reset()
+	assertError(t, nil, WriteLinks(&b, Links{"a": "y"}, true))
+	assert(t, "remove link    a -> y\n", b.String())
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+func serviceLogDir() string {
+	return "/var/log"
+}
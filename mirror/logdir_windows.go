@@ -0,0 +1,12 @@
+package mirror
+
+import "os"
+
+const defaultProgramData = `C:\ProgramData`
+
+func serviceLogDir() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return defaultProgramData
+}
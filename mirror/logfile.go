@@ -0,0 +1,51 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	FlagNameLogFile   = "log-file"
+	FlagUsageLogFile  = "file that lists handled items, '" + LogFile + "' in the working folder by default, or in the log folder of the system if stdout isn't available or the progress log goes to the system log"
+	MsgServiceLogFile = "stdout isn't used, so handled items are listed in"
+	MsgNoServiceLog   = "the log folder of the system can't be used, handled items are listed in the working folder:"
+	serviceLogFolder  = "mirror"
+)
+
+// LogFilePath returns the file that gets the paths of handled items, the null device if LogPath is empty
+func (o *Options) LogFilePath() string {
+	if o.LogPath == "" {
+		return os.DevNull
+	}
+	return o.LogPath
+}
+
+// ServiceLogPath returns a path of the log file in the log folder of the system (ProgramData on Windows, /var/log
+// elsewhere) if the program runs as a service or daemon, so the log file doesn't end up in an unknown working folder.
+// That is when stdout isn't available or sink isn't LogSinkStdout. It returns an empty path otherwise
+func ServiceLogPath(sink string) (string, error) {
+	return serviceLogPath(sink, stdoutAvailable(), serviceLogDir())
+}
+
+func serviceLogPath(sink string, stdout bool, dir string) (string, error) {
+	if sink == LogSinkStdout && stdout {
+		return "", nil
+	}
+
+	dir = filepath.Join(dir, serviceLogFolder)
+	if err := os.MkdirAll(dir, FolderPerm); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, LogFile), nil
+}
+
+// stdoutAvailable returns false if stdout is closed or goes to the null device, like the one of a service or daemon
+func stdoutAvailable() bool {
+	out, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(out, null)
+}
@@ -0,0 +1,46 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogFilePath(t *testing.T) {
+	assert(t, os.DevNull, (&Options{}).LogFilePath())
+	assert(t, "run.log", (&Options{LogPath: "run.log"}).LogFilePath())
+}
+
+func TestServiceLogPath(t *testing.T) {
+	dir := t.TempDir()
+	want := filepath.Join(dir, serviceLogFolder, LogFile)
+
+	tests := []struct {
+		name   string
+		sink   string
+		stdout bool
+		want   string
+	}{
+		{name: "run from a terminal", sink: LogSinkStdout, stdout: true},
+		{name: "no stdout", sink: LogSinkStdout, want: want},
+		{name: "system log", sink: LogSinkSyslog, stdout: true, want: want},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := serviceLogPath(test.sink, test.stdout, dir)
+			assertError(t, nil, err)
+			assert(t, test.want, got)
+		})
+	}
+
+	info, err := os.Stat(filepath.Dir(want))
+	assertError(t, nil, err)
+	assert(t, true, info.IsDir())
+
+	t.Run("the log folder can't be made", func(t *testing.T) {
+		file := filepath.Join(dir, "file")
+		assertError(t, nil, os.WriteFile(file, nil, FilePerm))
+		_, err := serviceLogPath(LogSinkSyslog, true, file)
+		assert(t, true, err != nil)
+	})
+}
@@ -0,0 +1,92 @@
+package mirror
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ErrUnknownLogSink      = CustomErr("unknown log sink")
+	ErrLogSinkNotSupported = CustomErr("the log sink isn't supported on this platform")
+	ErrUnknownLogFormat    = CustomErr("unknown log format")
+	LogSinkStdout          = "stdout"
+	LogSinkSyslog          = "syslog"
+	LogSinkEventLog        = "eventlog"
+	LogSinkTag             = "mirror"
+	LogFormatText          = "text"
+	LogFormatJSON          = "json"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// SetLogSink makes the log package write into sink. The returned io.Closer should be closed before the program ends
+func SetLogSink(sink string) (io.Closer, error) {
+	var (
+		w   io.WriteCloser
+		err error
+	)
+
+	switch sink {
+	case LogSinkStdout:
+		log.SetOutput(os.Stdout)
+		return nopCloser{}, nil
+	case LogSinkSyslog:
+		w, err = newSyslogWriter()
+	case LogSinkEventLog:
+		w, err = newEventLogWriter()
+	default:
+		return nil, ErrUnknownLogSink
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.SetOutput(w)
+	return w, nil
+}
+
+// jsonWriter turns every log line into a JSON object with the time and the message
+type jsonWriter struct {
+	w io.Writer
+}
+
+type jsonLine struct {
+	// Schema is SchemaLogLine
+	Schema int    `json:"schema"`
+	Time   string `json:"time"`
+	Msg    string `json:"msg"`
+}
+
+func (j jsonWriter) Write(p []byte) (int, error) {
+	line, err := json.Marshal(jsonLine{Schema: SchemaLogLine, Time: time.Now().Format(time.RFC3339Nano), Msg: strings.TrimSuffix(string(p), "\n")})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = j.w.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetLogFormat makes the log package write plain text lines or JSON lines. It should be called after SetLogSink
+func SetLogFormat(format string) error {
+	switch format {
+	case LogFormatText:
+	case LogFormatJSON:
+		log.SetFlags(0)
+		log.SetOutput(jsonWriter{w: log.Writer()})
+	default:
+		return ErrUnknownLogFormat
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import "io"
+
+func newEventLogWriter() (io.WriteCloser, error) {
+	return nil, ErrLogSinkNotSupported
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package mirror
+
+import "io"
+
+func newSyslogWriter() (io.WriteCloser, error) {
+	return nil, ErrLogSinkNotSupported
+}
@@ -0,0 +1,65 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSetLogSink(t *testing.T) {
+	t.Run("stdout", func(t *testing.T) {
+		c, err := SetLogSink(LogSinkStdout)
+		assertError(t, nil, err)
+		assert(t, os.Stdout, log.Writer())
+		assertError(t, nil, c.Close())
+	})
+
+	t.Run("unknown sink", func(t *testing.T) {
+		_, err := SetLogSink("aaa")
+		assertError(t, ErrUnknownLogSink, err)
+	})
+}
+
+func TestLogToFileRestoresOutput(t *testing.T) {
+	var sink, file bytes.Buffer
+	prev := log.Writer()
+	defer log.SetOutput(prev)
+
+	log.SetOutput(&sink)
+	LogToFile(&file, "aaa")
+
+	assert(t, &sink, log.Writer())
+	assert(t, 0, sink.Len())
+	if !bytes.Contains(file.Bytes(), []byte("aaa")) {
+		t.Errorf("want %q in the file, got %q", "aaa", file.String())
+	}
+}
+
+func TestSetLogFormat(t *testing.T) {
+	var sink bytes.Buffer
+	prev, prevFlags := log.Writer(), log.Flags()
+	defer func() {
+		log.SetOutput(prev)
+		log.SetFlags(prevFlags)
+	}()
+
+	t.Run("json", func(t *testing.T) {
+		log.SetOutput(&sink)
+		assertError(t, nil, SetLogFormat(LogFormatJSON))
+		log.Println("aaa")
+
+		var got jsonLine
+		assertError(t, nil, json.Unmarshal(sink.Bytes(), &got))
+		assert(t, "aaa", got.Msg)
+		if _, err := time.Parse(time.RFC3339Nano, got.Time); err != nil {
+			t.Errorf("wrong time %q: %v", got.Time, err)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assertError(t, ErrUnknownLogFormat, SetLogFormat("aaa"))
+	})
+}
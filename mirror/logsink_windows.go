@@ -0,0 +1,57 @@
+package mirror
+
+import (
+	"io"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// eventLogInformation is EVENTLOG_INFORMATION_TYPE from winnt.h
+const eventLogInformation = 4
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSource   = advapi32.NewProc("RegisterEventSourceW")
+	procReportEvent           = advapi32.NewProc("ReportEventW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+)
+
+// eventLogWriter writes every log line as one event into the Application log
+type eventLogWriter struct {
+	handle uintptr
+}
+
+func newEventLogWriter() (io.WriteCloser, error) {
+	source, err := syscall.UTF16PtrFromString(LogSinkTag)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, _, err := procRegisterEventSource.Call(0, uintptr(unsafe.Pointer(source)))
+	if handle == 0 {
+		return nil, err
+	}
+	return &eventLogWriter{handle: handle}, nil
+}
+
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	msg, err := syscall.UTF16PtrFromString(strings.TrimSuffix(string(p), "\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	msgs := []*uint16{msg}
+	ok, _, err := procReportEvent.Call(w.handle, eventLogInformation, 0, 1, 0, uintptr(len(msgs)), 0, uintptr(unsafe.Pointer(&msgs[0])), 0)
+	if ok == 0 {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *eventLogWriter) Close() error {
+	if ok, _, err := procDeregisterEventSource.Call(w.handle); ok == 0 {
+		return err
+	}
+	return nil
+}
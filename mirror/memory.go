@@ -0,0 +1,63 @@
+package mirror
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+)
+
+const (
+	FlagNameMaxMem    = "max-mem"
+	FlagNameMemStats  = "mem-stats"
+	FlagUsageMaxMem   = "MB of memory the program may use while it lists the folders, it stops with an error instead of being killed when it needs more (0 turns it off)"
+	FlagUsageMemStats = "log how much memory is used this often, e.g. 1m (0 turns it off)"
+	ErrMaxMem         = CustomErr("listing the folders needs more memory than -max-mem allows, raise it or mirror the subfolders one by one, in use (MB):")
+	MsgMemStats       = "memory: %s MB in use, %s MB taken from the system, %d garbage collections"
+	// memCheckEvery is how many listed items there are between two looks at the memory, reading it stops the world
+	memCheckEvery = 10000
+)
+
+// checkMem counts listed items and returns ErrMaxMem if the heap is bigger than o.MaxMem. It looks at the heap
+// right away if first is set and then once memCheckEvery items were listed
+func (o *Options) checkMem(items int, first bool) error {
+	if o.MaxMem <= 0 {
+		return nil
+	}
+
+	o.memItems += items
+	if !first && o.memItems < memCheckEvery {
+		return nil
+	}
+	o.memItems = 0
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if int64(stats.HeapAlloc) > o.MaxMem {
+		return fmt.Errorf("%w %s", ErrMaxMem, BytesToMB(int64(stats.HeapAlloc)))
+	}
+	return nil
+}
+
+// MemStats describes how much memory the program uses
+func MemStats() string {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return fmt.Sprintf(MsgMemStats, BytesToMB(int64(stats.HeapAlloc)), BytesToMB(int64(stats.Sys)), stats.NumGC)
+}
+
+// LogMemStats logs MemStats every interval until stop is closed
+func LogMemStats(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				log.Println(MemStats())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckMem(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxMem int64
+		items  int
+		first  bool
+		want   error
+	}{
+		{name: "turned off", maxMem: 0, first: true},
+		{name: "under the cap", maxMem: 1 << 50, first: true},
+		{name: "over the cap", maxMem: 1, first: true, want: ErrMaxMem},
+		{name: "over the cap, but not checked yet", maxMem: 1, items: memCheckEvery - 1},
+		{name: "over the cap after enough items", maxMem: 1, items: memCheckEvery, want: ErrMaxMem},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &Options{MaxMem: test.maxMem}
+			err := opts.checkMem(test.items, test.first)
+			if !errors.Is(err, test.want) {
+				t.Errorf("want %v, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestReadFolderWithMaxMem(t *testing.T) {
+	makeTestFolders(t)
+
+	_, _, _, err := ReadFolder(srcPathTest, &Options{MaxMem: 1})
+	if !errors.Is(err, ErrMaxMem) {
+		t.Errorf("want %v, got %v", ErrMaxMem, err)
+	}
+
+	cleanTestFolders(t)
+}
+
+func TestLogMemStats(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+
+	stop := make(chan struct{})
+	LogMemStats(time.Millisecond, stop)
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	time.Sleep(5 * time.Millisecond)
+	log.SetOutput(prev)
+
+	if !strings.Contains(buf.String(), "MB in use") {
+		t.Errorf("no memory stats in %q", buf.String())
+	}
+}
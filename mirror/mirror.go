@@ -2,24 +2,41 @@
 package mirror
 
 import (
-	"bufio"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	ErrWrongArgs               = CustomErr("wrong arguments, use the -h flag for help")
 	ErrSrcNotFound             = CustomErr("source folder doesn't exist")
 	ErrDstNotFound             = CustomErr("destination folder doesn't exist")
+	ErrSameFolder              = CustomErr("source and destination are the same folder (maybe through a bind mount, junction or link)")
+	ErrNestedFolder            = CustomErr("one of the source and destination folders is inside the other one (maybe through a bind mount, junction or link)")
 	ErrOnlyFoldersOrFiles      = CustomErr("the function accepts only folders and files")
+	ErrBadPattern              = CustomErr("invalid pattern")
+	ErrNotTerminal             = CustomErr("stdin isn't a terminal, so questions can't be answered, use the -yes flag")
+	ErrStopped                 = CustomErr("stopped by a signal")
+	ErrUnsetVariable           = CustomErr("the path uses an environment variable that isn't set:")
+	ErrTooMuchShrinkage        = CustomErr("the destination would shrink by more than -shrink-limit allows, run the program without -yes to confirm it or raise the limit")
+	ConfirmationWord           = "DELETE"
 	FolderToIgnore             = "dont_mirror"
+	ReasonIgnoredFolder        = reasonFolderNamed + FolderToIgnore
+	ReasonSymlink              = "symlink"
+	ReasonSpecialFile          = "special file"
 	LogFile                    = "log"
 	ZeroPercent                = "0%"
 	BytesInMB                  = 1e6
@@ -29,125 +46,862 @@ const (
 	LogCleanedFolders          = "directories removed: (if a folder had some subdirectories, they were also removed)"
 	LogCopiedFiles             = "files copied:"
 	LogCleanedFiles            = "files removed:"
+	LogErrorsIgnored           = "errors ignored:"
+	LogStopped                 = "stopped by a signal"
+	LogVanished                = "skipped, vanished: "
+	MsgVanished                = "files that vanished from the source before they could be copied:"
+	MsgIgnoredErrors           = "errors that were ignored:"
+	MsgEffectiveOptions        = "effective options:"
+	MsgSkipped                 = "skipped in %q:"
 	MsgProgressCopyingFiles    = "copying files:"
 	MsgProgressMakingFolders   = "making folders:"
 	MsgProgressCleaningFiles   = "removing files:"
 	MsgProgressCleaningFolders = "removing folders:"
+	EnvSrc                     = "MIRROR_SRC"
+	EnvDst                     = "MIRROR_DST"
+	EnvOpts                    = "MIRROR_OPTS"
 	FlagNameSrc                = "src"
 	FlagNameDst                = "dst"
 	FlagNameC                  = "c"
-	FlagUsageSrc               = "source folder"
-	FlagUsageDst               = "destination folder"
+	FlagNameIgnoreErrors       = "ignore-errors"
+	FlagNamePing               = "ping"
+	FlagNameLogSink            = "log-sink"
+	FlagNameAudit              = "audit"
+	FlagNameYes                = "yes"
+	FlagNameY                  = "y"
+	FlagNameLogFormat          = "log-format"
+	FlagNameShrinkLimit        = "shrink-limit"
+	FlagNameScanCmd            = "scan-cmd"
+	FlagNameScanPolicy         = "scan-policy"
+	FlagNameQuarantine         = "quarantine"
+	FlagNameCAS                = "cas"
+	FlagNameStaleAfter         = "stale-after"
+	FlagUsageSrc               = "source folder (defaults to the " + EnvSrc + " environment variable)"
+	FlagUsageDst               = "destination folder (defaults to the " + EnvDst + " environment variable)"
 	FlagUsageC                 = "cleaning mode"
+	FlagUsageIgnoreErrors      = "glob pattern of paths whose errors are skipped and summarized instead of stopping the program (can be repeated)"
+	FlagUsagePing              = "URL that gets run stats after the program finishes, or URL/fail if it fails (e.g. a healthchecks.io check)"
+	FlagUsageLogSink           = "where to log progress: stdout, syslog or eventlog (Windows)"
+	FlagUsageAudit             = "file that gets one JSON line per examined path with the decision that was made about it and why"
+	FlagUsageYes               = "answer yes to every question, needed when stdin isn't a terminal"
+	FlagUsageY                 = "short for -" + FlagNameYes
+	FlagUsageLogFormat         = "format of the progress log: text or json"
+	defaultShrinkLimit         = 50
+	defaultStaleAfter          = 10 * time.Minute
+	FlagUsageScanCmd           = "command that scans every copied file, e.g. clamdscan, exit code 1 means the file is infected"
+	FlagUsageScanPolicy        = "what to do with infected files: skip, quarantine or abort"
+	FlagUsageQuarantine        = "folder infected files are moved to with '-scan-policy quarantine'"
+	FlagUsageStaleAfter        = "offer to scan the folders again if the last question is answered this long after scanning (0 turns it off)"
+	FlagUsageCAS               = "store files in dst as objects named by their hash and write a manifest of the tree, see 'restore -h'"
+	FlagUsageShrinkLimit       = "percentage of the destination size that can be removed without typing " + ConfirmationWord + " (100 turns it off)"
+	// programName names the flags of a run in their usage, the subcommands have their own names, see CmdBench
+	programName = "mirror"
 )
 
+// envVar matches Windows style environment variables like %USERPROFILE% or %ProgramFiles(x86)% and Unix style ones
+// like ${HOME} or $HOME, in this order of its groups
+var envVar = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_()]*)%|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z0-9_]+)`)
+
 type (
 	CustomErr string
 	Folder    map[string]struct{}
 	File      map[string]int64
+	Patterns  []string
+	// Skipped maps paths that weren't read to the reason why
+	Skipped map[string]string
 )
 
+// Flags holds vetted command line flags
+type Flags struct {
+	Dst, Src     string
+	CleaningMode bool
+	Ping         string
+	LogSink      string
+	Audit        string
+	Yes          bool
+	LogFormat    string
+	ShrinkLimit  int64
+	CAS          bool
+	Resume       bool
+	StaleAfter   time.Duration
+	TempDir      string
+	DryRun       bool
+	Sync         bool
+	MemStats     time.Duration
+	OTel         string
+	OTelSample   float64
+	Plugins      Commands
+	AutoRerun    int
+	Snapshot     string
+	Swap         bool
+	// RecordManifest makes copying, cleaning and sync runs write the manifest of dst for 'changes', see WriteRunManifest
+	RecordManifest bool
+	Opts           Options
+	// set holds the parsed flags for EffectiveOptions
+	set *flag.FlagSet
+}
+
+// Options alters how folders and files are read, copied and removed
+type Options struct {
+	// IgnoreErrors holds patterns of paths whose errors don't stop the program
+	IgnoreErrors Patterns
+	// Stop makes the functions return ErrStopped before they start with the next item once it's closed
+	Stop <-chan struct{}
+	// ScanCmd is run with the path of every copied file as the last argument, see scanFile
+	ScanCmd string
+	// ScanPolicy says what happens with infected files: ScanPolicySkip, ScanPolicyQuarantine or ScanPolicyAbort.
+	// An empty ScanPolicy is ScanPolicySkip
+	ScanPolicy string
+	// SizeChange says what happens with a copy whose size isn't the scanned one: SizeChangeFlag, SizeChangeRetry or
+	// SizeChangeTruncate. An empty SizeChange is SizeChangeFlag
+	SizeChange string
+	// Quarantine is the folder infected files are moved to with ScanPolicyQuarantine
+	Quarantine string
+	// Progress gets an update after every item if it isn't nil. Updates are dropped if the channel isn't ready to receive them
+	Progress chan<- Progress
+	// Compare decides which files of the same size are copied anyway
+	Compare Comparer
+	// PreserveTimes makes copied files keep the modification and access times of the source. Without it they keep
+	// them only if -compare size+mtime or an age filter needs them
+	PreserveTimes bool
+	// PreserveOwner makes copied files and made folders keep the owner and group of the source where the process may
+	// change them, see Report.OwnerNotKept
+	PreserveOwner bool
+	// PreservePerms makes copied files and made folders keep the permission bits of the source, see copyPerm
+	PreservePerms bool
+	// BirthTime makes copied files keep the creation time of the source, see FlagUsageBirthTime
+	BirthTime bool
+	// Xattrs makes copied files keep the extended attributes of the source, see FlagUsageXattrs
+	Xattrs bool
+	// FileFlags makes copied files keep capabilities and chattr flags of the source, see FlagUsageFileFlags
+	FileFlags bool
+	// Links makes Mirror list symlinks with ReadFolderLinks and make them in dst, see MakeLinks
+	Links bool
+	// FollowLinks makes Mirror read the source with ReadFSFollowLinks, so symlinks are copied as what they point to.
+	// dst is read without following them
+	FollowLinks bool
+	// HardLinks makes Mirror make files that are hard links of each other in the source as hard links in dst, see
+	// PlanHardLinks
+	HardLinks bool
+	// DetectRenames makes Mirror move files in dst that were moved in the source during a sync, see PlanRenames
+	DetectRenames bool
+	// Move makes CopyFiles remove every copied file from the source once its copy is verified with MoveVerify, and
+	// then the folders this empties
+	Move bool
+	// MoveVerify is how copies are verified before Move removes the source: MoveVerifySize or MoveVerifySHA256.
+	// An empty MoveVerify is MoveVerifySize
+	MoveVerify string
+	// Delta makes CopyFiles patch files that are already in dst in place, so only blocks that changed are written,
+	// see patchFile
+	Delta bool
+	// TempDir holds partial files during a run if it isn't empty, see NewTempDir
+	TempDir string
+	// Workers is how many files CopyFiles copies at once, less than 1 counts as 1
+	Workers int
+	// Retries is how many times an item is tried again when reading, copying or removing it fails with an error of
+	// the system. The first retry waits RetryWait, every next one twice as long, see retry
+	Retries   int
+	RetryWait time.Duration
+	// LogPath is the file that gets the paths of handled items, there is no log file if it's empty. The command line
+	// tool uses LogFile in the working folder by default
+	LogPath string
+	// BufferSize is the buffer that CopyFiles copies files through, see VetBufferSize and writeTo
+	BufferSize Size
+	// BWLimit is how many bytes per second CopyFiles may read from the source with all workers, 0 turns it off
+	BWLimit Size
+	// MinSize and MaxSize skip files that are smaller or larger in ReadFolder, a MaxSize of 0 turns it off
+	MinSize, MaxSize Size
+	// NewerThan and OlderThan skip files modified before or after them in ReadFolder, a zero Age turns it off
+	NewerThan, OlderThan Age
+	// IgnoreDirs are names of folders that ReadFolder skips besides FolderToIgnore
+	IgnoreDirs Names
+	// Include limits the files that ReadFolder lists to the matching ones if it isn't empty
+	Include Globs
+	// Exclude holds patterns of files and folders that ReadFolder skips
+	Exclude Globs
+	// IncludeRegex limits the files that ReadFolder lists like Include, a file that matches either is listed
+	IncludeRegex Regexps
+	// ExcludeRegex holds expressions of paths of files and folders that ReadFolder skips
+	ExcludeRegex Regexps
+	// Priority holds patterns of files that CopyFiles copies before the others, see PrioritizeFiles
+	Priority Globs
+	// IgnoreFS is the tree whose MirrorIgnoreFile files apply while folders are read, the read tree if it's nil.
+	// It's src, so dst is read with the same rules
+	IgnoreFS fs.FS
+	// Artifacts are files or folders that ReadFolder skips besides the log file and other files of the program, relative
+	// paths are relative to the working folder, see artifacts
+	Artifacts Paths
+	// Journal gets the path of every finished item on its own line if it isn't nil, see LoadResumePlan
+	Journal io.Writer
+	// Report gets filled with things that happened but didn't stop the program
+	Report Report
+	// MaxMem is how many bytes the heap may have while folders are read, ReadFolder returns ErrMaxMem if it has more.
+	// 0 turns it off
+	MaxMem int64
+	// Tracer gets the spans of the run if it isn't nil, see NewTracer
+	Tracer *Tracer
+	// Plugins can skip items and get events about copied and removed files if it isn't nil, see StartPlugins
+	Plugins *Plugins
+	// state is what a crash report shows, see WriteCrashReport
+	state *runState
+	// limiter holds CopyFiles to BWLimit, see limit
+	limiter *rateLimiter
+	// memItems counts items listed since the memory was checked, see checkMem
+	memItems int
+}
+
+// Report holds things that happened during a run but didn't stop it
+type Report struct {
+	IgnoredErrors []error
+	// Unreadable holds relative paths of folders and files that couldn't be read because of an ignored error
+	Unreadable []string
+	// Vanished holds relative paths of files that were removed from the source before they could be copied
+	Vanished []string
+	// Infected holds relative paths of files that the scanner flagged
+	Infected []string
+	// OwnerNotKept holds relative paths of copied files and made folders whose owner the process may not change,
+	// see Options.PreserveOwner
+	OwnerNotKept []string
+	// XattrsNotKept holds relative paths of copied files whose extended attributes dst can't hold, see Options.Xattrs
+	XattrsNotKept []string
+	// FlagsNotKept holds relative paths of copied files whose capabilities or flags dst can't hold, see Options.FileFlags
+	FlagsNotKept []string
+	// BrokenLinks holds relative paths of made symlinks whose target doesn't exist, see MakeLinks
+	BrokenLinks []string
+	// SizeChanged holds relative paths of copied files whose size changed since the scan, see Options.SizeChange
+	SizeChanged []string
+	// Moved holds relative paths of copied files that were removed from the source, see Options.Move. NotMoved holds
+	// the ones that were kept because they changed since they were copied
+	Moved, NotMoved []string
+	// TooLong holds relative paths of items that weren't copied because dst can't hold their names, see SkipTooLong
+	TooLong []string
+	// Patched holds relative paths of copied files that were patched in place, see Options.Delta. PatchedSize is
+	// their size and PatchWritten what patching them wrote
+	Patched                   []string
+	PatchedSize, PatchWritten int64
+}
+
 func (e CustomErr) Error() string {
 	return string(e)
 }
 
-// AskQuestion prints question and returns true if it gets y/Y on input
-func AskQuestion(question string) bool {
-	reader := bufio.NewReader(os.Stdin)
-	log.Printf("%s (y/n)\n", question)
-	answer, _ := reader.ReadString('\n')
-	answer = strings.TrimSpace(answer)
-	if !strings.EqualFold("y", answer) {
+func (p *Patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *Patterns) Set(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return ErrBadPattern
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+// Match returns true if path, its base name or one of its parent folders matches one of the patterns
+func (p Patterns) Match(path string) bool {
+	for ; path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+		for _, pattern := range p {
+			if ok, _ := filepath.Match(pattern, path); ok {
+				return true
+			}
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return true
+			}
+		}
+		// a volume like C:\ or \\server\share\ is its own parent
+		if filepath.Dir(path) == path {
+			break
+		}
+	}
+	return false
+}
+
+func (o *Options) ignoreErr(path string, err error) bool {
+	if !o.IgnoreErrors.Match(path) {
 		return false
 	}
+	o.Report.IgnoredErrors = append(o.Report.IgnoredErrors, err)
 	return true
 }
 
-// VetFlags checks if flags are valid and rewrites them into an absolute path
-func VetFlags() (dst, src string, cleaningMode bool, err error) {
-	srcPath := flag.String(FlagNameSrc, "", FlagUsageSrc)
-	dstPath := flag.String(FlagNameDst, "", FlagUsageDst)
-	cFlag := flag.Bool(FlagNameC, false, FlagUsageC)
+// check returns an error if options can't work together, it's shared by VetFlags and New
+func (o *Options) check() error {
+	if o.ScanPolicy != "" {
+		if err := VetScanPolicy(o.ScanPolicy, o.Quarantine); err != nil {
+			return err
+		}
+	}
 
-	flag.Parse()
+	if o.SizeChange != "" {
+		if err := VetSizeChange(o.SizeChange); err != nil {
+			return err
+		}
+	}
+	if o.MoveVerify != "" {
+		if err := VetMoveVerify(o.MoveVerify); err != nil {
+			return err
+		}
+	}
 
-	src = *srcPath
-	dst = *dstPath
+	if o.Delta && o.ScanCmd != "" {
+		return ErrDeltaMode
+	}
 
-	if src == "" || dst == "" {
+	if o.BirthTime && !birthTimeSupported {
+		return ErrBirthTimeUnsupported
+	}
+	if o.FileFlags && !fileFlagsSupported {
+		return ErrFileFlagsUnsupported
+	}
+	if o.Xattrs && !xattrsSupported {
+		return ErrXattrsUnsupported
+	}
+	if o.PreserveOwner && !ownerSupported {
+		return ErrOwnerUnsupported
+	}
+
+	if m := o.Compare.Mode; m != "" && m != CompareSize && m != CompareSizeModTime {
+		return ErrUnknownCompare
+	}
+	if o.Compare.Tolerance < 0 || o.Workers < 0 || o.MinSize < 0 || o.MaxSize < 0 || o.BWLimit < 0 || o.Retries < 0 || o.RetryWait < 0 {
+		return ErrWrongArgs
+	}
+	if o.MaxSize > 0 && o.MaxSize < o.MinSize {
+		return ErrSizeRange
+	}
+	if err := VetBufferSize(o.BufferSize); err != nil {
+		return err
+	}
+	if o.Links && o.FollowLinks {
+		return ErrFollowLinksMode
+	}
+	if o.HardLinks && !hardLinksSupported {
+		return ErrHardLinksUnsupported
+	}
+	if newer, older := time.Time(o.NewerThan), time.Time(o.OlderThan); !newer.IsZero() && !older.IsZero() && !older.After(newer) {
+		return ErrAgeRange
+	}
+	return nil
+}
+
+func (o *Options) stopped() bool {
+	select {
+	case <-o.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (o *Options) sendProgress(phase string, done, total int64) {
+	o.runState().progress(phase, done, total)
+	o.Tracer.setPhase(phase, done, total)
+	if o.Progress == nil {
+		return
+	}
+	select {
+	case o.Progress <- Progress{Phase: phase, Done: done, Total: total}:
+	default:
+	}
+}
+
+// journal notes that path is finished. A failed write only means that the item is done again when the run is resumed
+func (o *Options) journal(path string) {
+	if o.Journal != nil {
+		fmt.Fprintln(o.Journal, path)
+	}
+}
+
+// IsTerminal returns true if f is a terminal, so questions asked on it can be answered
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f)
+}
+
+// VetFlags parses args, the command line without the program name, checks if the flags are valid and rewrites src and
+// dst into an absolute path. Flags from the MIRROR_OPTS environment variable are parsed before args, so args win.
+// The flags are registered on a FlagSet of their own, not on flag.CommandLine
+func VetFlags(args []string) (flags Flags, err error) {
+	fs := flag.NewFlagSet(programName, flag.ExitOnError)
+	srcPath := fs.String(FlagNameSrc, os.Getenv(EnvSrc), FlagUsageSrc)
+	dstPath := fs.String(FlagNameDst, os.Getenv(EnvDst), FlagUsageDst)
+	cFlag := fs.Bool(FlagNameC, false, FlagUsageC)
+	fs.Var(&flags.Opts.IgnoreErrors, FlagNameIgnoreErrors, FlagUsageIgnoreErrors)
+	fs.Var(&flags.Opts.Artifacts, FlagNameArtifact, FlagUsageArtifact)
+	fs.Var(&flags.Opts.IgnoreDirs, FlagNameIgnoreDir, FlagUsageIgnoreDir)
+	fs.Var(&flags.Opts.MinSize, FlagNameMinSize, FlagUsageMinSize)
+	fs.Var(&flags.Opts.MaxSize, FlagNameMaxSize, FlagUsageMaxSize)
+	fs.Var(&flags.Opts.BufferSize, FlagNameBufferSize, FlagUsageBufferSize)
+	fs.Var(&flags.Opts.BWLimit, FlagNameBWLimit, FlagUsageBWLimit)
+	fs.Var(&flags.Opts.NewerThan, FlagNameNewerThan, FlagUsageNewerThan)
+	fs.Var(&flags.Opts.OlderThan, FlagNameOlderThan, FlagUsageOlderThan)
+	fs.Var(&flags.Opts.Include, FlagNameInclude, FlagUsageInclude)
+	fs.Var(&flags.Opts.Exclude, FlagNameExclude, FlagUsageExclude)
+	fs.Var(&flags.Opts.IncludeRegex, FlagNameIncludeRegex, FlagUsageIncludeRegex)
+	fs.Var(&flags.Opts.ExcludeRegex, FlagNameExcludeRegex, FlagUsageExcludeRegex)
+	fs.Var(&flags.Opts.Priority, FlagNamePriority, FlagUsagePriority)
+	fs.StringVar(&flags.Ping, FlagNamePing, "", FlagUsagePing)
+	fs.StringVar(&flags.LogSink, FlagNameLogSink, LogSinkStdout, FlagUsageLogSink)
+	fs.StringVar(&flags.Opts.LogPath, FlagNameLogFile, "", FlagUsageLogFile)
+	fs.StringVar(&flags.Audit, FlagNameAudit, "", FlagUsageAudit)
+	fs.BoolVar(&flags.Yes, FlagNameYes, false, FlagUsageYes)
+	fs.BoolVar(&flags.Yes, FlagNameY, false, FlagUsageY)
+	fs.StringVar(&flags.LogFormat, FlagNameLogFormat, LogFormatText, FlagUsageLogFormat)
+	fs.Int64Var(&flags.ShrinkLimit, FlagNameShrinkLimit, defaultShrinkLimit, FlagUsageShrinkLimit)
+	fs.StringVar(&flags.Opts.ScanCmd, FlagNameScanCmd, "", FlagUsageScanCmd)
+	fs.StringVar(&flags.Opts.ScanPolicy, FlagNameScanPolicy, ScanPolicySkip, FlagUsageScanPolicy)
+	fs.StringVar(&flags.Opts.SizeChange, FlagNameSizeChange, SizeChangeFlag, FlagUsageSizeChange)
+	fs.StringVar(&flags.Opts.Quarantine, FlagNameQuarantine, "", FlagUsageQuarantine)
+	fs.BoolVar(&flags.CAS, FlagNameCAS, false, FlagUsageCAS)
+	fs.BoolVar(&flags.Resume, FlagNameResume, false, FlagUsageResume)
+	fs.DurationVar(&flags.StaleAfter, FlagNameStaleAfter, defaultStaleAfter, FlagUsageStaleAfter)
+	fs.IntVar(&flags.AutoRerun, FlagNameAutoRerun, 0, FlagUsageAutoRerun)
+	fs.StringVar(&flags.TempDir, FlagNameTempDir, "", FlagUsageTempDir)
+	fs.StringVar(&flags.Snapshot, FlagNameSnapshot, "", FlagUsageSnapshot)
+	fs.BoolVar(&flags.Swap, FlagNameSwap, false, FlagUsageSwap)
+	fs.BoolVar(&flags.RecordManifest, FlagNameRecordManifest, false, FlagUsageRecordManifest)
+	fs.BoolVar(&flags.Opts.PreserveTimes, FlagNamePreserveTimes, true, FlagUsagePreserveTimes)
+	fs.BoolVar(&flags.Opts.PreserveOwner, FlagNamePreserveOwner, false, FlagUsagePreserveOwner)
+	fs.BoolVar(&flags.Opts.PreservePerms, FlagNamePreservePerms, true, FlagUsagePreservePerms)
+	fs.BoolVar(&flags.Opts.BirthTime, FlagNameBirthTime, false, FlagUsageBirthTime)
+	fs.BoolVar(&flags.Opts.Xattrs, FlagNameXattrs, false, FlagUsageXattrs)
+	fs.BoolVar(&flags.Opts.Links, FlagNameLinks, false, FlagUsageLinks)
+	fs.BoolVar(&flags.Opts.FollowLinks, FlagNameFollowLinks, false, FlagUsageFollowLinks)
+	fs.BoolVar(&flags.Opts.HardLinks, FlagNameHardLinks, false, FlagUsageHardLinks)
+	fs.BoolVar(&flags.Opts.DetectRenames, FlagNameDetectRenames, false, FlagUsageDetectRenames)
+	fs.BoolVar(&flags.Opts.Move, FlagNameMove, false, FlagUsageMove)
+	fs.BoolVar(&flags.Opts.Delta, FlagNameDelta, false, FlagUsageDelta)
+	fs.StringVar(&flags.Opts.MoveVerify, FlagNameMoveVerify, MoveVerifySize, FlagUsageMoveVerify)
+	fs.BoolVar(&flags.Opts.FileFlags, FlagNameFileFlags, false, FlagUsageFileFlags)
+	fs.BoolVar(&flags.DryRun, FlagNameDryRun, false, FlagUsageDryRun)
+	fs.BoolVar(&flags.Sync, FlagNameSync, false, FlagUsageSync)
+	fs.IntVar(&flags.Opts.Workers, FlagNameJobs, runtime.NumCPU(), FlagUsageJobs)
+	fs.IntVar(&flags.Opts.Retries, FlagNameRetries, 0, FlagUsageRetries)
+	fs.DurationVar(&flags.Opts.RetryWait, FlagNameRetryWait, DefaultRetryWait, FlagUsageRetryWait)
+	maxMem := fs.Int64(FlagNameMaxMem, 0, FlagUsageMaxMem)
+	fs.DurationVar(&flags.MemStats, FlagNameMemStats, 0, FlagUsageMemStats)
+	fs.StringVar(&flags.OTel, FlagNameOTel, "", FlagUsageOTel)
+	fs.Float64Var(&flags.OTelSample, FlagNameOTelSample, DefaultOTelSample, FlagUsageOTelSample)
+	fs.Var(&flags.Plugins, FlagNamePlugin, FlagUsagePlugin)
+	fs.StringVar(&flags.Opts.Compare.Mode, FlagNameCompare, CompareSize, FlagUsageCompare)
+	fs.Var(&flags.Opts.Compare.Patterns, FlagNameComparePattern, FlagUsageComparePattern)
+	fs.DurationVar(&flags.Opts.Compare.Tolerance, FlagNameModTimeTolerance, defaultModTimeTolerance, FlagUsageModTimeTolerance)
+
+	flags.set = fs
+	if err = fs.Parse(append(strings.Fields(os.Getenv(EnvOpts)), args...)); err != nil {
+		return
+	}
+
+	if *srcPath == "" || *dstPath == "" || fs.NArg() > 0 || flags.ShrinkLimit < 0 || flags.ShrinkLimit > 100 || flags.StaleAfter < 0 || flags.AutoRerun < 0 || flags.Opts.Workers < 1 || *maxMem < 0 || flags.MemStats < 0 || flags.OTelSample < 0 || flags.OTelSample > 1 {
 		err = ErrWrongArgs
 		return
 	}
 
-	dst, err = filepath.Abs(*dstPath)
+	for _, path := range []*string{srcPath, dstPath, &flags.Audit, &flags.Opts.Quarantine, &flags.TempDir, &flags.Opts.LogPath} {
+		if *path, err = ExpandPath(*path); err != nil {
+			return
+		}
+	}
+
+	flags.Opts.MaxMem = *maxMem * BytesInMB
+
+	if flags.OTel != "" {
+		if flags.OTel, err = OTelEndpoint(flags.OTel); err != nil {
+			return
+		}
+	}
+
+	for i := range flags.Opts.Artifacts {
+		if flags.Opts.Artifacts[i], err = ExpandPath(flags.Opts.Artifacts[i]); err != nil {
+			return
+		}
+	}
+	if flags.Audit != "" {
+		flags.Opts.Artifacts = append(flags.Opts.Artifacts, flags.Audit)
+	}
+
+	if err = flags.Opts.check(); err != nil {
+		return
+	}
+	if flags.Snapshot != "" {
+		if err = VetSnapshot(flags.Snapshot); err != nil {
+			return
+		}
+	}
+
+	flags.Dst, err = filepath.Abs(*dstPath)
 	if err != nil {
 		return
 	}
 
-	src, err = filepath.Abs(*srcPath)
+	flags.Src, err = filepath.Abs(*srcPath)
 	if err != nil {
 		return
 	}
 
-	if f, errF := os.Stat(src); os.IsNotExist(errF) || !f.IsDir() {
+	flags.Dst, flags.Src = fixLongPath(flags.Dst), fixLongPath(flags.Src)
+	flags.Opts.IgnoreFS = OSFS(flags.Src)
+
+	if f, errF := os.Stat(flags.Src); os.IsNotExist(errF) || !f.IsDir() {
 		err = ErrSrcNotFound
 		return
 	}
 
-	if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+	if f, errF := os.Stat(flags.Dst); os.IsNotExist(errF) || !f.IsDir() {
 		err = ErrDstNotFound
+		if halfSwapped(flags.Dst) {
+			_, oldPath := SwapPaths(flags.Dst)
+			err = fmt.Errorf("%w %q", ErrSwapNotConfirmed, oldPath)
+		}
 		return
 	}
 
-	if *cFlag {
-		cleaningMode = true
+	if err = CheckNotNested(flags.Src, flags.Dst); err != nil {
+		return
 	}
 
+	flags.CleaningMode = *cFlag
+	if flags.CAS && flags.CleaningMode {
+		err = ErrCASCleaning
+	} else if flags.Sync && (flags.CleaningMode || flags.CAS || flags.Resume) {
+		err = ErrSyncMode
+	} else if flags.Snapshot != "" && flags.Resume {
+		err = ErrSnapshotMode
+	} else if flags.Opts.Move && (flags.CleaningMode || flags.Sync || flags.CAS || flags.Snapshot != "" || flags.Opts.HardLinks || flags.Swap) {
+		err = ErrMoveMode
+	} else if flags.Opts.Delta && (flags.Swap || flags.CAS) {
+		err = ErrDeltaMode
+	} else if flags.Opts.DetectRenames && !flags.Sync {
+		err = ErrDetectRenamesMode
+	} else if flags.Swap && (flags.CAS || flags.Resume) {
+		err = ErrSwapMode
+	} else if flags.Swap {
+		err = CheckSwap(flags.Dst)
+	}
+
+	if err == nil {
+		err = CheckDstConfig(&flags)
+	}
 	return
 }
 
-// ReadFolder returns paths of folders and files. The paths are relative to the path that was passed as an argument
-func ReadFolder(path string) (folders Folder, files File, err error) {
-	folders = make(Folder)
-	files = make(File)
-	err = readFolder(path, path, folders, files)
-	return
+// CheckNotNested returns ErrSameFolder if src and dst are the same folder and ErrNestedFolder if one is inside the other.
+// Folders are compared by device and inode (file index on Windows), so bind mounts and junctions are found too
+func CheckNotNested(src, dst string) error {
+	s, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	d, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(s, d) {
+		return ErrSameFolder
+	}
+
+	for _, pair := range [][2]string{{src, dst}, {dst, src}} {
+		inside, err := isInsideFolder(pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+		if inside {
+			return ErrNestedFolder
+		}
+	}
+	return nil
 }
 
-func readFolder(path string, startingPath string, folders Folder, files File) error {
-	items, err := os.ReadDir(path)
+// isInsideFolder returns true if one of the parent folders of path is folder
+func isInsideFolder(path, folder string) (bool, error) {
+	f, err := os.Stat(folder)
 	if err != nil {
+		return false, err
+	}
+
+	for parent := filepath.Dir(path); ; parent = filepath.Dir(parent) {
+		p, err := os.Stat(parent)
+		if err != nil {
+			return false, err
+		}
+		if os.SameFile(p, f) {
+			return true, nil
+		}
+		if filepath.Dir(parent) == parent {
+			return false, nil
+		}
+	}
+}
+
+// ExpandPath expands a leading ~ into the home folder and $VAR, ${VAR} and %VAR% into environment variables.
+// $VAR and %VAR% that aren't set are left alone, since $ and % can be a part of a file name, but a ${VAR} that isn't
+// set returns ErrUnsetVariable, the braces say that it's meant as a variable. Values of variables and the home folder
+// are taken as they are, variables in them aren't expanded
+func ExpandPath(path string) (string, error) {
+	var home string
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return "", err
+		}
+		path = path[1:]
+	}
+
+	var unset string
+	path = envVar.ReplaceAllStringFunc(path, func(v string) string {
+		m := envVar.FindStringSubmatch(v)
+		name := m[1] + m[2] + m[3]
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		if m[2] != "" && unset == "" {
+			unset = name
+		}
+		return v
+	})
+	if unset != "" {
+		return "", fmt.Errorf("%w %s", ErrUnsetVariable, unset)
+	}
+	return home + path, nil
+}
+
+// EffectiveOptions lists every flag that VetFlags parsed with the value it ended up with, one flag per line
+func (flags *Flags) EffectiveOptions() string {
+	var b strings.Builder
+	b.WriteString(MsgEffectiveOptions)
+	if flags.set == nil {
+		return b.String()
+	}
+	flags.set.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(&b, "\n  -%s=%s", f.Name, f.Value)
+	})
+	return b.String()
+}
+
+// ReadFolder returns paths of folders and files, and of items that were skipped. The paths are relative to the path that was passed as an argument.
+// Paths that couldn't be read because of an ignored error are added to opts.Report.Unreadable
+func ReadFolder(path string, opts *Options) (folders Folder, files File, skipped Skipped, err error) {
+	return ReadFS(OSFS(path), opts)
+}
+
+// ReadFS is ReadFolder for any fs.FS, e.g. an embed.FS or a zip archive. The paths use the separator of the OS, like with ReadFolder
+func ReadFS(fsys fs.FS, opts *Options) (folders Folder, files File, skipped Skipped, err error) {
+	r := &folderReader{fsys: fsys, folders: make(Folder), files: make(File), skipped: make(Skipped), artifacts: opts.artifactsIn(fsys), opts: opts}
+	err = r.readFolder(".", nil)
+	return r.folders, r.files, r.skipped, err
+}
+
+// folderReader holds what ReadFS fills while it walks fsys
+type folderReader struct {
+	fsys    fs.FS
+	folders Folder
+	files   File
+	// links gets the symlinks if it isn't nil, otherwise they are skipped, see ReadFolderLinks
+	links Links
+	// follow makes symlinks count as what they point to, see ReadFSFollowLinks
+	follow bool
+	// parents are the folders that hold the one being read when links are followed, see inParents
+	parents   []fs.FileInfo
+	skipped   Skipped
+	artifacts map[string]struct{}
+	opts      *Options
+}
+
+// readFolder reads the folder name and everything inside it. ignores are the MirrorIgnoreFile rules of its parents
+func (r *folderReader) readFolder(name string, ignores []*ignoreFile) error {
+	opts := r.opts
+	var items []fs.DirEntry
+	err := opts.withRetries(filepath.FromSlash(name), func() (err error) {
+		items, err = fs.ReadDir(r.fsys, name)
+		return
+	})
+	if err != nil {
+		if name == "." || !opts.ignoreErr(filepath.FromSlash(name), err) {
+			return err
+		}
+		opts.Report.Unreadable = append(opts.Report.Unreadable, filepath.FromSlash(name))
+		return nil
+	}
+
+	if err = opts.checkMem(len(items), name == "."); err != nil {
+		return err
+	}
+
+	if ignores, err = opts.loadIgnoreFile(r.fsys, name, items, ignores); err != nil {
 		return err
 	}
 
 	for _, item := range items {
 		currentName := item.Name()
-		currentPath := filepath.Join(path, currentName)
-		currentTrimmedPath, err := filepath.Rel(startingPath, currentPath)
-		if err != nil {
-			return err
+		currentFSName := path.Join(name, currentName)
+		currentTrimmedPath := filepath.FromSlash(currentFSName)
+
+		if _, ok := r.artifacts[currentTrimmedPath]; ok {
+			r.skipped[currentTrimmedPath] = ReasonArtifact
+			continue
 		}
 
-		if item.IsDir() {
-			if currentName != FolderToIgnore {
-				folders[currentTrimmedPath] = struct{}{}
-				if err = readFolder(currentPath, startingPath, folders, files); err != nil {
+		// a followed link is listed like what it points to
+		isDir, info := item.IsDir(), fs.FileInfo(nil)
+		if r.follow && item.Type()&fs.ModeSymlink != 0 {
+			if info, err = fs.Stat(r.fsys, currentFSName); errors.Is(err, fs.ErrNotExist) {
+				r.skipped[currentTrimmedPath] = ReasonBrokenLink
+				continue
+			} else if err != nil {
+				if !opts.ignoreErr(currentTrimmedPath, err) {
 					return err
 				}
+				opts.Report.Unreadable = append(opts.Report.Unreadable, currentTrimmedPath)
+				continue
 			}
-		} else {
-			info, err := item.Info()
-			if err != nil {
+			isDir = info.IsDir()
+		}
+
+		if reason := opts.filtered(currentFSName, isDir); reason != "" {
+			r.skipped[currentTrimmedPath] = reason
+			continue
+		}
+		if ignored(ignores, currentFSName, isDir) {
+			r.skipped[currentTrimmedPath] = ReasonMirrorIgnore
+			continue
+		}
+
+		if isDir {
+			if reason := opts.ignoredDir(currentName); reason != "" {
+				r.skipped[currentTrimmedPath] = reason
+				continue
+			}
+			if isTempDir(currentName) {
+				r.skipped[currentTrimmedPath] = ReasonTempFolder
+				continue
+			}
+			if name == "." && currentName == MetaFolder {
+				r.skipped[currentTrimmedPath] = ReasonMetaFolder
+				continue
+			}
+			if reason, err := opts.Plugins.filtered(r.fsys, currentFSName, true, nil); err != nil {
 				return err
+			} else if reason != "" {
+				r.skipped[currentTrimmedPath] = reason
+				continue
 			}
-			if info.Mode()&os.ModeSymlink != os.ModeSymlink {
-				files[currentTrimmedPath] = info.Size()
+			if r.follow {
+				if info == nil {
+					if info, err = item.Info(); err != nil {
+						if !opts.ignoreErr(currentTrimmedPath, err) {
+							return err
+						}
+						opts.Report.Unreadable = append(opts.Report.Unreadable, currentTrimmedPath)
+						continue
+					}
+				}
+				if r.inParents(info) {
+					r.skipped[currentTrimmedPath] = ReasonLinkCycle
+					continue
+				}
+				r.parents = append(r.parents, info)
+			}
+			r.folders[currentTrimmedPath] = struct{}{}
+			if err = r.readFolder(currentFSName, ignores); err != nil {
+				return err
+			}
+			if r.follow {
+				r.parents = r.parents[:len(r.parents)-1]
 			}
+		} else {
+			if isPartFile(currentName) {
+				r.skipped[currentTrimmedPath] = ReasonPartFile
+				continue
+			}
+			if info == nil {
+				if info, err = item.Info(); err != nil {
+					if !opts.ignoreErr(currentTrimmedPath, err) {
+						return err
+					}
+					opts.Report.Unreadable = append(opts.Report.Unreadable, currentTrimmedPath)
+					continue
+				}
+			}
+			if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+				if r.links == nil {
+					r.skipped[currentTrimmedPath] = ReasonSymlink
+					continue
+				}
+				target, err := r.readLink(currentFSName)
+				if err != nil {
+					if !opts.ignoreErr(currentTrimmedPath, err) {
+						return err
+					}
+					opts.Report.Unreadable = append(opts.Report.Unreadable, currentTrimmedPath)
+					continue
+				}
+				r.links[currentTrimmedPath] = target
+				continue
+			}
+			if !info.Mode().IsRegular() {
+				r.skipped[currentTrimmedPath] = ReasonSpecialFile
+				continue
+			}
+			if reason := opts.sizeFiltered(info.Size()); reason != "" {
+				r.skipped[currentTrimmedPath] = reason
+				continue
+			}
+			if reason := opts.ageFiltered(info.ModTime()); reason != "" {
+				r.skipped[currentTrimmedPath] = reason
+				continue
+			}
+			if reason, err := opts.Plugins.filtered(r.fsys, currentFSName, false, info); err != nil {
+				return err
+			} else if reason != "" {
+				r.skipped[currentTrimmedPath] = reason
+				continue
+			}
+			r.files[currentTrimmedPath] = info.Size()
 		}
 	}
 	return nil
 }
 
+// Summary counts skipped items by reason, e.g. `skipped in "src": symlink 12, special file 1`. It returns an empty string if nothing was skipped
+func (s Skipped) Summary(path string) string {
+	if len(s) == 0 {
+		return ""
+	}
+
+	counts := make(map[string]int)
+	for _, reason := range s {
+		counts[reason]++
+	}
+
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%s %d", reason, counts[reason])
+	}
+	return fmt.Sprintf(MsgSkipped, path) + " " + strings.Join(reasons, ", ")
+}
+
+// DropUnreadable removes unreadable paths, and everything inside them, from folders and files.
+// This way nothing is copied into or removed from a folder whose content isn't known
+func DropUnreadable(unreadable []string, folders Folder, files File) {
+	if len(unreadable) == 0 {
+		return
+	}
+	for folder := range folders {
+		if isInside(folder, unreadable) {
+			delete(folders, folder)
+		}
+	}
+	for file := range files {
+		if isInside(file, unreadable) {
+			delete(files, file)
+		}
+	}
+}
+
 // MissingFolders returns directories that are present in src but not in dst
 func MissingFolders(dst, src Folder) Folder {
 	res := make(Folder)
@@ -198,11 +952,31 @@ func FilesToClean(dst, src File) (res File, totalSize int64) {
 	return
 }
 
-// MakeFolders makes directories with os.MkdirAll in path directory and logs progress
-func MakeFolders(folders Folder, path string) error {
+// TotalSize returns the size of all files together
+func TotalSize(files File) (size int64) {
+	for _, s := range files {
+		size += s
+	}
+	return
+}
+
+// ShrinksTooMuch returns true if removing removed bytes out of total would take away more than limit percent
+func ShrinksTooMuch(total, removed, limit int64) bool {
+	return total > 0 && removed*100 > total*limit
+}
+
+// MakeFolders makes directories with os.MkdirAll in path directory and logs progress. They get FolderPerm, see
+// MakeFoldersFS for the permissions of the source
+func MakeFolders(folders Folder, path string, opts *Options) error {
+	return MakeFoldersFS(folders, nil, path, opts)
+}
+
+// MakeFoldersFS is MakeFolders that gives the folders the owners and permissions of the same folders in srcFS if
+// opts.PreserveOwner and opts.PreservePerms are set
+func MakeFoldersFS(folders Folder, srcFS fs.FS, path string, opts *Options) error {
 	var recentlyLoggedProgress, counter int
 
-	f, err := initLogFile()
+	f, err := initLogFile(opts)
 	if err != nil {
 		return err
 	}
@@ -212,13 +986,34 @@ func MakeFolders(folders Folder, path string) error {
 
 	sortedFolders := keepFoldersWithLongestPrefix(folders)
 	for _, folder := range sortedFolders {
+		if opts.stopped() {
+			return closeStoppedLog(f)
+		}
+
 		if err = os.MkdirAll(filepath.Join(path, folder), FolderPerm); err != nil {
-			return err
+			if !opts.ignoreErr(folder, err) {
+				return err
+			}
+			continue
 		}
 
 		logProgressFolders(&recentlyLoggedProgress, &counter, len(sortedFolders), MsgProgressMakingFolders)
+		opts.sendProgress(PhaseMakingFolders, int64(counter), int64(len(sortedFolders)))
 
 		LogToFile(f, folder)
+		opts.journal(folder)
+	}
+
+	if srcFS != nil && (opts.PreserveOwner || opts.keepsPerms()) {
+		ownerLost, err := copyFolderAttrs(folders, srcFS, path, opts)
+		for _, folder := range ownerLost {
+			LogToFile(f, LogOwnerNotKept+folder)
+		}
+		opts.Report.OwnerNotKept = append(opts.Report.OwnerNotKept, ownerLost...)
+		if err != nil {
+			f.Close()
+			return err
+		}
 	}
 
 	err = f.Close()
@@ -226,10 +1021,10 @@ func MakeFolders(folders Folder, path string) error {
 }
 
 // CleanFolders removes directories with os.RemoveAll in path directory and logs progress
-func CleanFolders(folders Folder, path string) error {
+func CleanFolders(folders Folder, path string, opts *Options) error {
 	var recentlyLoggedProgress, counter int
 
-	f, err := initLogFile()
+	f, err := initLogFile(opts)
 	if err != nil {
 		return err
 	}
@@ -239,13 +1034,25 @@ func CleanFolders(folders Folder, path string) error {
 
 	sortedFolders := keepFoldersWithShortestPrefix(folders)
 	for _, folder := range sortedFolders {
-		if err = os.RemoveAll(filepath.Join(path, folder)); err != nil {
-			return err
+		if opts.stopped() {
+			return closeStoppedLog(f)
+		}
+
+		err = opts.withRetries(folder, func() error {
+			return os.RemoveAll(filepath.Join(path, folder))
+		})
+		if err != nil {
+			if !opts.ignoreErr(folder, err) {
+				return err
+			}
+			continue
 		}
 
 		logProgressFolders(&recentlyLoggedProgress, &counter, len(sortedFolders), MsgProgressCleaningFolders)
+		opts.sendProgress(PhaseCleaningFolders, int64(counter), int64(len(sortedFolders)))
 
 		LogToFile(f, folder)
+		opts.journal(folder)
 	}
 
 	err = f.Close()
@@ -253,10 +1060,21 @@ func CleanFolders(folders Folder, path string) error {
 }
 
 // CopyFiles copies files and logs progress. The 'files' parameter should contain relative paths
-func CopyFiles(files File, totalSize int64, src, dst string) error {
+func CopyFiles(files File, totalSize int64, src, dst string, opts *Options) error {
+	return CopyFilesFS(files, totalSize, OSFS(src), dst, opts)
+}
+
+// CopyFilesFS is CopyFiles with the source in fsys, e.g. the one that ReadFS read.
+// opts.BirthTime, opts.Xattrs, opts.FileFlags and opts.PreserveOwner need an OSFS, it returns the matching
+// Err*NeedsOSFS otherwise
+func CopyFilesFS(files File, totalSize int64, fsys fs.FS, dst string, opts *Options) error {
 	var bytesWritten, recentlyLoggedProgress int64
 
-	l, err := initLogFile()
+	if err := needsOSFS(fsys, opts); err != nil {
+		return err
+	}
+
+	l, err := initLogFile(opts)
 	if err != nil {
 		return err
 	}
@@ -264,33 +1082,94 @@ func CopyFiles(files File, totalSize int64, src, dst string) error {
 	LogToFile(l, LogCopiedFiles+"\n")
 	log.Println(MsgProgressCopyingFiles, ZeroPercent)
 
-	for _, file := range sortFoldersOrFiles(files) {
-		s, err := os.Open(filepath.Join(src, file))
-		if err != nil {
-			return err
+	// workers only copy, everything else happens here, so the log, the report and the journal need no locks
+	done := make(chan struct{})
+	var failed error
+	var finished int
+	fail := func(err error) {
+		if failed == nil {
+			failed = err
+			close(done)
 		}
+	}
 
-		d, err := os.Create(filepath.Join(dst, file))
-		if err != nil {
-			return err
+	for r := range startCopying(PrioritizeFiles(sortFoldersOrFiles(files), opts.Priority), files, fsys, dst, opts, done) {
+		finished++
+		if p, ok := r.err.(*WorkerPanic); ok {
+			panic(p)
 		}
-
-		written, err := io.Copy(d, s)
-		if err != nil {
-			return err
+		for _, msg := range r.retried {
+			log.Println(msg)
 		}
-		bytesWritten += written
-
-		if err = s.Close(); err != nil {
-			return err
+		switch {
+		case r.vanished:
+			opts.Report.Vanished = append(opts.Report.Vanished, r.file)
+			totalSize -= files[r.file]
+			LogToFile(l, LogVanished+r.file)
+			continue
+		case r.infected:
+			opts.Report.Infected = append(opts.Report.Infected, r.file)
+			totalSize -= files[r.file]
+			LogToFile(l, fmt.Sprintf(LogInfected, opts.ScanPolicy)+r.file)
+			if r.err != nil {
+				fail(r.err)
+			}
+			continue
+		case r.err != nil:
+			if !opts.ignoreErr(r.file, r.err) {
+				fail(r.err)
+			}
+			continue
 		}
-		if err = d.Close(); err != nil {
-			return err
+		bytesWritten += r.written
+		if r.ownerLost {
+			opts.Report.OwnerNotKept = append(opts.Report.OwnerNotKept, r.file)
+			LogToFile(l, LogOwnerNotKept+r.file)
+		}
+		if r.xattrsLost {
+			opts.Report.XattrsNotKept = append(opts.Report.XattrsNotKept, r.file)
+			LogToFile(l, LogXattrsNotKept+r.file)
+		}
+		if r.flagsLost {
+			opts.Report.FlagsNotKept = append(opts.Report.FlagsNotKept, r.file)
+			LogToFile(l, LogFileFlagsNotKept+r.file)
+		}
+		if r.sizeChanged {
+			opts.Report.SizeChanged = append(opts.Report.SizeChanged, r.file)
+			LogToFile(l, fmt.Sprintf(LogSizeChanged, opts.sizeChange())+r.file)
+		}
+		if r.moveKept {
+			opts.Report.NotMoved = append(opts.Report.NotMoved, r.file)
+			LogToFile(l, LogNotMoved+r.file)
+		} else if opts.Move {
+			opts.Report.Moved = append(opts.Report.Moved, r.file)
+		}
+		if r.patched {
+			opts.Report.Patched = append(opts.Report.Patched, r.file)
+			opts.Report.PatchedSize += r.written
+			opts.Report.PatchWritten += r.patchWritten
+			LogToFile(l, fmt.Sprintf(LogPatched, ThousandSeparator(strconv.FormatInt(r.patchWritten, 10)), ThousandSeparator(strconv.FormatInt(r.written, 10)))+r.file)
 		}
 
 		logProgressFiles(&recentlyLoggedProgress, totalSize, bytesWritten, MsgProgressCopyingFiles)
+		opts.sendProgress(PhaseCopyingFiles, bytesWritten, totalSize)
 
-		LogToFile(l, file)
+		LogToFile(l, r.file)
+		opts.journal(r.file)
+		opts.Plugins.notify(PluginEventCopied, r.file, r.written)
+	}
+
+	// needsOSFS made sure that fsys is an OSFS
+	if opts.Move {
+		pruneFolders(opts.Report.Moved, string(fsys.(OSFS)), l)
+	}
+
+	if failed != nil {
+		l.Close()
+		return failed
+	}
+	if finished < len(files) {
+		return closeStoppedLog(l)
 	}
 
 	if err = l.Close(); err != nil {
@@ -301,10 +1180,10 @@ func CopyFiles(files File, totalSize int64, src, dst string) error {
 }
 
 // CleanFiles removes files and logs progress. The 'files' parameter should contain relative paths
-func CleanFiles(files File, totalSize int64, path string) error {
+func CleanFiles(files File, totalSize int64, path string, opts *Options) error {
 	var bytesDeleted, recentlyLoggedProgress int64
 
-	l, err := initLogFile()
+	l, err := initLogFile(opts)
 	if err != nil {
 		return err
 	}
@@ -313,19 +1192,31 @@ func CleanFiles(files File, totalSize int64, path string) error {
 	log.Println(MsgProgressCleaningFiles, ZeroPercent)
 
 	for _, file := range sortFoldersOrFiles(files) {
-		info, err := os.Stat(filepath.Join(path, file))
-		if err != nil {
-			return err
+		if opts.stopped() {
+			return closeStoppedLog(l)
 		}
-		bytesDeleted += info.Size()
 
-		if err = os.Remove(filepath.Join(path, file)); err != nil {
-			return err
+		var info os.FileInfo
+		err = opts.withRetries(file, func() (err error) {
+			if info, err = os.Stat(filepath.Join(path, file)); err == nil {
+				err = os.Remove(filepath.Join(path, file))
+			}
+			return
+		})
+		if err != nil {
+			if !opts.ignoreErr(file, err) {
+				return err
+			}
+			continue
 		}
+		bytesDeleted += info.Size()
 
 		logProgressFiles(&recentlyLoggedProgress, totalSize, bytesDeleted, MsgProgressCleaningFiles)
+		opts.sendProgress(PhaseCleaningFiles, bytesDeleted, totalSize)
 
 		LogToFile(l, file)
+		opts.journal(file)
+		opts.Plugins.notify(PluginEventRemoved, file, info.Size())
 	}
 
 	if err = l.Close(); err != nil {
@@ -335,6 +1226,24 @@ func CleanFiles(files File, totalSize int64, path string) error {
 	return nil
 }
 
+// LogIgnoredErrors prints errors that were ignored and writes them into the log file of opts
+func LogIgnoredErrors(errs []error, opts *Options) error {
+	l, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(l, LogErrorsIgnored+"\n")
+	log.Println(MsgIgnoredErrors, len(errs))
+
+	for _, e := range errs {
+		log.Println(e)
+		LogToFile(l, e.Error())
+	}
+
+	return l.Close()
+}
+
 // ThousandSeparator adds space after each thousand: 1000000 -> 1 000 000
 func ThousandSeparator(n string) string {
 	if len(n) < 4 {
@@ -358,13 +1267,17 @@ func WriteNewLineIfNotEmpty(f *os.File) error {
 }
 
 func LogToFile(w io.Writer, message string) {
+	prev, prevFlags := log.Writer(), log.Flags()
 	log.SetOutput(w)
+	log.SetFlags(log.LstdFlags)
 	log.Println(message)
-	log.SetOutput(os.Stdout)
+	log.SetOutput(prev)
+	log.SetFlags(prevFlags)
 }
 
-func TruncateLogFile() error {
-	err := os.WriteFile(LogFile, nil, FilePerm)
+// TruncateLogFile empties the log file of opts, see Options.LogFilePath
+func TruncateLogFile(opts *Options) error {
+	err := os.WriteFile(opts.LogFilePath(), nil, FilePerm)
 	return err
 }
 
@@ -419,8 +1332,85 @@ func sortFoldersOrFiles(m interface{}) []string {
 	return res
 }
 
-func initLogFile() (logFile *os.File, err error) {
-	logFile, err = os.OpenFile(LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, FilePerm)
+// closeStoppedLog notes into the log file that the program was stopped, closes it and returns ErrStopped
+func closeStoppedLog(l *os.File) error {
+	LogToFile(l, LogStopped)
+	if err := l.Close(); err != nil {
+		return err
+	}
+	return ErrStopped
+}
+
+func copyFile(src, dst string) (written int64, err error) {
+	s, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	return cloneOrWrite(s, dst, &Options{})
+}
+
+// copyFSFile is copyFile with the source in fsys, copies that aren't clones go through a buffer of opts.BufferSize,
+// see writeTo, and are limited to opts.BWLimit
+func copyFSFile(fsys fs.FS, name, dst string, opts *Options) (written int64, err error) {
+	s, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	return cloneOrWrite(s, dst, opts)
+}
+
+// cloneOrWrite clones a file of a folder on disk where the file system can do it, see cloneFile, and writes a copy
+// of s into dst otherwise. A clone isn't limited, nothing is read for it
+func cloneOrWrite(s fs.File, dst string, opts *Options) (written int64, err error) {
+	if f, ok := s.(*os.File); ok {
+		var cloned bool
+		if written, cloned, err = cloneFile(f, dst); cloned || err != nil {
+			return
+		}
+	}
+	return writeFile(opts.limit(s), dst, opts.BufferSize)
+}
+
+// writeFile creates dst with everything read from r, see writeTo for bufferSize
+func writeFile(r io.Reader, dst string, bufferSize Size) (written int64, err error) {
+	d, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+
+	if written, err = writeTo(d, r, bufferSize); err != nil {
+		d.Close()
+		return
+	}
+
+	err = d.Close()
+	return
+}
+
+// vanished returns true if err happened because the file name in fsys doesn't exist anymore
+func vanished(fsys fs.FS, name string, err error) bool {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	_, errStat := fs.Stat(fsys, name)
+	return errors.Is(errStat, fs.ErrNotExist)
+}
+
+// isInside returns true if path is one of the parents or a path inside one of them
+func isInside(path string, parents []string) bool {
+	for _, parent := range parents {
+		if path == parent || strings.HasPrefix(path, parent+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// initLogFile opens the log file of opts for appending, see Options.LogFilePath
+func initLogFile(opts *Options) (logFile *os.File, err error) {
+	logFile, err = os.OpenFile(opts.LogFilePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, FilePerm)
 	if err != nil {
 		return
 	}
@@ -431,12 +1421,13 @@ func initLogFile() (logFile *os.File, err error) {
 func keepFoldersWithLongestPrefix(folders Folder) (res []string) {
 	sorted := sortFoldersOrFiles(folders)
 
-	for i := 0; i < len(folders)-1; i++ {
-		if filepath.Dir(sorted[i+1]) == filepath.Dir(sorted[i]) || !strings.HasPrefix(sorted[i+1], sorted[i]) {
-			res = append(res, sorted[i])
+	for _, folder := range sorted {
+		// descendants of a folder sort right after "folder/", but not always right after the folder itself ("a", "a-b", "a/c")
+		prefix := folder + string(filepath.Separator)
+		if i := sort.SearchStrings(sorted, prefix); i == len(sorted) || !strings.HasPrefix(sorted[i], prefix) {
+			res = append(res, folder)
 		}
 	}
-	res = append(res, sorted[len(folders)-1])
 
 	return
 }
@@ -444,12 +1435,24 @@ func keepFoldersWithLongestPrefix(folders Folder) (res []string) {
 func keepFoldersWithShortestPrefix(folders Folder) (res []string) {
 	sorted := sortFoldersOrFiles(folders)
 
-	for i := len(folders) - 1; i > 0; i-- {
-		if filepath.Dir(sorted[i]) == filepath.Dir(sorted[i-1]) || !strings.HasPrefix(sorted[i], sorted[i-1]) {
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if !hasParentIn(sorted[i], folders) {
 			res = append(res, sorted[i])
 		}
 	}
-	res = append(res, sorted[0])
 
 	return
 }
+
+// hasParentIn reports whether any parent of folder is in folders, parents are found by cutting folder at its separators
+func hasParentIn(folder string, folders Folder) bool {
+	for i := 0; i < len(folder); i++ {
+		if folder[i] != filepath.Separator {
+			continue
+		}
+		if _, ok := folders[folder[:i]]; ok {
+			return true
+		}
+	}
+	return false
+}
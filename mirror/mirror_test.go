@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -25,7 +26,7 @@ const (
 )
 
 func init() {
-	if err := TruncateLogFile(); err != nil {
+	if err := TruncateLogFile(&Options{}); err != nil {
 		panic(err)
 	}
 }
@@ -35,40 +36,225 @@ func TestVetFlags(t *testing.T) {
 
 	t.Run("with correct flags", func(t *testing.T) {
 		setFlags(t, dstPathTest, srcPathTest, false)
-		_, src, _, err := VetFlags()
+		flags, err := VetFlags(os.Args[1:])
 		assertError(t, nil, err)
 		wantSrc, err := filepath.Abs(srcPathTest)
 		assertError(t, nil, err)
-		assert(t, wantSrc, src)
+		assert(t, wantSrc, flags.Src)
+	})
+
+	t.Run("effective options", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, true)
+		_, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+
+		flags, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+
+		got := flags.EffectiveOptions()
+		for _, want := range []string{"-" + FlagNameC + "=true", "-" + FlagNameSrc + "=" + srcPathTest, "-" + FlagNameLogSink + "=" + LogSinkStdout} {
+			if !strings.Contains(got, want) {
+				t.Errorf("want %q in %q", want, got)
+			}
+		}
+	})
+
+	t.Run("without flags of the importer", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		_, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+		assert(t, true, flag.Lookup(FlagNameSrc) == nil)
+	})
+
+	t.Run("with environment variables", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		os.Args = os.Args[:1]
+		t.Setenv(EnvSrc, srcPathTest)
+		t.Setenv(EnvDst, dstPathTest)
+		t.Setenv(EnvOpts, "-"+FlagNameC+" -"+FlagNamePing+" http://localhost")
+
+		flags, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+		wantDst, err := filepath.Abs(dstPathTest)
+		assertError(t, nil, err)
+		assert(t, wantDst, flags.Dst)
+		assert(t, true, flags.CleaningMode)
+		assert(t, "http://localhost", flags.Ping)
+	})
+
+	t.Run("with ignored folder names from the environment", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		t.Setenv(EnvOpts, "-"+FlagNameIgnoreDir+" .git -"+FlagNameIgnoreDir+" cache")
+
+		flags, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+		assert(t, Names{".git", "cache"}, flags.Opts.IgnoreDirs)
+	})
+
+	t.Run("with flags overriding environment variables", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		t.Setenv(EnvDst, "aaa")
+		t.Setenv(EnvOpts, "-"+FlagNameC)
+
+		flags, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+		assert(t, false, flags.CleaningMode)
+	})
+
+	t.Run("with the short yes flag", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		os.Args = append(os.Args, "-"+FlagNameY)
+		flags, err := VetFlags(os.Args[1:])
+		assertError(t, nil, err)
+		assert(t, true, flags.Yes)
+	})
+
+	t.Run("with sync and cleaning mode", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, true)
+		os.Args = append(os.Args, "-"+FlagNameSync)
+		_, err := VetFlags(os.Args[1:])
+		assertError(t, ErrSyncMode, err)
+	})
+
+	t.Run("with move and swap", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		os.Args = append(os.Args, "-"+FlagNameMove, "-"+FlagNameSwap)
+		_, err := VetFlags(os.Args[1:])
+		assertError(t, ErrMoveMode, err)
+	})
+
+	t.Run("with extra arguments", func(t *testing.T) {
+		setFlags(t, dstPathTest, srcPathTest, false)
+		os.Args = append(os.Args, "aaa")
+		_, err := VetFlags(os.Args[1:])
+		assertError(t, ErrWrongArgs, err)
 	})
 
 	t.Run("with incorrect flags", func(t *testing.T) {
 		setFlags(t, "aaa", srcPathTest, false)
-		_, _, _, err := VetFlags()
+		_, err := VetFlags(os.Args[1:])
 		assertError(t, ErrDstNotFound, err)
 	})
 
 	t.Run("with empty flags", func(t *testing.T) {
 		setFlags(t, "", "", false)
-		_, _, _, err := VetFlags()
+		_, err := VetFlags(os.Args[1:])
 		assertError(t, ErrWrongArgs, err)
 	})
 
 	cleanTestFolders(t)
 }
 
+func TestCheckNotNested(t *testing.T) {
+	root := t.TempDir()
+	src, other := filepath.Join(root, "src"), filepath.Join(root, "other")
+	for _, folder := range []string{filepath.Join(src, "inside"), other} {
+		err := os.MkdirAll(folder, FolderPerm)
+		assertError(t, nil, err)
+	}
+
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(src, link); err != nil {
+		t.Skip("symlinks can't be made:", err)
+	}
+
+	tests := []struct {
+		name, src, dst string
+		want           error
+	}{
+		{"different folders", src, other, nil},
+		{"the same folder", src, src, ErrSameFolder},
+		{"the same folder through a link", src, link, ErrSameFolder},
+		{"dst inside src", src, filepath.Join(src, "inside"), ErrNestedFolder},
+		{"src inside dst through a link", filepath.Join(link, "inside"), src, ErrNestedFolder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertError(t, tt.want, CheckNotNested(tt.src, tt.dst))
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	assertError(t, nil, err)
+	t.Setenv("MIRROR_TEST_VAR", "x")
+	t.Setenv("MIRROR_TEST_NESTED", "${MIRROR_UNSET}$MIRROR_TEST_VAR")
+
+	tests := []struct {
+		name, input, expected string
+	}{
+		{name: "tilde", input: "~", expected: home},
+		{name: "tilde with a path", input: "~/a", expected: home + "/a"},
+		{name: "tilde inside a name", input: "a~/b", expected: "a~/b"},
+		{name: "dollar variable", input: "$MIRROR_TEST_VAR/a", expected: "x/a"},
+		{name: "braced variable", input: "${MIRROR_TEST_VAR}a", expected: "xa"},
+		{name: "percent variable", input: `%MIRROR_TEST_VAR%\a`, expected: `x\a`},
+		{name: "unset variables", input: "$MIRROR_UNSET.Bin/%MIRROR_UNSET%", expected: "$MIRROR_UNSET.Bin/%MIRROR_UNSET%"},
+		{name: "variables in values", input: "%MIRROR_TEST_NESTED%/$MIRROR_TEST_NESTED", expected: "${MIRROR_UNSET}$MIRROR_TEST_VAR/${MIRROR_UNSET}$MIRROR_TEST_VAR"},
+		{name: "admin share", input: `\\server\c$\a`, expected: `\\server\c$\a`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExpandPath(test.input)
+			assertError(t, nil, err)
+			if got != test.expected {
+				t.Errorf("input %q, got %q, expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+
+	t.Run("unset braced variable", func(t *testing.T) {
+		_, err := ExpandPath("${MIRROR_TEST_VAR}/${MIRROR_UNSET}/a")
+		if !errors.Is(err, ErrUnsetVariable) || !strings.Contains(err.Error(), "MIRROR_UNSET") {
+			t.Errorf("want %v naming MIRROR_UNSET, got %v", ErrUnsetVariable, err)
+		}
+	})
+}
+
+func FuzzExpandPath(f *testing.F) {
+	for _, seed := range []string{"~", "~/a", `~\a`, "$", "${", "${}", "$A$B", "%", "%%", "%A(%", `\\server\c$\a`, "ä/€/𝄞"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		got, err := ExpandPath(path)
+		if err != nil {
+			t.Skip("no home folder or an unset variable:", err)
+		}
+		if !strings.ContainsAny(path, "~$%") && got != path {
+			t.Errorf("input %q without variables changed into %q", path, got)
+		}
+	})
+}
+
 func TestReadFolder(t *testing.T) {
 	makeTestFolders(t)
 
 	t.Run("with correct path", func(t *testing.T) {
-		gotFolders, gotFiles, err := ReadFolder(srcPathTest)
+		gotFolders, gotFiles, gotSkipped, err := ReadFolder(srcPathTest, &Options{})
 		assert(t, srcFolders, gotFolders)
 		assert(t, srcFiles, gotFiles)
+		assert(t, Skipped{}, gotSkipped)
+		assertError(t, nil, err)
+	})
+
+	t.Run("with skipped items", func(t *testing.T) {
+		err := os.Mkdir(filepath.Join(srcPathTest, FolderToIgnore), FolderPerm)
+		assertError(t, nil, err)
+		if err = os.Symlink("_same_1", filepath.Join(srcPathTest, "link")); err != nil {
+			t.Skip("can't make symlinks:", err)
+		}
+
+		gotFolders, gotFiles, gotSkipped, err := ReadFolder(srcPathTest, &Options{})
 		assertError(t, nil, err)
+		assert(t, srcFolders, gotFolders)
+		assert(t, srcFiles, gotFiles)
+		assert(t, Skipped{FolderToIgnore: ReasonIgnoredFolder, "link": ReasonSymlink}, gotSkipped)
 	})
 
 	t.Run("with incorrect path", func(t *testing.T) {
-		_, _, err := ReadFolder("aaa")
+		_, _, _, err := ReadFolder("aaa", &Options{})
 		if _, ok := err.(*fs.PathError); !ok {
 			t.Errorf("wanted *fs.PathError, but got %q", err)
 		}
@@ -115,16 +301,40 @@ func TestFilesToClean(t *testing.T) {
 	cleanTestFolders(t)
 }
 
+func TestShrinksTooMuch(t *testing.T) {
+	tests := []struct {
+		name                  string
+		total, removed, limit int64
+		expected              bool
+	}{
+		{name: "below the limit", total: 100, removed: 40, limit: 50, expected: false},
+		{name: "at the limit", total: 100, removed: 50, limit: 50, expected: false},
+		{name: "above the limit", total: 100, removed: 51, limit: 50, expected: true},
+		{name: "turned off", total: 100, removed: 100, limit: 100, expected: false},
+		{name: "empty destination", total: 0, removed: 0, limit: 0, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ShrinksTooMuch(test.total, test.removed, test.limit)
+			if got != test.expected {
+				t.Errorf("total %d, removed %d, limit %d, got %v, expected %v", test.total, test.removed, test.limit, got, test.expected)
+			}
+		})
+	}
+
+	assert(t, int64(3), TotalSize(File{"a": 1, "b": 2}))
+}
+
 func TestMakeFolders(t *testing.T) {
 	makeTestFolders(t)
 
-	err := MakeFolders(missingFolders, dstPathTest)
+	err := MakeFolders(missingFolders, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	src, _, err := ReadFolder(srcPathTest)
+	src, _, _, err := ReadFolder(srcPathTest, &Options{})
 	assertError(t, nil, err)
 
-	dst, _, err := ReadFolder(dstPathTest)
+	dst, _, _, err := ReadFolder(dstPathTest, &Options{})
 	assertError(t, nil, err)
 
 	missing := MissingFolders(dst, src)
@@ -137,16 +347,16 @@ func TestMakeFolders(t *testing.T) {
 func TestCleanFolders(t *testing.T) {
 	makeTestFolders(t)
 
-	err := CleanFolders(missingFolders, srcPathTest)
+	err := CleanFolders(missingFolders, srcPathTest, &Options{})
 	assertError(t, nil, err)
 
-	err = CleanFolders(foldersToClean, dstPathTest)
+	err = CleanFolders(foldersToClean, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	src, _, err := ReadFolder(srcPathTest)
+	src, _, _, err := ReadFolder(srcPathTest, &Options{})
 	assertError(t, nil, err)
 
-	dst, _, err := ReadFolder(dstPathTest)
+	dst, _, _, err := ReadFolder(dstPathTest, &Options{})
 	assertError(t, nil, err)
 
 	assert(t, dst, src)
@@ -157,19 +367,19 @@ func TestCleanFolders(t *testing.T) {
 func TestCopyFiles(t *testing.T) {
 	makeTestFolders(t)
 
-	err := MakeFolders(missingFolders, dstPathTest)
+	err := MakeFolders(missingFolders, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	err = CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest)
+	err = CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	err = CleanFiles(filesToClean, sizeOfFilesToClean, dstPathTest)
+	err = CleanFiles(filesToClean, sizeOfFilesToClean, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	_, src, err := ReadFolder(srcPathTest)
+	_, src, _, err := ReadFolder(srcPathTest, &Options{})
 	assertError(t, nil, err)
 
-	_, dst, err := ReadFolder(dstPathTest)
+	_, dst, _, err := ReadFolder(dstPathTest, &Options{})
 	assertError(t, nil, err)
 
 	assert(t, src, dst)
@@ -180,16 +390,16 @@ func TestCopyFiles(t *testing.T) {
 func TestCleanFiles(t *testing.T) {
 	makeTestFolders(t)
 
-	err := CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest)
+	err := CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	err = CleanFiles(filesToClean, sizeOfFilesToClean, dstPathTest)
+	err = CleanFiles(filesToClean, sizeOfFilesToClean, dstPathTest, &Options{})
 	assertError(t, nil, err)
 
-	_, src, err := ReadFolder(srcPathTest)
+	_, src, _, err := ReadFolder(srcPathTest, &Options{})
 	assertError(t, nil, err)
 
-	_, dst, err := ReadFolder(dstPathTest)
+	_, dst, _, err := ReadFolder(dstPathTest, &Options{})
 	assertError(t, nil, err)
 
 	assert(t, dst, src)
@@ -197,6 +407,173 @@ func TestCleanFiles(t *testing.T) {
 	cleanTestFolders(t)
 }
 
+func TestCopyFilesVanished(t *testing.T) {
+	makeTestFolders(t)
+
+	files := File{"_same_1": 1, "_vanished": 10}
+	opts := &Options{}
+
+	err := CopyFiles(files, 11, srcPathTest, dstPathTest, opts)
+	assertError(t, nil, err)
+	assert(t, []string{"_vanished"}, opts.Report.Vanished)
+	assert(t, 0, len(opts.Report.IgnoredErrors))
+
+	t.Run("missing destination folder isn't a vanished file", func(t *testing.T) {
+		err := CopyFiles(File{"_same_1": 1}, 1, srcPathTest, "aaa", &Options{})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("wanted fs.ErrNotExist, but got %q", err)
+		}
+	})
+
+	cleanTestFolders(t)
+}
+
+func TestCopyFilesIgnoreErrors(t *testing.T) {
+	makeTestFolders(t)
+
+	files := File{"_same_1": 1, filepath.Join("not_in_dst/_same_1"): 1}
+	err := os.Mkdir(filepath.Join(srcPathTest, "not_in_dst"), FolderPerm)
+	assertError(t, nil, err)
+	err = ioutil.WriteFile(filepath.Join(srcPathTest, "not_in_dst/_same_1"), []byte("s"), FilePerm)
+	assertError(t, nil, err)
+
+	t.Run("without a matching pattern", func(t *testing.T) {
+		err := CopyFiles(files, 2, srcPathTest, dstPathTest, &Options{IgnoreErrors: Patterns{"_other"}})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("wanted fs.ErrNotExist, but got %q", err)
+		}
+	})
+
+	t.Run("with a matching pattern", func(t *testing.T) {
+		opts := &Options{IgnoreErrors: Patterns{"not_in_*"}}
+		err := CopyFiles(files, 2, srcPathTest, dstPathTest, opts)
+		assertError(t, nil, err)
+		assert(t, 1, len(opts.Report.IgnoredErrors))
+	})
+
+	cleanTestFolders(t)
+}
+
+func TestStop(t *testing.T) {
+	makeTestFolders(t)
+
+	stop := make(chan struct{})
+	close(stop)
+	opts := &Options{Stop: stop}
+
+	err := MakeFolders(missingFolders, dstPathTest, opts)
+	assertError(t, ErrStopped, err)
+
+	err = CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest, opts)
+	assertError(t, ErrStopped, err)
+
+	_, dst, _, err := ReadFolder(dstPathTest, &Options{})
+	assertError(t, nil, err)
+	assert(t, dstFiles, dst)
+
+	cleanTestFolders(t)
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.Create("f")
+	assertError(t, nil, err)
+
+	assert(t, false, IsTerminal(f))
+
+	assertError(t, nil, f.Close())
+	assertError(t, nil, os.Remove("f"))
+}
+
+func TestReadFolderIgnoreErrors(t *testing.T) {
+	makeTestFolders(t)
+
+	unreadable := filepath.Join(srcPathTest, "same_1/same_2")
+	err := os.Chmod(unreadable, 0)
+	assertError(t, nil, err)
+
+	opts := &Options{IgnoreErrors: Patterns{"same_2"}}
+	folders, files, _, err := ReadFolder(srcPathTest, opts)
+
+	errChmod := os.Chmod(unreadable, FolderPerm)
+	assertError(t, nil, errChmod)
+
+	if len(opts.Report.IgnoredErrors) == 0 {
+		// the tests are probably running as root, so the folder can be read anyway
+		cleanTestFolders(t)
+		t.Skip("folder without permissions is still readable")
+	}
+
+	assertError(t, nil, err)
+	assert(t, []string{filepath.Join("same_1/same_2")}, opts.Report.Unreadable)
+
+	DropUnreadable(opts.Report.Unreadable, folders, files)
+	assert(t, Folder{"same_1": {}}, folders)
+	assert(t, File{"_same_1": 1, filepath.Join("same_1/_different"): 2}, files)
+
+	cleanTestFolders(t)
+}
+
+func TestSkippedSummary(t *testing.T) {
+	skipped := Skipped{"a": ReasonSymlink, "b": ReasonSymlink, "c": ReasonIgnoredFolder, "d": ReasonSpecialFile}
+	assert(t, `skipped in "src": folder named dont_mirror 1, special file 1, symlink 2`, skipped.Summary(srcPathTest))
+	assert(t, "", Skipped{}.Summary(srcPathTest))
+}
+
+func TestDropUnreadable(t *testing.T) {
+	folders := Folder{"a": {}, filepath.Join("a/b"): {}, filepath.Join("a/b/c"): {}, "ab": {}}
+	files := File{filepath.Join("a/b/f"): 1, filepath.Join("a/f"): 1, filepath.Join("ab/f"): 1}
+
+	DropUnreadable([]string{filepath.Join("a/b")}, folders, files)
+
+	assert(t, Folder{"a": {}, "ab": {}}, folders)
+	assert(t, File{filepath.Join("a/f"): 1, filepath.Join("ab/f"): 1}, files)
+}
+
+func TestPatternsMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		patterns Patterns
+		expected bool
+	}{
+		{name: "whole path", path: filepath.Join("a/b/c"), patterns: Patterns{filepath.Join("a/*/c")}, expected: true},
+		{name: "base name", path: filepath.Join("a/b/c.txt"), patterns: Patterns{"*.txt"}, expected: true},
+		{name: "parent folder", path: filepath.Join("a/locked/c"), patterns: Patterns{"locked"}, expected: true},
+		{name: "no match", path: filepath.Join("a/b/c"), patterns: Patterns{"d", "*.txt"}, expected: false},
+		{name: "no patterns", path: "a", patterns: nil, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.patterns.Match(test.path)
+			if got != test.expected {
+				t.Errorf("path %q, patterns %v, got %v, expected %v", test.path, test.patterns, got, test.expected)
+			}
+		})
+	}
+
+	t.Run("bad pattern", func(t *testing.T) {
+		var p Patterns
+		assertError(t, ErrBadPattern, p.Set("[a"))
+	})
+}
+
+func FuzzPatternsMatch(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"*", "a/b/"}, {"[a", "a"}, {"a/*", "/"}, {`\`, `a\`}, {"ä*", "ä/ö"}, {"*", strings.Repeat("a/", 500)}, {"", ""}, {"?", "//"},
+	} {
+		f.Add(seed[0], filepath.FromSlash(seed[1]))
+	}
+	f.Fuzz(func(t *testing.T, pattern, path string) {
+		got := Patterns{pattern}.Match(path)
+
+		// a path that matches as a whole matches, unless it's one of the paths the walk up stops at
+		ok, _ := filepath.Match(pattern, path)
+		if ok && !got && path != "." && path != string(filepath.Separator) {
+			t.Errorf("pattern %q matches %q, but Match says it doesn't", pattern, path)
+		}
+	})
+}
+
 func TestWriteNewLineIfNotEmpty(t *testing.T) {
 	fileName := "f"
 
@@ -262,21 +639,176 @@ func TestSortFoldersOrFiles2(t *testing.T) {
 }
 
 func TestKeepFoldersWithLongestPrefix(t *testing.T) {
-	input := Folder{"a/b/c": {}, "a": {}, "a/b": {}, "q": {}, "g": {}, "a/b/cc": {}, "aa": {}}
-	expected := []string{"a/b/c", "a/b/cc", "aa", "g", "q"}
-	got := keepFoldersWithLongestPrefix(input)
-	if !reflect.DeepEqual(got, expected) {
-		t.Errorf("input %v, got %v, expected %v", input, got, expected)
+	tests := []struct {
+		name     string
+		input    Folder
+		expected []string
+	}{
+		{
+			name:     "nested folders",
+			input:    Folder{"a/b/c": {}, "a": {}, "a/b": {}, "q": {}, "g": {}, "a/b/cc": {}, "aa": {}},
+			expected: []string{"a/b/c", "a/b/cc", "aa", "g", "q"},
+		},
+		{
+			name:     "name that is a prefix of another one",
+			input:    Folder{"a/b": {}, "a/bc/d": {}},
+			expected: []string{"a/b", "a/bc/d"},
+		},
+		{
+			name:     "descendant that doesn't sort right after its parent",
+			input:    Folder{"a": {}, "a-b": {}, "a/c": {}},
+			expected: []string{"a-b", "a/c"},
+		},
+		{
+			name:     "empty",
+			input:    Folder{},
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := make(Folder)
+			for folder := range test.input {
+				input[filepath.FromSlash(folder)] = struct{}{}
+			}
+			var expected []string
+			for _, folder := range test.expected {
+				expected = append(expected, filepath.FromSlash(folder))
+			}
+
+			got := keepFoldersWithLongestPrefix(input)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("input %v, got %v, expected %v", input, got, expected)
+			}
+		})
 	}
 }
 
 func TestKeepFoldersWithShortestPrefix(t *testing.T) {
-	input := Folder{"a/b/c": {}, "a": {}, "a/b": {}, "q": {}, "g": {}, "a/b/cc": {}, "aa": {}}
-	expected := []string{"q", "g", "aa", "a/b/cc", "a"}
-	got := keepFoldersWithShortestPrefix(input)
-	if !reflect.DeepEqual(got, expected) {
-		t.Errorf("input %v, got %v, expected %v", input, got, expected)
+	tests := []struct {
+		name     string
+		input    Folder
+		expected []string
+	}{
+		{
+			name:     "nested folders",
+			input:    Folder{"a/b/c": {}, "a": {}, "a/b": {}, "q": {}, "g": {}, "a/b/cc": {}, "aa": {}},
+			expected: []string{"q", "g", "aa", "a"},
+		},
+		{
+			name:     "name that is a prefix of another one",
+			input:    Folder{"a/b": {}, "a/bc/d": {}},
+			expected: []string{"a/bc/d", "a/b"},
+		},
+		{
+			name:     "descendant that doesn't sort right after its parent",
+			input:    Folder{"a": {}, "a-b": {}, "a-b/c": {}, "a/c": {}},
+			expected: []string{"a-b", "a"},
+		},
+		{
+			name:     "empty",
+			input:    Folder{},
+			expected: nil,
+		},
 	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := make(Folder)
+			for folder := range test.input {
+				input[filepath.FromSlash(folder)] = struct{}{}
+			}
+			var expected []string
+			for _, folder := range test.expected {
+				expected = append(expected, filepath.FromSlash(folder))
+			}
+
+			got := keepFoldersWithShortestPrefix(input)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("input %v, got %v, expected %v", input, got, expected)
+			}
+		})
+	}
+}
+
+// fuzzFolders splits names into a Folder, so the fuzzer can make sets of folders out of one string
+func fuzzFolders(names string) Folder {
+	folders := make(Folder)
+	for _, name := range strings.Split(names, "\n") {
+		folders[filepath.FromSlash(name)] = struct{}{}
+	}
+	return folders
+}
+
+func isParentFolder(parent, folder string) bool {
+	return strings.HasPrefix(folder, parent+string(filepath.Separator))
+}
+
+func addPrefixSeeds(f *testing.F) {
+	for _, seed := range []string{
+		"a\na/b\na/bc/d", "a\na-b\na/c", "a/\na", "a//b\na", "ä\nä/ö\näö", strings.TrimSuffix(strings.Repeat("a/", 300), "/") + "\na", "", "/\n/a",
+	} {
+		f.Add(seed)
+	}
+}
+
+func FuzzKeepFoldersWithLongestPrefix(f *testing.F) {
+	addPrefixSeeds(f)
+	f.Fuzz(func(t *testing.T, names string) {
+		folders := fuzzFolders(names)
+		got := keepFoldersWithLongestPrefix(folders)
+
+		kept := make(Folder)
+		for _, folder := range got {
+			if _, ok := folders[folder]; !ok {
+				t.Fatalf("%q isn't one of the folders", folder)
+			}
+			kept[folder] = struct{}{}
+		}
+		for folder := range folders {
+			made := false
+			for k := range kept {
+				if isParentFolder(folder, k) {
+					if _, ok := kept[folder]; ok {
+						t.Errorf("%q is kept together with its subfolder %q", folder, k)
+					}
+					made = true
+				}
+			}
+			if _, ok := kept[folder]; !ok && !made {
+				t.Errorf("%q wouldn't be made", folder)
+			}
+		}
+	})
+}
+
+func FuzzKeepFoldersWithShortestPrefix(f *testing.F) {
+	addPrefixSeeds(f)
+	f.Fuzz(func(t *testing.T, names string) {
+		folders := fuzzFolders(names)
+		got := keepFoldersWithShortestPrefix(folders)
+
+		kept := make(Folder)
+		for _, folder := range got {
+			if _, ok := folders[folder]; !ok {
+				t.Fatalf("%q isn't one of the folders", folder)
+			}
+			kept[folder] = struct{}{}
+		}
+		for folder := range folders {
+			removed := false
+			for k := range kept {
+				if isParentFolder(k, folder) {
+					if _, ok := kept[folder]; ok {
+						t.Errorf("%q is kept together with its parent %q", folder, k)
+					}
+					removed = true
+				}
+			}
+			if _, ok := kept[folder]; !ok && !removed {
+				t.Errorf("%q wouldn't be removed", folder)
+			}
+		}
+	})
 }
 
 func makeTestFolders(t testing.TB) {
@@ -354,11 +886,8 @@ func makeTestDstFolder(t testing.TB) {
 func setFlags(t testing.TB, dst, src string, c bool) {
 	t.Helper()
 
-	// reset flags
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-
 	os.Args = os.Args[:1]
-	os.Args = append(os.Args, "-"+FlagNameDst, dst, "-"+FlagNameSrc, src, "-"+FlagNameC, strconv.FormatBool(c))
+	os.Args = append(os.Args, "-"+FlagNameDst, dst, "-"+FlagNameSrc, src, "-"+FlagNameC+"="+strconv.FormatBool(c))
 }
 
 func assert(t testing.TB, want, got interface{}) {
@@ -0,0 +1,107 @@
+package mirror
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	FlagNameMove         = "move"
+	FlagUsageMove        = "remove every file from src once its copy is verified with -" + FlagNameMoveVerify + ", and then the folders of src this empties"
+	FlagNameMoveVerify   = "move-verify"
+	FlagUsageMoveVerify  = "how copies are verified before -" + FlagNameMove + " removes the source: size or sha256, which reads both files again"
+	MoveVerifySize       = "size"
+	MoveVerifySHA256     = "sha256"
+	ErrMoveMode          = CustomErr("the -move flag can't be used together with the -c, -sync, -cas, -snapshot, -hard-links or -swap flags, with -swap the moved files would only be in a tree that a rollback removes")
+	ErrUnknownMoveVerify = CustomErr("unknown verification, use size or sha256")
+	ErrMoveNeedsOSFS     = CustomErr("files can only be moved from a folder on disk")
+	LogPrunedFolders     = "emptied folders removed from the source:"
+	LogNotMoved          = "kept in the source, it changed since it was copied: "
+	MsgMoved             = "copied files removed from the source:"
+	MsgNotMoved          = "copied files kept in the source because they changed since they were copied:"
+)
+
+// VetMoveVerify checks if verify is known
+func VetMoveVerify(verify string) error {
+	switch verify {
+	case MoveVerifySize, MoveVerifySHA256:
+		return nil
+	default:
+		return ErrUnknownMoveVerify
+	}
+}
+
+// removeSource removes file from src once its copy in dst, of which written bytes were copied, is verified with
+// opts.MoveVerify. An empty MoveVerify is MoveVerifySize. A source that changed since it was read, e.g. a growing log,
+// is kept, the copy of the run stays in dst, and kept is true
+func removeSource(file, src, dst string, written int64, opts *Options) (kept bool, err error) {
+	srcPath, dstPath := filepath.Join(src, file), filepath.Join(dst, file)
+	s, err := os.Stat(srcPath)
+	if err != nil {
+		return false, err
+	}
+	d, err := os.Stat(dstPath)
+	if err != nil {
+		return false, err
+	}
+	if s.Size() != written || d.Size() != written {
+		return true, nil
+	}
+
+	if opts.MoveVerify == MoveVerifySHA256 {
+		srcSum, err := hashFile(srcPath)
+		if err != nil {
+			return false, err
+		}
+		dstSum, err := hashFile(dstPath)
+		if err != nil {
+			return false, err
+		}
+		if srcSum != dstSum {
+			return true, nil
+		}
+	}
+	return false, os.Remove(srcPath)
+}
+
+// pruneFolders removes the folders of src that hold the moved files, deepest first, if they are empty now, and logs
+// them to w. src itself stays
+func pruneFolders(moved []string, src string, w io.Writer) {
+	seen := make(map[string]struct{})
+	for _, file := range moved {
+		for folder := filepath.Dir(file); folder != "."; folder = filepath.Dir(folder) {
+			if _, ok := seen[folder]; ok {
+				break
+			}
+			seen[folder] = struct{}{}
+		}
+	}
+
+	folders := make([]string, 0, len(seen))
+	for folder := range seen {
+		folders = append(folders, folder)
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		di, dj := strings.Count(folders[i], string(filepath.Separator)), strings.Count(folders[j], string(filepath.Separator))
+		if di != dj {
+			return di > dj
+		}
+		return folders[i] < folders[j]
+	})
+
+	logged := false
+	for _, folder := range folders {
+		// a folder that still holds something can't be removed, which is what should happen
+		if os.Remove(filepath.Join(src, folder)) != nil {
+			continue
+		}
+		if !logged {
+			LogToFile(w, LogPrunedFolders+"\n")
+			logged = true
+		}
+		LogToFile(w, folder)
+	}
+}
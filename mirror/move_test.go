@@ -0,0 +1,93 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVetMoveVerify(t *testing.T) {
+	assertError(t, nil, VetMoveVerify(MoveVerifySize))
+	assertError(t, nil, VetMoveVerify(MoveVerifySHA256))
+	assertError(t, ErrUnknownMoveVerify, VetMoveVerify("md5"))
+}
+
+func TestCopyFilesMove(t *testing.T) {
+	for _, verify := range []string{"", MoveVerifySize, MoveVerifySHA256} {
+		t.Run(verify, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			assertError(t, nil, os.MkdirAll(filepath.Join(src, "a", "b"), FolderPerm))
+			assertError(t, nil, os.MkdirAll(filepath.Join(src, "kept", "empty"), FolderPerm))
+			assertError(t, nil, os.MkdirAll(filepath.Join(dst, "a", "b"), FolderPerm))
+			assertError(t, nil, os.MkdirAll(filepath.Join(dst, "kept"), FolderPerm))
+			files := File{filepath.Join("a", "b", "1"): 1, filepath.Join("a", "2"): 2, filepath.Join("kept", "3"): 3}
+			for file, size := range files {
+				assertError(t, nil, os.WriteFile(filepath.Join(src, file), make([]byte, size), FilePerm))
+			}
+
+			opts := &Options{LogPath: os.DevNull, Move: true, MoveVerify: verify}
+			assertError(t, nil, CopyFiles(files, TotalSize(files), src, dst, opts))
+			assert(t, 3, len(opts.Report.Moved))
+
+			_, got, _, err := ReadFolder(dst, &Options{})
+			assertError(t, nil, err)
+			assert(t, files, got)
+
+			// folders that were empty before the run stay
+			folders, got, _, err := ReadFolder(src, &Options{})
+			assertError(t, nil, err)
+			assert(t, Folder{"kept": {}, filepath.Join("kept", "empty"): {}}, folders)
+			assert(t, File{}, got)
+		})
+	}
+
+	_, err := NewFS(fstest.MapFS{}, t.TempDir(), WithMove(MoveVerifySize))
+	assertError(t, ErrMoveNeedsOSFS, err)
+}
+
+func TestRemoveSource(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "f"), []byte("abc"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "f"), []byte("abd"), FilePerm))
+
+	// a source that grew since the copy is kept
+	kept, err := removeSource("f", src, dst, 2, &Options{})
+	assertError(t, nil, err)
+	assert(t, true, kept)
+
+	kept, err = removeSource("f", src, dst, 3, &Options{MoveVerify: MoveVerifySHA256})
+	assertError(t, nil, err)
+	assert(t, true, kept)
+	_, err = os.Stat(filepath.Join(src, "f"))
+	assertError(t, nil, err)
+
+	kept, err = removeSource("f", src, dst, 3, &Options{MoveVerify: MoveVerifySize})
+	assertError(t, nil, err)
+	assert(t, false, kept)
+	_, err = os.Stat(filepath.Join(src, "f"))
+	assert(t, true, os.IsNotExist(err))
+
+	t.Run("run goes on", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the test scanner is a shell script")
+		}
+		src, dst := t.TempDir(), t.TempDir()
+		files := File{"grows": 3, "same": 3}
+		for file := range files {
+			assertError(t, nil, os.WriteFile(filepath.Join(src, file), []byte("abc"), FilePerm))
+		}
+		// the scanner runs between the copy and the check, so the source grows in between like a log would
+		scanner := filepath.Join(t.TempDir(), "scanner")
+		script := "#!/bin/sh\necho more >> " + filepath.Join(src, "grows") + "\nexit 0\n"
+		assertError(t, nil, os.WriteFile(scanner, []byte(script), 0755))
+
+		opts := &Options{LogPath: os.DevNull, Move: true, ScanCmd: scanner, Workers: 1}
+		assertError(t, nil, CopyFiles(files, TotalSize(files), src, dst, opts))
+		assert(t, []string{"grows"}, opts.Report.NotMoved)
+		assert(t, 1, len(opts.Report.Moved))
+		_, err := os.Stat(filepath.Join(src, "grows"))
+		assertError(t, nil, err)
+	})
+}
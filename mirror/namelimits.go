@@ -0,0 +1,58 @@
+package mirror
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ReasonNameTooLong = "name too long for dst"
+	ReasonPathTooLong = "path too long for dst"
+	MsgTooLong        = "files, folders and links that weren't copied because dst can't hold their names:"
+)
+
+// SkipTooLong removes folders, files and links whose name, or the name of one of their folders, is longer than the
+// file system of dst allows, or whose path in dst would be, and returns them as skipped. They are added to
+// opts.Report.TooLong too. Nothing is removed on systems whose limits aren't known
+func SkipTooLong(dst string, folders Folder, files File, links Links, opts *Options) (Skipped, error) {
+	skipped := make(Skipped)
+	nameMax, pathMax, ok, err := nameLimits(dst)
+	if err != nil || !ok {
+		return skipped, err
+	}
+
+	tooLong := func(path string) bool {
+		reason := ""
+		if len(filepath.Join(dst, path)) >= pathMax {
+			reason = ReasonPathTooLong
+		}
+		for _, name := range strings.Split(path, string(filepath.Separator)) {
+			if nameLength(name) > nameMax {
+				reason = ReasonNameTooLong
+			}
+		}
+		if reason == "" {
+			return false
+		}
+		skipped[path] = reason
+		opts.Report.TooLong = append(opts.Report.TooLong, path)
+		return true
+	}
+
+	for folder := range folders {
+		if tooLong(folder) {
+			delete(folders, folder)
+		}
+	}
+	for file := range files {
+		if tooLong(file) {
+			delete(files, file)
+		}
+	}
+	for link := range links {
+		if tooLong(link) {
+			delete(links, link)
+		}
+	}
+	return skipped, nil
+}
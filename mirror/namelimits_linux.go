@@ -0,0 +1,23 @@
+package mirror
+
+import "syscall"
+
+// linuxPathMax is PATH_MAX, the longest path that system calls take, with the terminating zero
+const linuxPathMax = 4096
+
+// nameLimits returns the longest name that the file system of path takes, in bytes, and PATH_MAX
+func nameLimits(path string) (nameMax, pathMax int, ok bool, err error) {
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(path, &stat); err != nil {
+		return
+	}
+	// some network file systems don't report it
+	if stat.Namelen <= 0 {
+		return
+	}
+	return int(stat.Namelen), linuxPathMax, true, nil
+}
+
+func nameLength(name string) int {
+	return len(name)
+}
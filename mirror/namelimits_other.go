@@ -0,0 +1,18 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package mirror
+
+const (
+	// bsdNameMax and bsdPathMax are NAME_MAX and PATH_MAX of macOS and the BSDs, their statfs doesn't report limits
+	bsdNameMax = 255
+	bsdPathMax = 1024
+)
+
+func nameLimits(path string) (nameMax, pathMax int, ok bool, err error) {
+	return bsdNameMax, bsdPathMax, true, nil
+}
+
+func nameLength(name string) int {
+	return len(name)
+}
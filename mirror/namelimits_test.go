@@ -0,0 +1,39 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkipTooLong(t *testing.T) {
+	dst := t.TempDir()
+	nameMax, pathMax, ok, err := nameLimits(dst)
+	assertError(t, nil, err)
+	if !ok {
+		t.Skip("the limits of dst aren't known")
+	}
+
+	long := strings.Repeat("n", nameMax+1)
+	fits := strings.Repeat("n", nameMax)
+	// enough folders that fit to make the path too long
+	deep := strings.Repeat(fits+string(filepath.Separator), pathMax/nameMax+1) + "f"
+
+	folders := Folder{"a": {}, long: {}}
+	files := File{filepath.Join("a", fits): 1, filepath.Join(long, "f"): 1, deep: 1}
+	links := Links{long: "a"}
+	opts := &Options{}
+
+	skipped, err := SkipTooLong(dst, folders, files, links, opts)
+	assertError(t, nil, err)
+	assert(t, Skipped{long: ReasonNameTooLong, filepath.Join(long, "f"): ReasonNameTooLong, deep: ReasonPathTooLong}, skipped)
+	assert(t, Folder{"a": {}}, folders)
+	assert(t, File{filepath.Join("a", fits): 1}, files)
+	assert(t, Links{}, links)
+	assert(t, 4, len(opts.Report.TooLong))
+
+	// what is left can be made
+	assertError(t, nil, os.Mkdir(filepath.Join(dst, "a"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "a", fits), nil, FilePerm))
+}
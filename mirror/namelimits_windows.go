@@ -0,0 +1,26 @@
+package mirror
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// windowsNameMax is the longest name NTFS, exFAT and ReFS take, in UTF-16 code units
+	windowsNameMax = 255
+	// windowsPathMax is MAX_PATH, the longest path without the long path prefix, with the terminating zero
+	windowsPathMax = 260
+	// windowsLongPathMax is the longest path with the long path prefix, see fixLongPath
+	windowsLongPathMax = 32767
+)
+
+func nameLimits(path string) (nameMax, pathMax int, ok bool, err error) {
+	if strings.HasPrefix(path, longPathPrefix) {
+		return windowsNameMax, windowsLongPathMax, true, nil
+	}
+	return windowsNameMax, windowsPathMax, true, nil
+}
+
+func nameLength(name string) int {
+	return len(utf16.Encode([]rune(name)))
+}
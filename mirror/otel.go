@@ -0,0 +1,284 @@
+package mirror
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	FlagNameOTel         = "otel"
+	FlagNameOTelSample   = "otel-sample"
+	FlagUsageOTel        = "OTLP/HTTP endpoint of an OpenTelemetry collector, e.g. http://localhost:4318, that gets a trace of the run with a span for every phase"
+	FlagUsageOTelSample  = "share of copied files that get their own span in the trace, from 0 to 1"
+	ErrOTelEndpoint      = CustomErr("the -" + FlagNameOTel + " flag needs an http or https URL")
+	ErrOTelStatus        = CustomErr("the OpenTelemetry collector responded with")
+	OTelTracesPath       = "/v1/traces"
+	OTelTimeout          = 10 * time.Second
+	DefaultOTelSample    = 0.01
+	otelServiceName      = "mirror"
+	otelSpanRun          = "mirror run"
+	otelSpanCopy         = "copy file"
+	otelMaxSpans         = 10000
+	otelSpanKindInternal = 1
+	otelStatusOK         = 1
+	otelStatusError      = 2
+)
+
+// Tracer collects OpenTelemetry spans of a run: one for the run, one for every phase and one for a sample of copied
+// files, and sends them to an OTLP/HTTP collector with Flush. A nil *Tracer does nothing. It's safe to use from
+// several goroutines
+type Tracer struct {
+	endpoint string
+	sample   float64
+	traceID  string
+	run      otelSpan
+
+	mu      sync.Mutex
+	phase   *otelSpan
+	done    int64
+	total   int64
+	spans   []otelSpan
+	dropped int
+}
+
+type otelSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otelAttr `json:"attributes,omitempty"`
+	Status       otelStatus `json:"status"`
+}
+
+type otelAttr struct {
+	Key   string    `json:"key"`
+	Value otelValue `json:"value"`
+}
+
+type otelValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	IntValue    string `json:"intValue,omitempty"`
+	BoolValue   bool   `json:"boolValue,omitempty"`
+}
+
+type otelStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// otelRequest is the body of an OTLP/HTTP JSON export
+type otelRequest struct {
+	ResourceSpans []otelResourceSpans `json:"resourceSpans"`
+}
+
+type otelResourceSpans struct {
+	Resource   otelResource     `json:"resource"`
+	ScopeSpans []otelScopeSpans `json:"scopeSpans"`
+}
+
+type otelResource struct {
+	Attributes []otelAttr `json:"attributes"`
+}
+
+type otelScopeSpans struct {
+	Scope otelScope  `json:"scope"`
+	Spans []otelSpan `json:"spans"`
+}
+
+type otelScope struct {
+	Name string `json:"name"`
+}
+
+// OTelEndpoint checks that endpoint is an http or https URL and adds OTelTracesPath to it if it has no path
+func OTelEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrOTelEndpoint
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = OTelTracesPath
+	}
+	return u.String(), nil
+}
+
+// NewTracer starts the span of the run with attrs and its first phase, PhaseScanning. sample is the share of
+// copied files that get a span, see OTelEndpoint for endpoint
+func NewTracer(endpoint string, sample float64, attrs map[string]string) *Tracer {
+	t := &Tracer{endpoint: endpoint, sample: sample, traceID: otelID(16)}
+	t.run = t.newSpan(otelSpanRun, "", time.Now())
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		t.run.Attributes = append(t.run.Attributes, otelString(key, attrs[key]))
+	}
+
+	t.setPhase(PhaseScanning, 0, 0)
+	return t
+}
+
+func (t *Tracer) newSpan(name, parent string, start time.Time) otelSpan {
+	return otelSpan{TraceID: t.traceID, SpanID: otelID(8), ParentSpanID: parent, Name: name, Kind: otelSpanKindInternal, Start: otelTime(start)}
+}
+
+// setPhase ends the span of the current phase and starts one for phase if it's another one. done and total are
+// the last progress of the phase and end up in its span
+func (t *Tracer) setPhase(phase string, done, total int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done, t.total = done, total
+	if t.phase != nil && t.phase.Name == phase {
+		return
+	}
+	now := time.Now()
+	t.endPhase(now)
+	s := t.newSpan(phase, t.run.SpanID, now)
+	t.phase = &s
+}
+
+// endPhase needs t.mu
+func (t *Tracer) endPhase(now time.Time) {
+	if t.phase == nil {
+		return
+	}
+	t.phase.End = otelTime(now)
+	t.phase.Attributes = append(t.phase.Attributes, otelInt("mirror.done", t.done), otelInt("mirror.total", t.total))
+	t.add(*t.phase)
+	t.phase = nil
+}
+
+// add needs t.mu. Spans above otelMaxSpans are only counted, so a big run doesn't keep them all in memory
+func (t *Tracer) add(s otelSpan) {
+	if len(t.spans) >= otelMaxSpans {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, s)
+}
+
+// copied adds a span of the file that r is about if the file is in the sample. The sample depends on the path only,
+// so the same files are sampled in every run
+func (t *Tracer) copied(r copyResult, start time.Time) {
+	if t == nil || !t.sampled(r.file) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parent := t.run.SpanID
+	if t.phase != nil {
+		parent = t.phase.SpanID
+	}
+	s := t.newSpan(otelSpanCopy, parent, start)
+	s.End = otelTime(time.Now())
+	s.Attributes = []otelAttr{otelString("mirror.file", r.file), otelInt("mirror.written", r.written)}
+	if r.vanished {
+		s.Attributes = append(s.Attributes, otelBool("mirror.vanished"))
+	}
+	if r.infected {
+		s.Attributes = append(s.Attributes, otelBool("mirror.infected"))
+	}
+	if r.err != nil {
+		s.Status = otelStatus{Code: otelStatusError, Message: r.err.Error()}
+	}
+	t.add(s)
+}
+
+func (t *Tracer) sampled(file string) bool {
+	if t.sample >= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(file))
+	return float64(h.Sum32())/math.MaxUint32 < t.sample
+}
+
+// Flush ends the current phase and the run, which failed if err isn't nil, and sends the trace to the collector
+func (t *Tracer) Flush(err error) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	t.endPhase(now)
+	run := t.run
+	run.End = otelTime(now)
+	run.Status = otelStatus{Code: otelStatusOK}
+	if err != nil {
+		run.Status = otelStatus{Code: otelStatusError, Message: err.Error()}
+	}
+	if t.dropped > 0 {
+		run.Attributes = append(run.Attributes, otelInt("mirror.dropped_spans", int64(t.dropped)))
+	}
+	spans := append([]otelSpan{run}, t.spans...)
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	body, err := json.Marshal(otelRequest{ResourceSpans: []otelResourceSpans{{
+		Resource:   otelResource{Attributes: []otelAttr{otelString("service.name", otelServiceName)}},
+		ScopeSpans: []otelScopeSpans{{Scope: otelScope{Name: otelServiceName}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: OTelTimeout}
+	resp, err := client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if err = resp.Body.Close(); err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%w %s", ErrOTelStatus, resp.Status)
+	}
+	return nil
+}
+
+// otelID returns n random bytes in hex, OTLP JSON uses hex for trace and span IDs
+func otelID(n int) string {
+	b := make([]byte, n)
+	// an ID that isn't random only makes spans of different runs collide, it doesn't stop the run
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func otelTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otelString(key, value string) otelAttr {
+	return otelAttr{Key: key, Value: otelValue{StringValue: value}}
+}
+
+func otelInt(key string, value int64) otelAttr {
+	return otelAttr{Key: key, Value: otelValue{IntValue: strconv.FormatInt(value, 10)}}
+}
+
+func otelBool(key string) otelAttr {
+	return otelAttr{Key: key, Value: otelValue{BoolValue: true}}
+}
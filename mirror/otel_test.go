@@ -0,0 +1,168 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestOTelEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint, want string
+		err            error
+	}{
+		{endpoint: "http://localhost:4318", want: "http://localhost:4318" + OTelTracesPath},
+		{endpoint: "https://otel.example.com/", want: "https://otel.example.com" + OTelTracesPath},
+		{endpoint: "http://localhost:4318/custom/traces", want: "http://localhost:4318/custom/traces"},
+		{endpoint: "localhost:4318", err: ErrOTelEndpoint},
+		{endpoint: "ftp://localhost", err: ErrOTelEndpoint},
+		{endpoint: "http://", err: ErrOTelEndpoint},
+	}
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			got, err := OTelEndpoint(test.endpoint)
+			assertError(t, test.err, err)
+			assert(t, test.want, got)
+		})
+	}
+}
+
+// collector returns a test collector and a function that returns the spans of the last export
+func collector(t *testing.T, status int) (*httptest.Server, func() []otelSpan) {
+	t.Helper()
+
+	var last otelRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != OTelTracesPath || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		last = otelRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&last); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []otelSpan {
+		if len(last.ResourceSpans) != 1 || len(last.ResourceSpans[0].ScopeSpans) != 1 {
+			t.Fatalf("unexpected export %+v", last)
+		}
+		assert(t, []otelAttr{otelString("service.name", otelServiceName)}, last.ResourceSpans[0].Resource.Attributes)
+		return last.ResourceSpans[0].ScopeSpans[0].Spans
+	}
+}
+
+func TestTracer(t *testing.T) {
+	srv, spans := collector(t, http.StatusOK)
+
+	tr := NewTracer(srv.URL+OTelTracesPath, 1, map[string]string{"mirror.src": "a", "mirror.dst": "b"})
+	tr.setPhase(PhaseScanning, 0, 0)
+	tr.setPhase(PhaseCopyingFiles, 1, 3)
+	tr.copied(copyResult{file: "f", written: 3}, time.Now())
+	tr.copied(copyResult{file: "g", err: ErrStopped}, time.Now())
+	tr.setPhase(PhaseCopyingFiles, 3, 3)
+	assertError(t, nil, tr.Flush(nil))
+
+	got := spans()
+	assert(t, 5, len(got))
+	run, scanning, copyF, copyG, copying := got[0], got[1], got[2], got[3], got[4]
+
+	assert(t, otelSpanRun, run.Name)
+	assert(t, "", run.ParentSpanID)
+	assert(t, otelStatus{Code: otelStatusOK}, run.Status)
+	assert(t, []otelAttr{otelString("mirror.dst", "b"), otelString("mirror.src", "a")}, run.Attributes)
+
+	assert(t, PhaseScanning, scanning.Name)
+	assert(t, run.SpanID, scanning.ParentSpanID)
+	assert(t, PhaseCopyingFiles, copying.Name)
+	assert(t, []otelAttr{otelInt("mirror.done", 3), otelInt("mirror.total", 3)}, copying.Attributes)
+
+	assert(t, copying.SpanID, copyF.ParentSpanID)
+	assert(t, []otelAttr{otelString("mirror.file", "f"), otelInt("mirror.written", 3)}, copyF.Attributes)
+	assert(t, otelStatus{Code: otelStatusError, Message: ErrStopped.Error()}, copyG.Status)
+
+	for _, s := range got {
+		assert(t, run.TraceID, s.TraceID)
+		assert(t, 32, len(s.TraceID))
+		assert(t, 16, len(s.SpanID))
+	}
+
+	t.Run("failed run", func(t *testing.T) {
+		tr := NewTracer(srv.URL+OTelTracesPath, 0, nil)
+		tr.copied(copyResult{file: "f"}, time.Now())
+		assertError(t, nil, tr.Flush(ErrStopped))
+
+		got := spans()
+		assert(t, 2, len(got))
+		assert(t, otelStatus{Code: otelStatusError, Message: ErrStopped.Error()}, got[0].Status)
+	})
+
+	t.Run("too many spans", func(t *testing.T) {
+		tr := NewTracer(srv.URL+OTelTracesPath, 1, nil)
+		for i := 0; i < otelMaxSpans+5; i++ {
+			tr.copied(copyResult{file: fmt.Sprint(i)}, time.Now())
+		}
+		assertError(t, nil, tr.Flush(nil))
+
+		got := spans()
+		assert(t, otelMaxSpans+1, len(got))
+		assert(t, []otelAttr{otelInt("mirror.dropped_spans", 6)}, got[0].Attributes)
+	})
+
+	t.Run("collector error", func(t *testing.T) {
+		srv, _ := collector(t, http.StatusBadRequest)
+		err := NewTracer(srv.URL+OTelTracesPath, 1, nil).Flush(nil)
+		assert(t, true, errors.Is(err, ErrOTelStatus))
+	})
+
+	t.Run("nil tracer", func(t *testing.T) {
+		var tr *Tracer
+		tr.setPhase(PhaseScanning, 0, 0)
+		tr.copied(copyResult{file: "f"}, time.Now())
+		assertError(t, nil, tr.Flush(nil))
+	})
+}
+
+func TestTracerSample(t *testing.T) {
+	tr := &Tracer{sample: 0.5}
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if tr.sampled(fmt.Sprintf("folder/file_%d", i)) {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("want about 500 sampled files, got %d", sampled)
+	}
+	assert(t, tr.sampled("a"), tr.sampled("a"))
+	assert(t, false, (&Tracer{}).sampled("a"))
+}
+
+func TestCopyFilesTrace(t *testing.T) {
+	discardLog(t)
+	srv, spans := collector(t, http.StatusOK)
+	tr := NewTracer(srv.URL+OTelTracesPath, 1, nil)
+
+	fsys := fstest.MapFS{"a": {Data: []byte("aa")}, "b": {Data: []byte("b")}}
+	files := File{"a": 2, "b": 1}
+	dst := t.TempDir()
+	assertError(t, nil, CopyFilesFS(files, 3, fsys, dst, &Options{LogPath: os.DevNull, Tracer: tr, Workers: 2}))
+	assertError(t, nil, tr.Flush(nil))
+
+	names := map[string]int{}
+	for _, s := range spans() {
+		names[s.Name]++
+	}
+	assert(t, map[string]int{otelSpanRun: 1, PhaseScanning: 1, PhaseCopyingFiles: 1, otelSpanCopy: 2}, names)
+
+	_, err := os.Stat(filepath.Join(dst, "a"))
+	assertError(t, nil, err)
+}
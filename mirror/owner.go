@@ -0,0 +1,10 @@
+package mirror
+
+const (
+	FlagNamePreserveOwner  = "preserve-owner"
+	FlagUsagePreserveOwner = "copied files and made folders keep the owner and group of the source, changing the owner needs root (not on Windows)"
+	ErrOwnerUnsupported    = CustomErr("owners can't be copied on this system")
+	ErrOwnerNeedsOSFS      = CustomErr("owners can only be copied from a folder on disk")
+	LogOwnerNotKept        = "owner not kept, no permission to change it: "
+	MsgOwnerNotKept        = "copied files and made folders whose owner couldn't be kept:"
+)
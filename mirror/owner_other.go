@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+const ownerSupported = true
+
+// copyOwner gives dst the owner and group in info of the source. kept is false if the process may not change them,
+// which usually means that it doesn't run as root
+func copyOwner(info fs.FileInfo, dst string) (kept bool, err error) {
+	s, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, ErrOwnerNeedsOSFS
+	}
+	if err = os.Lchown(dst, int(s.Uid), int(s.Gid)); os.IsPermission(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
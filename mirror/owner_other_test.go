@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPreserveOwner(t *testing.T) {
+	discardLog(t)
+
+	src := t.TempDir()
+	assertError(t, nil, os.Mkdir(filepath.Join(src, "a"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a", "f"), []byte("f"), FilePerm))
+
+	// nobody owns the source when the test can change owners, otherwise the owner is the user of the test
+	const nobody = 65534
+	root := os.Geteuid() == 0
+	if root {
+		for _, path := range []string{filepath.Join(src, "a"), filepath.Join(src, "a", "f")} {
+			assertError(t, nil, os.Lchown(path, nobody, nobody))
+		}
+	}
+
+	dst := t.TempDir()
+	opts := &Options{LogPath: os.DevNull, PreserveOwner: true, PreservePerms: true}
+	assertError(t, nil, MakeFoldersFS(Folder{"a": {}}, OSFS(src), dst, opts))
+	assertError(t, nil, CopyFiles(File{filepath.Join("a", "f"): 1}, 1, src, dst, opts))
+	assert(t, 0, len(opts.Report.OwnerNotKept))
+
+	for _, path := range []string{"a", filepath.Join("a", "f")} {
+		want, err := os.Lstat(filepath.Join(src, path))
+		assertError(t, nil, err)
+		got, err := os.Lstat(filepath.Join(dst, path))
+		assertError(t, nil, err)
+		assert(t, want.Sys().(*syscall.Stat_t).Uid, got.Sys().(*syscall.Stat_t).Uid)
+		assert(t, want.Sys().(*syscall.Stat_t).Gid, got.Sys().(*syscall.Stat_t).Gid)
+	}
+
+	t.Run("without permission", func(t *testing.T) {
+		if root {
+			t.Skip("root may change every owner")
+		}
+		info, err := os.Lstat(filepath.Join(src, "a", "f"))
+		assertError(t, nil, err)
+		info.Sys().(*syscall.Stat_t).Uid = 0
+
+		kept, err := copyOwner(info, filepath.Join(dst, "a", "f"))
+		assertError(t, nil, err)
+		assert(t, false, kept)
+	})
+
+	t.Run("needs a folder on disk", func(t *testing.T) {
+		err := CopyFilesFS(File{"f": 1}, 1, fstest.MapFS{"f": {Data: []byte("f")}}, t.TempDir(), opts)
+		assertError(t, ErrOwnerNeedsOSFS, err)
+	})
+}
@@ -0,0 +1,10 @@
+package mirror
+
+import "io/fs"
+
+// owners on Windows are security descriptors, not numbers that fs.FileInfo has
+const ownerSupported = false
+
+func copyOwner(info fs.FileInfo, dst string) (bool, error) {
+	return false, ErrOwnerUnsupported
+}
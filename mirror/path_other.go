@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+func fixLongPath(path string) string {
+	return path
+}
@@ -0,0 +1,23 @@
+package mirror
+
+import "strings"
+
+const (
+	longPathPrefix = `\\?\`
+	longUNCPrefix  = `\\?\UNC\`
+	devicePrefix   = `\\.\`
+)
+
+// fixLongPath prefixes an absolute path, so Windows accepts it even if it's longer than MAX_PATH.
+// UNC paths like \\server\share\folder become \\?\UNC\server\share\folder. Paths that already start with \\?\ or
+// with the \\.\ of devices like \\.\pipe\name stay as they are, they aren't UNC paths
+func fixLongPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, longPathPrefix), strings.HasPrefix(path, devicePrefix):
+		return path
+	case strings.HasPrefix(path, `\\`):
+		return longUNCPrefix + path[2:]
+	default:
+		return longPathPrefix + path
+	}
+}
@@ -0,0 +1,44 @@
+package mirror
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFixLongPath(t *testing.T) {
+	tests := []struct {
+		name, input, expected string
+	}{
+		{name: "drive letter", input: `C:\a\b`, expected: `\\?\C:\a\b`},
+		{name: "UNC path", input: `\\server\share\folder`, expected: `\\?\UNC\server\share\folder`},
+		{name: "UNC share root", input: `\\server\share`, expected: `\\?\UNC\server\share`},
+		{name: "UNC folder", input: `\\server\share\dir`, expected: `\\?\UNC\server\share\dir`},
+		{name: "already prefixed", input: `\\?\UNC\server\share`, expected: `\\?\UNC\server\share`},
+		{name: "prefixed drive letter", input: `\\?\C:\x`, expected: `\\?\C:\x`},
+		{name: "device path", input: `\\.\pipe\x`, expected: `\\.\pipe\x`},
+		{name: "device root", input: `\\.\C:\x`, expected: `\\.\C:\x`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := fixLongPath(test.input)
+			if got != test.expected {
+				t.Errorf("input %q, got %q, expected %q", test.input, got, test.expected)
+			}
+		})
+	}
+}
+
+func FuzzFixLongPath(f *testing.F) {
+	for _, seed := range []string{`C:\a\b`, `\\server\share`, `\\?\UNC\server`, `\\.\pipe\x`, `\\`, `\`, "", `C:\ä\𝄞`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		got := fixLongPath(path)
+		if !strings.HasPrefix(got, longPathPrefix) && !strings.HasPrefix(got, devicePrefix) {
+			t.Errorf("input %q, got %q without the %q or %q prefix", path, got, longPathPrefix, devicePrefix)
+		}
+		if again := fixLongPath(got); again != got {
+			t.Errorf("input %q, got %q once and %q twice", path, got, again)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	FlagNamePreservePerms  = "preserve-perms"
+	FlagUsagePreservePerms = "copied files and made folders keep the permission bits of the source, -" + FlagNamePreservePerms + "=false gives them the default ones (not on Windows)"
+	// folderOwnerPerm stays on made folders, so files can still be copied into them
+	folderOwnerPerm = 0700
+)
+
+// keepsPerms returns true if copies and made folders get the permissions of the source
+func (o *Options) keepsPerms() bool {
+	return o.PreservePerms && permsSupported
+}
+
+// copyPerm gives dst the permission bits in info of the source
+func copyPerm(info fs.FileInfo, dst string) error {
+	return os.Chmod(dst, info.Mode().Perm())
+}
+
+// copyFolderAttrs gives folders in path the owners and the permission bits of the same folders in srcFS, as opts say.
+// The owner can always read and write them, otherwise files couldn't be copied into a read-only folder, or folders
+// inside it made. It returns the folders whose owner couldn't be kept
+func copyFolderAttrs(folders Folder, srcFS fs.FS, path string, opts *Options) (ownerLost []string, err error) {
+	for _, folder := range sortFoldersOrFiles(folders) {
+		info, err := fs.Stat(srcFS, fsName(folder))
+		// the owner comes first, changing it can clear the setgid bit
+		if err == nil && opts.PreserveOwner {
+			var kept bool
+			if kept, err = copyOwner(info, filepath.Join(path, folder)); err == nil && !kept {
+				ownerLost = append(ownerLost, folder)
+			}
+		}
+		if err == nil && opts.keepsPerms() {
+			err = os.Chmod(filepath.Join(path, folder), info.Mode().Perm()|folderOwnerPerm)
+		}
+		if err != nil && !vanished(srcFS, fsName(folder), err) && !opts.ignoreErr(folder, err) {
+			return ownerLost, err
+		}
+	}
+	return ownerLost, nil
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+const permsSupported = true
@@ -0,0 +1,69 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreservePerms(t *testing.T) {
+	if !permsSupported {
+		t.Skip("permissions aren't copied on this system")
+	}
+	discardLog(t)
+
+	src := t.TempDir()
+	assertError(t, nil, os.MkdirAll(filepath.Join(src, "private", "ro"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "private", "key"), []byte("k"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh"), FilePerm))
+	assertError(t, nil, os.Chmod(filepath.Join(src, "private", "key"), 0600))
+	assertError(t, nil, os.Chmod(filepath.Join(src, "run.sh"), 0755))
+	assertError(t, nil, os.Chmod(filepath.Join(src, "private", "ro"), 0555))
+	assertError(t, nil, os.Chmod(filepath.Join(src, "private"), 0700))
+
+	folders := Folder{"private": {}, filepath.Join("private", "ro"): {}}
+	files := File{filepath.Join("private", "key"): 1, "run.sh": 9}
+
+	tests := []struct {
+		name               string
+		preserve           bool
+		key, run, ro, priv os.FileMode
+	}{
+		{name: "preserved", preserve: true, key: 0600, run: 0755, ro: 0755, priv: 0700},
+		{name: "not preserved", key: FilePerm, run: FilePerm, ro: FolderPerm, priv: FolderPerm},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			opts := &Options{LogPath: os.DevNull, PreservePerms: test.preserve}
+			assertError(t, nil, MakeFoldersFS(folders, OSFS(src), dst, opts))
+			assertError(t, nil, CopyFiles(files, TotalSize(files), src, dst, opts))
+
+			for path, want := range map[string]os.FileMode{
+				filepath.Join("private", "key"): test.key,
+				"run.sh":                        test.run,
+				filepath.Join("private", "ro"):  test.ro,
+				"private":                       test.priv,
+			} {
+				info, err := os.Stat(filepath.Join(dst, path))
+				assertError(t, nil, err)
+				// without preserving, the umask decides
+				if test.preserve {
+					assert(t, want, info.Mode().Perm())
+				} else if info.Mode().Perm()&^want != 0 {
+					t.Errorf("%s has mode %v, more than %v", path, info.Mode().Perm(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPreservesPerms(t *testing.T) {
+	m, err := New(t.TempDir(), t.TempDir())
+	assertError(t, nil, err)
+	assert(t, true, m.opts.PreservePerms)
+
+	m, err = New(t.TempDir(), t.TempDir(), WithPreservePerms(false))
+	assertError(t, nil, err)
+	assert(t, false, m.opts.PreservePerms)
+}
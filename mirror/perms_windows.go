@@ -0,0 +1,5 @@
+package mirror
+
+// Windows only has the read-only attribute behind the permission bits, and a read-only copy couldn't be replaced
+// or cleaned by a later run
+const permsSupported = false
@@ -0,0 +1,36 @@
+package mirror
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ErrPingStatus  = CustomErr("the ping URL responded with")
+	PingFailSuffix = "/fail"
+	PingTimeout    = 10 * time.Second
+)
+
+// Ping sends body to url, or to url + "/fail" if the run failed. Monitoring services like healthchecks.io use this convention
+func Ping(url string, failed bool, body string) error {
+	if failed {
+		url = strings.TrimSuffix(url, "/") + PingFailSuffix
+	}
+
+	client := http.Client{Timeout: PingTimeout}
+	resp, err := client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if err = resp.Body.Close(); err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%w %s", ErrPingStatus, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package mirror
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	var gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dat, _ := io.ReadAll(r.Body)
+		gotPath, gotBody = r.URL.Path, string(dat)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("success", func(t *testing.T) {
+		err := Ping(server.URL+"/uuid", false, "stats")
+		assertError(t, nil, err)
+		assert(t, "/uuid", gotPath)
+		assert(t, "stats", gotBody)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		err := Ping(server.URL+"/uuid/", true, "error")
+		assertError(t, nil, err)
+		assert(t, "/uuid/fail", gotPath)
+		assert(t, "error", gotBody)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		err := Ping(server.URL+"/broken", false, "")
+		if !errors.Is(err, ErrPingStatus) {
+			t.Errorf("wanted ErrPingStatus, but got %q", err)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FlagNameDryRun   = "dry-run"
+	FlagUsageDryRun  = "list every folder and file that would be made, copied or removed and exit without changing anything"
+	PlanMakeFolder   = "make folder"
+	PlanCopyFile     = "copy file"
+	PlanRemoveFile   = "remove file"
+	PlanRemoveFolder = "remove folder"
+	formatPlanFolder = "%-13s  %s\n"
+	formatPlanFile   = "%-13s  %s (%s B)\n"
+	formatPlanTotal  = "%d folders and %d files (%s B)\n"
+	// PlanReclaimRoot stands for the files right in dst in the table of WriteReclaim
+	PlanReclaimRoot      = "."
+	PlanReclaimHeader    = "space that cleaning would free, by top-level folder:"
+	formatPlanReclaim    = "%15s B  %7d files  %s\n"
+	formatPlanReclaimSum = "%15s B  %7d files  in total\n"
+)
+
+// Reclaim is the space that removing files would free in one top-level folder of dst, see ReclaimByFolder
+type Reclaim struct {
+	// Folder is the top-level folder, or PlanReclaimRoot for files right in dst
+	Folder string
+	Files  int
+	Size   int64
+}
+
+// WritePlan writes one line for every folder and file into w, in the order in which they would be processed.
+// Cleaning mode removes files first and folders then, copying makes folders first
+func WritePlan(w io.Writer, folders Folder, files File, cleaningMode bool) error {
+	folderAction, fileAction := PlanMakeFolder, PlanCopyFile
+	if cleaningMode {
+		folderAction, fileAction = PlanRemoveFolder, PlanRemoveFile
+	}
+
+	writeFolders := func() error {
+		for _, folder := range sortFoldersOrFiles(folders) {
+			if _, err := fmt.Fprintf(w, formatPlanFolder, folderAction, folder); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	writeFiles := func() error {
+		for _, file := range sortFoldersOrFiles(files) {
+			if _, err := fmt.Fprintf(w, formatPlanFile, fileAction, file, ThousandSeparator(strconv.FormatInt(files[file], 10))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	steps := []func() error{writeFolders, writeFiles}
+	if cleaningMode {
+		steps = []func() error{writeFiles, writeFolders}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, formatPlanTotal, len(folders), len(files), ThousandSeparator(strconv.FormatInt(TotalSize(files), 10)))
+	return err
+}
+
+// ReclaimByFolder sums files by the top-level folder they are in. The biggest folders come first, folders of the same
+// size are sorted by name
+func ReclaimByFolder(files File) []Reclaim {
+	byFolder := make(map[string]*Reclaim)
+	for file, size := range files {
+		folder := PlanReclaimRoot
+		if i := strings.IndexRune(file, filepath.Separator); i >= 0 {
+			folder = file[:i]
+		}
+		r, ok := byFolder[folder]
+		if !ok {
+			r = &Reclaim{Folder: folder}
+			byFolder[folder] = r
+		}
+		r.Files++
+		r.Size += size
+	}
+
+	res := make([]Reclaim, 0, len(byFolder))
+	for _, r := range byFolder {
+		res = append(res, *r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Size != res[j].Size {
+			return res[i].Size > res[j].Size
+		}
+		return res[i].Folder < res[j].Folder
+	})
+	return res
+}
+
+// WriteReclaim writes the table of ReclaimByFolder for a dry-run of cleaning into w, with the total at the end.
+// Nothing is written if there are no files
+func WriteReclaim(w io.Writer, files File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, PlanReclaimHeader); err != nil {
+		return err
+	}
+	for _, r := range ReclaimByFolder(files) {
+		if _, err := fmt.Fprintf(w, formatPlanReclaim, ThousandSeparator(strconv.FormatInt(r.Size, 10)), r.Files, r.Folder); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, formatPlanReclaimSum, ThousandSeparator(strconv.FormatInt(TotalSize(files), 10)), len(files))
+	return err
+}
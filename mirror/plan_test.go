@@ -0,0 +1,48 @@
+package mirror
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritePlan(t *testing.T) {
+	folders, files := Folder{"a": {}}, File{"a/1": 1234, "b": 1}
+
+	tests := []struct {
+		name         string
+		cleaningMode bool
+		want         string
+	}{
+		{"copying", false, "make folder    a\ncopy file      a/1 (1 234 B)\ncopy file      b (1 B)\n1 folders and 2 files (1 235 B)\n"},
+		{"cleaning", true, "remove file    a/1 (1 234 B)\nremove file    b (1 B)\nremove folder  a\n1 folders and 2 files (1 235 B)\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := WritePlan(&b, folders, files, tt.cleaningMode)
+			assertError(t, nil, err)
+			assert(t, tt.want, b.String())
+		})
+	}
+}
+
+func TestWriteReclaim(t *testing.T) {
+	files := File{filepath.Join("a", "1"): 1234, filepath.Join("a", "b", "2"): 1, filepath.Join("c", "3"): 1235, "d": 10, "e": 5}
+
+	assert(t, []Reclaim{{"a", 2, 1235}, {"c", 1, 1235}, {PlanReclaimRoot, 2, 15}}, ReclaimByFolder(files))
+
+	var b strings.Builder
+	assertError(t, nil, WriteReclaim(&b, files))
+	want := PlanReclaimHeader + "\n" +
+		"          1 235 B        2 files  a\n" +
+		"          1 235 B        1 files  c\n" +
+		"             15 B        2 files  .\n" +
+		"          2 485 B        5 files  in total\n"
+	assert(t, want, b.String())
+
+	b.Reset()
+	assertError(t, nil, WriteReclaim(&b, File{}))
+	assert(t, "", b.String())
+}
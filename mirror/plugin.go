@@ -0,0 +1,332 @@
+package mirror
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FlagNamePlugin       = "plugin"
+	FlagUsagePlugin      = "command line of a plugin, a program that reads JSON lines on stdin and answers on stdout, which can skip items and hears about copied and removed files, see the README (can be repeated)"
+	SchemaPlugin         = 1
+	PluginHookFilter     = "filter"
+	PluginHookNotify     = "notify"
+	PluginMsgHello       = "hello"
+	PluginMsgFilter      = "filter"
+	PluginMsgEvent       = "event"
+	PluginEventCopied    = "copied"
+	PluginEventRemoved   = "removed"
+	PluginEventFinished  = "finished"
+	PluginTreeSrc        = "src"
+	PluginTreeDst        = "dst"
+	ErrPluginHandshake   = CustomErr("the plugin didn't answer the hello message with its hooks:")
+	ErrUnknownPluginHook = CustomErr("the plugin asked for an unknown hook:")
+	ErrPluginFailed      = CustomErr("the plugin failed:")
+	ErrPluginNoReply     = CustomErr("the plugin didn't answer within")
+	ReasonPlugin         = "skipped by a plugin"
+	MsgPluginDropped     = "the plugin stopped getting events because it failed:"
+	// pluginExitTimeout is how long a plugin has to exit once its stdin is closed, see Plugins.Close
+	pluginExitTimeout = 10 * time.Second
+	// pluginReplyTimeout is how long a plugin has to answer a message, one that hangs is killed
+	pluginReplyTimeout = time.Minute
+)
+
+// Commands holds command lines, its flag can be repeated
+type Commands []string
+
+func (c *Commands) String() string {
+	return strings.Join(*c, "; ")
+}
+
+func (c *Commands) Set(command string) error {
+	*c = append(*c, command)
+	return nil
+}
+
+// PluginMessage is a line that the program writes to the stdin of a plugin. The first one is a hello with Version,
+// the plugin answers it with the hooks it wants. A filter message asks about an item of the scan of Tree in Root,
+// Size and ModTime are only set for files, the plugin answers with Skip. An event message about a copied or removed
+// file gets no answer, the last one is the finished event with Failed and Message
+type PluginMessage struct {
+	// Schema is SchemaPlugin
+	Schema  int    `json:"schema"`
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+	Event   string `json:"event,omitempty"`
+	// Tree is PluginTreeSrc or PluginTreeDst, or empty if the scanned folder is neither, e.g. an archive. Root is the
+	// scanned folder, if it's one of the OS
+	Tree string `json:"tree,omitempty"`
+	Root string `json:"root,omitempty"`
+	// Path is relative to Root and uses forward slashes
+	Path    string `json:"path,omitempty"`
+	Dir     bool   `json:"dir,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime string `json:"modTime,omitempty"`
+	Failed  bool   `json:"failed,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// PluginReply is a line that a plugin writes to its stdout. Hooks answer the hello, Skip and Reason a filter
+// message. Error fails the run
+type PluginReply struct {
+	Hooks  []string `json:"hooks,omitempty"`
+	Skip   bool     `json:"skip,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Plugins are the plugins of a run, which StartPlugins started. A nil *Plugins does nothing. It's safe to use from
+// several goroutines. What a plugin without the filter hook writes to stdout after its hooks goes to stderr, so it
+// can't fill the pipe and block the run
+type Plugins struct {
+	list []*plugin
+	// src and dst tell filtered which tree a scan is of
+	src, dst string
+}
+
+type plugin struct {
+	command string
+	cmd     *exec.Cmd
+	filter  bool
+	notify  bool
+
+	// mu keeps a message and its reply together
+	mu  sync.Mutex
+	in  io.WriteCloser
+	enc *json.Encoder
+	out io.Reader
+	dec *json.Decoder
+	// replyTimeout is pluginReplyTimeout, see receive
+	replyTimeout time.Duration
+	// drained is closed once the stdout of a plugin without the filter hook is copied to stderr, see drain
+	drained chan struct{}
+	// dropped is set once an event couldn't be sent, the plugin gets no more of them
+	dropped bool
+}
+
+// StartPlugins starts every command and asks it for its hooks. src and dst are the folders of the run, filter messages
+// say which one the item is in. A plugin writes what it logs to stderr, which is the one of the program
+func StartPlugins(commands []string, src, dst string) (*Plugins, error) {
+	p := &Plugins{src: src, dst: dst}
+	for _, command := range commands {
+		pl, err := startPlugin(command)
+		if err != nil {
+			p.Close(true, err.Error())
+			return nil, err
+		}
+		p.list = append(p.list, pl)
+	}
+	return p, nil
+}
+
+func startPlugin(command string) (*plugin, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrPluginHandshake, command)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+
+	pl := &plugin{command: command, cmd: cmd, in: in, enc: json.NewEncoder(in), out: bufio.NewReader(out), replyTimeout: pluginReplyTimeout}
+	pl.dec = json.NewDecoder(pl.out)
+	reply, err := pl.ask(PluginMessage{Type: PluginMsgHello, Version: Version})
+	if err != nil {
+		pl.close(true, "")
+		return nil, fmt.Errorf("%w %q: %v", ErrPluginHandshake, command, err)
+	}
+	for _, hook := range reply.Hooks {
+		switch hook {
+		case PluginHookFilter:
+			pl.filter = true
+		case PluginHookNotify:
+			pl.notify = true
+		default:
+			pl.close(true, "")
+			return nil, fmt.Errorf("%w %q of %q", ErrUnknownPluginHook, hook, command)
+		}
+	}
+	if !pl.filter {
+		pl.drain()
+	}
+	return pl, nil
+}
+
+// ask sends m and returns the reply, the caller holds mu unless the plugin is starting
+func (pl *plugin) ask(m PluginMessage) (reply PluginReply, err error) {
+	m.Schema = SchemaPlugin
+	if err = pl.enc.Encode(m); err != nil {
+		return
+	}
+	if reply, err = pl.receive(); err != nil {
+		return
+	}
+	if reply.Error != "" {
+		err = errors.New(reply.Error)
+	}
+	return
+}
+
+// receive reads the next reply. A plugin that doesn't answer within replyTimeout is killed, so the run doesn't hang
+func (pl *plugin) receive() (PluginReply, error) {
+	type answer struct {
+		reply PluginReply
+		err   error
+	}
+	// a child of the plugin can keep stdout open after the kill, the read is left behind then
+	decoded := make(chan answer, 1)
+	go func() {
+		var a answer
+		a.err = pl.dec.Decode(&a.reply)
+		decoded <- a
+	}()
+	t := time.NewTimer(pl.replyTimeout)
+	defer t.Stop()
+	select {
+	case a := <-decoded:
+		return a.reply, a.err
+	case <-t.C:
+		pl.cmd.Process.Kill()
+		return PluginReply{}, fmt.Errorf("%w %v", ErrPluginNoReply, pl.replyTimeout)
+	}
+}
+
+// drain copies what the plugin writes to stdout from now on to stderr, nobody reads its replies anymore
+func (pl *plugin) drain() {
+	pl.drained = make(chan struct{})
+	go func() {
+		defer close(pl.drained)
+		io.Copy(os.Stderr, io.MultiReader(pl.dec.Buffered(), pl.out))
+	}()
+}
+
+func (pl *plugin) send(m PluginMessage) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.dropped {
+		return
+	}
+	m.Schema = SchemaPlugin
+	if err := pl.enc.Encode(m); err != nil {
+		pl.dropped = true
+		log.Println(MsgPluginDropped, pl.command, err)
+	}
+}
+
+// close sends the finished event if the plugin wants events, closes its stdin and waits until it exits
+func (pl *plugin) close(failed bool, msg string) error {
+	if pl.notify {
+		pl.send(PluginMessage{Type: PluginMsgEvent, Event: PluginEventFinished, Failed: failed, Message: msg})
+	}
+	pl.in.Close()
+
+	exited := make(chan error, 1)
+	go func() {
+		// Wait closes stdout, so it has to be read to the end first
+		if pl.drained != nil {
+			<-pl.drained
+		}
+		exited <- pl.cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		if err != nil {
+			return fmt.Errorf("%w %q: %v", ErrPluginFailed, pl.command, err)
+		}
+		return nil
+	case <-time.After(pluginExitTimeout):
+		pl.cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("%w %q: it didn't exit", ErrPluginFailed, pl.command)
+	}
+}
+
+// filtered returns the reason why a plugin skips the item name (with forward slashes) of fsys, or an empty string if
+// none does. info is only needed for files. A plugin that fails to answer fails the run, the items it would skip
+// aren't known
+func (p *Plugins) filtered(fsys fs.FS, name string, isDir bool, info fs.FileInfo) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	m := PluginMessage{Type: PluginMsgFilter, Path: name, Dir: isDir}
+	if root, ok := fsys.(OSFS); ok {
+		m.Root = string(root)
+		switch m.Root {
+		case p.src:
+			m.Tree = PluginTreeSrc
+		case p.dst:
+			m.Tree = PluginTreeDst
+		}
+	}
+	if !isDir {
+		m.Size, m.ModTime = info.Size(), info.ModTime().Format(time.RFC3339Nano)
+	}
+	for _, pl := range p.list {
+		if !pl.filter {
+			continue
+		}
+		pl.mu.Lock()
+		reply, err := pl.ask(m)
+		pl.mu.Unlock()
+		if err != nil {
+			return "", fmt.Errorf("%w %q: %v", ErrPluginFailed, pl.command, err)
+		}
+		if reply.Skip {
+			if reply.Reason != "" {
+				return reply.Reason, nil
+			}
+			return ReasonPlugin, nil
+		}
+	}
+	return "", nil
+}
+
+// notify sends event about file, a relative path, to the plugins that want events. A plugin that can't get it
+// doesn't get more events, the run goes on
+func (p *Plugins) notify(event, file string, size int64) {
+	if p == nil {
+		return
+	}
+	for _, pl := range p.list {
+		if pl.notify {
+			pl.send(PluginMessage{Type: PluginMsgEvent, Event: event, Path: filepath.ToSlash(file), Size: size})
+		}
+	}
+}
+
+// Close sends the finished event with failed and msg to the plugins that want events and waits until they exit. It
+// returns the first error of a plugin
+func (p *Plugins) Close(failed bool, msg string) error {
+	if p == nil {
+		return nil
+	}
+	var res error
+	for _, pl := range p.list {
+		if err := pl.close(failed, msg); err != nil && res == nil {
+			res = err
+		}
+	}
+	p.list = nil
+	return res
+}
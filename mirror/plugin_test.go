@@ -0,0 +1,171 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// pluginScript skips items whose path starts with "skip", and the ones of dst whose path starts with "dst", fails on paths that start with "bad" and writes the events
+// it gets into the file of its argument
+const pluginScript = `#!/bin/sh
+while IFS= read -r line; do
+	case "$line" in
+	*'"type":"hello"'*) echo '{"hooks":["filter","notify"]}' ;;
+	*'"type":"filter"'*'"tree":"dst"'*'"path":"dst'*) echo '{"skip":true,"reason":"kept in dst"}' ;;
+	*'"type":"filter"'*'"path":"skip'*) echo '{"skip":true,"reason":"skipped by the test"}' ;;
+	*'"type":"filter"'*'"path":"bad'*) echo '{"error":"bad path"}' ;;
+	*'"type":"filter"'*) echo '{}' ;;
+	*'"type":"event"'*) echo "$line" >> "$1" ;;
+	esac
+done
+`
+
+func writePlugin(t *testing.T, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	p := filepath.Join(t.TempDir(), "plugin")
+	assertError(t, nil, os.WriteFile(p, []byte(script), 0755))
+	return p
+}
+
+func TestPlugins(t *testing.T) {
+	plugin := writePlugin(t, pluginScript)
+	events := filepath.Join(t.TempDir(), "events")
+
+	p, err := StartPlugins([]string{plugin + " " + events}, "", "")
+	assertError(t, nil, err)
+	opts := &Options{Plugins: p}
+	fsys := fstest.MapFS{
+		"a.txt":        {Data: []byte("a")},
+		"skip.txt":     {Data: []byte("s")},
+		"skipped/b":    {Data: []byte("b")},
+		"folder/c.txt": {Data: []byte("c")},
+	}
+	folders, files, skipped, err := ReadFS(fsys, opts)
+	assertError(t, nil, err)
+	assert(t, Folder{"folder": {}}, folders)
+	assert(t, File{"a.txt": 1, filepath.Join("folder", "c.txt"): 1}, files)
+	assert(t, Skipped{"skip.txt": "skipped by the test", "skipped": "skipped by the test"}, skipped)
+
+	p.notify(PluginEventCopied, filepath.Join("folder", "c.txt"), 1)
+	assertError(t, nil, p.Close(false, "done"))
+
+	got, err := os.ReadFile(events)
+	assertError(t, nil, err)
+	want := `{"schema":1,"type":"event","event":"copied","path":"folder/c.txt","size":1}
+{"schema":1,"type":"event","event":"finished","message":"done"}
+`
+	assert(t, want, string(got))
+}
+
+func TestPluginsTree(t *testing.T) {
+	plugin := writePlugin(t, pluginScript)
+	src, dst := t.TempDir(), t.TempDir()
+	for _, folder := range []string{src, dst} {
+		assertError(t, nil, os.WriteFile(filepath.Join(folder, "dst.txt"), []byte("d"), FilePerm))
+	}
+
+	p, err := StartPlugins([]string{plugin + " " + filepath.Join(t.TempDir(), "events")}, src, dst)
+	assertError(t, nil, err)
+	opts := &Options{Plugins: p}
+	_, files, _, err := ReadFolder(src, opts)
+	assertError(t, nil, err)
+	assert(t, File{"dst.txt": 1}, files)
+	_, files, skipped, err := ReadFolder(dst, opts)
+	assertError(t, nil, err)
+	assert(t, File{}, files)
+	assert(t, Skipped{"dst.txt": "kept in dst"}, skipped)
+	assertError(t, nil, p.Close(false, ""))
+}
+
+func TestPluginsFail(t *testing.T) {
+	plugin := writePlugin(t, pluginScript)
+
+	p, err := StartPlugins([]string{plugin + " " + filepath.Join(t.TempDir(), "events")}, "", "")
+	assertError(t, nil, err)
+	_, _, _, err = ReadFS(fstest.MapFS{"bad": {Data: []byte("b")}}, &Options{Plugins: p})
+	if !errors.Is(err, ErrPluginFailed) || !strings.Contains(err.Error(), "bad path") {
+		t.Errorf("want the error of the plugin, got %v", err)
+	}
+	assertError(t, nil, p.Close(true, err.Error()))
+
+	unknown := writePlugin(t, "#!/bin/sh\necho '{\"hooks\":[\"rename\"]}'\ncat > /dev/null\n")
+	_, err = StartPlugins([]string{unknown}, "", "")
+	if !errors.Is(err, ErrUnknownPluginHook) {
+		t.Errorf("want %v, got %v", ErrUnknownPluginHook, err)
+	}
+
+	silent := writePlugin(t, "#!/bin/sh\nexit 0\n")
+	_, err = StartPlugins([]string{silent}, "", "")
+	if !errors.Is(err, ErrPluginHandshake) {
+		t.Errorf("want %v, got %v", ErrPluginHandshake, err)
+	}
+
+	var nilPlugins *Plugins
+	reason, err := nilPlugins.filtered(nil, "a", true, nil)
+	assertError(t, nil, err)
+	assert(t, "", reason)
+	assertError(t, nil, nilPlugins.Close(false, ""))
+}
+
+func TestPluginsStdout(t *testing.T) {
+	t.Run("notify only", func(t *testing.T) {
+		// more than a pipe holds, the plugin is stuck until it's read
+		chatty := writePlugin(t, `#!/bin/sh
+while IFS= read -r line; do
+	case "$line" in
+	*'"type":"hello"'*) echo '{"hooks":["notify"]}'; head -c 200000 /dev/zero | tr '\0' x; echo ;;
+	esac
+done
+`)
+		stderr := os.Stderr
+		var err error
+		os.Stderr, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		assertError(t, nil, err)
+		defer func() {
+			os.Stderr.Close()
+			os.Stderr = stderr
+		}()
+
+		p, err := StartPlugins([]string{chatty}, "", "")
+		assertError(t, nil, err)
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			for i := 0; i < 5000; i++ {
+				p.notify(PluginEventCopied, "a.txt", 1)
+			}
+		}()
+		select {
+		case <-sent:
+		case <-time.After(10 * time.Second):
+			t.Fatal("the events are blocked by the output of the plugin")
+		}
+		assertError(t, nil, p.Close(false, ""))
+	})
+
+	t.Run("no reply", func(t *testing.T) {
+		mute := writePlugin(t, `#!/bin/sh
+while IFS= read -r line; do
+	case "$line" in
+	*'"type":"hello"'*) echo '{"hooks":["filter"]}' ;;
+	esac
+done
+`)
+		p, err := StartPlugins([]string{mute}, "", "")
+		assertError(t, nil, err)
+		p.list[0].replyTimeout = 10 * time.Millisecond
+		_, err = p.filtered(nil, "a", true, nil)
+		if !errors.Is(err, ErrPluginFailed) || !strings.Contains(err.Error(), string(ErrPluginNoReply)) {
+			t.Errorf("want %v, got %v", ErrPluginNoReply, err)
+		}
+		p.Close(true, "")
+	})
+}
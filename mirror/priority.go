@@ -0,0 +1,36 @@
+package mirror
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+const (
+	FlagNamePriority  = "priority"
+	FlagUsagePriority = "comma separated glob patterns of files that are copied before the others, like with -" + FlagNameInclude + ", files that match an earlier pattern go first, e.g. 'documents/**' (can be repeated)"
+)
+
+// PrioritizeFiles moves files that match one of the patterns of priority to the front of sortedFiles, those that
+// match an earlier pattern first. The order within each group stays as it was
+func PrioritizeFiles(sortedFiles []string, priority Globs) []string {
+	if len(priority) == 0 {
+		return sortedFiles
+	}
+
+	rank := make(map[string]int, len(sortedFiles))
+	for _, file := range sortedFiles {
+		rank[file] = len(priority)
+		name := filepath.ToSlash(file)
+		for i, pattern := range priority {
+			if (Globs{pattern}).Match(name) {
+				rank[file] = i
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(sortedFiles, func(i, j int) bool {
+		return rank[sortedFiles[i]] < rank[sortedFiles[j]]
+	})
+	return sortedFiles
+}
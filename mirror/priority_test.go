@@ -0,0 +1,41 @@
+package mirror
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPrioritizeFiles(t *testing.T) {
+	files := []string{
+		"a.mp4",
+		filepath.Join("documents", "a.txt"),
+		filepath.Join("documents", "deep", "b.txt"),
+		filepath.Join("media", "b.mp4"),
+		filepath.Join("taxes", "2024.pdf"),
+		"z.pdf",
+	}
+	tests := []struct {
+		name     string
+		priority Globs
+		want     []string
+	}{
+		{name: "without patterns", want: files},
+		{
+			name:     "a folder",
+			priority: Globs{"documents/**"},
+			want:     []string{files[1], files[2], files[0], files[3], files[4], files[5]},
+		},
+		{
+			name:     "in the order of the patterns",
+			priority: Globs{"*.pdf", "documents/**"},
+			want:     []string{files[4], files[5], files[1], files[2], files[0], files[3]},
+		},
+		{name: "nothing matches", priority: Globs{"*.jpg"}, want: files},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := PrioritizeFiles(append([]string(nil), files...), test.priority)
+			assert(t, test.want, got)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path/filepath"
+)
+
+const (
+	FlagNameDetectRenames  = "detect-renames"
+	FlagUsageDetectRenames = "with -" + FlagNameSync + ", move files of dst that aren't in src to where src has a missing file with the same size and SHA-256, instead of removing and copying them"
+	ErrDetectRenamesMode   = CustomErr("the -detect-renames flag only works together with the -sync flag")
+	LogMovedFiles          = "files moved:"
+	MsgProgressMovingFiles = "moving files:"
+	PlanMoveFile           = "move"
+)
+
+// Renames maps relative paths of missing files to the paths of files in dst that have the same content and are
+// moved there instead of being removed, see PlanRenames
+type Renames map[string]string
+
+// PlanRenames finds files of toClean in dst that have the same size and SHA-256 as files of missing in srcFS, and
+// moves every pair from missing and toClean to the returned renames. Only files with a size that both have are
+// hashed, each one once, and empty files aren't moved. A missing file in the place of a folder of foldersToClean is
+// copied, the folder is only removed after the moves
+func PlanRenames(missing, toClean File, foldersToClean Folder, srcFS fs.FS, dst string, opts *Options) (Renames, error) {
+	bySize := make(map[int64][]string)
+	for _, file := range sortFoldersOrFiles(toClean) {
+		if size := toClean[file]; size > 0 {
+			bySize[size] = append(bySize[size], file)
+		}
+	}
+
+	renames := make(Renames)
+	dstSums := make(map[string]string)
+	for _, file := range sortFoldersOrFiles(missing) {
+		candidates := bySize[missing[file]]
+		if _, ok := foldersToClean[file]; ok || len(candidates) == 0 {
+			continue
+		}
+
+		sum, err := hashFSFile(srcFS, fsName(file))
+		if err != nil {
+			if opts.ignoreErr(file, err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for i, old := range candidates {
+			s, ok := dstSums[old]
+			if !ok {
+				if s, err = hashFile(filepath.Join(dst, old)); err != nil {
+					if opts.ignoreErr(old, err) {
+						continue
+					}
+					return nil, err
+				}
+				dstSums[old] = s
+			}
+			if s == sum {
+				renames[file] = old
+				bySize[missing[file]] = append(candidates[:i:i], candidates[i+1:]...)
+				delete(missing, file)
+				delete(toClean, old)
+				break
+			}
+		}
+	}
+	return renames, nil
+}
+
+// MoveFiles moves files of dst to their new paths in renames and logs progress. Folders that a new path needs are
+// made with FolderPerm, MakeFoldersFS gives them their permissions later. The moved files get the times and permissions of srcFS
+// like copies do
+func MoveFiles(renames Renames, srcFS fs.FS, dst string, opts *Options) error {
+	var recentlyLoggedProgress, counter int
+
+	f, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(f, LogMovedFiles+"\n")
+	log.Println(MsgProgressMovingFiles, ZeroPercent)
+
+	sortedFiles := sortLinks(Links(renames))
+	for _, file := range sortedFiles {
+		if opts.stopped() {
+			return closeStoppedLog(f)
+		}
+
+		if err = moveRenamed(renames[file], file, srcFS, dst, opts); err != nil {
+			if !opts.ignoreErr(file, err) {
+				f.Close()
+				return err
+			}
+			continue
+		}
+
+		logProgressFolders(&recentlyLoggedProgress, &counter, len(sortedFiles), MsgProgressMovingFiles)
+		opts.sendProgress(PhaseMovingFiles, int64(counter), int64(len(sortedFiles)))
+
+		LogToFile(f, fmt.Sprintf(formatPlanLink, PlanMoveFile, renames[file], file))
+		opts.journal(file)
+	}
+
+	err = f.Close()
+	return err
+}
+
+// WriteRenames is WriteLinks for moved files, the old path comes first
+func WriteRenames(w io.Writer, renames Renames) error {
+	for _, file := range sortLinks(Links(renames)) {
+		if _, err := fmt.Fprintf(w, formatPlanLink, PlanMoveFile, renames[file], file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveRenamed moves old to file in dst and gives it the times and permissions of file in srcFS if opts keep them
+func moveRenamed(old, file string, srcFS fs.FS, dst string, opts *Options) error {
+	path := filepath.Join(dst, file)
+	if err := moveFile(filepath.Join(dst, old), path); err != nil {
+		return err
+	}
+	if !opts.keepsTimes() && !opts.keepsPerms() {
+		return nil
+	}
+
+	info, err := fs.Stat(srcFS, fsName(file))
+	if err != nil {
+		return err
+	}
+	if opts.keepsPerms() {
+		if err = copyPerm(info, path); err != nil {
+			return err
+		}
+	}
+	if opts.keepsTimes() {
+		return copyTimes(info, path)
+	}
+	return nil
+}
+
+// hashFSFile is hashFile for a file in fsys
+func hashFSFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
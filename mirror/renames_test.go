@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPlanRenames(t *testing.T) {
+	dst := t.TempDir()
+	for file, data := range map[string]string{"old": "photo", "other": "other", "twin": "photo", "empty": "", "x": "folder"} {
+		assertError(t, nil, os.WriteFile(filepath.Join(dst, file), []byte(data), FilePerm))
+	}
+	srcFS := fstest.MapFS{
+		"2024/photo": {Data: []byte("photo")},
+		"2024/copy":  {Data: []byte("photo")},
+		"2024/new":   {Data: []byte("fresh")},
+		"2024/empty": {Data: []byte("")},
+		"dir":        {Data: []byte("folder")},
+	}
+	missing := File{
+		filepath.Join("2024", "photo"): 5, filepath.Join("2024", "copy"): 5, filepath.Join("2024", "new"): 5,
+		filepath.Join("2024", "empty"): 0, "dir": 6,
+	}
+	toClean := File{"old": 5, "other": 5, "twin": 5, "empty": 0, "x": 6}
+
+	renames, err := PlanRenames(missing, toClean, Folder{"dir": {}}, srcFS, dst, &Options{})
+	assertError(t, nil, err)
+	// every old file is only moved once, both photos find one
+	assert(t, Renames{filepath.Join("2024", "copy"): "old", filepath.Join("2024", "photo"): "twin"}, renames)
+	assert(t, File{filepath.Join("2024", "new"): 5, filepath.Join("2024", "empty"): 0, "dir": 6}, missing)
+	assert(t, File{"other": 5, "empty": 0, "x": 6}, toClean)
+}
+
+func TestMirrorDetectRenames(t *testing.T) {
+	discardLog(t)
+	src, dst := t.TempDir(), t.TempDir()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assertError(t, nil, os.MkdirAll(filepath.Join(src, "2024", "may"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "2024", "may", "photo"), []byte("photo"), FilePerm))
+	assertError(t, nil, os.Chtimes(filepath.Join(src, "2024", "may", "photo"), modTime, modTime))
+	assertError(t, nil, os.MkdirAll(filepath.Join(dst, "unsorted"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "unsorted", "photo"), []byte("photo"), FilePerm))
+
+	m, err := New(src, dst, WithDetectRenames(), WithLogFile(os.DevNull))
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, Renames{filepath.Join("2024", "may", "photo"): filepath.Join("unsorted", "photo")}, p.Renames)
+	assert(t, File{}, p.MissingFiles)
+	assert(t, File{}, p.FilesToClean)
+	assert(t, ErrDetectRenamesMode, m.Copy(context.Background(), p))
+
+	// the old folder is removed after the file is moved out of it
+	assertError(t, nil, m.Sync(context.Background(), p))
+	folders, files, _, err := ReadFolder(dst, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"2024": {}, filepath.Join("2024", "may"): {}}, folders)
+	assert(t, File{filepath.Join("2024", "may", "photo"): 5}, files)
+	info, err := os.Stat(filepath.Join(dst, "2024", "may", "photo"))
+	assertError(t, nil, err)
+	assert(t, true, info.ModTime().Equal(modTime))
+
+	p, err = m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, true, p.Empty())
+}
+
+func TestWriteRenames(t *testing.T) {
+	var b bytes.Buffer
+	assertError(t, nil, WriteRenames(&b, Renames{"new": "old"}))
+	assert(t, "move           old -> new\n", b.String())
+}
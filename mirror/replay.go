@@ -0,0 +1,106 @@
+package mirror
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CmdReplay            = "replay"
+	FlagNameReplayLog    = "log"
+	FlagNameSpeed        = "speed"
+	FlagUsageReplayLog   = "log that was written with '-log-format json'"
+	FlagUsageSpeed       = "replay this many times faster than the run was, 0 doesn't wait between lines"
+	ErrReplayWrongArgs   = CustomErr("wrong arguments, use 'replay -h' for help")
+	ErrBadLogLine        = CustomErr("not a line written with '-log-format json', line")
+	formatReplayLine     = "%s %s\n"
+	formatReplayResult   = "%d lines replayed, the run took %s"
+	replayTimeLayout     = "2006/01/02 15:04:05"
+	replayMaxLineLength  = 1 << 20
+	replayInitLineLength = 64 << 10
+)
+
+// ReplayResult is what Replay found in the log
+type ReplayResult struct {
+	Lines int
+	// Took is the time between the first and the last line
+	Took time.Duration
+}
+
+func (r ReplayResult) String() string {
+	return fmt.Sprintf(formatReplayResult, r.Lines, r.Took)
+}
+
+// VetReplayFlags parses flags of the replay subcommand and rewrites the log path into an absolute path
+func VetReplayFlags(args []string) (logPath string, speed float64, err error) {
+	fs := flag.NewFlagSet(CmdReplay, flag.ExitOnError)
+	fs.StringVar(&logPath, FlagNameReplayLog, "", FlagUsageReplayLog)
+	fs.Float64Var(&speed, FlagNameSpeed, 0, FlagUsageSpeed)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if logPath == "" || speed < 0 || fs.NArg() > 0 {
+		err = ErrReplayWrongArgs
+		return
+	}
+
+	if logPath, err = ExpandPath(logPath); err != nil {
+		return
+	}
+	if logPath, err = filepath.Abs(logPath); err != nil {
+		return
+	}
+	_, err = os.Stat(logPath)
+	return
+}
+
+// Replay writes lines of a JSON log from r into w the way the text log would show them, with the recorded times,
+// so the output of a run can be seen without its folders. With speed above 0 it waits between lines as long as
+// the run did, divided by speed. Nothing but r and w is touched
+func Replay(w io.Writer, r io.Reader, speed float64) (res ReplayResult, err error) {
+	var first, prev time.Time
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, replayInitLineLength), replayMaxLineLength)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var line jsonLine
+		if err = decodeVersioned(scanner.Bytes(), logLineSchema, &line); errors.Is(err, ErrSchemaTooNew) {
+			return res, fmt.Errorf("%w, line %d", err, n)
+		} else if err != nil {
+			return res, fmt.Errorf("%w %d", ErrBadLogLine, n)
+		}
+		t, errT := time.Parse(time.RFC3339Nano, line.Time)
+		if errT != nil {
+			return res, fmt.Errorf("%w %d", ErrBadLogLine, n)
+		}
+
+		if res.Lines == 0 {
+			first = t
+		} else if speed > 0 && t.After(prev) {
+			time.Sleep(time.Duration(float64(t.Sub(prev)) / speed))
+		}
+		prev = t
+
+		// the recorded zone is kept, so the output is the same wherever it's replayed
+		if _, err = fmt.Fprintf(w, formatReplayLine, t.Format(replayTimeLayout), line.Msg); err != nil {
+			return
+		}
+		res.Lines++
+		res.Took = t.Sub(first)
+	}
+
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,87 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVetReplayFlags(t *testing.T) {
+	path := t.TempDir() + "/log.jsonl"
+	assertError(t, nil, os.WriteFile(path, nil, FilePerm))
+
+	t.Run("with correct flags", func(t *testing.T) {
+		_, speed, err := VetReplayFlags([]string{"-" + FlagNameReplayLog, path, "-" + FlagNameSpeed, "10"})
+		assertError(t, nil, err)
+		assert(t, 10.0, speed)
+	})
+
+	t.Run("without a log", func(t *testing.T) {
+		_, _, err := VetReplayFlags(nil)
+		assertError(t, ErrReplayWrongArgs, err)
+	})
+
+	t.Run("with a negative speed", func(t *testing.T) {
+		_, _, err := VetReplayFlags([]string{"-" + FlagNameReplayLog, path, "-" + FlagNameSpeed, "-1"})
+		assertError(t, ErrReplayWrongArgs, err)
+	})
+
+	t.Run("with a missing log", func(t *testing.T) {
+		_, _, err := VetReplayFlags([]string{"-" + FlagNameReplayLog, path + "x"})
+		if !os.IsNotExist(err) {
+			t.Errorf("want a not exist error, got %v", err)
+		}
+	})
+}
+
+func TestReplay(t *testing.T) {
+	t.Run("written by the JSON log", func(t *testing.T) {
+		var recorded bytes.Buffer
+		for _, msg := range []string{MsgProgressMakingFolders + " " + ZeroPercent, MsgProgressCopyingFiles + " " + ZeroPercent} {
+			_, err := jsonWriter{w: &recorded}.Write([]byte(msg + "\n"))
+			assertError(t, nil, err)
+		}
+
+		var out bytes.Buffer
+		res, err := Replay(&out, &recorded, 0)
+		assertError(t, nil, err)
+		assert(t, 2, res.Lines)
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert(t, 2, len(lines))
+		if !strings.HasSuffix(lines[1], " "+MsgProgressCopyingFiles+" "+ZeroPercent) {
+			t.Errorf("unexpected line %q", lines[1])
+		}
+	})
+
+	t.Run("keeps the recorded times", func(t *testing.T) {
+		recorded := `{"time":"2024-05-01T10:00:00+02:00","msg":"a"}` + "\n\n" + `{"time":"2024-05-01T10:01:30.5+02:00","msg":"b"}` + "\n"
+
+		var out bytes.Buffer
+		res, err := Replay(&out, strings.NewReader(recorded), 0)
+		assertError(t, nil, err)
+		assert(t, "2024/05/01 10:00:00 a\n2024/05/01 10:01:30 b\n", out.String())
+		assert(t, ReplayResult{Lines: 2, Took: 90*time.Second + 500*time.Millisecond}, res)
+	})
+
+	t.Run("waits with a speed", func(t *testing.T) {
+		recorded := `{"time":"2024-05-01T10:00:00Z","msg":"a"}` + "\n" + `{"time":"2024-05-01T10:00:01Z","msg":"b"}` + "\n"
+
+		start := time.Now()
+		_, err := Replay(&bytes.Buffer{}, strings.NewReader(recorded), 20)
+		assertError(t, nil, err)
+		if took := time.Since(start); took < 50*time.Millisecond {
+			t.Errorf("want at least 50ms, took %s", took)
+		}
+	})
+
+	t.Run("with a text log", func(t *testing.T) {
+		_, err := Replay(&bytes.Buffer{}, strings.NewReader("2024/05/01 10:00:00 a\n"), 0)
+		if !errors.Is(err, ErrBadLogLine) {
+			t.Errorf("want %v, got %v", ErrBadLogLine, err)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package mirror
+
+import "time"
+
+const (
+	FlagNameAutoRerun  = "auto-rerun"
+	FlagUsageAutoRerun = "run what is left again up to this many times after a run that failed or ignored errors, with a pause of 1m, 2m, 4m and so on up to 1h before each rerun, reruns only handle items of the first plan"
+	RerunFirstDelay    = time.Minute
+	RerunMaxDelay      = time.Hour
+)
+
+// RerunDelay returns the pause before rerun n, counted from 1. It doubles with every rerun up to RerunMaxDelay
+func RerunDelay(n int) time.Duration {
+	delay := RerunFirstDelay
+	for i := 1; i < n && delay < RerunMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > RerunMaxDelay {
+		return RerunMaxDelay
+	}
+	return delay
+}
+
+// RemainingPlan returns the items of now, the plan of a scan after a run, that are in first, the plan of that run,
+// so a rerun doesn't handle anything that first didn't have, and the part files of now. Sizes are the ones of now
+func RemainingPlan(first, now SyncPlan) SyncPlan {
+	var p SyncPlan
+	p.MissingFolders = commonFolders(first.MissingFolders, now.MissingFolders)
+	p.FoldersToClean = commonFolders(first.FoldersToClean, now.FoldersToClean)
+	p.MissingFiles, p.CopySize = commonFiles(first.MissingFiles, now.MissingFiles)
+	p.FilesToClean, p.CleanSize = commonFiles(first.FilesToClean, now.FilesToClean)
+	p.MissingLinks = commonLinks(first.MissingLinks, now.MissingLinks)
+	p.LinksToClean = commonLinks(first.LinksToClean, now.LinksToClean)
+	p.HardLinks = commonHardLinks(first, now.HardLinks)
+	p.Renames = commonRenames(first.Renames, now.Renames)
+	// what failed copies of the run left behind
+	p.StaleParts = now.StaleParts
+	return p
+}
+
+func commonFolders(first, now Folder) Folder {
+	res := make(Folder)
+	for folder := range now {
+		if _, ok := first[folder]; ok {
+			res[folder] = struct{}{}
+		}
+	}
+	return res
+}
+
+func commonFiles(first, now File) (res File, size int64) {
+	res = make(File)
+	for file, s := range now {
+		if _, ok := first[file]; ok {
+			res[file] = s
+			size += s
+		}
+	}
+	return
+}
+
+func commonLinks(first, now Links) Links {
+	res := make(Links)
+	for link, target := range now {
+		if _, ok := first[link]; ok {
+			res[link] = target
+		}
+	}
+	return res
+}
+
+// commonHardLinks keeps the hard links of now that first made or copied, a file whose copy failed can be linked to a
+// file of its group that got copied
+func commonHardLinks(first SyncPlan, now HardLinks) HardLinks {
+	res := make(HardLinks)
+	for file, target := range now {
+		_, linked := first.HardLinks[file]
+		_, copied := first.MissingFiles[file]
+		if linked || copied {
+			res[file] = target
+		}
+	}
+	return res
+}
+
+func commonRenames(first, now Renames) Renames {
+	res := make(Renames)
+	for file, old := range now {
+		if _, ok := first[file]; ok {
+			res[file] = old
+		}
+	}
+	return res
+}
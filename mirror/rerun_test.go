@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRerunDelay(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{n: 1, want: time.Minute},
+		{n: 2, want: 2 * time.Minute},
+		{n: 3, want: 4 * time.Minute},
+		{n: 6, want: 32 * time.Minute},
+		{n: 7, want: time.Hour},
+		{n: 100, want: time.Hour},
+	}
+	for _, test := range tests {
+		assert(t, test.want, RerunDelay(test.n))
+	}
+}
+
+func TestRemainingPlan(t *testing.T) {
+	first := SyncPlan{
+		MissingFolders: Folder{"a": {}, "b": {}},
+		MissingFiles:   File{"a/1": 1, "b/2": 2, "3": 3},
+		CopySize:       6,
+		FoldersToClean: Folder{"old": {}},
+		FilesToClean:   File{"old/1": 1, "4": 4},
+		CleanSize:      5,
+		MissingLinks:   Links{"l": "a"},
+		LinksToClean:   Links{},
+		HardLinks:      HardLinks{"h": "a/1"},
+		Renames:        Renames{"r": "old/r"},
+	}
+	now := SyncPlan{
+		MissingFolders: Folder{"b": {}, "new": {}},
+		MissingFiles:   File{"b/2": 5, "new/1": 1},
+		CopySize:       6,
+		FoldersToClean: Folder{},
+		FilesToClean:   File{"4": 4, "extra": 1},
+		CleanSize:      5,
+		MissingLinks:   Links{"l": "b", "new/l": "a"},
+		LinksToClean:   Links{"extra-l": "a"},
+		// 3 was copied in the first run, so it may be linked in the rerun
+		HardLinks: HardLinks{"h": "a/1", "3": "b/2", "new/h": "b/2"},
+		Renames:   Renames{"r": "moved/r", "new/r": "extra"},
+	}
+
+	assert(t, SyncPlan{
+		MissingFolders: Folder{"b": {}},
+		MissingFiles:   File{"b/2": 5},
+		CopySize:       5,
+		FoldersToClean: Folder{},
+		FilesToClean:   File{"4": 4},
+		CleanSize:      4,
+		MissingLinks:   Links{"l": "b"},
+		LinksToClean:   Links{},
+		HardLinks:      HardLinks{"h": "a/1", "3": "b/2"},
+		Renames:        Renames{"r": "moved/r"},
+	}, RemainingPlan(first, now))
+
+	assert(t, true, RemainingPlan(first, SyncPlan{}).Empty())
+}
@@ -0,0 +1,114 @@
+package mirror
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+const (
+	ResumePlanFile    = "resume.json"
+	ResumeJournalFile = "resume.journal"
+	FlagNameResume    = "resume"
+	FlagUsageResume   = "save the plan and finished items, so a restarted run continues without scanning and questions"
+)
+
+// ResumePlan is what a run with the -resume flag is going to do
+type ResumePlan struct {
+	// Schema is SchemaResumePlan, SaveResumePlan sets it
+	Schema       int    `json:"schema"`
+	Src          string `json:"src"`
+	Dst          string `json:"dst"`
+	CleaningMode bool   `json:"cleaningMode"`
+	Folders      Folder `json:"folders"`
+	Files        File   `json:"files"`
+	TotalSize    int64  `json:"totalSize"`
+	// HardLinks are made after Files, see PlanHardLinks
+	HardLinks HardLinks `json:"hardLinks,omitempty"`
+	// MissingLinks are made and LinksToClean removed with the -links flag
+	MissingLinks Links `json:"missingLinks,omitempty"`
+	LinksToClean Links `json:"linksToClean,omitempty"`
+	// StaleParts are the part files of earlier runs that the scan found, see StaleParts
+	StaleParts []string `json:"staleParts,omitempty"`
+}
+
+// SaveResumePlan writes p into ResumePlanFile and empties ResumeJournalFile
+func SaveResumePlan(p ResumePlan) error {
+	p.Schema = SchemaResumePlan
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(ResumePlanFile, data, FilePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(ResumeJournalFile, nil, FilePerm)
+}
+
+// LoadResumePlan returns the saved plan without items that are in ResumeJournalFile. The part files that the
+// interrupted run left in dst are added to StaleParts, so they're removed too. It returns false if there is no plan
+// or if the plan is for other folders or another mode. A plan of an older version is migrated, see decodeVersioned
+func LoadResumePlan(src, dst string, cleaningMode bool) (p ResumePlan, ok bool, err error) {
+	data, err := os.ReadFile(ResumePlanFile)
+	if os.IsNotExist(err) {
+		return p, false, nil
+	}
+	if err != nil {
+		return
+	}
+	if err = decodeVersioned(data, resumePlanSchema, &p); err != nil {
+		return
+	}
+	if p.Src != src || p.Dst != dst || p.CleaningMode != cleaningMode {
+		return ResumePlan{}, false, nil
+	}
+
+	if err = p.dropFinished(); err != nil {
+		return
+	}
+	if !p.CleaningMode {
+		p.StaleParts = append(p.StaleParts, leftParts(dst, p.Files)...)
+	}
+	return p, true, nil
+}
+
+// dropFinished removes the items that are in ResumeJournalFile from p
+func (p *ResumePlan) dropFinished() error {
+	f, err := os.Open(ResumeJournalFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		path := scanner.Text()
+		delete(p.Folders, path)
+		if size, found := p.Files[path]; found {
+			p.TotalSize -= size
+			delete(p.Files, path)
+		}
+		delete(p.HardLinks, path)
+		delete(p.MissingLinks, path)
+		delete(p.LinksToClean, path)
+	}
+	return scanner.Err()
+}
+
+// OpenResumeJournal opens ResumeJournalFile for appending, it can be used as Options.Journal
+func OpenResumeJournal() (*os.File, error) {
+	return os.OpenFile(ResumeJournalFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, FilePerm)
+}
+
+// RemoveResumeState removes ResumePlanFile and ResumeJournalFile after a finished run
+func RemoveResumeState() error {
+	for _, path := range []string{ResumePlanFile, ResumeJournalFile} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
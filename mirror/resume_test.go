@@ -0,0 +1,148 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumePlan(t *testing.T) {
+	defer RemoveResumeState()
+
+	p := ResumePlan{Src: "src", Dst: "dst", Folders: Folder{"a": {}, "b": {}}, Files: File{"a/1": 1, "b/2": 2}, TotalSize: 3}
+	err := SaveResumePlan(p)
+	assertError(t, nil, err)
+
+	journal, err := OpenResumeJournal()
+	assertError(t, nil, err)
+	opts := &Options{Journal: journal}
+	opts.journal("a")
+	opts.journal("a/1")
+	assertError(t, nil, journal.Close())
+
+	t.Run("the same run", func(t *testing.T) {
+		got, ok, err := LoadResumePlan("src", "dst", false)
+		assertError(t, nil, err)
+		assert(t, true, ok)
+		assert(t, ResumePlan{Schema: SchemaResumePlan, Src: "src", Dst: "dst", Folders: Folder{"b": {}}, Files: File{"b/2": 2}, TotalSize: 2}, got)
+	})
+
+	t.Run("another run", func(t *testing.T) {
+		_, ok, err := LoadResumePlan("src", "dst", true)
+		assertError(t, nil, err)
+		assert(t, false, ok)
+	})
+
+	t.Run("without a saved plan", func(t *testing.T) {
+		err := RemoveResumeState()
+		assertError(t, nil, err)
+		_, ok, err := LoadResumePlan("src", "dst", false)
+		assertError(t, nil, err)
+		assert(t, false, ok)
+	})
+}
+
+func TestResumePlanHardLinks(t *testing.T) {
+	if !hardLinksSupported {
+		t.Skip(ErrHardLinksUnsupported)
+	}
+	discardLog(t)
+	defer RemoveResumeState()
+	src, dst := t.TempDir(), t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a"), []byte("data"), FilePerm))
+	if err := os.Link(filepath.Join(src, "a"), filepath.Join(src, "b")); err != nil {
+		t.Skip("can't make hard links:", err)
+	}
+
+	files := File{"a": 4, "b": 4}
+	groups, err := HardLinkGroups(OSFS(src), files, &Options{})
+	assertError(t, nil, err)
+	links := PlanHardLinks(groups, files)
+	assertError(t, nil, SaveResumePlan(ResumePlan{Src: src, Dst: dst, Files: files, TotalSize: 4, HardLinks: links}))
+
+	// the run is interrupted after it copied a, before it made the link
+	journal, err := OpenResumeJournal()
+	assertError(t, nil, err)
+	opts := &Options{LogPath: os.DevNull, Journal: journal}
+	assertError(t, nil, CopyFiles(files, 4, src, dst, opts))
+	assertError(t, nil, journal.Close())
+
+	p, ok, err := LoadResumePlan(src, dst, false)
+	assertError(t, nil, err)
+	assert(t, true, ok)
+	assert(t, File{}, p.Files)
+	assert(t, HardLinks{"b": "a"}, p.HardLinks)
+
+	assertError(t, nil, MakeHardLinks(p.HardLinks, dst, &Options{LogPath: os.DevNull}))
+	a, err := os.Stat(filepath.Join(dst, "a"))
+	assertError(t, nil, err)
+	b, err := os.Stat(filepath.Join(dst, "b"))
+	assertError(t, nil, err)
+	assert(t, true, os.SameFile(a, b))
+}
+
+func TestResumePlanLinks(t *testing.T) {
+	defer RemoveResumeState()
+
+	p := ResumePlan{Src: "src", Dst: "dst", Folders: Folder{}, Files: File{}, MissingLinks: Links{"l1": "a", "l2": "b"}}
+	assertError(t, nil, SaveResumePlan(p))
+
+	journal, err := OpenResumeJournal()
+	assertError(t, nil, err)
+	(&Options{Journal: journal}).journal("l1")
+	assertError(t, nil, journal.Close())
+
+	got, ok, err := LoadResumePlan("src", "dst", false)
+	assertError(t, nil, err)
+	assert(t, true, ok)
+	assert(t, Links{"l2": "b"}, got.MissingLinks)
+
+	// a plan of an older version is migrated
+	old := `{"schema":1,"src":"src","dst":"dst","cleaningMode":true,"folders":{},"files":{"a":1},"totalSize":1}`
+	assertError(t, nil, os.WriteFile(ResumePlanFile, []byte(old), FilePerm))
+	assertError(t, nil, os.WriteFile(ResumeJournalFile, nil, FilePerm))
+	got, ok, err = LoadResumePlan("src", "dst", true)
+	assertError(t, nil, err)
+	assert(t, true, ok)
+	assert(t, ResumePlan{Schema: SchemaResumePlan, Src: "src", Dst: "dst", CleaningMode: true, Folders: Folder{}, Files: File{"a": 1}, TotalSize: 1}, got)
+}
+
+func TestResumePlanStaleParts(t *testing.T) {
+	defer RemoveResumeState()
+	dst := t.TempDir()
+
+	p := ResumePlan{Src: "src", Dst: dst, Folders: Folder{}, Files: File{"a": 1, "b": 1, "c": 1}, StaleParts: []string{"old" + PartSuffix}}
+	assertError(t, nil, SaveResumePlan(p))
+	// the run was interrupted while it copied b, a part of a finished file can't be left
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "b"+PartSuffix), []byte("b"), FilePerm))
+	journal, err := OpenResumeJournal()
+	assertError(t, nil, err)
+	(&Options{Journal: journal}).journal("a")
+	assertError(t, nil, journal.Close())
+
+	got, ok, err := LoadResumePlan("src", dst, false)
+	assertError(t, nil, err)
+	assert(t, true, ok)
+	assert(t, []string{"old" + PartSuffix, "b" + PartSuffix}, got.StaleParts)
+}
+
+func TestCopyFilesJournal(t *testing.T) {
+	makeTestFolders(t)
+
+	journal, err := os.CreateTemp(t.TempDir(), "journal")
+	assertError(t, nil, err)
+	err = CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest, &Options{Journal: journal})
+	assertError(t, nil, err)
+	assertError(t, nil, journal.Close())
+
+	data, err := os.ReadFile(journal.Name())
+	assertError(t, nil, err)
+	var want string
+	for _, file := range sortFoldersOrFiles(missingFiles) {
+		want += fmt.Sprintln(file)
+	}
+	assert(t, want, string(data))
+
+	cleanTestFolders(t)
+}
@@ -0,0 +1,76 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"time"
+)
+
+const (
+	FlagNameRetries    = "retries"
+	FlagNameRetryWait  = "retry-wait"
+	FlagUsageRetries   = "how many times opening, copying or removing an item is tried again before its error counts, which helps with network shares that drop out and files that an antivirus holds for a moment"
+	FlagUsageRetryWait = "wait before the first retry of an item, it doubles with every next one up to " + maxRetryWaitText
+	DefaultRetryWait   = time.Second
+	MsgRetrying        = "trying %s again in %v, attempt %d of %d failed: %v"
+	// maxRetryWait caps the doubled waits, so a high -retries doesn't wait for hours
+	maxRetryWait     = 5 * time.Minute
+	maxRetryWaitText = "5m"
+)
+
+// retryable returns true for errors of the system, which can go away on their own. A missing item is gone, and the
+// errors of the program itself, e.g. an infected file, come out the same every time
+func retryable(err error) bool {
+	var custom CustomErr
+	var p *WorkerPanic
+	return err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.As(err, &custom) && !errors.As(err, &p)
+}
+
+// retry returns true once it waited for the next try of path, whose attempt (from 0) failed with err, msg says so. It
+// returns false and no msg if there is to be no next try: err is nil or isn't retryable, o.Retries are used up or the
+// run is stopped, also while waiting. It doesn't log, workers call it too, see copyResult.retried
+func (o *Options) retry(attempt int, path string, err error) (msg string, again bool) {
+	if attempt >= o.Retries || !retryable(err) || o.stopped() {
+		return "", false
+	}
+	wait := o.RetryWait
+	for i := 0; i < attempt && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	if !o.wait(wait) {
+		return "", false
+	}
+	return fmt.Sprintf(MsgRetrying, path, wait, attempt+1, o.Retries+1, err), true
+}
+
+// wait returns true after d, or false once the run is stopped
+func (o *Options) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-o.Stop:
+		return false
+	}
+}
+
+// withRetries runs op on path until it succeeds or retry gives up, and returns its last error. It logs the retries,
+// so it's only for the goroutine that logs
+func (o *Options) withRetries(path string, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		msg, again := o.retry(attempt, path, err)
+		if msg != "" {
+			log.Println(msg)
+		}
+		if !again {
+			return err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	assert(t, false, retryable(nil))
+	assert(t, true, retryable(errors.New("the share dropped out")))
+	assert(t, true, retryable(&fs.PathError{Op: "open", Path: "f", Err: fs.ErrPermission}))
+	assert(t, false, retryable(&fs.PathError{Op: "open", Path: "f", Err: fs.ErrNotExist}))
+	assert(t, false, retryable(fmt.Errorf("%w %s", ErrInfected, "f")))
+	assert(t, false, retryable(&WorkerPanic{Value: "boom"}))
+}
+
+func TestWithRetries(t *testing.T) {
+	failing := func(fails int, err error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= fails {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+	locked := errors.New("locked")
+
+	t.Run("succeeds", func(t *testing.T) {
+		op, calls := failing(2, locked)
+		opts := &Options{Retries: 3, RetryWait: time.Millisecond}
+		start := time.Now()
+		assertError(t, nil, opts.withRetries("f", op))
+		assert(t, 3, *calls)
+		// 1ms and then 2ms
+		if took := time.Since(start); took < 3*time.Millisecond {
+			t.Errorf("the retries waited only %v", took)
+		}
+	})
+
+	t.Run("message", func(t *testing.T) {
+		opts := &Options{Retries: 2, RetryWait: time.Millisecond}
+		msg, again := opts.retry(1, "f", locked)
+		assert(t, true, again)
+		assert(t, fmt.Sprintf(MsgRetrying, "f", 2*time.Millisecond, 2, 3, locked), msg)
+		msg, again = opts.retry(2, "f", locked)
+		assert(t, false, again)
+		assert(t, "", msg)
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		op, calls := failing(5, locked)
+		assertError(t, locked, (&Options{Retries: 2}).withRetries("f", op))
+		assert(t, 3, *calls)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		op, calls := failing(5, ErrInfected)
+		assertError(t, ErrInfected, (&Options{Retries: 2}).withRetries("f", op))
+		assert(t, 1, *calls)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		close(stop)
+		op, calls := failing(5, locked)
+		assertError(t, locked, (&Options{Retries: 2, RetryWait: time.Hour, Stop: stop}).withRetries("f", op))
+		assert(t, 1, *calls)
+	})
+
+	t.Run("stopped while waiting", func(t *testing.T) {
+		stop := make(chan struct{})
+		time.AfterFunc(10*time.Millisecond, func() { close(stop) })
+		msg, again := (&Options{Retries: 2, RetryWait: time.Hour, Stop: stop}).retry(0, "f", locked)
+		assert(t, false, again)
+		assert(t, "", msg)
+	})
+}
@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ScanPolicySkip       = "skip"
+	ScanPolicyQuarantine = "quarantine"
+	ScanPolicyAbort      = "abort"
+	ErrInfected          = CustomErr("the scanner found an infected file:")
+	ErrUnknownScanPolicy = CustomErr("unknown scan policy")
+	ErrNoQuarantine      = CustomErr("the quarantine policy needs the -quarantine flag")
+	LogInfected          = "infected, %s: "
+	// scanExitInfected is the exit code of scanners like clamscan and clamdscan when they find a virus
+	scanExitInfected = 1
+)
+
+// VetScanPolicy checks if policy is known and if it has everything it needs
+func VetScanPolicy(policy, quarantine string) error {
+	switch policy {
+	case ScanPolicySkip, ScanPolicyAbort:
+		return nil
+	case ScanPolicyQuarantine:
+		if quarantine == "" {
+			return ErrNoQuarantine
+		}
+		return nil
+	default:
+		return ErrUnknownScanPolicy
+	}
+}
+
+// scanFile runs the scan command with path as the last argument. Exit code 1 means that the file is infected,
+// other non-zero exit codes are errors of the scanner
+func scanFile(command, path string) (infected bool, err error) {
+	args := append(strings.Fields(command), path)
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == scanExitInfected {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(out)))
+	}
+	return false, nil
+}
+
+// scanCopied scans path, where file was copied to, and deals with it according to opts.ScanPolicy if it's infected.
+// A file that couldn't be scanned is removed. The caller reports infected files, see CopyFiles
+func scanCopied(file, path string, opts *Options) (infected bool, err error) {
+	infected, err = scanFile(opts.ScanCmd, path)
+	if err != nil {
+		if errR := os.Remove(path); errR != nil {
+			return false, errR
+		}
+		return false, err
+	}
+	if !infected {
+		return false, nil
+	}
+
+	if opts.ScanPolicy == ScanPolicyQuarantine {
+		return true, moveFile(path, filepath.Join(opts.Quarantine, file))
+	}
+
+	if err = os.Remove(path); err != nil {
+		return true, err
+	}
+	if opts.ScanPolicy == ScanPolicyAbort {
+		return true, fmt.Errorf("%w %s", ErrInfected, file)
+	}
+	return true, nil
+}
+
+// moveFile makes parent folders of dst and moves src there, see renameOrCopy
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), FolderPerm); err != nil {
+		return err
+	}
+	return renameOrCopy(src, dst)
+}
+
+// renameOrCopy renames src to dst. If renaming isn't possible, e.g. because src and dst are on different devices,
+// it copies the file with its extended attributes and permissions and removes src
+func renameOrCopy(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if _, err = copyFile(src, dst); err != nil {
+		return err
+	}
+	// src is a part file, so it only has the attributes that -xattrs gave it
+	if xattrsSupported {
+		if _, err = copyXattrs(src, dst); err != nil {
+			return err
+		}
+	}
+	if err = copyPerm(info, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
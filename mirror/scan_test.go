@@ -0,0 +1,104 @@
+package mirror
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// scannerScript flags files that contain "dd" and fails on files that contain "n"
+const scannerScript = "#!/bin/sh\ngrep -q dd \"$1\" && exit 1\ngrep -q n \"$1\" && exit 2\nexit 0\n"
+
+func TestVetScanPolicy(t *testing.T) {
+	tests := []struct {
+		policy, quarantine string
+		want               error
+	}{
+		{ScanPolicySkip, "", nil},
+		{ScanPolicyAbort, "", nil},
+		{ScanPolicyQuarantine, "q", nil},
+		{ScanPolicyQuarantine, "", ErrNoQuarantine},
+		{"delete", "", ErrUnknownScanPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			assertError(t, tt.want, VetScanPolicy(tt.policy, tt.quarantine))
+		})
+	}
+}
+
+func TestCopyFilesScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test scanner is a shell script")
+	}
+
+	scanner := filepath.Join(t.TempDir(), "scanner")
+	err := ioutil.WriteFile(scanner, []byte(scannerScript), 0755)
+	assertError(t, nil, err)
+
+	infected := filepath.Join("same_1/_different")
+	clean := File{"_same_1": 1, infected: 2}
+
+	t.Run("skip", func(t *testing.T) {
+		makeTestFolders(t)
+
+		opts := &Options{ScanCmd: scanner, ScanPolicy: ScanPolicySkip}
+		err := CopyFiles(clean, 3, srcPathTest, dstPathTest, opts)
+		assertError(t, nil, err)
+		assert(t, []string{infected}, opts.Report.Infected)
+
+		// the infected copy never replaces the file that dst had
+		content, err := ioutil.ReadFile(filepath.Join(dstPathTest, infected))
+		assertError(t, nil, err)
+		assert(t, "d", string(content))
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		makeTestFolders(t)
+
+		quarantine := t.TempDir()
+		opts := &Options{ScanCmd: scanner, ScanPolicy: ScanPolicyQuarantine, Quarantine: quarantine}
+		err := CopyFiles(clean, 3, srcPathTest, dstPathTest, opts)
+		assertError(t, nil, err)
+
+		content, err := ioutil.ReadFile(filepath.Join(dstPathTest, infected))
+		assertError(t, nil, err)
+		assert(t, "d", string(content))
+		content, err = ioutil.ReadFile(filepath.Join(quarantine, infected))
+		assertError(t, nil, err)
+		assert(t, "dd", string(content))
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		makeTestFolders(t)
+
+		err := CopyFiles(clean, 3, srcPathTest, dstPathTest, &Options{ScanCmd: scanner, ScanPolicy: ScanPolicyAbort})
+		if !errors.Is(err, ErrInfected) {
+			t.Errorf("wanted ErrInfected, but got %q", err)
+		}
+
+		cleanTestFolders(t)
+	})
+
+	t.Run("scanner error", func(t *testing.T) {
+		makeTestFolders(t)
+
+		files := File{filepath.Join("same_1/same_2/_not_in_dst"): 1}
+		err := CopyFiles(files, 1, srcPathTest, dstPathTest, &Options{ScanCmd: scanner, ScanPolicy: ScanPolicySkip})
+		if err == nil {
+			t.Error("wanted an error of the scanner")
+		}
+		_, err = os.Stat(filepath.Join(dstPathTest, "same_1/same_2/_not_in_dst"))
+		assert(t, true, os.IsNotExist(err))
+
+		cleanTestFolders(t)
+	})
+}
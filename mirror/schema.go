@@ -0,0 +1,98 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// SchemaResumePlan, SchemaManifest, SchemaAudit and SchemaLogLine are the versions of the JSON that the program
+	// writes into the "schema" field of a resume plan, a CAS manifest, an audit record and a line of the JSON log.
+	// A version goes up when a field is renamed, removed or changes its meaning, or when a new field mustn't be
+	// ignored by older versions. Documents of older versions are migrated when they're read, files without the field
+	// are version 0
+	SchemaResumePlan = 3
+	SchemaManifest   = 1
+	SchemaAudit      = 1
+	SchemaLogLine    = 1
+	ErrSchemaTooNew  = CustomErr("the file was written by a newer version of the program, unknown schema version")
+	ErrSchemaInvalid = CustomErr("the file doesn't match its schema:")
+	schemaField      = "schema"
+)
+
+// schema describes one kind of JSON document that the program writes and reads again, see decodeVersioned
+type schema struct {
+	name    string
+	version int
+	// migrations[v] turns a document of version v into one of version v+1, there is one for every older version
+	migrations []func(doc map[string]json.RawMessage) error
+	// required are the fields that a document of the current version must have
+	required []string
+}
+
+var (
+	resumePlanSchema = schema{name: "resume plan", version: SchemaResumePlan, migrations: []func(map[string]json.RawMessage) error{migrateUnversioned, migrateResumePlan1, migrateResumePlan2},
+		required: []string{"src", "dst", "cleaningMode", "folders", "files", "totalSize"}}
+	manifestSchema = schema{name: "manifest", version: SchemaManifest, migrations: []func(map[string]json.RawMessage) error{migrateUnversioned},
+		required: []string{"time", "folders", "files"}}
+	logLineSchema = schema{name: "log line", version: SchemaLogLine, migrations: []func(map[string]json.RawMessage) error{migrateUnversioned},
+		required: []string{"time", "msg"}}
+)
+
+// migrateUnversioned migrates documents that were written before versions were, their fields are the ones of
+// version 1
+func migrateUnversioned(map[string]json.RawMessage) error {
+	return nil
+}
+
+// migrateResumePlan1 migrates resume plans of version 1, which had no hard links. Version 2 added them, so older
+// versions refuse a plan whose links they would skip
+func migrateResumePlan1(map[string]json.RawMessage) error {
+	return nil
+}
+
+// migrateResumePlan2 migrates resume plans of version 2, which had no symlinks. Version 3 added them
+func migrateResumePlan2(map[string]json.RawMessage) error {
+	return nil
+}
+
+// decodeVersioned checks the version of the JSON document in data, migrates it to the current version of s, checks
+// that it has the required fields and decodes it into v
+func decodeVersioned(data []byte, s schema, v interface{}) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrSchemaInvalid, s.name, err)
+	}
+
+	var version int
+	if raw, ok := doc[schemaField]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 0 {
+			return fmt.Errorf("%w %s: bad %q field", ErrSchemaInvalid, s.name, schemaField)
+		}
+	}
+	if version > s.version {
+		return fmt.Errorf("%w %d of a %s, the latest known is %d", ErrSchemaTooNew, version, s.name, s.version)
+	}
+
+	for ; version < s.version; version++ {
+		if err := s.migrations[version](doc); err != nil {
+			return err
+		}
+	}
+	doc[schemaField] = json.RawMessage(fmt.Sprint(s.version))
+
+	for _, field := range s.required {
+		if _, ok := doc[field]; !ok {
+			return fmt.Errorf("%w %s: no %q field", ErrSchemaInvalid, s.name, field)
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrSchemaInvalid, s.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package mirror
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeVersioned(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{name: "current", data: `{"schema":1,"time":"2024-05-01T10:00:00Z","msg":"a"}`},
+		{name: "unversioned", data: `{"time":"2024-05-01T10:00:00Z","msg":"a"}`},
+		{name: "too new", data: `{"schema":2,"time":"2024-05-01T10:00:00Z","msg":"a"}`, err: ErrSchemaTooNew},
+		{name: "bad version", data: `{"schema":"1","time":"2024-05-01T10:00:00Z","msg":"a"}`, err: ErrSchemaInvalid},
+		{name: "missing field", data: `{"schema":1,"time":"2024-05-01T10:00:00Z"}`, err: ErrSchemaInvalid},
+		{name: "not an object", data: `[]`, err: ErrSchemaInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var line jsonLine
+			err := decodeVersioned([]byte(test.data), logLineSchema, &line)
+			if test.err != nil {
+				assert(t, true, errors.Is(err, test.err))
+				return
+			}
+			assertError(t, nil, err)
+			assert(t, jsonLine{Schema: SchemaLogLine, Time: "2024-05-01T10:00:00Z", Msg: "a"}, line)
+		})
+	}
+
+	// every older version has a migration
+	for _, s := range []schema{resumePlanSchema, manifestSchema, logLineSchema} {
+		assert(t, s.version, len(s.migrations))
+	}
+}
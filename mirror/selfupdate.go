@@ -0,0 +1,300 @@
+package mirror
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CmdSelfUpdate           = "self-update"
+	FlagNameReleaseURL      = "url"
+	FlagNameReleaseKey      = "key"
+	FlagNameCheck           = "check"
+	FlagNameInsecure        = "insecure"
+	FlagUsageReleaseURL     = "URL of the release manifest, the one the program was built with by default"
+	FlagUsageReleaseKey     = "hex encoded ed25519 public key that signs the release manifest, the one the program was built with by default"
+	FlagUsageCheck          = "only print whether there is another release"
+	FlagUsageInsecure       = "update without a release key, the manifest and so the binary aren't checked for who made them"
+	SchemaRelease           = 1
+	ReleaseSignatureSuffix  = ".sig"
+	ErrSelfUpdateWrongArgs  = CustomErr("wrong arguments, use 'self-update -h' for help")
+	ErrNoReleaseURL         = CustomErr("the program was built without a release URL, use -" + FlagNameReleaseURL)
+	ErrBadReleaseKey        = CustomErr("the release key isn't a hex encoded ed25519 public key")
+	ErrNoReleaseKey         = CustomErr("the program was built without a release key, use -" + FlagNameReleaseKey + " or -" + FlagNameInsecure)
+	ErrBadReleaseVersion    = CustomErr("the release has a version that isn't like 1.2.3:")
+	ErrReleaseStatus        = CustomErr("the release server responded with")
+	ErrBadReleaseSignature  = CustomErr("the signature of the release manifest doesn't match, it wasn't signed with the release key:")
+	ErrNoReleaseFile        = CustomErr("the release has no binary for")
+	ErrReleaseFileCorrupted = CustomErr("the downloaded binary doesn't match the checksum of the release:")
+	MsgReleaseUnsigned      = "no release key is known, the binary is only checked against the checksum in the manifest"
+	MsgOlderRelease         = "version %s is released, it's older than %s and isn't installed\n"
+	releaseTimeout          = 10 * time.Minute
+	releaseNewSuffix        = ".new"
+	releaseOldSuffix        = ".old"
+	releasePerm             = 0755
+	releaseManifestMaxSize  = 1 << 20
+)
+
+// Version, ReleaseURL and ReleaseKey are set when a release is built, e.g. with
+// -ldflags "-X mirror/mirror.Version=1.2.0". ReleaseKey is the hex encoded ed25519 public key that signs the release
+// manifests at ReleaseURL, see CheckRelease
+var (
+	Version    = "dev"
+	ReleaseURL = ""
+	ReleaseKey = ""
+)
+
+// Release is the manifest of a release. It's signed by the release key, the signature is next to it, with
+// ReleaseSignatureSuffix
+type Release struct {
+	// Schema is SchemaRelease
+	Schema  int    `json:"schema"`
+	Version string `json:"version"`
+	// Files maps GOOS/GOARCH to the binary for it
+	Files map[string]ReleaseFile `json:"files"`
+}
+
+// ReleaseFile is the binary of a release for one system
+type ReleaseFile struct {
+	URL string `json:"url"`
+	// SHA256 is the hex encoded hash of the binary
+	SHA256 string `json:"sha256"`
+}
+
+var releaseSchema = schema{name: "release manifest", version: SchemaRelease, migrations: []func(map[string]json.RawMessage) error{migrateUnversioned},
+	required: []string{"version", "files"}}
+
+// VetSelfUpdateFlags parses flags of the self-update subcommand. url and key are ReleaseURL and ReleaseKey if the
+// flags aren't given. Without a key the binary is only installed with -insecure
+func VetSelfUpdateFlags(args []string) (url, key string, check bool, err error) {
+	var insecure bool
+	fs := flag.NewFlagSet(CmdSelfUpdate, flag.ExitOnError)
+	fs.StringVar(&url, FlagNameReleaseURL, ReleaseURL, FlagUsageReleaseURL)
+	fs.StringVar(&key, FlagNameReleaseKey, ReleaseKey, FlagUsageReleaseKey)
+	fs.BoolVar(&check, FlagNameCheck, false, FlagUsageCheck)
+	fs.BoolVar(&insecure, FlagNameInsecure, false, FlagUsageInsecure)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if fs.NArg() > 0 {
+		err = ErrSelfUpdateWrongArgs
+	} else if url == "" {
+		err = ErrNoReleaseURL
+	} else if key == "" && !check && !insecure {
+		err = ErrNoReleaseKey
+	}
+	return
+}
+
+// CheckRelease downloads the release manifest from url. If key isn't empty, the manifest must have a signature made
+// with it at url + ReleaseSignatureSuffix
+func CheckRelease(url, key string) (r Release, err error) {
+	var pub ed25519.PublicKey
+	if key != "" {
+		if pub, err = hex.DecodeString(key); err != nil || len(pub) != ed25519.PublicKeySize {
+			return r, ErrBadReleaseKey
+		}
+	}
+
+	client := http.Client{Timeout: PingTimeout}
+	data, err := download(client, url)
+	if err != nil {
+		return
+	}
+	if pub != nil {
+		sig, errS := download(client, url+ReleaseSignatureSuffix)
+		if errS != nil {
+			return r, errS
+		}
+		if sig, errS = hex.DecodeString(strings.TrimSpace(string(sig))); errS != nil || !ed25519.Verify(pub, data, sig) {
+			return r, fmt.Errorf("%w %q", ErrBadReleaseSignature, url)
+		}
+	}
+
+	err = decodeVersioned(data, releaseSchema, &r)
+	return
+}
+
+// Newer returns true if r is a later version than current. Versions are like 1.2.3, with an optional v before and
+// -pre-release and +build after them, which compare like in semantic versioning. A current version that isn't like
+// that, e.g. the "dev" of a build without a version, is older than every release
+func (r Release) Newer(current string) (bool, error) {
+	rv, ok := parseVersion(r.Version)
+	if !ok {
+		return false, fmt.Errorf("%w %q", ErrBadReleaseVersion, r.Version)
+	}
+	cv, ok := parseVersion(current)
+	if !ok {
+		return true, nil
+	}
+	return compareVersions(rv, cv) > 0, nil
+}
+
+// version is a parsed version, see Release.Newer
+type version struct {
+	core [3]int
+	pre  []string
+}
+
+func parseVersion(s string) (v version, ok bool) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if v.pre = strings.Split(s[i+1:], "."); s[i+1:] == "" {
+			return v, false
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > len(v.core) {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	return v, true
+}
+
+// compareVersions returns -1, 0 or 1 if a is older, the same or newer than b. A pre-release is older than its release
+func compareVersions(a, b version) int {
+	for i := range a.core {
+		if a.core[i] != b.core[i] {
+			return compareInts(a.core[i], b.core[i])
+		}
+	}
+	if len(a.pre) == 0 || len(b.pre) == 0 {
+		return compareInts(len(b.pre), len(a.pre))
+	}
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		if a.pre[i] == b.pre[i] {
+			continue
+		}
+		an, errA := strconv.Atoi(a.pre[i])
+		bn, errB := strconv.Atoi(b.pre[i])
+		switch {
+		case errA == nil && errB == nil:
+			return compareInts(an, bn)
+		// numbers are older than words
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case a.pre[i] < b.pre[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return compareInts(len(a.pre), len(b.pre))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// File returns the binary of r for the system that the program runs on
+func (r Release) File() (ReleaseFile, error) {
+	system := runtime.GOOS + "/" + runtime.GOARCH
+	f, ok := r.Files[system]
+	if !ok {
+		return f, fmt.Errorf("%w %s", ErrNoReleaseFile, system)
+	}
+	return f, nil
+}
+
+// SelfUpdate downloads the binary of r next to exe, checks its hash and puts it in place of exe. The previous binary
+// is removed, where a running one can't be (Windows), it stays with releaseOldSuffix until the next update
+func SelfUpdate(r Release, exe string) error {
+	file, err := r.File()
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: releaseTimeout}
+	resp, err := client.Get(file.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w %s", ErrReleaseStatus, resp.Status)
+	}
+
+	newPath, oldPath := exe+releaseNewSuffix, exe+releaseOldSuffix
+	h := sha256.New()
+	if _, err = writeFile(io.TeeReader(resp.Body, h), newPath, 0); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, file.SHA256) {
+		os.Remove(newPath)
+		return fmt.Errorf("%w %q", ErrReleaseFileCorrupted, file.URL)
+	}
+	if err = os.Chmod(newPath, releasePerm); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	// a running binary can be renamed everywhere, but not replaced or removed on Windows
+	os.Remove(oldPath)
+	if err = os.Rename(exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if err = os.Rename(newPath, exe); err != nil {
+		if errR := os.Rename(oldPath, exe); errR != nil {
+			return errR
+		}
+		return err
+	}
+	os.Remove(oldPath)
+	return nil
+}
+
+// Executable returns the path of the running binary without links, so SelfUpdate replaces the binary itself
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// download returns the body of a GET of url, which must be OK and small
+func download(client http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w %s", ErrReleaseStatus, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, releaseManifestMaxSize))
+}
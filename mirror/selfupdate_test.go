@@ -0,0 +1,122 @@
+package mirror
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assertError(t, nil, err)
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+
+	var manifest []byte
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/release.json", func(w http.ResponseWriter, r *http.Request) { w.Write(manifest) })
+	mux.HandleFunc("/release.json"+ReleaseSignatureSuffix, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, hex.EncodeToString(ed25519.Sign(priv, manifest)))
+	})
+	mux.HandleFunc("/mirror", func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+	setManifest := func(sha string) {
+		manifest = []byte(fmt.Sprintf(`{"schema":1,"version":"2.0.0","files":{%q:{"url":%q,"sha256":%q}}}`,
+			runtime.GOOS+"/"+runtime.GOARCH, srv.URL+"/mirror", sha))
+	}
+	setManifest(hex.EncodeToString(sum[:]))
+	url, key := srv.URL+"/release.json", hex.EncodeToString(pub)
+
+	exe := filepath.Join(t.TempDir(), "mirror")
+	assertError(t, nil, os.WriteFile(exe, []byte("old binary"), FilePerm))
+
+	r, err := CheckRelease(url, key)
+	assertError(t, nil, err)
+	assert(t, "2.0.0", r.Version)
+	assertError(t, nil, SelfUpdate(r, exe))
+	got, err := os.ReadFile(exe)
+	assertError(t, nil, err)
+	assert(t, string(binary), string(got))
+	_, err = os.Stat(exe + releaseOldSuffix)
+	assert(t, true, os.IsNotExist(err))
+
+	t.Run("another key", func(t *testing.T) {
+		other, _, err := ed25519.GenerateKey(nil)
+		assertError(t, nil, err)
+		_, err = CheckRelease(url, hex.EncodeToString(other))
+		assert(t, true, errors.Is(err, ErrBadReleaseSignature))
+		_, err = CheckRelease(url, "abc")
+		assertError(t, ErrBadReleaseKey, err)
+	})
+
+	t.Run("wrong checksum", func(t *testing.T) {
+		setManifest(hex.EncodeToString(make([]byte, sha256.Size)))
+		r, err := CheckRelease(url, key)
+		assertError(t, nil, err)
+		err = SelfUpdate(r, exe)
+		assert(t, true, errors.Is(err, ErrReleaseFileCorrupted))
+		_, err = os.Stat(exe + releaseNewSuffix)
+		assert(t, true, os.IsNotExist(err))
+	})
+
+	t.Run("no binary for the system", func(t *testing.T) {
+		err := SelfUpdate(Release{Version: "2.0.0"}, exe)
+		assert(t, true, errors.Is(err, ErrNoReleaseFile))
+	})
+}
+
+func TestVetSelfUpdateFlags(t *testing.T) {
+	url, _, check, err := VetSelfUpdateFlags([]string{"-" + FlagNameReleaseURL, "https://example.com/release.json", "-" + FlagNameCheck})
+	assertError(t, nil, err)
+	assert(t, "https://example.com/release.json", url)
+	assert(t, true, check)
+
+	_, _, _, err = VetSelfUpdateFlags(nil)
+	assertError(t, ErrNoReleaseURL, err)
+
+	release := []string{"-" + FlagNameReleaseURL, "https://example.com/release.json"}
+	_, _, _, err = VetSelfUpdateFlags(release)
+	assertError(t, ErrNoReleaseKey, err)
+	_, key, _, err := VetSelfUpdateFlags(append(release, "-"+FlagNameInsecure))
+	assertError(t, nil, err)
+	assert(t, "", key)
+}
+
+func TestReleaseNewer(t *testing.T) {
+	tests := []struct {
+		release, current string
+		want             bool
+	}{
+		{"1.2.0", "1.1.9", true},
+		{"1.10.0", "1.9.0", true},
+		{"v2.0.0", "1.9.9", true},
+		{"1.2.0", "1.2.0", false},
+		{"1.1.0", "1.2.0", false},
+		{"1.2", "1.2.0", false},
+		{"1.2.0", "1.2.0-rc.1", true},
+		{"1.2.0-rc.1", "1.2.0", false},
+		{"1.2.0-rc.10", "1.2.0-rc.9", true},
+		{"1.2.0-rc.1", "1.2.0-beta.2", true},
+		{"1.2.0+build.5", "1.2.0+build.4", false},
+		{"1.0.0", "dev", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.release+" "+tt.current, func(t *testing.T) {
+			got, err := Release{Version: tt.release}.Newer(tt.current)
+			assertError(t, nil, err)
+			assert(t, tt.want, got)
+		})
+	}
+
+	_, err := Release{Version: "latest"}.Newer("1.0.0")
+	assert(t, true, errors.Is(err, ErrBadReleaseVersion))
+}
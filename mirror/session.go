@@ -0,0 +1,43 @@
+package mirror
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	LogSession        = "questions and answers:"
+	LogSessionArgs    = "command line:"
+	formatSessionItem = "%s asked: %s\n%s answered: %q"
+)
+
+// Session notes the questions asked before a run and the answers they got, so the log file shows that a person
+// approved the run. The log file is emptied only once the questions are answered, see Write
+type Session struct {
+	// Args is the command line of the run, with the program name first
+	Args  []string
+	items []string
+}
+
+// Answer notes question, which was asked at asked, and the answer it got now
+func (s *Session) Answer(question string, asked time.Time, answer string) {
+	s.items = append(s.items, fmt.Sprintf(formatSessionItem, asked.Format(time.RFC3339), question, time.Now().Format(time.RFC3339), answer))
+}
+
+// Write appends the command line and the noted answers to the log file of opts. Answers are written only once,
+// later calls write the ones noted since
+func (s *Session) Write(opts *Options) error {
+	f, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(f, LogSession)
+	LogToFile(f, LogSessionArgs+" "+strings.Join(s.Args, " "))
+	for _, item := range s.items {
+		LogToFile(f, item)
+	}
+	s.items = nil
+	return f.Close()
+}
@@ -0,0 +1,24 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionWrite(t *testing.T) {
+	opts := &Options{LogPath: filepath.Join(t.TempDir(), LogFile)}
+	s := Session{Args: []string{"mirror", "-c", "-dst", "d"}}
+	s.Answer("remove?", time.Now(), "y")
+	assertError(t, nil, s.Write(opts))
+	assertError(t, nil, s.Write(opts))
+
+	b, err := os.ReadFile(opts.LogFilePath())
+	assertError(t, nil, err)
+	log := string(b)
+	assert(t, 2, strings.Count(log, LogSessionArgs+" mirror -c -dst d"))
+	assert(t, 1, strings.Count(log, "asked: remove?"))
+	assert(t, 1, strings.Count(log, `answered: "y"`))
+}
@@ -0,0 +1,74 @@
+package mirror
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	FlagNameMinSize  = "min-size"
+	FlagNameMaxSize  = "max-size"
+	FlagUsageMinSize = "files smaller than this are skipped in src and dst, e.g. 1 skips empty files, units are K, M, G and T (powers of 1000) or KiB, MiB, GiB and TiB (powers of 1024)"
+	FlagUsageMaxSize = "files larger than this are skipped in src and dst, e.g. 2G, 0 turns it off"
+	ErrBadSize       = CustomErr("invalid size, use a number with an optional unit like 10M or 2GiB, got")
+	ErrSizeRange     = CustomErr("-" + FlagNameMaxSize + " is smaller than -" + FlagNameMinSize)
+	ReasonTooSmall   = "smaller than -" + FlagNameMinSize
+	ReasonTooLarge   = "larger than -" + FlagNameMaxSize
+)
+
+// sizeUnits are the units that Size accepts, in lower case. A trailing "b" is optional for the decimal ones
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"m":   1e6,
+	"g":   1e9,
+	"t":   1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// Size is a number of bytes that can be read from a command line flag with a unit, e.g. 10M or 1.5GiB
+type Size int64
+
+func (s *Size) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *Size) Set(value string) error {
+	v := strings.ToLower(strings.TrimSpace(value))
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(v)
+	}
+
+	unit := strings.TrimSpace(v[i:])
+	multiplier, ok := sizeUnits[unit]
+	if !ok && len(unit) == 2 && unit[1] == 'b' {
+		multiplier, ok = sizeUnits[unit[:1]]
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	if !ok || err != nil || n < 0 || n*multiplier > math.MaxInt64 {
+		return fmt.Errorf("%w %q", ErrBadSize, value)
+	}
+
+	*s = Size(math.Round(n * multiplier))
+	return nil
+}
+
+// sizeFiltered returns the reason why a file of size bytes is skipped by -min-size or -max-size, or an empty string
+func (o *Options) sizeFiltered(size int64) string {
+	if size < int64(o.MinSize) {
+		return ReasonTooSmall
+	}
+	if o.MaxSize > 0 && size > int64(o.MaxSize) {
+		return ReasonTooLarge
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package mirror
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSizeSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Size
+		err   error
+	}{
+		{value: "0", want: 0},
+		{value: "100", want: 100},
+		{value: "100B", want: 100},
+		{value: "10K", want: 10e3},
+		{value: "10kb", want: 10e3},
+		{value: "10M", want: 10e6},
+		{value: "2G", want: 2e9},
+		{value: "1.5 GB", want: 1.5e9},
+		{value: "3T", want: 3e12},
+		{value: "1KiB", want: 1 << 10},
+		{value: "2mib", want: 2 << 20},
+		{value: "1.5GiB", want: 3 << 29},
+		{value: "1TiB", want: 1 << 40},
+		{value: "", err: ErrBadSize},
+		{value: "M", err: ErrBadSize},
+		{value: "-1", err: ErrBadSize},
+		{value: "10X", err: ErrBadSize},
+		{value: "1e3", err: ErrBadSize},
+		{value: "1.2.3", err: ErrBadSize},
+		{value: "10000000T", err: ErrBadSize},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			var s Size
+			err := s.Set(test.value)
+			assert(t, test.err != nil, errors.Is(err, ErrBadSize))
+			assert(t, test.want, s)
+		})
+	}
+}
+
+func TestReadFolderSizeFilters(t *testing.T) {
+	fsys := fstest.MapFS{
+		"empty":     {},
+		"small":     {Data: make([]byte, 10)},
+		"medium":    {Data: make([]byte, 100)},
+		"a/large":   {Data: make([]byte, 1000)},
+		"a/exactly": {Data: make([]byte, 500)},
+	}
+
+	tests := []struct {
+		name             string
+		minSize, maxSize Size
+		files            File
+		skipped          Skipped
+	}{
+		{name: "no limits", files: File{"empty": 0, "small": 10, "medium": 100, filepath.Join("a", "large"): 1000, filepath.Join("a", "exactly"): 500}, skipped: Skipped{}},
+		{name: "no empty files", minSize: 1, files: File{"small": 10, "medium": 100, filepath.Join("a", "large"): 1000, filepath.Join("a", "exactly"): 500}, skipped: Skipped{"empty": ReasonTooSmall}},
+		{
+			name: "both limits", minSize: 100, maxSize: 500,
+			files:   File{"medium": 100, filepath.Join("a", "exactly"): 500},
+			skipped: Skipped{"empty": ReasonTooSmall, "small": ReasonTooSmall, filepath.Join("a", "large"): ReasonTooLarge},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, files, skipped, err := ReadFS(fsys, &Options{MinSize: test.minSize, MaxSize: test.maxSize})
+			assertError(t, nil, err)
+			assert(t, test.files, files)
+			assert(t, test.skipped, skipped)
+		})
+	}
+}
+
+func TestSizeLimitsCheck(t *testing.T) {
+	assertError(t, ErrSizeRange, (&Options{MinSize: 10, MaxSize: 5}).check())
+	assertError(t, nil, (&Options{MinSize: 10}).check())
+	assertError(t, ErrWrongArgs, (&Options{MinSize: -1}).check())
+}
@@ -0,0 +1,60 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+)
+
+const (
+	FlagNameSizeChange   = "size-change"
+	FlagUsageSizeChange  = "what to do with a file whose size changed since the scan, e.g. a growing log, when the copy is done: flag it in the log and keep the copy, retry copying it once or truncate the copy to the scanned size"
+	SizeChangeFlag       = "flag"
+	SizeChangeRetry      = "retry"
+	SizeChangeTruncate   = "truncate"
+	ErrUnknownSizeChange = CustomErr("unknown size change policy, use flag, retry or truncate")
+	LogSizeChanged       = "size changed during the copy, %s: "
+	MsgSizeChanged       = "copied files whose size changed since the scan:"
+)
+
+// VetSizeChange checks if policy is known
+func VetSizeChange(policy string) error {
+	switch policy {
+	case SizeChangeFlag, SizeChangeRetry, SizeChangeTruncate:
+		return nil
+	default:
+		return ErrUnknownSizeChange
+	}
+}
+
+// checkSize deals with a copy of name at part whose written size isn't the scanned size, according to
+// opts.SizeChange. It returns the size of the copy and whether the change is reported, which is every time except
+// after a retry that got the scanned size. A copy that is shorter than the scanned size can't be truncated
+func checkSize(fsys fs.FS, name, part string, size, written int64, opts *Options) (int64, bool, error) {
+	if written == size {
+		return written, false, nil
+	}
+
+	switch opts.SizeChange {
+	case SizeChangeRetry:
+		written, err := copyFSFile(fsys, name, part, opts)
+		return written, err == nil && written != size, err
+	case SizeChangeTruncate:
+		if written < size {
+			return written, true, nil
+		}
+		if err := os.Truncate(part, size); err != nil {
+			return written, false, err
+		}
+		return size, true, nil
+	default:
+		return written, true, nil
+	}
+}
+
+// sizeChange returns opts.SizeChange, or SizeChangeFlag if it's empty
+func (o *Options) sizeChange() string {
+	if o.SizeChange == "" {
+		return SizeChangeFlag
+	}
+	return o.SizeChange
+}
@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// changingFS returns the next of versions every time the file "f" is opened, like a log that is written while it's copied
+type changingFS struct {
+	versions []string
+	opened   int
+}
+
+func (c *changingFS) Open(name string) (fs.File, error) {
+	data := c.versions[len(c.versions)-1]
+	if c.opened < len(c.versions) {
+		data = c.versions[c.opened]
+	}
+	if name == "f" {
+		c.opened++
+	}
+	return fstest.MapFS{"f": {Data: []byte(data)}}.Open(name)
+}
+
+func TestVetSizeChange(t *testing.T) {
+	for _, policy := range []string{SizeChangeFlag, SizeChangeRetry, SizeChangeTruncate} {
+		assertError(t, nil, VetSizeChange(policy))
+	}
+	assertError(t, ErrUnknownSizeChange, VetSizeChange("ignore"))
+}
+
+func TestCopyFilesSizeChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		versions []string
+		size     int64
+		want     string
+		reported bool
+	}{
+		{name: "same size", policy: SizeChangeRetry, versions: []string{"123"}, size: 3, want: "123"},
+		{name: "flagged", versions: []string{"12345"}, size: 3, want: "12345", reported: true},
+		{name: "retried", policy: SizeChangeRetry, versions: []string{"12345", "123"}, size: 3, want: "123"},
+		{name: "retried but still growing", policy: SizeChangeRetry, versions: []string{"1234", "12345"}, size: 3, want: "12345", reported: true},
+		{name: "truncated", policy: SizeChangeTruncate, versions: []string{"12345"}, size: 3, want: "123", reported: true},
+		{name: "shrunk can't be truncated", policy: SizeChangeTruncate, versions: []string{"1"}, size: 3, want: "1", reported: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			opts := &Options{LogPath: os.DevNull, SizeChange: test.policy}
+			files := File{"f": test.size}
+
+			assertError(t, nil, CopyFilesFS(files, TotalSize(files), &changingFS{versions: test.versions}, dst, opts))
+			data, err := os.ReadFile(filepath.Join(dst, "f"))
+			assertError(t, nil, err)
+			assert(t, test.want, string(data))
+			assert(t, test.reported, len(opts.Report.SizeChanged) == 1)
+		})
+	}
+
+	assertError(t, ErrUnknownSizeChange, (&Options{SizeChange: "ignore"}).check())
+}
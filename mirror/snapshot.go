@@ -0,0 +1,199 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FlagNameSnapshot       = "snapshot"
+	FlagUsageSnapshot      = "read src from a snapshot of its volume that is made before the scan and removed at the end: btrfs, zfs or lvm (Linux only, usually needs root)"
+	SnapshotBtrfs          = "btrfs"
+	SnapshotZFS            = "zfs"
+	SnapshotLVM            = "lvm"
+	ErrUnknownSnapshot     = CustomErr("unknown snapshot kind, use btrfs, zfs or lvm")
+	ErrSnapshotUnsupported = CustomErr("snapshots can only be made on Linux")
+	ErrSnapshotMode        = CustomErr("the -snapshot flag can't be used together with the -resume flag, the snapshot is a new folder in every run")
+	ErrNotBtrfs            = CustomErr("no btrfs subvolume holds the folder")
+	MsgSnapshot            = "reading src from the snapshot %q\n"
+	MsgSnapshotLeft        = "the snapshot couldn't be removed:"
+	// snapshotPrefix starts the names of snapshots, so ones that were left behind are easy to find
+	snapshotPrefix = "mirror-snapshot-"
+	// lvmSnapshotSize is the share of the origin volume that an LVM snapshot may take for changes made during the run
+	lvmSnapshotSize = "10%ORIGIN"
+)
+
+// Snapshot is a read-only copy of the volume that holds a folder, see NewSnapshot
+type Snapshot struct {
+	// Path is the folder inside the snapshot
+	Path string
+	// undo holds the steps that remove the snapshot, in the order in which they're run
+	undo []func() error
+}
+
+// VetSnapshot checks if kind is known and if snapshots can be made on this system
+func VetSnapshot(kind string) error {
+	switch kind {
+	case SnapshotBtrfs, SnapshotZFS, SnapshotLVM:
+	default:
+		return ErrUnknownSnapshot
+	}
+	if !snapshotSupported {
+		return ErrSnapshotUnsupported
+	}
+	return nil
+}
+
+// NewSnapshot makes a snapshot of kind (SnapshotBtrfs, SnapshotZFS or SnapshotLVM) of the volume that holds path.
+// Folders of other subvolumes, datasets or mounts inside path are empty in the snapshot. Remove should be called
+// when the snapshot isn't needed anymore
+func NewSnapshot(kind, path string) (s *Snapshot, err error) {
+	s = &Snapshot{}
+	defer func() {
+		if err != nil {
+			s.Remove()
+			s = nil
+		}
+	}()
+
+	// the tools report mount points without links, so path is compared with them without links too
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return
+	}
+
+	name := snapshotPrefix + time.Now().Format("20060102-150405")
+	switch kind {
+	case SnapshotBtrfs:
+		err = s.btrfs(name, path)
+	case SnapshotZFS:
+		err = s.zfs(name, path)
+	case SnapshotLVM:
+		err = s.lvm(name, path)
+	default:
+		err = ErrUnknownSnapshot
+	}
+	return
+}
+
+// Remove removes the snapshot. It runs every step even if one fails and returns the first error
+func (s *Snapshot) Remove() (err error) {
+	for _, undo := range s.undo {
+		if errU := undo(); errU != nil && err == nil {
+			err = errU
+		}
+	}
+	s.undo = nil
+	return
+}
+
+// btrfs snapshots the subvolume that holds path into the subvolume itself
+func (s *Snapshot) btrfs(name, path string) error {
+	root, err := btrfsRoot(path)
+	if err != nil {
+		return err
+	}
+	snap := filepath.Join(root, name)
+	if _, err = snapshotCmd("btrfs", "subvolume", "snapshot", "-r", root, snap); err != nil {
+		return err
+	}
+	s.onRemove("btrfs", "subvolume", "delete", snap)
+	return s.setPath(root, snap, path)
+}
+
+// zfs snapshots the dataset that holds path, which is then readable in the .zfs folder of the dataset
+func (s *Snapshot) zfs(name, path string) error {
+	out, err := snapshotCmd("zfs", "list", "-H", "-o", "name,mountpoint", path)
+	if err != nil {
+		return err
+	}
+	fields := strings.SplitN(out, "\t", 2)
+	if len(fields) != 2 {
+		return fmt.Errorf("zfs list %s: unexpected output: %s", path, out)
+	}
+	dataset, mountpoint := fields[0], fields[1]
+
+	if _, err = snapshotCmd("zfs", "snapshot", dataset+"@"+name); err != nil {
+		return err
+	}
+	s.onRemove("zfs", "destroy", dataset+"@"+name)
+	return s.setPath(mountpoint, filepath.Join(mountpoint, ".zfs", "snapshot", name), path)
+}
+
+// lvm snapshots the logical volume that is mounted where path is and mounts the snapshot read-only into a
+// temporary folder
+func (s *Snapshot) lvm(name, path string) error {
+	device, err := snapshotCmd("findmnt", "-n", "-o", "SOURCE", "--target", path)
+	if err != nil {
+		return err
+	}
+	mountpoint, err := snapshotCmd("findmnt", "-n", "-o", "TARGET", "--target", path)
+	if err != nil {
+		return err
+	}
+	fsType, err := snapshotCmd("findmnt", "-n", "-o", "FSTYPE", "--target", path)
+	if err != nil {
+		return err
+	}
+	out, err := snapshotCmd("lvs", "--noheadings", "-o", "vg_name,lv_name", device)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return fmt.Errorf("lvs %s: unexpected output: %s", device, out)
+	}
+	vg, lv := fields[0], fields[1]
+
+	if _, err = snapshotCmd("lvcreate", "-s", "-n", name, "-l", lvmSnapshotSize, vg+"/"+lv); err != nil {
+		return err
+	}
+	s.onRemove("lvremove", "-f", vg+"/"+name)
+
+	dir, err := os.MkdirTemp("", name)
+	if err != nil {
+		return err
+	}
+	s.undo = append([]func() error{func() error { return os.Remove(dir) }}, s.undo...)
+
+	// XFS refuses to mount a second volume with the same UUID
+	options := "ro"
+	if fsType == "xfs" {
+		options += ",nouuid"
+	}
+	if _, err = snapshotCmd("mount", "-o", options, "/dev/"+vg+"/"+name, dir); err != nil {
+		return err
+	}
+	s.onRemove("umount", dir)
+	return s.setPath(mountpoint, dir, path)
+}
+
+// onRemove makes Remove run the command before the steps that are already there
+func (s *Snapshot) onRemove(name string, args ...string) {
+	s.undo = append([]func() error{func() error {
+		_, err := snapshotCmd(name, args...)
+		return err
+	}}, s.undo...)
+}
+
+// setPath sets Path to where path, which is inside root, is in the snapshot of root at snap
+func (s *Snapshot) setPath(root, snap, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	s.Path = filepath.Join(snap, rel)
+	return nil
+}
+
+// snapshotCmd runs the command and returns its trimmed output
+func snapshotCmd(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,42 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	snapshotSupported = true
+	// btrfsMagic is the file system type that statfs returns for btrfs
+	btrfsMagic = 0x9123683e
+	// btrfsRootInode is the inode number of the top folder of every btrfs subvolume
+	btrfsRootInode = 256
+)
+
+// btrfsRoot returns the top folder of the btrfs subvolume that holds path
+func btrfsRoot(path string) (string, error) {
+	for {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(path, &st); err != nil {
+			return "", err
+		}
+		if int64(st.Type) != btrfsMagic {
+			return "", ErrNotBtrfs
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Ino == btrfsRootInode {
+			return path, nil
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", ErrNotBtrfs
+		}
+		path = parent
+	}
+}
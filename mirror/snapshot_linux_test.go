@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSnapshotTools puts scripts named like the snapshot tools first in PATH. Each one notes its name and
+// arguments into the returned file and prints its output from outputs, fail makes the named one fail
+func fakeSnapshotTools(t *testing.T, outputs map[string]string, fail string) (calls string) {
+	bin := t.TempDir()
+	calls = filepath.Join(bin, "calls")
+	for _, tool := range []string{"btrfs", "zfs", "findmnt", "lvs", "lvcreate", "lvremove", "mount", "umount"} {
+		script := "#!/bin/sh\necho \"" + tool + " $*\" >> " + calls + "\n"
+		for prefix, out := range outputs {
+			if strings.HasPrefix(prefix, tool+" ") {
+				script += "case \"$*\" in \"" + strings.TrimPrefix(prefix, tool+" ") + "\"*) printf '%s\\n' '" + out + "';; esac\n"
+			}
+		}
+		if tool == fail {
+			script += "exit 1\n"
+		}
+		assertError(t, nil, os.WriteFile(filepath.Join(bin, tool), []byte(script), 0755))
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+func readCalls(t *testing.T, calls string) []string {
+	b, err := os.ReadFile(calls)
+	assertError(t, nil, err)
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestSnapshotZFS(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	assertError(t, nil, err)
+	src := filepath.Join(root, "photos")
+	assertError(t, nil, os.Mkdir(src, FolderPerm))
+	calls := fakeSnapshotTools(t, map[string]string{"zfs list": "tank/data\t" + root}, "")
+
+	s, err := NewSnapshot(SnapshotZFS, src)
+	assertError(t, nil, err)
+	name := filepath.Base(filepath.Dir(s.Path))
+	assert(t, true, strings.HasPrefix(name, snapshotPrefix))
+	assert(t, filepath.Join(root, ".zfs", "snapshot", name, "photos"), s.Path)
+
+	assertError(t, nil, s.Remove())
+	assert(t, []string{
+		"zfs list -H -o name,mountpoint " + src,
+		"zfs snapshot tank/data@" + name,
+		"zfs destroy tank/data@" + name,
+	}, readCalls(t, calls))
+}
+
+func TestSnapshotLVM(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	assertError(t, nil, err)
+	src := filepath.Join(root, "home")
+	assertError(t, nil, os.Mkdir(src, FolderPerm))
+
+	t.Run("made and removed", func(t *testing.T) {
+		calls := fakeSnapshotTools(t, map[string]string{
+			"findmnt -n -o SOURCE": "/dev/mapper/vg0-data",
+			"findmnt -n -o TARGET": root,
+			"findmnt -n -o FSTYPE": "xfs",
+			"lvs --noheadings":     "  vg0 data",
+		}, "")
+
+		s, err := NewSnapshot(SnapshotLVM, src)
+		assertError(t, nil, err)
+		dir := filepath.Dir(s.Path)
+		assert(t, "home", filepath.Base(s.Path))
+		name := strings.Split(readCalls(t, calls)[4], " ")[3]
+
+		assertError(t, nil, s.Remove())
+		_, err = os.Stat(dir)
+		assert(t, true, os.IsNotExist(err))
+		assert(t, []string{
+			"lvcreate -s -n " + name + " -l " + lvmSnapshotSize + " vg0/data",
+			"mount -o ro,nouuid /dev/vg0/" + name + " " + dir,
+			"umount " + dir,
+			"lvremove -f vg0/" + name,
+		}, readCalls(t, calls)[4:])
+	})
+
+	t.Run("removed if mounting fails", func(t *testing.T) {
+		calls := fakeSnapshotTools(t, map[string]string{
+			"findmnt -n -o SOURCE": "/dev/mapper/vg0-data",
+			"findmnt -n -o TARGET": root,
+			"findmnt -n -o FSTYPE": "ext4",
+			"lvs --noheadings":     "vg0 data",
+		}, "mount")
+
+		_, err := NewSnapshot(SnapshotLVM, src)
+		assert(t, true, err != nil)
+		got := readCalls(t, calls)
+		assert(t, true, strings.HasPrefix(got[len(got)-1], "lvremove -f vg0/"+snapshotPrefix))
+	})
+}
+
+func TestBtrfsRoot(t *testing.T) {
+	if _, err := btrfsRoot(t.TempDir()); err != nil {
+		assertError(t, ErrNotBtrfs, err)
+	}
+}
+
+func TestVetSnapshot(t *testing.T) {
+	assertError(t, nil, VetSnapshot(SnapshotBtrfs))
+	assertError(t, ErrUnknownSnapshot, VetSnapshot("vss"))
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package mirror
+
+// the snapshots are made with Linux tools like findmnt and lvcreate
+const snapshotSupported = false
+
+func btrfsRoot(path string) (string, error) {
+	return "", ErrSnapshotUnsupported
+}
@@ -0,0 +1,222 @@
+package mirror
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	CmdSplit            = "split"
+	SplitRecordFile     = "mirror-split.json"
+	FlagUsageSplitSrc   = "source folder"
+	FlagUsageSplitDst   = "destination drive, can be repeated, drives are filled in the given order"
+	ErrSplitWrongArgs   = CustomErr("wrong arguments, use 'split -h' for help")
+	ErrSplitNoSpace     = CustomErr("there isn't enough free space on the drives for:")
+	ErrFreeSpaceUnknown = CustomErr("free space can't be found out on this system")
+	// splitReserve is left free on every drive for the split record and file system metadata
+	splitReserve = 10 * BytesInMB
+)
+
+// Drive is one destination of a split copy. Files are assigned to it by SplitPlan
+type Drive struct {
+	Path  string
+	Free  int64
+	Files File
+}
+
+// SplitRecord says which files were copied to which drive. Every drive gets the records of all drives
+type SplitRecord struct {
+	Drive int      `json:"drive"`
+	Path  string   `json:"path"`
+	Files []string `json:"files"`
+}
+
+// Paths is a list of paths that can be used as a repeatable command line flag
+type Paths []string
+
+func (p *Paths) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *Paths) Set(path string) error {
+	*p = append(*p, path)
+	return nil
+}
+
+// VetSplitFlags parses flags of the split subcommand and rewrites src and dsts into absolute paths
+func VetSplitFlags(args []string) (src string, dsts []string, err error) {
+	var dstPaths Paths
+	fs := flag.NewFlagSet(CmdSplit, flag.ExitOnError)
+	srcPath := fs.String(FlagNameSrc, "", FlagUsageSplitSrc)
+	fs.Var(&dstPaths, FlagNameDst, FlagUsageSplitDst)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *srcPath == "" || len(dstPaths) == 0 || fs.NArg() > 0 {
+		err = ErrSplitWrongArgs
+		return
+	}
+
+	if src, err = filepath.Abs(*srcPath); err != nil {
+		return
+	}
+	if f, errF := os.Stat(src); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrSrcNotFound
+		return
+	}
+
+	for _, p := range dstPaths {
+		var dst string
+		if dst, err = filepath.Abs(p); err != nil {
+			return
+		}
+		if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+			err = fmt.Errorf("%w %s", ErrDstNotFound, dst)
+			return
+		}
+		dsts = append(dsts, dst)
+	}
+	return
+}
+
+// NewDrives returns drives with the free space of their file systems
+func NewDrives(paths []string) ([]Drive, error) {
+	drives := make([]Drive, 0, len(paths))
+	for _, path := range paths {
+		free, ok, err := freeSpace(path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrFreeSpaceUnknown
+		}
+		drives = append(drives, Drive{Path: path, Free: free})
+	}
+	return drives, nil
+}
+
+// SplitPlan assigns files to drives. Files of one folder stay together if a drive has room for all of them,
+// the rest is placed file by file. Larger items are placed first and every item goes to the first drive it fits on
+func SplitPlan(files File, drives []Drive) error {
+	free := make([]int64, len(drives))
+	for i := range drives {
+		drives[i].Files = make(File)
+		free[i] = drives[i].Free - splitReserve
+	}
+
+	groups := make(map[string]File)
+	for file, size := range files {
+		folder := filepath.Dir(file)
+		if groups[folder] == nil {
+			groups[folder] = make(File)
+		}
+		groups[folder][file] = size
+	}
+
+	folders := make([]string, 0, len(groups))
+	sizes := make(map[string]int64, len(groups))
+	for folder, g := range groups {
+		folders = append(folders, folder)
+		sizes[folder] = TotalSize(g)
+	}
+	sortBySize(folders, sizes)
+
+	var loose []string
+	for _, folder := range folders {
+		size := sizes[folder]
+		i := firstFit(free, size)
+		if i < 0 {
+			for file := range groups[folder] {
+				loose = append(loose, file)
+			}
+			continue
+		}
+		for file, s := range groups[folder] {
+			drives[i].Files[file] = s
+		}
+		free[i] -= size
+	}
+
+	sortBySize(loose, files)
+	for _, file := range loose {
+		i := firstFit(free, files[file])
+		if i < 0 {
+			return fmt.Errorf("%w %s", ErrSplitNoSpace, file)
+		}
+		drives[i].Files[file] = files[file]
+		free[i] -= files[file]
+	}
+	return nil
+}
+
+// Split copies files of every drive from src, makes their parent folders and writes SplitRecordFile to every drive
+func Split(src string, drives []Drive, opts *Options) error {
+	for _, d := range drives {
+		if len(d.Files) == 0 {
+			continue
+		}
+
+		folders := make(Folder)
+		for file := range d.Files {
+			if folder := filepath.Dir(file); folder != "." {
+				folders[folder] = struct{}{}
+			}
+		}
+
+		if len(folders) > 0 {
+			if err := MakeFoldersFS(folders, OSFS(src), d.Path, opts); err != nil {
+				return err
+			}
+		}
+		if err := CopyFiles(d.Files, TotalSize(d.Files), src, d.Path, opts); err != nil {
+			return err
+		}
+	}
+
+	return writeSplitRecords(drives)
+}
+
+func writeSplitRecords(drives []Drive) error {
+	records := make([]SplitRecord, 0, len(drives))
+	for i, d := range drives {
+		records = append(records, SplitRecord{Drive: i + 1, Path: d.Path, Files: sortFoldersOrFiles(d.Files)})
+	}
+
+	data, err := json.MarshalIndent(records, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	for _, d := range drives {
+		if err = os.WriteFile(filepath.Join(d.Path, SplitRecordFile), data, FilePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func firstFit(free []int64, size int64) int {
+	for i := range free {
+		if size <= free[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortBySize sorts items from the largest to the smallest, items of the same size are sorted by name
+func sortBySize(items []string, sizes map[string]int64) {
+	sort.Slice(items, func(i, j int) bool {
+		if si, sj := sizes[items[i]], sizes[items[j]]; si != sj {
+			return si > sj
+		}
+		return items[i] < items[j]
+	})
+}
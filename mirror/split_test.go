@@ -0,0 +1,92 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitPlan(t *testing.T) {
+	files := File{
+		filepath.Join("a/1"): 4, filepath.Join("a/2"): 4,
+		filepath.Join("b/1"): 6,
+		filepath.Join("c/1"): 5, filepath.Join("c/2"): 5,
+	}
+
+	t.Run("folders stay together", func(t *testing.T) {
+		drives := []Drive{{Free: splitReserve + 10}, {Free: splitReserve + 14}}
+		err := SplitPlan(files, drives)
+		assertError(t, nil, err)
+		assert(t, File{filepath.Join("c/1"): 5, filepath.Join("c/2"): 5}, drives[0].Files)
+		assert(t, File{filepath.Join("a/1"): 4, filepath.Join("a/2"): 4, filepath.Join("b/1"): 6}, drives[1].Files)
+	})
+
+	t.Run("a folder that doesn't fit anywhere is split", func(t *testing.T) {
+		drives := []Drive{{Free: splitReserve + 4}, {Free: splitReserve + 4}, {Free: splitReserve + 16}}
+		err := SplitPlan(files, drives)
+		assertError(t, nil, err)
+		assert(t, File{filepath.Join("a/1"): 4}, drives[0].Files)
+		assert(t, File{filepath.Join("a/2"): 4}, drives[1].Files)
+		assert(t, File{filepath.Join("b/1"): 6, filepath.Join("c/1"): 5, filepath.Join("c/2"): 5}, drives[2].Files)
+	})
+
+	t.Run("not enough space", func(t *testing.T) {
+		err := SplitPlan(files, []Drive{{Free: splitReserve + 10}})
+		if !errors.Is(err, ErrSplitNoSpace) {
+			t.Errorf("wanted ErrSplitNoSpace, but got %q", err)
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	makeTestFolders(t)
+
+	drives := []Drive{{Path: t.TempDir(), Free: splitReserve + 2}, {Path: t.TempDir(), Free: splitReserve + 2}}
+	err := SplitPlan(srcFiles, drives)
+	assertError(t, nil, err)
+
+	err = Split(srcPathTest, drives, &Options{})
+	assertError(t, nil, err)
+
+	for _, d := range drives {
+		data, err := os.ReadFile(filepath.Join(d.Path, SplitRecordFile))
+		assertError(t, nil, err)
+		var records []SplitRecord
+		err = json.Unmarshal(data, &records)
+		assertError(t, nil, err)
+		assert(t, len(drives), len(records))
+
+		for file := range d.Files {
+			_, err = os.Stat(filepath.Join(d.Path, file))
+			assertError(t, nil, err)
+		}
+	}
+
+	cleanTestFolders(t)
+}
+
+func TestVetSplitFlags(t *testing.T) {
+	makeTestFolders(t)
+
+	t.Run("with correct flags", func(t *testing.T) {
+		_, dsts, err := VetSplitFlags([]string{"-" + FlagNameSrc, srcPathTest, "-" + FlagNameDst, dstPathTest, "-" + FlagNameDst, dstPathTest})
+		assertError(t, nil, err)
+		assert(t, 2, len(dsts))
+	})
+
+	t.Run("without dst", func(t *testing.T) {
+		_, _, err := VetSplitFlags([]string{"-" + FlagNameSrc, srcPathTest})
+		assertError(t, ErrSplitWrongArgs, err)
+	})
+
+	t.Run("with incorrect dst", func(t *testing.T) {
+		_, _, err := VetSplitFlags([]string{"-" + FlagNameSrc, srcPathTest, "-" + FlagNameDst, "aaa"})
+		if !errors.Is(err, ErrDstNotFound) {
+			t.Errorf("wanted ErrDstNotFound, but got %q", err)
+		}
+	})
+
+	cleanTestFolders(t)
+}
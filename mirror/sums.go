@@ -0,0 +1,204 @@
+package mirror
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	CmdSums           = "sums"
+	CmdVerify         = "verify"
+	SumsFile          = "SHA256SUMS"
+	FlagUsageSumsDst  = "folder whose files are hashed or verified"
+	ErrSumsWrongArgs  = CustomErr("wrong arguments, use 'sums -h' or 'verify -h' for help")
+	ErrSumsBadLine    = CustomErr("malformed line in")
+	ErrSumsMismatch   = CustomErr("the copy doesn't match its checksums")
+	formatSumsLine    = "%s  %s\n"
+	formatSumsResult  = "%d files checked, %d don't match, %d are missing, %d aren't listed"
+	sumsBinaryPrefix  = "*"
+	sumsLineSeparator = "  "
+)
+
+// SumsResult holds results of VerifySums. Paths are relative
+type SumsResult struct {
+	Checked    int
+	Mismatched []string
+	Missing    []string
+	// Unlisted holds files that aren't in the SumsFile of their folder
+	Unlisted []string
+}
+
+func (r SumsResult) String() string {
+	return fmt.Sprintf(formatSumsResult, r.Checked, len(r.Mismatched), len(r.Missing), len(r.Unlisted))
+}
+
+// OK returns true if every file matches and nothing is missing or unlisted
+func (r SumsResult) OK() bool {
+	return len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Unlisted) == 0
+}
+
+// VetSumsFlags parses flags of the sums and verify subcommands and rewrites dst into an absolute path
+func VetSumsFlags(cmd string, args []string) (dst string, err error) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dstPath := fs.String(FlagNameDst, "", FlagUsageSumsDst)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *dstPath == "" || fs.NArg() > 0 {
+		err = ErrSumsWrongArgs
+		return
+	}
+
+	if dst, err = filepath.Abs(*dstPath); err != nil {
+		return
+	}
+
+	if f, errF := os.Stat(dst); os.IsNotExist(errF) || !f.IsDir() {
+		err = ErrDstNotFound
+	}
+	return
+}
+
+// WriteSums writes a SumsFile into every folder of path with SHA-256 hashes of files in that folder.
+// The files can be checked by VerifySums or by 'sha256sum -c'. It returns the number of hashed files
+func WriteSums(path string, opts *Options) (int, error) {
+	folders, err := sumsFolders(path, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	hashed := 0
+	for _, folder := range sortedKeys(folders) {
+		if opts.stopped() {
+			return hashed, ErrStopped
+		}
+
+		var b strings.Builder
+		for _, name := range folders[folder] {
+			sum, err := hashFile(filepath.Join(path, folder, name))
+			if err != nil {
+				return hashed, err
+			}
+			fmt.Fprintf(&b, formatSumsLine, sum, name)
+			hashed++
+		}
+
+		if err = os.WriteFile(filepath.Join(path, folder, SumsFile), []byte(b.String()), FilePerm); err != nil {
+			return hashed, err
+		}
+	}
+	return hashed, nil
+}
+
+// VerifySums checks files in path against the SumsFile of every folder. It only reads, so it can be used on
+// read-only media
+func VerifySums(path string, opts *Options) (res SumsResult, err error) {
+	folders, err := sumsFolders(path, opts)
+	if err != nil {
+		return
+	}
+
+	for _, folder := range sortedKeys(folders) {
+		if opts.stopped() {
+			return res, ErrStopped
+		}
+
+		sums, err := readSums(filepath.Join(path, folder, SumsFile))
+		if err != nil && !os.IsNotExist(err) {
+			return res, err
+		}
+
+		for _, name := range folders[folder] {
+			if _, ok := sums[name]; !ok {
+				res.Unlisted = append(res.Unlisted, filepath.Join(folder, name))
+			}
+		}
+
+		names := make([]string, 0, len(sums))
+		for name := range sums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			file := filepath.Join(folder, filepath.FromSlash(name))
+			sum, err := hashFile(filepath.Join(path, file))
+			if os.IsNotExist(err) {
+				res.Missing = append(res.Missing, file)
+				continue
+			}
+			if err != nil {
+				return res, err
+			}
+
+			res.Checked++
+			if sum != sums[name] {
+				res.Mismatched = append(res.Mismatched, file)
+			}
+		}
+	}
+	return
+}
+
+// sumsFolders maps every folder of path, "." included, to sorted names of its files except SumsFile
+func sumsFolders(path string, opts *Options) (map[string][]string, error) {
+	folders, files, _, err := ReadFolder(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string][]string{".": nil}
+	for folder := range folders {
+		res[folder] = nil
+	}
+	for _, file := range sortFoldersOrFiles(files) {
+		if name := filepath.Base(file); name != SumsFile {
+			res[filepath.Dir(file)] = append(res[filepath.Dir(file)], name)
+		}
+	}
+	return res, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readSums parses a file in the format of sha256sum and returns names mapped to hashes
+func readSums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		i := strings.Index(line, sumsLineSeparator)
+		if i < 0 {
+			// sha256sum -b separates the name by a space and an asterisk
+			if i = strings.Index(line, " "+sumsBinaryPrefix); i < 0 {
+				return nil, fmt.Errorf("%w %s: %q", ErrSumsBadLine, path, line)
+			}
+		}
+		sums[line[i+2:]] = strings.ToLower(line[:i])
+	}
+	return sums, scanner.Err()
+}
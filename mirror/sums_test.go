@@ -0,0 +1,68 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSums(t *testing.T) {
+	makeTestFolders(t)
+
+	hashed, err := WriteSums(srcPathTest, &Options{})
+	assertError(t, nil, err)
+	assert(t, len(srcFiles), hashed)
+
+	t.Run("unchanged copy", func(t *testing.T) {
+		res, err := VerifySums(srcPathTest, &Options{})
+		assertError(t, nil, err)
+		assert(t, SumsResult{Checked: len(srcFiles)}, res)
+		assert(t, true, res.OK())
+	})
+
+	t.Run("changed copy", func(t *testing.T) {
+		err := os.WriteFile(filepath.Join(srcPathTest, "_same_1"), []byte("x"), FilePerm)
+		assertError(t, nil, err)
+		err = os.Remove(filepath.Join(srcPathTest, "same_1/_different"))
+		assertError(t, nil, err)
+		err = os.WriteFile(filepath.Join(srcPathTest, "_new"), []byte("n"), FilePerm)
+		assertError(t, nil, err)
+
+		res, err := VerifySums(srcPathTest, &Options{})
+		assertError(t, nil, err)
+		assert(t, SumsResult{
+			Checked:    2,
+			Mismatched: []string{"_same_1"},
+			Missing:    []string{filepath.Join("same_1/_different")},
+			Unlisted:   []string{"_new"},
+		}, res)
+		assert(t, false, res.OK())
+	})
+
+	cleanTestFolders(t)
+}
+
+func TestReadSums(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SumsFile)
+	err := os.WriteFile(path, []byte("AB  a\n\ncd *b c\n"), FilePerm)
+	assertError(t, nil, err)
+
+	sums, err := readSums(path)
+	assertError(t, nil, err)
+	assert(t, map[string]string{"a": "ab", "b c": "cd"}, sums)
+
+	err = os.WriteFile(path, []byte("abc"), FilePerm)
+	assertError(t, nil, err)
+	_, err = readSums(path)
+	if err == nil {
+		t.Error("wanted an error for a malformed line")
+	}
+}
+
+func TestVetSumsFlags(t *testing.T) {
+	_, err := VetSumsFlags(CmdVerify, nil)
+	assertError(t, ErrSumsWrongArgs, err)
+
+	_, err = VetSumsFlags(CmdSums, []string{"-" + FlagNameDst, "aaa"})
+	assertError(t, ErrDstNotFound, err)
+}
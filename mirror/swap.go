@@ -0,0 +1,214 @@
+package mirror
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	FlagNameSwap          = "swap"
+	FlagUsageSwap         = "make the changes in a copy of dst named dst" + SwapNewSuffix + " and swap it with dst when the run succeeds, the previous tree stays as dst" + SwapOldSuffix + " until 'swap -confirm'"
+	CmdSwap               = "swap"
+	FlagNameSwapConfirm   = "confirm"
+	FlagNameSwapRollback  = "rollback"
+	FlagUsageSwapDst      = "folder that was mirrored with the -" + FlagNameSwap + " flag"
+	FlagUsageSwapConfirm  = "remove the previous tree"
+	FlagUsageSwapRollback = "put the previous tree back in place and remove the new one"
+	SwapNewSuffix         = ".new"
+	SwapOldSuffix         = ".old"
+	ErrSwapWrongArgs      = CustomErr("wrong arguments, use 'swap -h' for help")
+	ErrSwapMode           = CustomErr("the -swap flag can't be used together with the -cas or -resume flags")
+	ErrSwapNotConfirmed   = CustomErr("the previous tree of the last -swap run is still there, use 'swap -confirm' or 'swap -rollback' first:")
+	ErrNoSwapOld          = CustomErr("there is no previous tree to confirm or roll back:")
+)
+
+// SwapPaths returns where SeedSwap makes the new tree of dst and where Swap leaves the previous one
+func SwapPaths(dst string) (newPath, oldPath string) {
+	dst = filepath.Clean(dst)
+	return dst + SwapNewSuffix, dst + SwapOldSuffix
+}
+
+// CheckSwap returns ErrSwapNotConfirmed if the previous tree of the last swap of dst is still there
+func CheckSwap(dst string) error {
+	_, oldPath := SwapPaths(dst)
+	if _, err := os.Lstat(oldPath); err == nil {
+		return fmt.Errorf("%w %q", ErrSwapNotConfirmed, oldPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SeedSwap makes the new tree of dst with hard links to the files of dst, or with copies where links can't be made,
+// and returns its path. Files are copied into a part path and renamed into place, so changing the new tree never
+// changes dst. A new tree that a failed run left behind is removed first, special files, temporary folders and
+// part files of runs aren't carried over
+func SeedSwap(dst string, opts *Options) (string, error) {
+	if err := CheckSwap(dst); err != nil {
+		return "", err
+	}
+	newPath, _ := SwapPaths(dst)
+	if err := os.RemoveAll(newPath); err != nil {
+		return "", err
+	}
+
+	err := filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if opts.stopped() {
+			return ErrStopped
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(newPath, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if rel != "." && isTempDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if err = os.Mkdir(target, FolderPerm); err != nil || !permsSupported {
+				return err
+			}
+			// like made folders, so the run can write into the new tree
+			return os.Chmod(target, info.Mode().Perm()|folderOwnerPerm)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular() && !isPartFile(d.Name()):
+			if os.Link(path, target) == nil {
+				return nil
+			}
+			if _, err = copyFile(path, target); err != nil {
+				return err
+			}
+			if permsSupported {
+				if err = copyPerm(info, target); err != nil {
+					return err
+				}
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(newPath)
+		return "", err
+	}
+	return newPath, nil
+}
+
+// Swap moves dst to its old path and the new tree that SeedSwap made into its place. dst is missing between the two
+// renames, if the second one fails, dst is moved back. A crash between them leaves both trees without dst, the swap
+// subcommand finishes the swap then, see recoverSwap
+func Swap(dst string) error {
+	newPath, oldPath := SwapPaths(dst)
+	if err := os.Rename(dst, oldPath); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, dst); err != nil {
+		if errR := os.Rename(oldPath, dst); errR != nil {
+			return errR
+		}
+		return err
+	}
+	return nil
+}
+
+// halfSwapped returns true if dst is missing, but the previous tree of a swap is there, see recoverSwap
+func halfSwapped(dst string) bool {
+	_, oldPath := SwapPaths(dst)
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		return false
+	}
+	_, err := os.Lstat(oldPath)
+	return err == nil
+}
+
+// recoverSwap puts a tree back in place of dst if a crash left it half swapped. That's the new tree, which Swap was
+// moving into place, or the previous one if there is no new tree. A rollback that crashed between its renames leaves
+// the same names, it swaps again then and can be run again
+func recoverSwap(dst string) error {
+	if !halfSwapped(dst) {
+		return nil
+	}
+	newPath, oldPath := SwapPaths(dst)
+	if _, err := os.Lstat(newPath); err == nil {
+		return os.Rename(newPath, dst)
+	}
+	return os.Rename(oldPath, dst)
+}
+
+// ConfirmSwap removes the previous tree of dst that Swap left
+func ConfirmSwap(dst string) error {
+	if err := recoverSwap(dst); err != nil {
+		return err
+	}
+	_, oldPath := SwapPaths(dst)
+	if _, err := os.Lstat(oldPath); os.IsNotExist(err) {
+		return fmt.Errorf("%w %q", ErrNoSwapOld, oldPath)
+	}
+	return os.RemoveAll(oldPath)
+}
+
+// RollbackSwap puts the previous tree of dst back in place and removes the new one
+func RollbackSwap(dst string) error {
+	if err := recoverSwap(dst); err != nil {
+		return err
+	}
+	newPath, oldPath := SwapPaths(dst)
+	if _, err := os.Lstat(oldPath); os.IsNotExist(err) {
+		return fmt.Errorf("%w %q", ErrNoSwapOld, oldPath)
+	}
+	// the new tree gets the name that SeedSwap removes, so a failed removal is cleaned by the next run
+	if err := os.RemoveAll(newPath); err != nil {
+		return err
+	}
+	if err := os.Rename(dst, newPath); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, dst); err != nil {
+		return err
+	}
+	return os.RemoveAll(newPath)
+}
+
+// VetSwapFlags parses flags of the swap subcommand and rewrites dst into an absolute path
+func VetSwapFlags(args []string) (dst string, rollback bool, err error) {
+	fs := flag.NewFlagSet(CmdSwap, flag.ExitOnError)
+	dstPath := fs.String(FlagNameDst, "", FlagUsageSwapDst)
+	confirm := fs.Bool(FlagNameSwapConfirm, false, FlagUsageSwapConfirm)
+	fs.BoolVar(&rollback, FlagNameSwapRollback, false, FlagUsageSwapRollback)
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if *dstPath == "" || *confirm == rollback || fs.NArg() > 0 {
+		err = ErrSwapWrongArgs
+		return
+	}
+
+	if dst, err = filepath.Abs(*dstPath); err != nil {
+		return
+	}
+
+	// a half swapped dst is missing, confirming or rolling back recovers it
+	if f, errF := os.Stat(dst); (os.IsNotExist(errF) && !halfSwapped(dst)) || (errF == nil && !f.IsDir()) {
+		err = ErrDstNotFound
+	}
+	return
+}
@@ -0,0 +1,143 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeedSwap(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "dst")
+	assertError(t, nil, os.MkdirAll(filepath.Join(dst, "a"), FolderPerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "a", "1"), []byte("1"), FilePerm))
+	assertError(t, nil, os.Mkdir(filepath.Join(dst, TempDirPrefix+"1"), FolderPerm))
+	newPath, oldPath := SwapPaths(dst)
+
+	// a new tree of a failed run is made again
+	assertError(t, nil, os.MkdirAll(filepath.Join(newPath, "left"), FolderPerm))
+
+	got, err := SeedSwap(dst, &Options{})
+	assertError(t, nil, err)
+	assert(t, newPath, got)
+
+	folders, files, _, err := ReadFolder(newPath, &Options{})
+	assertError(t, nil, err)
+	assert(t, Folder{"a": {}}, folders)
+	assert(t, File{filepath.Join("a", "1"): 1}, files)
+	_, err = os.Stat(filepath.Join(newPath, TempDirPrefix+"1"))
+	assert(t, true, os.IsNotExist(err))
+
+	f, err := os.Stat(filepath.Join(dst, "a", "1"))
+	assertError(t, nil, err)
+	g, err := os.Stat(filepath.Join(newPath, "a", "1"))
+	assertError(t, nil, err)
+	assert(t, true, os.SameFile(f, g))
+
+	assertError(t, nil, os.Mkdir(oldPath, FolderPerm))
+	_, err = SeedSwap(dst, &Options{})
+	assert(t, true, errors.Is(err, ErrSwapNotConfirmed))
+}
+
+func TestSwap(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "dst")
+	newPath, oldPath := SwapPaths(dst)
+	write := func(path, data string) {
+		t.Helper()
+		assertError(t, nil, os.MkdirAll(path, FolderPerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(path, "f"), []byte(data), FilePerm))
+	}
+	read := func(path string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(path, "f"))
+		assertError(t, nil, err)
+		return string(b)
+	}
+
+	t.Run("confirmed", func(t *testing.T) {
+		write(dst, "old")
+		write(newPath, "new")
+
+		assertError(t, nil, Swap(dst))
+		assert(t, "new", read(dst))
+		assert(t, "old", read(oldPath))
+		assert(t, true, errors.Is(CheckSwap(dst), ErrSwapNotConfirmed))
+
+		assertError(t, nil, ConfirmSwap(dst))
+		_, err := os.Stat(oldPath)
+		assert(t, true, os.IsNotExist(err))
+		assertError(t, nil, CheckSwap(dst))
+		assert(t, true, errors.Is(ConfirmSwap(dst), ErrNoSwapOld))
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		write(newPath, "newer")
+
+		assertError(t, nil, Swap(dst))
+		assertError(t, nil, RollbackSwap(dst))
+		assert(t, "new", read(dst))
+		for _, path := range []string{newPath, oldPath} {
+			_, err := os.Stat(path)
+			assert(t, true, os.IsNotExist(err))
+		}
+		assert(t, true, errors.Is(RollbackSwap(dst), ErrNoSwapOld))
+	})
+
+	t.Run("without a new tree", func(t *testing.T) {
+		assert(t, true, Swap(dst) != nil)
+		assert(t, "new", read(dst))
+	})
+
+	// a crash between the renames of Swap
+	halfSwap := func(data string) {
+		t.Helper()
+		write(newPath, data)
+		assertError(t, nil, os.Rename(dst, oldPath))
+		_, _, err := VetSwapFlags([]string{"-" + FlagNameDst, dst, "-" + FlagNameSwapConfirm})
+		assertError(t, nil, err)
+	}
+
+	t.Run("confirmed after a crash", func(t *testing.T) {
+		halfSwap("newer")
+		assertError(t, nil, ConfirmSwap(dst))
+		assert(t, "newer", read(dst))
+		for _, path := range []string{newPath, oldPath} {
+			_, err := os.Stat(path)
+			assert(t, true, os.IsNotExist(err))
+		}
+	})
+
+	t.Run("rolled back after a crash", func(t *testing.T) {
+		halfSwap("newest")
+		assertError(t, nil, RollbackSwap(dst))
+		assert(t, "newer", read(dst))
+		for _, path := range []string{newPath, oldPath} {
+			_, err := os.Stat(path)
+			assert(t, true, os.IsNotExist(err))
+		}
+	})
+}
+
+func TestVetSwapFlags(t *testing.T) {
+	dst := t.TempDir()
+	tests := []struct {
+		name     string
+		args     []string
+		rollback bool
+		err      error
+	}{
+		{name: "confirm", args: []string{"-" + FlagNameDst, dst, "-" + FlagNameSwapConfirm}},
+		{name: "rollback", args: []string{"-" + FlagNameDst, dst, "-" + FlagNameSwapRollback}, rollback: true},
+		{name: "without an action", args: []string{"-" + FlagNameDst, dst}, err: ErrSwapWrongArgs},
+		{name: "with both actions", args: []string{"-" + FlagNameDst, dst, "-" + FlagNameSwapConfirm, "-" + FlagNameSwapRollback}, rollback: true, err: ErrSwapWrongArgs},
+		{name: "without dst", args: []string{"-" + FlagNameSwapConfirm}, err: ErrSwapWrongArgs},
+		{name: "with a missing dst", args: []string{"-" + FlagNameDst, filepath.Join(dst, "missing"), "-" + FlagNameSwapConfirm}, err: ErrDstNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, rollback, err := VetSwapFlags(test.args)
+			assertError(t, test.err, err)
+			assert(t, test.rollback, rollback)
+		})
+	}
+}
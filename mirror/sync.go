@@ -0,0 +1,140 @@
+package mirror
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+const (
+	FlagNameSync  = "sync"
+	FlagUsageSync = "copy missing files and remove files and folders that aren't in src, in one run with one confirmation"
+	ErrSyncMode   = CustomErr("the -sync flag can't be used together with the -c, -cas or -resume flags")
+)
+
+// SyncPlan holds both halves of a sync: what is missing in dst and what isn't in src anymore
+type SyncPlan struct {
+	MissingFolders, FoldersToClean Folder
+	MissingFiles, FilesToClean     File
+	CopySize, CleanSize            int64
+	// MissingLinks and LinksToClean are only filled with Options.Links, see ReadFolderLinks
+	MissingLinks, LinksToClean Links
+	// HardLinks are missing files that are made as hard links instead of being copied, see PlanHardLinks
+	HardLinks HardLinks
+	// Renames are missing files that are moved from files to clean instead of being copied, see PlanRenames
+	Renames Renames
+	// StaleParts are part files of interrupted runs in dst, which are removed first. They alone don't make the plan
+	// non-empty, see StaleParts
+	StaleParts []string
+}
+
+// NewSyncPlan compares both trees once. changed holds files of the same size that are copied anyway, see Comparer
+func NewSyncPlan(dstFolders, srcFolders Folder, dstFiles, srcFiles, changed File) (p SyncPlan) {
+	p.MissingFolders = MissingFolders(dstFolders, srcFolders)
+	p.FoldersToClean = FoldersToClean(dstFolders, srcFolders)
+	p.MissingFiles, p.CopySize = MissingFiles(dstFiles, srcFiles)
+	p.FilesToClean, p.CleanSize = FilesToClean(dstFiles, srcFiles)
+
+	for file, size := range changed {
+		if _, ok := p.MissingFiles[file]; !ok {
+			p.MissingFiles[file] = size
+			p.CopySize += size
+		}
+	}
+	return
+}
+
+// KeepSkipped takes the items that src has, but skipped, out of the cleaning, e.g. a file larger than -max-size, so dst
+// keeps its copy of them like with rsync. What is inside a skipped folder of src is kept too
+func (p *SyncPlan) KeepSkipped(srcSkipped Skipped) {
+	if len(srcSkipped) == 0 {
+		return
+	}
+	inSrc := func(path string) bool {
+		for ; path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+			if _, ok := srcSkipped[path]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for file, size := range p.FilesToClean {
+		if inSrc(file) {
+			delete(p.FilesToClean, file)
+			p.CleanSize -= size
+		}
+	}
+	for folder := range p.FoldersToClean {
+		if inSrc(folder) {
+			delete(p.FoldersToClean, folder)
+		}
+	}
+	for link := range p.LinksToClean {
+		if inSrc(link) {
+			delete(p.LinksToClean, link)
+		}
+	}
+}
+
+// Empty reports whether there is nothing to copy or remove
+func (p SyncPlan) Empty() bool {
+	return len(p.MissingFolders) == 0 && len(p.FoldersToClean) == 0 && len(p.MissingFiles) == 0 && len(p.FilesToClean) == 0 &&
+		len(p.MissingLinks) == 0 && len(p.LinksToClean) == 0 && len(p.HardLinks) == 0 &&
+		len(p.Renames) == 0
+}
+
+// Sync removes files and links that aren't in src, moves renamed files and removes folders that aren't in src, so
+// space is freed and a file can be replaced by a folder of the same name (or the other way around), and then makes
+// the missing folders, copies the missing files and makes the missing hard links and symlinks
+func Sync(p SyncPlan, src, dst string, opts *Options) error {
+	return SyncFS(p, OSFS(src), dst, opts)
+}
+
+// SyncFS is Sync with the source in fsys
+func SyncFS(p SyncPlan, fsys fs.FS, dst string, opts *Options) error {
+	if len(p.StaleParts) > 0 {
+		if err := RemoveStaleParts(p.StaleParts, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.FilesToClean) > 0 {
+		if err := CleanFiles(p.FilesToClean, p.CleanSize, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.LinksToClean) > 0 {
+		if err := CleanLinks(p.LinksToClean, dst, opts); err != nil {
+			return err
+		}
+	}
+	// before the folders are removed, they can hold the old paths
+	if len(p.Renames) > 0 {
+		if err := MoveFiles(p.Renames, fsys, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.FoldersToClean) > 0 {
+		if err := CleanFolders(p.FoldersToClean, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.MissingFolders) > 0 {
+		if err := MakeFoldersFS(p.MissingFolders, fsys, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.MissingFiles) > 0 {
+		if err := CopyFilesFS(p.MissingFiles, p.CopySize, fsys, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.HardLinks) > 0 {
+		if err := MakeHardLinks(p.HardLinks, dst, opts); err != nil {
+			return err
+		}
+	}
+	if len(p.MissingLinks) > 0 {
+		return MakeLinks(p.MissingLinks, dst, opts)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package mirror
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func TestNewSyncPlan(t *testing.T) {
+	changed := File{"_same_1": 1}
+	p := NewSyncPlan(dstFolders, srcFolders, dstFiles, srcFiles, changed)
+
+	wantCopy := File{"_same_1": 1}
+	for file, size := range missingFiles {
+		wantCopy[file] = size
+	}
+
+	assert(t, missingFolders, p.MissingFolders)
+	assert(t, foldersToClean, p.FoldersToClean)
+	assert(t, wantCopy, p.MissingFiles)
+	assert(t, filesToClean, p.FilesToClean)
+	assert(t, int64(sizeOfMissingFiles+1), p.CopySize)
+	assert(t, TotalSize(filesToClean), p.CleanSize)
+	assert(t, false, p.Empty())
+	assert(t, true, SyncPlan{}.Empty())
+}
+
+func TestKeepSkipped(t *testing.T) {
+	p := SyncPlan{
+		FoldersToClean: Folder{"cache": {}, filepath.Join("cache", "a"): {}, "old": {}},
+		FilesToClean:   File{"big": 5, filepath.Join("cache", "a", "1"): 1, "gone": 2},
+		LinksToClean:   Links{"link": "target", "other": "target"},
+		CleanSize:      8,
+	}
+	p.KeepSkipped(Skipped{"big": ReasonTooLarge, "cache": ReasonPlugin, "link": ReasonExcluded})
+	assert(t, Folder{"old": {}}, p.FoldersToClean)
+	assert(t, File{"gone": 2}, p.FilesToClean)
+	assert(t, Links{"other": "target"}, p.LinksToClean)
+	assert(t, int64(2), p.CleanSize)
+}
+
+func TestSync(t *testing.T) {
+	t.Run("file replaced by a folder", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		assertError(t, nil, os.MkdirAll(filepath.Join(src, "a"), FolderPerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "a", "1"), []byte("1"), FilePerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(dst, "a"), []byte("12"), FilePerm))
+		assertError(t, nil, os.MkdirAll(filepath.Join(dst, "b"), FolderPerm))
+
+		p := NewSyncPlan(Folder{"b": {}}, Folder{"a": {}}, File{"a": 2}, File{filepath.Join("a", "1"): 1}, nil)
+		assertError(t, nil, Sync(p, src, dst, &Options{}))
+
+		folders, files, _, err := ReadFolder(dst, &Options{})
+		assertError(t, nil, err)
+		assert(t, Folder{"a": {}}, folders)
+		assert(t, File{filepath.Join("a", "1"): 1}, files)
+	})
+
+	t.Run("skipped in src", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		// the copy in dst is older and smaller, it fits -max-size
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "big"), []byte("12345"), FilePerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(dst, "big"), []byte("1"), FilePerm))
+		assertError(t, nil, os.WriteFile(filepath.Join(dst, "gone"), []byte("1"), FilePerm))
+
+		j := Job{Src: src, Dst: dst, Sync: true, Opts: Options{MaxSize: 3, LogPath: os.DevNull}}
+		assertError(t, nil, j.Run(context.Background()))
+
+		_, files, _, err := ReadFolder(dst, &Options{})
+		assertError(t, nil, err)
+		assert(t, File{"big": 1}, files)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		makeTestFolders(t)
+
+		stop := make(chan struct{})
+		close(stop)
+		p := NewSyncPlan(dstFolders, srcFolders, dstFiles, srcFiles, nil)
+		assertError(t, ErrStopped, Sync(p, srcPathTest, dstPathTest, &Options{Stop: stop}))
+
+		_, files, _, err := ReadFolder(dstPathTest, &Options{})
+		assertError(t, nil, err)
+		assert(t, dstFiles, files)
+
+		cleanTestFolders(t)
+	})
+}
+
+// syncTrees is a random pair of trees for testing/quick. Names come from a tiny alphabet, so the trees overlap a lot,
+// and a path can be a file in one tree and a folder in the other one
+type syncTrees struct {
+	DstFolders, SrcFolders Folder
+	DstFiles, SrcFiles     File
+}
+
+func (syncTrees) Generate(r *rand.Rand, size int) reflect.Value {
+	tree := func() (Folder, File) {
+		folders, files := make(Folder), make(File)
+		for i := r.Intn(size + 1); i > 0; i-- {
+			var parts []string
+			for depth := r.Intn(4) + 1; depth > 0; depth-- {
+				parts = append(parts, string(rune('a'+r.Intn(3))))
+			}
+			path := filepath.Join(parts...)
+			if r.Intn(4) == 0 {
+				folders[path] = struct{}{}
+			} else {
+				files[path] = int64(r.Intn(3))
+			}
+		}
+
+		// every parent is a folder, so a path that is somebody's parent can't be a file
+		var paths []string
+		for path := range files {
+			paths = append(paths, path)
+		}
+		for path := range folders {
+			paths = append(paths, path)
+		}
+		for _, path := range paths {
+			for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+				folders[dir] = struct{}{}
+			}
+		}
+		for path := range folders {
+			delete(files, path)
+		}
+		return folders, files
+	}
+
+	var t syncTrees
+	t.DstFolders, t.DstFiles = tree()
+	t.SrcFolders, t.SrcFiles = tree()
+	return reflect.ValueOf(t)
+}
+
+// apply changes the dst half of the trees the way Sync would change dst on disk
+func (t syncTrees) apply(p SyncPlan) syncTrees {
+	res := syncTrees{SrcFolders: t.SrcFolders, SrcFiles: t.SrcFiles, DstFolders: make(Folder), DstFiles: make(File)}
+	for folder := range t.DstFolders {
+		if _, ok := p.FoldersToClean[folder]; !ok {
+			res.DstFolders[folder] = struct{}{}
+		}
+	}
+	for file, size := range t.DstFiles {
+		if _, ok := p.FilesToClean[file]; !ok {
+			res.DstFiles[file] = size
+		}
+	}
+	for folder := range p.MissingFolders {
+		res.DstFolders[folder] = struct{}{}
+	}
+	for file, size := range p.MissingFiles {
+		res.DstFiles[file] = size
+	}
+	return res
+}
+
+func TestSyncPlanProperties(t *testing.T) {
+	config := &quick.Config{MaxCount: 1000}
+
+	t.Run("copying and cleaning don't overlap", func(t *testing.T) {
+		property := func(trees syncTrees) bool {
+			p := NewSyncPlan(trees.DstFolders, trees.SrcFolders, trees.DstFiles, trees.SrcFiles, nil)
+			for file := range p.MissingFiles {
+				if _, ok := p.FilesToClean[file]; ok {
+					return false
+				}
+			}
+			for folder := range p.MissingFolders {
+				if _, ok := p.FoldersToClean[folder]; ok {
+					return false
+				}
+			}
+			return true
+		}
+		assertError(t, nil, quick.Check(property, config))
+	})
+
+	t.Run("only paths from src are copied and only paths that aren't in src are removed", func(t *testing.T) {
+		property := func(trees syncTrees) bool {
+			p := NewSyncPlan(trees.DstFolders, trees.SrcFolders, trees.DstFiles, trees.SrcFiles, nil)
+			for file, size := range p.MissingFiles {
+				if trees.SrcFiles[file] != size {
+					return false
+				}
+			}
+			for file := range p.FilesToClean {
+				if _, ok := trees.SrcFiles[file]; ok {
+					return false
+				}
+			}
+			for folder := range p.FoldersToClean {
+				if _, ok := trees.SrcFolders[folder]; ok {
+					return false
+				}
+			}
+			return p.CopySize == TotalSize(p.MissingFiles) && p.CleanSize == TotalSize(p.FilesToClean)
+		}
+		assertError(t, nil, quick.Check(property, config))
+	})
+
+	t.Run("planning again after the plan was applied finds nothing", func(t *testing.T) {
+		property := func(trees syncTrees) bool {
+			p := NewSyncPlan(trees.DstFolders, trees.SrcFolders, trees.DstFiles, trees.SrcFiles, nil)
+			after := trees.apply(p)
+			return NewSyncPlan(after.DstFolders, after.SrcFolders, after.DstFiles, after.SrcFiles, nil).Empty() &&
+				reflect.DeepEqual(after.DstFiles, trees.SrcFiles) && reflect.DeepEqual(after.DstFolders, trees.SrcFolders)
+		}
+		assertError(t, nil, quick.Check(property, config))
+	})
+
+	t.Run("planning again after a sync on disk finds nothing", func(t *testing.T) {
+		discardLog(t)
+		t.Cleanup(func() {
+			if err := os.Remove(LogFile); err != nil && !os.IsNotExist(err) {
+				t.Error(err)
+			}
+		})
+
+		write := func(root string, folders Folder, files File) error {
+			for folder := range folders {
+				if err := os.MkdirAll(filepath.Join(root, folder), FolderPerm); err != nil {
+					return err
+				}
+			}
+			for file, size := range files {
+				if err := os.WriteFile(filepath.Join(root, file), make([]byte, size), FilePerm); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		property := func(trees syncTrees) bool {
+			src, dst := t.TempDir(), t.TempDir()
+			if err := write(src, trees.SrcFolders, trees.SrcFiles); err != nil {
+				t.Fatal(err)
+			}
+			if err := write(dst, trees.DstFolders, trees.DstFiles); err != nil {
+				t.Fatal(err)
+			}
+
+			p := NewSyncPlan(trees.DstFolders, trees.SrcFolders, trees.DstFiles, trees.SrcFiles, nil)
+			if err := Sync(p, src, dst, &Options{Workers: 4}); err != nil {
+				t.Fatal(err)
+			}
+
+			folders, files, _, err := ReadFolder(dst, &Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return NewSyncPlan(folders, trees.SrcFolders, files, trees.SrcFiles, nil).Empty()
+		}
+		assertError(t, nil, quick.Check(property, &quick.Config{MaxCount: 50}))
+	})
+}
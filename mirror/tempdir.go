@@ -0,0 +1,115 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// TempDirPrefix starts names of run temp folders, ReadFolder skips them so leftovers of crashed runs aren't copied
+	TempDirPrefix    = ".mirror-tmp-"
+	FlagNameTempDir  = "temp-dir"
+	FlagUsageTempDir = "folder in which the run makes its temporary folder for partial copies, by default files are copied into name" + PartSuffix + " next to where they belong"
+	ReasonTempFolder = "temporary folder of a run"
+	// PartSuffix ends the names of files that are being copied next to where they belong, ReadFolder skips them
+	PartSuffix        = ".mirror-part"
+	ReasonPartFile    = "partial copy of a run"
+	LogStaleParts     = "partial copies of earlier runs removed:"
+	tempDirPattern    = TempDirPrefix + "*"
+	tempPartExtension = ".part"
+	// partNameMax is the longest name of a part file next to its file, longer ones get a hash instead, see partPath
+	partNameMax = 255
+)
+
+// NewTempDir makes a temporary folder for one run inside base. Everything in it can be removed once the run ends
+func NewTempDir(base string) (string, error) {
+	return os.MkdirTemp(base, tempDirPattern)
+}
+
+// RemoveTempDir removes the temporary folder of a run, nothing happens if path is empty
+func RemoveTempDir(path string) error {
+	if path == "" {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+func isTempDir(name string) bool {
+	return strings.HasPrefix(name, TempDirPrefix)
+}
+
+func isPartFile(name string) bool {
+	return strings.HasSuffix(name, PartSuffix)
+}
+
+// partPath returns the path file is copied to before it's moved to dst. Without opts.TempDir, it's next to where file
+// belongs, with PartSuffix, so an interrupted copy never has the name of a complete one
+func (o *Options) partPath(dst, file string) string {
+	if o.TempDir == "" {
+		return filepath.Join(dst, partName(file))
+	}
+	// a hash keeps names unique and short no matter how deep file is
+	sum := sha256.Sum256([]byte(file))
+	return filepath.Join(o.TempDir, hex.EncodeToString(sum[:])+tempPartExtension)
+}
+
+// partName returns the relative path of the part of file next to where it belongs, see partPath
+func partName(file string) string {
+	if len(filepath.Base(file)+PartSuffix) > partNameMax {
+		sum := sha256.Sum256([]byte(file))
+		return filepath.Join(filepath.Dir(file), "."+hex.EncodeToString(sum[:])+PartSuffix)
+	}
+	return file + PartSuffix
+}
+
+// leftParts returns the part files of files that are in dst, sorted. They are what an interrupted run left behind
+// while it copied them
+func leftParts(dst string, files File) []string {
+	var parts []string
+	for file := range files {
+		part := partName(file)
+		if _, err := os.Lstat(filepath.Join(dst, part)); err == nil {
+			parts = append(parts, part)
+		}
+	}
+	sort.Strings(parts)
+	return parts
+}
+
+// StaleParts returns the part files, see PartSuffix, that ReadFolder skipped in dst. They are what interrupted runs
+// left behind
+func StaleParts(skipped Skipped) []string {
+	var parts []string
+	for path, reason := range skipped {
+		if reason == ReasonPartFile {
+			parts = append(parts, path)
+		}
+	}
+	sort.Strings(parts)
+	return parts
+}
+
+// RemoveStaleParts removes the part files from dst and logs them
+func RemoveStaleParts(parts []string, dst string, opts *Options) error {
+	f, err := initLogFile(opts)
+	if err != nil {
+		return err
+	}
+
+	LogToFile(f, LogStaleParts+"\n")
+	for _, part := range parts {
+		if err = os.Remove(filepath.Join(dst, part)); err != nil && !os.IsNotExist(err) {
+			if !opts.ignoreErr(part, err) {
+				f.Close()
+				return err
+			}
+			continue
+		}
+		LogToFile(f, part)
+	}
+	return f.Close()
+}
@@ -0,0 +1,76 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyFilesTempDir(t *testing.T) {
+	makeTestFolders(t)
+
+	tempDir, err := NewTempDir(dstPathTest)
+	assertError(t, nil, err)
+
+	err = CopyFiles(missingFiles, sizeOfMissingFiles, srcPathTest, dstPathTest, &Options{TempDir: tempDir})
+	assertError(t, nil, err)
+
+	parts, err := os.ReadDir(tempDir)
+	assertError(t, nil, err)
+	assert(t, 0, len(parts))
+
+	t.Run("the temp folder is skipped", func(t *testing.T) {
+		_, files, skipped, err := ReadFolder(dstPathTest, &Options{})
+		assertError(t, nil, err)
+		missing, _ := MissingFiles(files, srcFiles)
+		assert(t, 0, len(missing))
+		assert(t, ReasonTempFolder, skipped[filepath.Base(tempDir)])
+	})
+
+	err = RemoveTempDir(tempDir)
+	assertError(t, nil, err)
+	_, err = os.Stat(tempDir)
+	assert(t, true, os.IsNotExist(err))
+
+	cleanTestFolders(t)
+}
+
+func TestPartPath(t *testing.T) {
+	assert(t, filepath.Join("dst", "a")+PartSuffix, (&Options{}).partPath("dst", "a"))
+	long := strings.Repeat("n", partNameMax)
+	part := (&Options{}).partPath("dst", filepath.Join("a", long))
+	assert(t, filepath.Join("dst", "a"), filepath.Dir(part))
+	assert(t, true, len(filepath.Base(part)) < partNameMax && isPartFile(part))
+
+	opts := &Options{TempDir: "tmp"}
+	if opts.partPath("dst", "a") == opts.partPath("dst", "b") {
+		t.Error("different files got the same partial file")
+	}
+	assert(t, "tmp", filepath.Dir(opts.partPath("dst", filepath.Join("a", "b"))))
+}
+
+func TestStaleParts(t *testing.T) {
+	discardLog(t)
+	src, dst := t.TempDir(), t.TempDir()
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a"), []byte("new"), FilePerm))
+	assertError(t, nil, os.WriteFile(filepath.Join(dst, "a"+PartSuffix), []byte("ne"), FilePerm))
+
+	_, files, skipped, err := ReadFolder(dst, &Options{})
+	assertError(t, nil, err)
+	assert(t, File{}, files)
+	assert(t, []string{"a" + PartSuffix}, StaleParts(skipped))
+
+	m, err := New(src, dst, WithLogFile(os.DevNull))
+	assertError(t, nil, err)
+	p, err := m.Plan(context.Background())
+	assertError(t, nil, err)
+	assert(t, []string{"a" + PartSuffix}, p.StaleParts)
+	assertError(t, nil, m.Sync(context.Background(), p))
+
+	_, files, skipped, err = ReadFolder(dst, &Options{})
+	assertError(t, nil, err)
+	assert(t, File{"a": 3}, files)
+	assert(t, Skipped{}, skipped)
+}
@@ -0,0 +1,27 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	FlagNamePreserveTimes  = "preserve-times"
+	FlagUsagePreserveTimes = "copied files keep the modification and access times of the source, -" + FlagNamePreserveTimes + "=false leaves them at the time of the copy"
+)
+
+// copyTimes sets the modification and access times of dst to the ones in info of the source, so copied files aren't
+// different next time. The access time is the time of the copy if info doesn't have one
+func copyTimes(info fs.FileInfo, dst string) error {
+	atime, ok := accessTime(info)
+	if !ok {
+		atime = time.Now()
+	}
+	return os.Chtimes(dst, atime, info.ModTime())
+}
+
+// keepsTimes returns true if copies get the times of the source. -compare size+mtime and the age filters need them
+func (o *Options) keepsTimes() bool {
+	return o.PreserveTimes || o.Compare.Mode == CompareSizeModTime || o.filtersAge()
+}
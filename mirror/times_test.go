@@ -0,0 +1,48 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFilesPreserveTimes(t *testing.T) {
+	discardLog(t)
+	src := t.TempDir()
+	atime := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	mtime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	assertError(t, nil, os.WriteFile(filepath.Join(src, "a"), []byte("a"), FilePerm))
+	assertError(t, nil, os.Chtimes(filepath.Join(src, "a"), atime, mtime))
+
+	tests := []struct {
+		name     string
+		preserve bool
+	}{
+		{name: "preserved", preserve: true},
+		{name: "not preserved"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			assertError(t, nil, CopyFiles(File{"a": 1}, 1, src, dst, &Options{LogPath: os.DevNull, PreserveTimes: test.preserve}))
+
+			info, err := os.Stat(filepath.Join(dst, "a"))
+			assertError(t, nil, err)
+			assert(t, test.preserve, info.ModTime().Equal(mtime))
+			if got, ok := accessTime(info); ok && test.preserve {
+				assert(t, true, got.Equal(atime))
+			}
+		})
+	}
+}
+
+func TestNewPreservesTimes(t *testing.T) {
+	m, err := New(t.TempDir(), t.TempDir())
+	assertError(t, nil, err)
+	assert(t, true, m.opts.PreserveTimes)
+
+	m, err = New(t.TempDir(), t.TempDir(), WithPreserveTimes(false))
+	assertError(t, nil, err)
+	assert(t, false, m.opts.PreserveTimes)
+}
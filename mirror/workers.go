@@ -0,0 +1,190 @@
+package mirror
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	FlagNameJobs  = "j"
+	FlagUsageJobs = "how many files are copied at once, 1 is better for hard drives"
+)
+
+// copyResult is what a worker found out about one file, it's handed back so logging and the report stay in one goroutine
+type copyResult struct {
+	file     string
+	written  int64
+	vanished bool
+	infected bool
+	// ownerLost is true if the process may not give the copy the owner of the file, see Options.PreserveOwner
+	ownerLost bool
+	// xattrsLost is true if dst can't hold the extended attributes of the file, see Options.Xattrs
+	xattrsLost bool
+	// flagsLost is true if dst can't hold the capabilities or flags of the file, see Options.FileFlags
+	flagsLost bool
+	// sizeChanged is true if the file had another size than the scanned one when it was copied, see checkSize
+	sizeChanged bool
+	// patched is true if the copy in dst was patched in place, patchWritten is what that wrote, see Options.Delta
+	patched      bool
+	patchWritten int64
+	// moveKept is true if Options.Move kept the source because it changed since it was copied, see removeSource
+	moveKept bool
+	// retried are the messages of the retries of the file, the result is the one of the last try, see Options.Retries
+	retried []string
+	err     error
+}
+
+// startCopying copies files in the order of sortedFiles with opts.Workers goroutines (at least one) and sends the
+// result of every started file. It stops starting files once done or opts.Stop is closed, results is closed when the
+// started ones are finished
+func startCopying(sortedFiles []string, files File, fsys fs.FS, dst string, opts *Options, done <-chan struct{}) (results <-chan copyResult) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	paths, res := make(chan string), make(chan copyResult)
+	go func() {
+		defer close(paths)
+		for _, file := range sortedFiles {
+			if opts.stopped() {
+				return
+			}
+			select {
+			case paths <- file:
+			case <-done:
+				return
+			case <-opts.Stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range paths {
+				res <- copyOne(file, files[file], fsys, dst, opts)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(res)
+	}()
+
+	return res
+}
+
+// copyOne copies file, which had size when it was scanned, into its part path, scans it and moves it into place. It
+// only touches the file system. A panic is returned as a *WorkerPanic, see CopyFiles
+func copyOne(file string, size int64, fsys fs.FS, dst string, opts *Options) (r copyResult) {
+	r.file = file
+	start := time.Now()
+	state := opts.runState()
+	state.begin(file)
+	defer func() {
+		if p := recover(); p != nil {
+			r.err = &WorkerPanic{Value: p, Stack: debug.Stack()}
+			return
+		}
+		state.end(file)
+		opts.Tracer.copied(r, start)
+	}()
+
+	var retried []string
+	for attempt := 0; ; attempt++ {
+		r = copyAttempt(file, size, fsys, dst, opts)
+		msg, again := opts.retry(attempt, file, r.err)
+		if msg != "" {
+			retried = append(retried, msg)
+		}
+		if !again {
+			r.retried = retried
+			return
+		}
+	}
+}
+
+// copyAttempt is one try of copyOne, it leaves no part behind when it fails
+func copyAttempt(file string, size int64, fsys fs.FS, dst string, opts *Options) (r copyResult) {
+	r.file = file
+	part := opts.partPath(dst, file)
+	// a part next to its file isn't removed with a temporary folder, the ones of crashed runs end up in StaleParts
+	defer func() {
+		if r.err != nil && opts.TempDir == "" && !r.patched {
+			os.Remove(part)
+		}
+	}()
+
+	// the times are read before the copy, because reading the file can move its access time
+	var info fs.FileInfo
+	if opts.keepsTimes() || opts.keepsPerms() || opts.PreserveOwner {
+		info, r.err = fs.Stat(fsys, fsName(file))
+	}
+	// a patched file is its own part, it's complete once the rest is copied too
+	if r.err == nil && opts.Delta {
+		if r.patched, r.patchWritten, r.written, r.err = patchFile(fsys, fsName(file), filepath.Join(dst, file), size, opts); r.patched {
+			part = filepath.Join(dst, file)
+		}
+	}
+	if r.err == nil && !r.patched {
+		r.written, r.err = copyFSFile(fsys, fsName(file), part, opts)
+	}
+	if r.err == nil {
+		r.written, r.sizeChanged, r.err = checkSize(fsys, fsName(file), part, size, r.written, opts)
+	}
+	// before the permissions, Linux needs write permission to set user attributes
+	if r.err == nil && opts.Xattrs {
+		var kept bool
+		kept, r.err = copyXattrs(filepath.Join(string(fsys.(OSFS)), file), part)
+		r.xattrsLost = r.err == nil && !kept
+	}
+	// before the permissions, changing the owner clears the setuid bit
+	if r.err == nil && opts.PreserveOwner {
+		var kept bool
+		kept, r.err = copyOwner(info, part)
+		r.ownerLost = r.err == nil && !kept
+	}
+	// before the file is in place, so a private file is never readable by others in dst
+	if r.err == nil && opts.keepsPerms() {
+		r.err = copyPerm(info, part)
+	}
+	if r.err != nil && vanished(fsys, fsName(file), r.err) {
+		r.vanished, r.err = true, nil
+		return
+	}
+	if r.err == nil && opts.ScanCmd != "" {
+		if r.infected, r.err = scanCopied(file, part, opts); r.infected {
+			return
+		}
+	}
+	if r.err == nil && !r.patched {
+		r.err = renameOrCopy(part, filepath.Join(dst, file))
+	}
+	if r.err == nil && opts.keepsTimes() {
+		r.err = copyTimes(info, filepath.Join(dst, file))
+	}
+	// after the modification time, because macOS moves the creation time back if it's later than the modification time
+	// CopyFilesFS made sure that fsys is an OSFS
+	if r.err == nil && opts.BirthTime {
+		r.err = copyBirthTime(filepath.Join(string(fsys.(OSFS)), file), filepath.Join(dst, file))
+	}
+	// last, an immutable file can't be changed anymore
+	if r.err == nil && opts.FileFlags {
+		var kept bool
+		kept, r.err = copyFileFlags(filepath.Join(string(fsys.(OSFS)), file), filepath.Join(dst, file))
+		r.flagsLost = r.err == nil && !kept
+	}
+	// only once the copy is complete, CopyFilesFS made sure that fsys is an OSFS
+	if r.err == nil && opts.Move {
+		r.moveKept, r.err = removeSource(file, string(fsys.(OSFS)), dst, r.written, opts)
+	}
+	return
+}
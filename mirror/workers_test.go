@@ -0,0 +1,71 @@
+package mirror
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyFilesWithWorkers(t *testing.T) {
+	t.Run("copies every file", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		files := make(File)
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			assertError(t, nil, os.WriteFile(filepath.Join(src, name), []byte(name+name), FilePerm))
+			files[name] = 2
+		}
+
+		var journal bytes.Buffer
+		opts := &Options{Workers: 3, Journal: &journal}
+		assertError(t, nil, CopyFiles(files, TotalSize(files), src, dst, opts))
+
+		_, got, _, err := ReadFolder(dst, &Options{})
+		assertError(t, nil, err)
+		assert(t, files, got)
+		assert(t, len(files), strings.Count(journal.String(), "\n"))
+	})
+
+	t.Run("stops on an error", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		files := make(File)
+		for _, name := range []string{"a", "b", "c", "d"} {
+			assertError(t, nil, os.MkdirAll(filepath.Join(src, name), FolderPerm))
+			assertError(t, nil, os.WriteFile(filepath.Join(src, name, "1"), []byte("1"), FilePerm))
+			files[filepath.Join(name, "1")] = 1
+		}
+
+		// the folders weren't made in dst, so no file can be created
+		err := CopyFiles(files, TotalSize(files), src, dst, &Options{Workers: 2})
+		if err == nil {
+			t.Error("want an error")
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "a"), []byte("a"), FilePerm))
+
+		stop := make(chan struct{})
+		close(stop)
+		err := CopyFiles(File{"a": 1}, 1, src, dst, &Options{Workers: 2, Stop: stop})
+		assertError(t, ErrStopped, err)
+
+		_, err = os.Stat(filepath.Join(dst, "a"))
+		assert(t, true, os.IsNotExist(err))
+	})
+
+	t.Run("vanished files", func(t *testing.T) {
+		src, dst := t.TempDir(), t.TempDir()
+		assertError(t, nil, os.WriteFile(filepath.Join(src, "a"), []byte("a"), FilePerm))
+
+		opts := &Options{Workers: 2}
+		assertError(t, nil, CopyFiles(File{"a": 1, "gone": 1}, 2, src, dst, opts))
+		assert(t, []string{"gone"}, opts.Report.Vanished)
+	})
+
+	if err := os.Remove(LogFile); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
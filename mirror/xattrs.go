@@ -0,0 +1,10 @@
+package mirror
+
+const (
+	FlagNameXattrs       = "xattrs"
+	FlagUsageXattrs      = "copied files keep the extended attributes of the source, user.* ones on Linux and all of them on macOS, e.g. tags and Finder info"
+	ErrXattrsUnsupported = CustomErr("extended attributes can't be copied on this system")
+	ErrXattrsNeedsOSFS   = CustomErr("extended attributes can only be copied from a folder on disk")
+	LogXattrsNotKept     = "copied without extended attributes, dst can't hold them: "
+	MsgXattrsNotKept     = "copied files whose extended attributes dst can't hold:"
+)
@@ -0,0 +1,73 @@
+package mirror
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// errNoXattr is what getxattr returns for an attribute that a file doesn't have
+	errNoXattr = syscall.ENOATTR
+	// xattrNoFollow is XATTR_NOFOLLOW
+	xattrNoFollow = 1
+)
+
+// xattrCopied returns true for every attribute, tags and Finder info are in com.apple.* ones
+func xattrCopied(name string) bool {
+	return true
+}
+
+// the syscall package has no xattr functions on macOS, they are called like the ones of golang.org/x/sys/unix
+
+func listxattr(path string, buf []byte) (int, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_LISTXATTR, uintptr(unsafe.Pointer(p)), uintptr(bufPtr(buf)), uintptr(len(buf)), xattrNoFollow, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+func getxattr(path, name string, buf []byte) (int, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)), uintptr(bufPtr(buf)), uintptr(len(buf)), 0, xattrNoFollow)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(r), nil
+}
+
+func setxattr(path, name string, value []byte) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)), uintptr(bufPtr(value)), uintptr(len(value)), 0, xattrNoFollow)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// bufPtr is nil for an empty buf. It returns an unsafe.Pointer, so the conversion to uintptr is in the call of
+// Syscall6 and buf can't move before it
+func bufPtr(buf []byte) unsafe.Pointer {
+	if len(buf) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&buf[0])
+}
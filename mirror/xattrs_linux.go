@@ -0,0 +1,27 @@
+package mirror
+
+import (
+	"strings"
+	"syscall"
+)
+
+// errNoXattr is what getxattr returns for an attribute that a file doesn't have
+const errNoXattr = syscall.ENODATA
+
+// xattrCopied returns true for attributes of users. The security, system and trusted ones belong to the system
+// (capabilities are copied with -file-flags), copying them is a matter of the root of dst
+func xattrCopied(name string) bool {
+	return strings.HasPrefix(name, "user.")
+}
+
+func listxattr(path string, buf []byte) (int, error) {
+	return syscall.Listxattr(path, buf)
+}
+
+func getxattr(path, name string, buf []byte) (int, error) {
+	return syscall.Getxattr(path, name, buf)
+}
+
+func setxattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
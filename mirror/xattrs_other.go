@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package mirror
+
+const xattrsSupported = false
+
+func copyXattrs(src, dst string) (bool, error) {
+	return false, ErrXattrsUnsupported
+}
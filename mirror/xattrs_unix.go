@@ -0,0 +1,104 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+)
+
+const xattrsSupported = true
+
+// copyXattrs gives dst the extended attributes of src that xattrCopied allows. kept is false if src has some
+// but the file system of dst can't hold them
+func copyXattrs(src, dst string) (kept bool, err error) {
+	names, err := listXattrs(src)
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		if !xattrCopied(name) {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err != nil {
+			return false, err
+		}
+		if err = setxattr(dst, name, value); notSupported(err) {
+			return false, nil
+		} else if err != nil {
+			return false, &os.PathError{Op: "setxattr", Path: dst, Err: err}
+		}
+	}
+	return true, nil
+}
+
+// listXattrs returns nothing if the file system of path doesn't support attributes
+func listXattrs(path string) ([]string, error) {
+	for {
+		size, err := listxattr(path, nil)
+		if notSupported(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		size, err = listxattr(path, buf)
+		// an attribute was added in between
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+		}
+
+		var names []string
+		for _, name := range bytes.Split(buf[:size], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+}
+
+// getXattr returns nothing if path doesn't have the attribute or its file system doesn't support attributes
+func getXattr(path, attr string) ([]byte, error) {
+	for {
+		size, err := getxattr(path, attr, nil)
+		if errors.Is(err, errNoXattr) || notSupported(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		size, err = getxattr(path, attr, buf)
+		// the attribute grew in between
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		return buf[:size], nil
+	}
+}
+
+// notSupported returns true if err says that the file system can't hold attributes or flags
+func notSupported(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.ENOTTY)
+}
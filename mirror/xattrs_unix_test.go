@@ -0,0 +1,78 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testXattr = "user.mirror.tags"
+
+func TestCopyFilesXattrs(t *testing.T) {
+	discardLog(t)
+	src := t.TempDir()
+	path := filepath.Join(src, "a")
+	assertError(t, nil, os.WriteFile(path, []byte("a"), FilePerm))
+	if err := setxattr(path, testXattr, []byte("red,blue")); err != nil {
+		t.Skipf("extended attributes can't be set here: %v", err)
+	}
+	// the copy gets this mode after its attributes, setting them on a read-only file would fail
+	assertError(t, nil, os.Chmod(path, 0444))
+
+	dst := t.TempDir()
+	opts := &Options{LogPath: os.DevNull, Xattrs: true, PreservePerms: true}
+	assertError(t, nil, CopyFiles(File{"a": 1}, 1, src, dst, opts))
+	assert(t, 0, len(opts.Report.XattrsNotKept))
+
+	got, err := getXattr(filepath.Join(dst, "a"), testXattr)
+	assertError(t, nil, err)
+	assert(t, "red,blue", string(got))
+
+	t.Run("without the flag", func(t *testing.T) {
+		dst := t.TempDir()
+		assertError(t, nil, CopyFiles(File{"a": 1}, 1, src, dst, &Options{LogPath: os.DevNull}))
+		names, err := listXattrs(filepath.Join(dst, "a"))
+		assertError(t, nil, err)
+		for _, name := range names {
+			if name == testXattr {
+				t.Errorf("%s was copied", testXattr)
+			}
+		}
+	})
+
+	t.Run("copied from a part file", func(t *testing.T) {
+		part := filepath.Join(t.TempDir(), "part")
+		assertError(t, nil, os.WriteFile(part, []byte("p"), FilePerm))
+		assertError(t, nil, setxattr(part, testXattr, []byte("green")))
+
+		moved := filepath.Join(t.TempDir(), "moved")
+		_, err := copyFile(part, moved)
+		assertError(t, nil, err)
+		kept, err := copyXattrs(part, moved)
+		assertError(t, nil, err)
+		assert(t, true, kept)
+
+		got, err := getXattr(moved, testXattr)
+		assertError(t, nil, err)
+		assert(t, "green", string(got))
+	})
+}
+
+func TestListXattrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a")
+	assertError(t, nil, os.WriteFile(path, nil, FilePerm))
+	names, err := listXattrs(path)
+	assertError(t, nil, err)
+	for _, name := range names {
+		if xattrCopied(name) {
+			t.Errorf("a new file has the attribute %s", name)
+		}
+	}
+
+	got, err := getXattr(path, testXattr)
+	assertError(t, nil, err)
+	assert(t, 0, len(got))
+}